@@ -36,6 +36,7 @@ type CounselorCacheData struct {
 	Specialty string    `json:"specialty"`
 	Price     float64   `json:"price"`
 	YearsExp  int       `json:"years_exp"`
+	Gender    string    `json:"gender"`
 	Rating    float64   `json:"rating"`
 	Status    int       `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
@@ -132,6 +133,7 @@ func GetCounselorWithCache(ctx context.Context, counselorID uint) (*CounselorCac
 			Specialty: counselor.Specialty,
 			Price:     counselor.Price,
 			YearsExp:  counselor.YearsExp,
+			Gender:    counselor.Gender,
 			Rating:    counselor.Rating,
 			Status:    counselor.Status,
 			CreatedAt: counselor.CreatedAt,
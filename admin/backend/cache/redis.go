@@ -108,6 +108,24 @@ func DeleteUserCache(ctx context.Context, userID uint) error {
 	return Rdb.Del(ctx, getUserCacheKey(userID)).Err()
 }
 
+// DeleteIdentityCache 删除 api 服务缓存的用户与咨询师身份映射（键格式与 api 的 cache/identity_cache.go 一致），
+// 后台创建或绑定咨询师后调用，避免用户在未命中缓存过期前仍被识别为普通用户
+func DeleteIdentityCache(ctx context.Context, userID, counselorID uint) {
+	if Rdb == nil {
+		return
+	}
+	keys := make([]string, 0, 2)
+	if userID != 0 {
+		keys = append(keys, fmt.Sprintf("identity:user:%d:counselor", userID))
+	}
+	if counselorID != 0 {
+		keys = append(keys, fmt.Sprintf("identity:counselor:%d:user", counselorID))
+	}
+	if len(keys) > 0 {
+		Rdb.Del(ctx, keys...)
+	}
+}
+
 // 刷新用户缓存
 func RefreshUserCache(ctx context.Context, userID uint) error {
 	var user models.User
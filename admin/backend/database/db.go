@@ -23,17 +23,42 @@ func InitDB() error {
 		&models.User{},
 		&models.Administrator{},
 		&models.Counselor{},
+		&models.CounselorTag{},
 		&models.CounselorApplication{},
+		&models.CounselorApplicationDocument{},
+		&models.CounselorApplicationEvent{},
+		&models.CounselorProfileChange{},
+		&models.CounselorLevel{},
 		&models.Order{},
+		&models.OrderEvent{},
+		&models.CounselorPackage{},
+		&models.UserPackage{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.ScheduledJob{},
+		&models.JobRun{},
 		&models.Payment{},
 		&models.PaymentConfig{},
+		&models.UserTransaction{},
+		&models.CounselorAvailability{},
+		&models.CounselorScheduleException{},
+		&models.CounselorScheduleSetting{},
+		&models.CounselorBooking{},
+		&models.MatchRequest{},
+		&models.MatchImpression{},
 		&models.Review{},
+		&models.ReviewReport{},
+		&models.ReviewAppeal{},
+		&models.ReviewDecision{},
 		&models.CounselorStatistics{},
 		&models.Notification{},
 		&models.ChatSession{},
 		&models.ChatMessage{},
+		&models.ChatMessageRevision{},
 		&models.File{},
 		&models.ChatBilling{},
+		&models.DataArchive{},
+		&models.LegalHold{},
 		&models.CounselorAccount{},
 		&models.WithdrawRecord{},
 		&models.Role{},
@@ -46,6 +71,8 @@ func InitDB() error {
 		&models.UserRole{},
 		&models.SystemLog{},
 		&models.SystemConfig{},
+		&models.SensitiveWord{},
+		&models.ModerationIncident{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
@@ -53,6 +80,8 @@ func InitDB() error {
 
 	// 创建默认管理员账号
 	createDefaultAdmin()
+	// 创建默认咨询师等级
+	createDefaultCounselorLevels()
 
 	return nil
 }
@@ -220,3 +249,13 @@ func createDefaultRoleAndPermissions() {
 func intPtr(i int) *int {
 	return &i
 }
+
+// createDefaultCounselorLevels 等级表为空时创建默认咨询师等级
+func createDefaultCounselorLevels() {
+	var count int64
+	DB.Model(&models.CounselorLevel{}).Count(&count)
+	if count == 0 {
+		levels := models.DefaultCounselorLevels()
+		DB.Create(&levels)
+	}
+}
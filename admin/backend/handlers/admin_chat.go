@@ -4,7 +4,9 @@ import (
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"time"
 )
 
 // GetAdminChatSessions godoc
@@ -129,6 +131,69 @@ func GetAdminChatMessages(c *gin.Context) {
 	})
 }
 
+// GetMessageRevisions godoc
+// @Summary 获取消息修订记录
+// @Description 查看消息编辑、撤回前的原始内容（仅超级管理员，每次查看都会记录日志）
+// @Tags 聊天管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param message_id path int true "消息ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{message,revisions}"
+// @Router /api/admin/chat/messages/{message_id}/revisions [get]
+func GetMessageRevisions(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
+	messageID := c.Param("message_id")
+
+	var admin models.Administrator
+	if err := database.DB.First(&admin, adminID).Error; err != nil || admin.Role != "super_admin" {
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  "无权查看消息修订记录",
+		})
+		return
+	}
+
+	var message models.ChatMessage
+	if err := database.DB.First(&message, messageID).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "消息不存在",
+		})
+		return
+	}
+
+	var revisions []models.ChatMessageRevision
+	if err := database.DB.Where("message_id = ?", message.ID).Order("revision ASC").Find(&revisions).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 查看原始内容属于敏感操作，留痕备查
+	database.DB.Create(&models.SystemLog{
+		Operator:    admin.Username,
+		Action:      "查看消息修订记录",
+		Module:      "聊天管理",
+		Description: fmt.Sprintf("查看消息 %d 的修订记录", message.ID),
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		Status:      1,
+		CreatedAt:   time.Now(),
+	})
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"message":   message,
+			"revisions": revisions,
+		},
+	})
+}
+
 // GetChatStatistics godoc
 // @Summary 获取聊天统计
 // @Description 获取聊天统计数据（管理员接口）
@@ -182,40 +247,34 @@ func GetChatStatistics(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param keyword query string true "搜索关键词"
+// @Param keyword query string true "搜索关键词，多个词用空格分隔"
+// @Param session_id query int false "会话ID"
+// @Param sender_id query int false "发送者用户ID"
+// @Param content_type query string false "内容类型:text/image/audio/file"
+// @Param start_date query string false "开始日期(2006-01-02)"
+// @Param end_date query string false "结束日期(2006-01-02，含当天)"
+// @Param sort query string false "排序:time-按时间,relevance-按相关度" default(time)
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(20)
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{messages(含snippet高亮片段),total}"
 // @Router /api/admin/chat/messages/search [get]
 func SearchChatMessages(c *gin.Context) {
-	keyword := c.Query("keyword")
-	page := c.DefaultQuery("page", "1")
-	pageSize := c.DefaultQuery("page_size", "20")
-
-	if keyword == "" {
+	q, msg := chatSearchQuery(c)
+	if q == nil {
 		c.JSON(400, gin.H{
 			"code": 400,
-			"msg":  "搜索关键词不能为空",
+			"msg":  msg,
 		})
 		return
 	}
-
-	query := database.DB.Model(&models.ChatMessage{}).
-		Where("content LIKE ?", "%"+keyword+"%")
-
-	var total int64
-	query.Count(&total)
-
-	var messages []models.ChatMessage
-	offset := 0
-	if page == "1" {
-		offset = 0
-	} else {
-		offset = (utils.ParseInt(page) - 1) * utils.ParseInt(pageSize)
+	// 管理员检索不限会话范围（SessionIDs 为 nil），也不排除用户"仅自己删除"的消息
+	result, ok := runChatSearch(c, q)
+	if !ok {
+		return
 	}
 
-	if err := query.Preload("Session").Preload("Session.User").Preload("Session.Counselor").
-		Offset(offset).Limit(utils.ParseInt(pageSize)).Order("created_at DESC").Find(&messages).Error; err != nil {
+	hits, err := withSessions(result.Messages)
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "查询失败: " + err.Error(),
@@ -227,15 +286,15 @@ func SearchChatMessages(c *gin.Context) {
 		"code": 200,
 		"msg":  "获取成功",
 		"data": gin.H{
-			"messages": messages,
-			"total":    total,
+			"messages": hits,
+			"total":    result.Total,
 		},
 	})
 }
 
 // DeleteChatSession godoc
 // @Summary 删除聊天会话
-// @Description 删除聊天会话（管理员接口）
+// @Description 删除聊天会话（管理员接口），处于法律保留中的会话不能删除
 // @Tags 聊天管理
 // @Accept json
 // @Produce json
@@ -254,6 +313,13 @@ func DeleteChatSession(c *gin.Context) {
 		})
 		return
 	}
+	if sessionHeld(&session) {
+		c.JSON(409, gin.H{
+			"code": 409,
+			"msg":  "会话处于法律保留中，不能删除",
+		})
+		return
+	}
 
 	// 开始事务
 	tx := database.DB.Begin()
@@ -4,6 +4,8 @@ import (
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	apimodels "akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
 	"github.com/gin-gonic/gin"
 )
 
@@ -123,20 +125,22 @@ func GetOrderStatistics(c *gin.Context) {
 
 // AdminUpdateOrderStatus godoc
 // @Summary 更新订单状态
-// @Description 管理员更新订单状态
+// @Description 管理员按订单状态机变更订单状态（支付、取消、完成、退款），附带原因
 // @Tags 订单管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "订单ID"
-// @Param request body map[string]interface{} true "状态信息"
+// @Param request body map[string]interface{} true "status:目标状态,reason:原因"
 // @Success 200 {object} map[string]interface{} "code:200,msg:更新成功"
 // @Router /api/admin/orders/{id}/status [put]
 func AdminUpdateOrderStatus(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
 	orderID := c.Param("id")
 
 	var req struct {
-		Status int `json:"status" binding:"required,oneof=0 1 2 3 4"`
+		Status int    `json:"status" binding:"oneof=0 1 2 3 4"`
+		Reason string `json:"reason" binding:"max=255"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -147,7 +151,7 @@ func AdminUpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	var order models.Order
+	var order apimodels.Order
 	if err := database.DB.First(&order, orderID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
@@ -156,16 +160,144 @@ func AdminUpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Model(&order).Update("status", req.Status).Error; err != nil {
+	// 管理员同样只能执行状态机允许的变更（如已支付订单退款），不能任意改写状态
+	actor := orderflow.Actor{Type: models.OrderActorAdmin, ID: adminID.(uint)}
+	event, ok := orderflow.EventFor(&order, req.Status, actor)
+	if !ok {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "当前订单状态不允许变更为该状态",
+		})
+		return
+	}
+
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID: order.ID,
+		Event:   event,
+		Actor:   actor,
+		Reason:  req.Reason,
+	}); err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+	})
+}
+
+// AdminGetOrderDetail godoc
+// @Summary 获取订单详情
+// @Description 获取订单详情，包含支付记录、咨询会话和完整事件流（管理员接口）
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "订单ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{order,payments,sessions,events,timeline}"
+// @Router /api/admin/orders/{id} [get]
+func AdminGetOrderDetail(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.Preload("User").Preload("Counselor").First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "订单不存在",
+		})
+		return
+	}
+
+	var payments []models.Payment
+	database.DB.Where("order_id = ?", order.ID).Order("id ASC").Find(&payments)
+
+	var sessions []models.ChatSession
+	database.DB.Where("order_id = ?", order.ID).Order("id ASC").Find(&sessions)
+
+	events, err := orderflow.Events(order.ID)
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
-			"msg":  "更新失败: " + err.Error(),
+			"msg":  "查询失败: " + err.Error(),
 		})
 		return
 	}
 
 	c.JSON(200, gin.H{
 		"code": 200,
-		"msg":  "更新成功",
+		"msg":  "获取成功",
+		"data": gin.H{
+			"order":    order,
+			"payments": payments,
+			"sessions": sessions,
+			"events":   events,
+			"timeline": orderflow.Timeline(events),
+		},
+	})
+}
+
+// GetOrderEvents godoc
+// @Summary 查询订单事件
+// @Description 跨订单检索事件流，用于纠纷调查（如某用户的全部取消、某管理员的全部退款操作）
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param order_id query int false "订单ID"
+// @Param order_no query string false "订单号"
+// @Param event query string false "事件类型"
+// @Param actor_type query string false "操作人类型:user/counselor/admin/system"
+// @Param actor_id query int false "操作人ID"
+// @Param start_date query string false "开始日期(2006-01-02)"
+// @Param end_date query string false "结束日期(2006-01-02)"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{events,total}"
+// @Router /api/admin/orders/events [get]
+func GetOrderEvents(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.OrderEvent{})
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+	if orderNo := c.Query("order_no"); orderNo != "" {
+		query = query.Where("order_id IN (?)", database.DB.Model(&models.Order{}).Select("id").Where("order_no = ?", orderNo))
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+	if actorType := c.Query("actor_type"); actorType != "" {
+		query = query.Where("actor_type = ?", actorType)
+	}
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("created_at < DATE_ADD(?, INTERVAL 1 DAY)", endDate)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var events []models.OrderEvent
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id DESC").Find(&events).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"events": events,
+			"total":  total,
+		},
 	})
 }
@@ -746,6 +746,13 @@ func GetAdminPermissions2(c *gin.Context) {
 			"finance:view",
 			"system:view",
 		}
+	} else if admin.Role == "reviewer" || admin.Role == "interviewer" {
+		// 入驻审核员、面试官只处理咨询师入驻申请（各自可处理的审核阶段见 application_stage_roles 配置）
+		permissions = []string{
+			"dashboard:view",
+			"counselor:view",
+			"application:view", "application:review",
+		}
 	}
 
 	c.JSON(200, gin.H{
@@ -771,7 +778,7 @@ type CreateAdministratorRequest struct {
 	Email    string `json:"email" binding:"omitempty,email,max=100"`
 	Phone    string `json:"phone" binding:"omitempty,max=20"`
 	Avatar   string `json:"avatar"`
-	Role     string `json:"role" binding:"required,oneof=admin super_admin"`
+	Role     string `json:"role" binding:"required,oneof=admin super_admin reviewer interviewer"`
 	Status   int    `json:"status" binding:"omitempty,oneof=0 1"`
 }
 
@@ -781,7 +788,7 @@ type UpdateAdministratorRequest struct {
 	Email    string `json:"email" binding:"omitempty,email,max=100"`
 	Phone    string `json:"phone" binding:"omitempty,max=20"`
 	Avatar   string `json:"avatar"`
-	Role     string `json:"role" binding:"omitempty,oneof=admin super_admin"`
+	Role     string `json:"role" binding:"omitempty,oneof=admin super_admin reviewer interviewer"`
 	Status   *int   `json:"status" binding:"omitempty,oneof=0 1"`
 }
 
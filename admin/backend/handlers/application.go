@@ -1,17 +1,66 @@
 package handlers
 
 import (
+	"akrick.com/mychat/admin/backend/cache"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	"akrick.com/mychat/counselorstats"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type ReviewApplicationRequest struct {
-	Status        int    `json:"status" binding:"required,oneof=1 2"`
-	RejectReason string `json:"reject_reason"`
+// 咨询师入驻申请由用户在 api 服务中提交、补充材料（见 api/handlers/application.go），管理后台分阶段审核：
+// 资质审核（核验证明材料）→ 面试 → 终审。各阶段可处理的管理员角色由系统配置 application_stage_roles 决定，
+// 同一管理员不能通过同一次提交的多个阶段；任一阶段可拒绝或要求补充材料，终审通过时创建咨询师、咨询师账户和统计记录
+
+const (
+	configApplicationStageRoles   = "application_stage_roles"
+	configApplicationMaterialDays = "application_material_days"
+
+	// defaultApplicationMaterialDays 未指定期限时补充材料的天数
+	defaultApplicationMaterialDays = 7
+	// defaultApplicationPrice 终审未指定单价时咨询师的默认单价(元/分钟)
+	defaultApplicationPrice = 1.0
+)
+
+// defaultApplicationStageRoles 各审核阶段可处理的管理员角色，配置缺失的阶段使用该默认值
+var defaultApplicationStageRoles = map[string][]string{
+	models.ApplicationStageQualification: {"super_admin", "admin", "reviewer"},
+	models.ApplicationStageInterview:     {"super_admin", "admin", "interviewer"},
+	models.ApplicationStageFinal:         {"super_admin"},
+}
+
+var (
+	errApplicationNotFound         = errors.New("申请不存在")
+	errApplicationDocumentNotFound = errors.New("申请材料不存在")
+	errApplicationNotReviewing     = errors.New("该申请当前不在审核中")
+	errApplicationStageForbidden   = errors.New("当前角色不能处理该审核阶段")
+	errApplicationSameReviewer     = errors.New("同一管理员不能通过同一申请的多个审核阶段")
+	errApplicationDocumentsPending = errors.New("请先核验全部材料，且至少一份资质证书核验通过")
+	errApplicationNotQualification = errors.New("仅资质审核阶段可核验材料")
+	errApplicationUserIsCounselor  = errors.New("该用户已是咨询师")
+)
+
+// VerifyApplicationDocumentRequest 核验申请材料
+type VerifyApplicationDocumentRequest struct {
+	Status int    `json:"status" binding:"required,oneof=1 2"`
+	Note   string `json:"note" binding:"max=500"`
+}
+
+// ApplicationDecisionRequest 审核决定
+type ApplicationDecisionRequest struct {
+	Action       string  `json:"action" binding:"required,oneof=pass reject request_material"`
+	Comment      string  `json:"comment" binding:"max=1000"`
+	DeadlineDays int     `json:"deadline_days" binding:"omitempty,min=1,max=60"`
+	Price        float64 `json:"price" binding:"omitempty,min=0"`
 }
 
 // GetApplicationList 获取入驻申请列表
@@ -23,7 +72,8 @@ type ReviewApplicationRequest struct {
 // @Security BearerAuth
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(20)
-// @Param status query int false "状态:0-待审核,1-审核通过,2-审核拒绝"
+// @Param status query int false "状态:0-审核中,1-审核通过,2-审核拒绝,3-待补充材料,4-已失效"
+// @Param stage query string false "审核阶段:qualification/interview/final"
 // @Param keyword query string false "搜索关键词"
 // @Success 200 {object} map[string]interface{} "code:200,msg:获取成功"
 // @Router /api/admin/counselor/applications [get]
@@ -31,6 +81,7 @@ func GetApplicationList(c *gin.Context) {
 	page := c.DefaultQuery("page", "1")
 	pageSize := c.DefaultQuery("page_size", "20")
 	status := c.Query("status")
+	stage := c.Query("stage")
 	keyword := c.Query("keyword")
 
 	query := database.DB.Model(&models.CounselorApplication{})
@@ -39,6 +90,9 @@ func GetApplicationList(c *gin.Context) {
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if stage != "" {
+		query = query.Where("stage = ?", stage)
+	}
 
 	// 搜索
 	if keyword != "" {
@@ -57,7 +111,7 @@ func GetApplicationList(c *gin.Context) {
 		offset = (utils.ParseInt(page) - 1) * utils.ParseInt(pageSize)
 	}
 
-	if err := query.Preload("User").Preload("Reviewer").
+	if err := query.Preload("User").
 		Offset(offset).Limit(utils.ParseInt(pageSize)).
 		Order("created_at DESC").Find(&applications).Error; err != nil {
 		c.JSON(500, gin.H{
@@ -79,7 +133,7 @@ func GetApplicationList(c *gin.Context) {
 
 // GetApplicationDetail 获取入驻申请详情
 // @Summary 获取入驻申请详情
-// @Description 根据ID获取入驻申请详情
+// @Description 根据ID获取入驻申请详情，包含证明材料及核验结果、处理记录和各阶段可处理的角色
 // @Tags 入驻申请
 // @Accept json
 // @Produce json
@@ -91,8 +145,11 @@ func GetApplicationDetail(c *gin.Context) {
 	applicationID := c.Param("id")
 
 	var application models.CounselorApplication
-	if err := database.DB.Preload("User").Preload("Reviewer").
-		First(&application, applicationID).Error; err != nil {
+	if err := database.DB.Preload("User").Preload("Documents", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Documents.File").Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&application, applicationID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
 			"msg":  "申请不存在",
@@ -103,44 +160,124 @@ func GetApplicationDetail(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "获取成功",
-		"data": application,
+		"data": gin.H{
+			"application": application,
+			"stage_roles": applicationStageRoles(),
+		},
 	})
 }
 
-// ReviewApplication 审核入驻申请
-// @Summary 审核入驻申请
-// @Description 审核入驻申请，通过后自动创建咨询师账户
+// VerifyApplicationDocument 核验入驻申请材料
+// @Summary 核验入驻申请材料
+// @Description 资质审核阶段逐份核验申请材料，核验不通过须填写说明。全部材料核验后才能通过资质审核
 // @Tags 入驻申请
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "申请ID"
-// @Param request body ReviewApplicationRequest true "审核信息"
-// @Success 200 {object} map[string]interface{} "code:200,msg:审核成功"
-// @Router /api/admin/counselor/applications/{id}/review [put]
-func ReviewApplication(c *gin.Context) {
-	applicationID := c.Param("id")
-	reviewerID, _ := c.Get("admin_id")
+// @Param doc_id path int true "材料ID"
+// @Param request body VerifyApplicationDocumentRequest true "核验结果:1-通过,2-不通过"
+// @Success 200 {object} map[string]interface{} "code:200,msg:核验成功"
+// @Failure 403 {object} map[string]interface{} "当前角色不能处理资质审核"
+// @Router /api/admin/counselor/applications/{id}/documents/{doc_id}/verify [post]
+func VerifyApplicationDocument(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
 
-	var application models.CounselorApplication
-	if err := database.DB.First(&application, applicationID).Error; err != nil {
-		c.JSON(404, gin.H{
-			"code": 404,
-			"msg":  "申请不存在",
+	var req VerifyApplicationDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
 		})
 		return
 	}
-
-	// 检查申请状态
-	if application.Status != models.ApplicationStatusPending {
+	if req.Status == models.ApplicationDocumentRejected && req.Note == "" {
 		c.JSON(400, gin.H{
 			"code": 400,
-			"msg":  "该申请已处理",
+			"msg":  "请填写不通过的原因",
 		})
 		return
 	}
+	role := administratorRole(adminID.(uint))
+
+	var document models.CounselorApplicationDocument
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var application models.CounselorApplication
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&application, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errApplicationNotFound
+			}
+			return err
+		}
+		if application.Status != models.ApplicationStatusPending {
+			return errApplicationNotReviewing
+		}
+		if application.Stage != models.ApplicationStageQualification {
+			return errApplicationNotQualification
+		}
+		if !canHandleApplicationStage(role, application.Stage) {
+			return errApplicationStageForbidden
+		}
+		if err := tx.Where("id = ? AND application_id = ?", c.Param("doc_id"), application.ID).First(&document).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errApplicationDocumentNotFound
+			}
+			return err
+		}
 
-	var req ReviewApplicationRequest
+		now := time.Now()
+		if err := tx.Model(&document).Updates(map[string]interface{}{
+			"status":      req.Status,
+			"note":        req.Note,
+			"verified_by": adminID,
+			"verified_at": &now,
+		}).Error; err != nil {
+			return err
+		}
+		result := "核验通过"
+		if req.Status == models.ApplicationDocumentRejected {
+			result = "核验不通过"
+		}
+		comment := fmt.Sprintf("材料 #%d（%s）%s", document.ID, document.Kind, result)
+		if req.Note != "" {
+			comment += "：" + req.Note
+		}
+		return tx.Create(&models.CounselorApplicationEvent{
+			ApplicationID: application.ID,
+			Stage:         application.Stage,
+			Action:        models.ApplicationActionVerifyDocument,
+			ActorType:     models.ApplicationActorAdmin,
+			ActorID:       adminID.(uint),
+			Comment:       comment,
+		}).Error
+	})
+	if !respondApplicationError(c, err) {
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "核验成功",
+		"data": document,
+	})
+}
+
+// DecideApplication 审核入驻申请
+// @Summary 审核入驻申请
+// @Description 对当前审核阶段作出决定：pass 进入下一阶段（资质审核须全部材料已核验，终审通过时创建咨询师、咨询师账户和统计记录）；reject 拒绝申请；request_material 要求在期限内补充材料。拒绝和要求补充材料须填写说明
+// @Tags 入驻申请
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "申请ID"
+// @Param request body ApplicationDecisionRequest true "审核决定，deadline_days 为补充材料期限(天)，price 为终审通过时的咨询单价"
+// @Success 200 {object} map[string]interface{} "code:200,msg:审核成功"
+// @Failure 403 {object} map[string]interface{} "当前角色不能处理该阶段或已通过本申请的其他阶段"
+// @Router /api/admin/counselor/applications/{id}/decision [post]
+func DecideApplication(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
+
+	var req ApplicationDecisionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{
 			"code": 400,
@@ -148,63 +285,317 @@ func ReviewApplication(c *gin.Context) {
 		})
 		return
 	}
-
-	// 检查拒绝原因
-	if req.Status == models.ApplicationStatusRejected && req.RejectReason == "" {
+	if req.Action != models.ApplicationActionPass && req.Comment == "" {
 		c.JSON(400, gin.H{
 			"code": 400,
-			"msg":  "请填写拒绝原因",
+			"msg":  "拒绝或要求补充材料时须填写说明",
 		})
 		return
 	}
+	reviewerID := adminID.(uint)
+	role := administratorRole(reviewerID)
+
+	var application models.CounselorApplication
+	var counselor models.Counselor
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&application, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errApplicationNotFound
+			}
+			return err
+		}
+		// 待补充材料的申请仍可直接拒绝
+		if application.Status != models.ApplicationStatusPending &&
+			!(application.Status == models.ApplicationStatusNeedMaterial && req.Action == models.ApplicationActionReject) {
+			return errApplicationNotReviewing
+		}
+		if !canHandleApplicationStage(role, application.Stage) {
+			return errApplicationStageForbidden
+		}
 
-	now := time.Now()
+		stage := application.Stage
+		now := time.Now()
+		updates := map[string]interface{}{}
+		var notice models.Notification
+		switch req.Action {
+		case models.ApplicationActionReject:
+			updates["status"] = models.ApplicationStatusRejected
+			updates["reject_reason"] = req.Comment
+			updates["material_deadline"] = nil
+			notice = models.Notification{
+				Level:   models.NotificationLevelWarning,
+				Title:   "入驻申请未通过",
+				Content: "您的咨询师入驻申请未通过审核，原因：" + req.Comment,
+			}
 
-	// 更新申请状态
-	updates := map[string]interface{}{
-		"status":     req.Status,
-		"reviewer_id": reviewerID,
-		"reviewed_at": &now,
-	}
+		case models.ApplicationActionRequestMaterial:
+			days := req.DeadlineDays
+			if days == 0 {
+				days = applicationMaterialDays()
+			}
+			deadline := now.AddDate(0, 0, days)
+			updates["status"] = models.ApplicationStatusNeedMaterial
+			updates["material_request"] = req.Comment
+			updates["material_deadline"] = &deadline
+			notice = models.Notification{
+				Level: models.NotificationLevelWarning,
+				Title: "入驻申请需要补充材料",
+				Content: fmt.Sprintf("请在 %s 前补充以下材料，逾期申请将失效：%s",
+					deadline.Format("2006-01-02 15:04"), req.Comment),
+			}
 
-	if req.RejectReason != "" {
-		updates["reject_reason"] = req.RejectReason
-	}
+		case models.ApplicationActionPass:
+			if err := checkDistinctReviewer(tx, &application, reviewerID); err != nil {
+				return err
+			}
+			if stage == models.ApplicationStageQualification {
+				if err := checkDocumentsVerified(tx, application.ID); err != nil {
+					return err
+				}
+			}
+			next := nextApplicationStage(stage)
+			if next != "" {
+				updates["stage"] = next
+				notice = models.Notification{
+					Level:   models.NotificationLevelInfo,
+					Title:   "入驻申请进入下一阶段",
+					Content: fmt.Sprintf("您的咨询师入驻申请已通过%s，进入%s阶段", applicationStageLabel(stage), applicationStageLabel(next)),
+				}
+				break
+			}
 
-	// 如果审核通过，创建咨询师账户
-	if req.Status == models.ApplicationStatusApproved {
-		// 创建咨询师
-		counselor := models.Counselor{
-			Name:      application.Name,
-			Title:     application.Title,
-			Bio:       application.Bio,
-			Specialty: application.Specialty,
-			YearsExp:  application.YearsExp,
-			Price:     1.0, // 默认单价
-			Rating:    5.0,
-			Status:    1,
+			// 终审通过：创建咨询师及其账户
+			var err error
+			if counselor, err = createApplicationCounselor(tx, &application, req.Price); err != nil {
+				return err
+			}
+			updates["status"] = models.ApplicationStatusApproved
+			updates["reviewed_by"] = reviewerID
+			updates["reviewed_at"] = &now
+			updates["counselor_id"] = counselor.ID
+			notice = models.Notification{
+				Level:   models.NotificationLevelSuccess,
+				Title:   "入驻申请已通过",
+				Content: "恭喜，您的咨询师入驻申请已通过审核，现在可以设置排班并接受预约",
+			}
 		}
 
-		if err := database.DB.Create(&counselor).Error; err != nil {
-			c.JSON(500, gin.H{
-				"code": 500,
-				"msg":  "创建咨询师失败: " + err.Error(),
-			})
-			return
+		if err := tx.Model(&application).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.CounselorApplicationEvent{
+			ApplicationID: application.ID,
+			Stage:         stage,
+			Action:        req.Action,
+			ActorType:     models.ApplicationActorAdmin,
+			ActorID:       reviewerID,
+			Comment:       req.Comment,
+		}).Error; err != nil {
+			return err
 		}
+		notice.UserID = application.UserID
+		notice.Type = models.NotificationTypeSystem
+		return tx.Create(&notice).Error
+	})
+	if !respondApplicationError(c, err) {
+		return
 	}
 
-	// 更新申请状态
-	if err := database.DB.Model(&application).Updates(updates).Error; err != nil {
-		c.JSON(500, gin.H{
-			"code": 500,
-			"msg":  "审核失败: " + err.Error(),
-		})
-		return
+	if counselor.ID != 0 {
+		cache.DeleteIdentityCache(context.Background(), application.UserID, counselor.ID)
+		notifyCounselorSearch(counselor.ID)
 	}
 
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "审核成功",
+		"data": application,
 	})
 }
+
+// createApplicationCounselor 终审通过时创建咨询师、咨询师账户、统计记录和擅长领域标签
+func createApplicationCounselor(tx *gorm.DB, application *models.CounselorApplication, price float64) (models.Counselor, error) {
+	var count int64
+	if err := tx.Model(&models.Counselor{}).Where("user_id = ?", application.UserID).Count(&count).Error; err != nil {
+		return models.Counselor{}, err
+	}
+	if count > 0 {
+		return models.Counselor{}, errApplicationUserIsCounselor
+	}
+	if price == 0 {
+		price = defaultApplicationPrice
+	}
+
+	var user models.User
+	tx.Select("avatar").First(&user, application.UserID)
+	// 还没有评价的咨询师按平滑评分公式取先验均值，与评价后重算的口径一致，
+	// 新咨询师不会因为默认满分排在有真实评价的咨询师前面
+	counselor := models.Counselor{
+		UserID:    application.UserID,
+		Name:      application.Name,
+		Title:     application.Title,
+		Avatar:    user.Avatar,
+		Bio:       application.Bio,
+		Specialty: application.Specialty,
+		YearsExp:  application.YearsExp,
+		Gender:    models.NormalizeGender(application.Gender),
+		Price:     price,
+		Rating:    counselorstats.LoadPrior(tx).Mean,
+		Status:    1,
+	}
+	if err := tx.Create(&counselor).Error; err != nil {
+		return counselor, err
+	}
+	if err := tx.Create(&models.CounselorAccount{CounselorID: counselor.ID}).Error; err != nil {
+		return counselor, err
+	}
+	if err := tx.Create(&models.CounselorStatistics{CounselorID: counselor.ID}).Error; err != nil {
+		return counselor, err
+	}
+	return counselor, replaceCounselorTags(tx, counselor.ID, models.CounselorTagSpecialty, models.SplitSpecialty(application.Specialty))
+}
+
+// checkDistinctReviewer 同一次提交中，已通过其他阶段的管理员不能再通过当前阶段
+func checkDistinctReviewer(tx *gorm.DB, application *models.CounselorApplication, reviewerID uint) error {
+	query := tx.Model(&models.CounselorApplicationEvent{}).
+		Where("application_id = ? AND action = ? AND actor_type = ? AND actor_id = ?",
+			application.ID, models.ApplicationActionPass, models.ApplicationActorAdmin, reviewerID)
+	if application.SubmittedAt != nil {
+		query = query.Where("created_at >= ?", application.SubmittedAt)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errApplicationSameReviewer
+	}
+	return nil
+}
+
+// checkDocumentsVerified 资质审核通过的前提：没有待核验的材料，且至少一份资质证书核验通过
+func checkDocumentsVerified(tx *gorm.DB, applicationID uint) error {
+	var pending, certificates int64
+	if err := tx.Model(&models.CounselorApplicationDocument{}).
+		Where("application_id = ? AND status = ?", applicationID, models.ApplicationDocumentPending).
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.CounselorApplicationDocument{}).
+		Where("application_id = ? AND kind = ? AND status = ?", applicationID,
+			models.ApplicationDocumentCertificate, models.ApplicationDocumentVerified).
+		Count(&certificates).Error; err != nil {
+		return err
+	}
+	if pending > 0 || certificates == 0 {
+		return errApplicationDocumentsPending
+	}
+	return nil
+}
+
+// respondApplicationError 按审核错误类型返回响应，没有错误时返回 true
+func respondApplicationError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errApplicationNotFound) || errors.Is(err, errApplicationDocumentNotFound):
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  err.Error(),
+		})
+	case errors.Is(err, errApplicationStageForbidden) || errors.Is(err, errApplicationSameReviewer):
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  err.Error(),
+		})
+	case errors.Is(err, errApplicationNotReviewing) || errors.Is(err, errApplicationDocumentsPending) ||
+		errors.Is(err, errApplicationNotQualification) || errors.Is(err, errApplicationUserIsCounselor):
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+	default:
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "审核失败: " + err.Error(),
+		})
+	}
+	return false
+}
+
+// administratorRole 查询管理员角色，管理员不存在或已禁用时返回空
+func administratorRole(adminID uint) string {
+	var admin models.Administrator
+	if err := database.DB.Select("role").Where("id = ? AND status = 1", adminID).First(&admin).Error; err != nil {
+		return ""
+	}
+	return admin.Role
+}
+
+// applicationStageRoles 读取各审核阶段可处理的角色，配置缺失或格式错误的阶段使用默认值
+func applicationStageRoles() map[string][]string {
+	roles := make(map[string][]string, len(defaultApplicationStageRoles))
+	for stage, list := range defaultApplicationStageRoles {
+		roles[stage] = list
+	}
+	var config models.SystemConfig
+	if err := database.DB.Where("`key` = ?", configApplicationStageRoles).First(&config).Error; err != nil {
+		return roles
+	}
+	var configured map[string][]string
+	if err := json.Unmarshal([]byte(config.Value), &configured); err != nil {
+		return roles
+	}
+	for _, stage := range models.ApplicationStages {
+		if list, ok := configured[stage]; ok && len(list) > 0 {
+			roles[stage] = list
+		}
+	}
+	return roles
+}
+
+func canHandleApplicationStage(role, stage string) bool {
+	if role == "" {
+		return false
+	}
+	for _, r := range applicationStageRoles()[stage] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// applicationMaterialDays 读取默认的补充材料期限(天)
+func applicationMaterialDays() int {
+	var config models.SystemConfig
+	if err := database.DB.Where("`key` = ?", configApplicationMaterialDays).First(&config).Error; err == nil {
+		var days int
+		if json.Unmarshal([]byte(config.Value), &days) == nil && days > 0 {
+			return days
+		}
+	}
+	return defaultApplicationMaterialDays
+}
+
+// nextApplicationStage 返回下一审核阶段，终审返回空
+func nextApplicationStage(stage string) string {
+	for i, s := range models.ApplicationStages {
+		if s == stage && i+1 < len(models.ApplicationStages) {
+			return models.ApplicationStages[i+1]
+		}
+	}
+	return ""
+}
+
+func applicationStageLabel(stage string) string {
+	switch stage {
+	case models.ApplicationStageQualification:
+		return "资质审核"
+	case models.ApplicationStageInterview:
+		return "面试"
+	case models.ApplicationStageFinal:
+		return "终审"
+	}
+	return stage
+}
@@ -4,7 +4,11 @@ import (
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	"akrick.com/mychat/counselorstats"
+	apimodels "akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
 	"github.com/gin-gonic/gin"
+	"log"
 	"time"
 )
 
@@ -23,7 +27,7 @@ func StartChatSession(c *gin.Context) {
 	orderID := c.Param("order_id")
 
 	// 查询订单
-	var order models.Order
+	var order apimodels.Order
 	if err := database.DB.First(&order, orderID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
@@ -84,8 +88,11 @@ func StartChatSession(c *gin.Context) {
 	// 发送通知给用户
 	go CreateNotification(order.UserID, models.NotificationTypeChat, models.NotificationLevelInfo, "咨询会话已开始", "您的咨询会话已经开始，请及时参与", "")
 
-	// 更新订单状态
-	database.DB.Model(&order).Update("status", models.OrderStatusCompleted)
+	orderflow.Record(database.DB, &order, orderflow.Request{
+		Event:    models.OrderEventSessionStart,
+		Actor:    orderflow.Actor{Type: models.OrderActorCounselor, ID: order.CounselorID},
+		Metadata: map[string]interface{}{"session_id": session.ID},
+	})
 
 	c.JSON(200, gin.H{
 		"code": 200,
@@ -127,7 +134,7 @@ func SendMessage(c *gin.Context) {
 	}
 
 	// 查询会话
-	var session models.ChatSession
+	var session apimodels.ChatSession
 	if err := database.DB.First(&session, sessionID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
@@ -287,7 +294,7 @@ func EndChatSession(c *gin.Context) {
 	sessionID := c.Param("session_id")
 
 	// 查询会话
-	var session models.ChatSession
+	var session apimodels.ChatSession
 	if err := database.DB.First(&session, sessionID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
@@ -318,20 +325,42 @@ func EndChatSession(c *gin.Context) {
 	now := time.Now()
 	duration := int(now.Sub(*session.StartTime).Seconds())
 
-	if err := database.DB.Model(&session).Updates(map[string]interface{}{
-		"status":   2,
+	ended, err := counselorstats.EndSession(database.DB, &session, map[string]interface{}{
 		"end_time": &now,
 		"duration": duration,
-	}).Error; err != nil {
+	})
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "结束失败: " + err.Error(),
 		})
 		return
 	}
+	if !ended {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "会话已结束",
+		})
+		return
+	}
 
-	// 发送通知给用户
-	go CreateNotification(session.UserID, models.NotificationTypeChat, models.NotificationLevelSuccess, "咨询已结束", "您的咨询会话已结束", "")
+	// 记录会话结束；会话结束即咨询完成（完成通知由订单状态机发送）
+	var order apimodels.Order
+	if err := database.DB.First(&order, session.OrderID).Error; err == nil {
+		orderflow.Record(database.DB, &order, orderflow.Request{
+			Event:    models.OrderEventSessionEnd,
+			Actor:    orderflow.Actor{Type: models.OrderActorCounselor, ID: session.CounselorID},
+			Metadata: map[string]interface{}{"session_id": session.ID, "duration": duration},
+		})
+	}
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID:  session.OrderID,
+		Event:    models.OrderEventComplete,
+		Actor:    orderflow.System,
+		Metadata: map[string]interface{}{"session_id": session.ID},
+	}); err != nil {
+		log.Printf("会话结束后完成订单失败: sessionID=%d, orderID=%d, err=%v", session.ID, session.OrderID, err)
+	}
 
 	c.JSON(200, gin.H{
 		"code": 200,
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/search"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 聊天记录检索
+// 与 API 服务共用检索模块（akrick.com/mychat/search），按 CHAT_SEARCH_ENGINE 使用同一种引擎，
+// 同一关键词在用户端和管理端得到一致的结果；这里只负责解析筛选参数和组装管理端的返回结构
+
+// chatSearchHit 带高亮片段和会话信息的消息
+type chatSearchHit struct {
+	search.MessageHit
+	Session *models.ChatSession `json:"session,omitempty"`
+}
+
+// chatSearchQuery 解析检索参数：keyword、session_id、sender_id、content_type、start_date、end_date、sort、page、page_size
+// 参数有误时返回错误提示
+func chatSearchQuery(c *gin.Context) (*search.Query, string) {
+	sessionID, _ := strconv.ParseUint(c.Query("session_id"), 10, 64)
+	senderID, _ := strconv.ParseUint(c.Query("sender_id"), 10, 64)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	q := &search.Query{
+		Keyword:     c.Query("keyword"),
+		SessionID:   uint(sessionID),
+		SenderID:    uint(senderID),
+		ContentType: c.Query("content_type"),
+		Sort:        c.DefaultQuery("sort", search.SortTime),
+		Page:        page,
+		PageSize:    pageSize,
+	}
+	if v := c.Query("start_date"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return nil, "开始日期格式错误"
+		}
+		q.StartTime = &t
+	}
+	if v := c.Query("end_date"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return nil, "结束日期格式错误"
+		}
+		t = t.AddDate(0, 0, 1)
+		q.EndTime = &t
+	}
+	return q, ""
+}
+
+// runChatSearch 执行检索，失败时写入错误响应
+func runChatSearch(c *gin.Context, q *search.Query) (*search.Result, bool) {
+	result, err := search.Search(c.Request.Context(), q)
+	if err != nil {
+		code, msg := 500, "搜索失败: "+err.Error()
+		if errors.Is(err, search.ErrEmptyKeyword) {
+			code, msg = 400, "请输入搜索关键词"
+		}
+		c.JSON(code, gin.H{
+			"code": code,
+			"msg":  msg,
+		})
+		return nil, false
+	}
+	return result, true
+}
+
+// withSessions 为命中的消息附加会话及其来访者、咨询师信息
+func withSessions(messages []search.MessageHit) ([]chatSearchHit, error) {
+	ids := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.SessionID)
+	}
+	var sessions []models.ChatSession
+	if len(ids) > 0 {
+		if err := database.DB.Preload("User").Preload("Counselor").Where("id IN ?", ids).Find(&sessions).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]*models.ChatSession, len(sessions))
+	for i := range sessions {
+		byID[sessions[i].ID] = &sessions[i]
+	}
+
+	hits := make([]chatSearchHit, 0, len(messages))
+	for _, m := range messages {
+		hits = append(hits, chatSearchHit{MessageHit: m, Session: byID[m.SessionID]})
+	}
+	return hits, nil
+}
@@ -2,34 +2,50 @@ package handlers
 
 import (
 	"context"
+	"strings"
+
 	"akrick.com/mychat/admin/backend/cache"
+	"akrick.com/mychat/counselorstats"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// 咨询师资料或标签变更后通知 api 服务同步咨询师检索（须与 api/counselorsearch.SyncChannel 一致）
+const counselorSearchSyncChannel = "counselor:search:sync"
+
 type CreateCounselorRequest struct {
-	Name      string  `json:"name" binding:"required,min=2,max=50"`
-	Title     string  `json:"title"`
-	Avatar    string  `json:"avatar"`
-	Bio       string  `json:"bio"`
-	Specialty string  `json:"specialty"`
-	Price     float64 `json:"price" binding:"required,min=0"`
-	YearsExp  int     `json:"years_exp"`
-	Rating    float64 `json:"rating"`
+	Name        string   `json:"name" binding:"required,min=2,max=50"`
+	Title       string   `json:"title"`
+	Avatar      string   `json:"avatar"`
+	Bio         string   `json:"bio"`
+	Specialty   string   `json:"specialty"`
+	Price       float64  `json:"price" binding:"required,min=0"`
+	YearsExp    int      `json:"years_exp"`
+	Rating      float64  `json:"rating"`
+	Gender      string   `json:"gender" binding:"omitempty,oneof=male female"`
+	Specialties []string `json:"specialties" binding:"max=20,dive,min=1,max=50"`
+	Tags        []string `json:"tags" binding:"max=20,dive,min=1,max=50"`
+	Languages   []string `json:"languages" binding:"max=10,dive,min=1,max=50"`
 }
 
+// UpdateCounselorRequest 标签字段不传时保持不变，传空数组时清空
 type UpdateCounselorRequest struct {
-	Name      string  `json:"name" binding:"min=2,max=50"`
-	Title     string  `json:"title"`
-	Avatar    string  `json:"avatar"`
-	Bio       string  `json:"bio"`
-	Specialty string  `json:"specialty"`
-	Price     float64 `json:"price" binding:"min=0"`
-	YearsExp  int     `json:"years_exp"`
-	Rating    float64 `json:"rating"`
-	Status    *int    `json:"status" binding:"omitempty,oneof=0 1"`
+	Name        string    `json:"name" binding:"min=2,max=50"`
+	Title       string    `json:"title"`
+	Avatar      string    `json:"avatar"`
+	Bio         string    `json:"bio"`
+	Specialty   string    `json:"specialty"`
+	Price       float64   `json:"price" binding:"min=0"`
+	YearsExp    int       `json:"years_exp"`
+	Rating      float64   `json:"rating"`
+	Status      *int      `json:"status" binding:"omitempty,oneof=0 1"`
+	Gender      *string   `json:"gender"` // male/female，空字符串表示清除
+	Specialties *[]string `json:"specialties" binding:"omitempty,max=20,dive,min=1,max=50"`
+	Tags        *[]string `json:"tags" binding:"omitempty,max=20,dive,min=1,max=50"`
+	Languages   *[]string `json:"languages" binding:"omitempty,max=10,dive,min=1,max=50"`
 }
 
 // CreateCounselor godoc
@@ -54,30 +70,47 @@ func CreateCounselor(c *gin.Context) {
 		return
 	}
 
+	specialty := req.Specialty
+	if specialty == "" {
+		specialty = strings.Join(req.Specialties, "、")
+	}
 	counselor := models.Counselor{
 		Name:      req.Name,
 		Title:     req.Title,
 		Avatar:    req.Avatar,
 		Bio:       req.Bio,
-		Specialty: req.Specialty,
+		Specialty: specialty,
 		Price:     req.Price,
 		YearsExp:  req.YearsExp,
+		Gender:    req.Gender,
 		Rating:    req.Rating,
 		Status:    1,
 	}
 
-	if err := database.DB.Create(&counselor).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&counselor).Error; err != nil {
+			return err
+		}
+		for kind, values := range map[string][]string{
+			models.CounselorTagSpecialty: req.Specialties,
+			models.CounselorTagTag:       req.Tags,
+			models.CounselorTagLanguage:  req.Languages,
+		} {
+			if err := replaceCounselorTags(tx, counselor.ID, kind, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "创建失败: " + err.Error(),
 		})
 		return
 	}
-
-	// 删除咨询师列表缓存（创建新咨询师后列表会变化）
-	if cache.Rdb != nil {
-		// 这里可以添加删除列表缓存的逻辑
-	}
+	counselor.Specialties, counselor.Tags, counselor.Languages = req.Specialties, req.Tags, req.Languages
+	notifyCounselorSearch(counselor.ID)
 
 	c.JSON(200, gin.H{
 		"code": 200,
@@ -161,6 +194,7 @@ func GetCounselorDetail(c *gin.Context) {
 				Specialty: counselorData.Specialty,
 				Price:     counselorData.Price,
 				YearsExp:  counselorData.YearsExp,
+				Gender:    counselorData.Gender,
 				Rating:    counselorData.Rating,
 				Status:    counselorData.Status,
 				CreatedAt: counselorData.CreatedAt,
@@ -195,14 +229,14 @@ func GetCounselorDetail(c *gin.Context) {
 
 // UpdateCounselor godoc
 // @Summary 更新咨询师信息
-// @Description 更新咨询师信息（仅咨询师本人或管理员）
+// @Description 更新咨询师信息（仅咨询师本人或管理员）；职称、头像、简介、擅长领域和单价的修改记为资料修改申请，由其他管理员审核通过后生效
 // @Tags 咨询师
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "咨询师ID"
 // @Param request body UpdateCounselorRequest true "更新信息"
-// @Success 200 {object} map[string]interface{} "code:200,msg:更新成功"
+// @Success 200 {object} map[string]interface{} "code:200,msg:更新成功,data:{change}"
 // @Failure 400 {object} map[string]interface{} "参数错误"
 // @Failure 401 {object} map[string]interface{} "未授权"
 // @Failure 403 {object} map[string]interface{} "无权操作"
@@ -229,24 +263,39 @@ func UpdateCounselor(c *gin.Context) {
 		return
 	}
 
-	updates := make(map[string]interface{})
-	if req.Name != "" {
-		updates["name"] = req.Name
-	}
+	// 职称、头像、简介、擅长领域和单价的修改须经其他管理员审核，记为资料修改申请；
+	// 更新擅长领域标签且未单独指定展示文本时，展示文本随标签修改，审核通过后按文本重建擅长领域标签
+	var edit models.ProfileEdit
 	if req.Title != "" {
-		updates["title"] = req.Title
+		edit.Title = &req.Title
 	}
 	if req.Avatar != "" {
-		updates["avatar"] = req.Avatar
+		edit.Avatar = &req.Avatar
 	}
 	if req.Bio != "" {
-		updates["bio"] = req.Bio
+		edit.Bio = &req.Bio
 	}
 	if req.Specialty != "" {
-		updates["specialty"] = req.Specialty
+		edit.Specialty = &req.Specialty
+	} else if req.Specialties != nil {
+		specialty := strings.Join(*req.Specialties, "、")
+		edit.Specialty = &specialty
 	}
 	if req.Price > 0 {
-		updates["price"] = req.Price
+		edit.Price = &req.Price
+	}
+	change, err := newProfileChange(&counselor, edit)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		updates["name"] = req.Name
 	}
 	if req.YearsExp > 0 {
 		updates["years_exp"] = req.YearsExp
@@ -257,8 +306,45 @@ func UpdateCounselor(c *gin.Context) {
 	if req.Status != nil {
 		updates["status"] = *req.Status
 	}
+	if req.Gender != nil {
+		if *req.Gender != "" && *req.Gender != models.GenderMale && *req.Gender != models.GenderFemale {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "性别参数错误",
+			})
+			return
+		}
+		updates["gender"] = *req.Gender
+	}
+
+	tags := make(map[string][]string)
+	if req.Tags != nil {
+		tags[models.CounselorTagTag] = *req.Tags
+	}
+	if req.Languages != nil {
+		tags[models.CounselorTagLanguage] = *req.Languages
+	}
 
-	if err := database.DB.Model(&counselor).Updates(updates).Error; err != nil {
+	adminID, _ := c.Get("admin_id")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&counselor).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		for kind, values := range tags {
+			if err := replaceCounselorTags(tx, counselor.ID, kind, values); err != nil {
+				return err
+			}
+		}
+		if change != nil {
+			change.SubmitterType = models.ProfileChangeSubmitterAdmin
+			change.SubmitterID = adminID.(uint)
+			return tx.Create(change).Error
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "更新失败: " + err.Error(),
@@ -270,13 +356,49 @@ func UpdateCounselor(c *gin.Context) {
 	if cache.Rdb != nil {
 		cache.DeleteCounselorCache(context.Background(), counselor.ID)
 	}
+	notifyCounselorSearch(counselor.ID)
 
+	msg := "更新成功"
+	if change != nil {
+		msg = "更新成功，职称、头像、简介、擅长领域和单价的修改已提交审核"
+	}
 	c.JSON(200, gin.H{
 		"code": 200,
-		"msg":  "更新成功",
+		"msg":  msg,
+		"data": gin.H{
+			"change": change,
+		},
 	})
 }
 
+// replaceCounselorTags 用 values 替换咨询师某类标签（去除空白和重复值）
+func replaceCounselorTags(tx *gorm.DB, counselorID uint, kind string, values []string) error {
+	if err := tx.Where("counselor_id = ? AND kind = ?", counselorID, kind).Delete(&models.CounselorTag{}).Error; err != nil {
+		return err
+	}
+	var tags []models.CounselorTag
+	seen := make(map[string]bool)
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		tags = append(tags, models.CounselorTag{CounselorID: counselorID, Kind: kind, Value: v})
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tx.Create(&tags).Error
+}
+
+// notifyCounselorSearch 通知 api 服务同步咨询师检索；Redis 不可用时由检索快照的定期刷新兜底
+func notifyCounselorSearch(counselorID uint) {
+	if cache.Rdb != nil {
+		cache.Rdb.Publish(context.Background(), counselorSearchSyncChannel, counselorID)
+	}
+}
+
 // DeleteCounselor godoc
 // @Summary 删除咨询师
 // @Description 删除咨询师（仅管理员可操作）
@@ -311,13 +433,58 @@ func DeleteCounselor(c *gin.Context) {
 		return
 	}
 
+	database.DB.Where("counselor_id = ?", counselor.ID).Delete(&models.CounselorTag{})
+
 	// 删除缓存
 	if cache.Rdb != nil {
 		cache.DeleteCounselorCache(ctx, counselor.ID)
 	}
+	notifyCounselorSearch(counselor.ID)
 
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "删除成功",
 	})
 }
+
+// RebuildCounselorStatistics godoc
+// @Summary 重算咨询师统计
+// @Description 按订单、会话和评价重算单个咨询师的统计和评分；全部咨询师的重算通过手动触发 counselor_stats_rebuild 任务执行
+// @Tags 咨询师
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "咨询师ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:重算成功,data:statistics"
+// @Failure 404 {object} map[string]interface{} "咨询师不存在"
+// @Router /api/admin/counselors/{id}/statistics/rebuild [post]
+func RebuildCounselorStatistics(c *gin.Context) {
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "咨询师不存在",
+		})
+		return
+	}
+
+	if err := counselorstats.RebuildCounselor(counselor.ID); err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "重算失败: " + err.Error(),
+		})
+		return
+	}
+	if cache.Rdb != nil {
+		cache.DeleteCounselorCache(context.Background(), counselor.ID)
+	}
+
+	var stats models.CounselorStatistics
+	database.DB.Where("counselor_id = ?", counselor.ID).First(&stats)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "重算成功",
+		"data": stats,
+	})
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"akrick.com/mychat/admin/backend/cache"
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 咨询师等级决定单价区间：咨询师的基础单价和时长档位单价须在区间内，下单时时段加价后的单价也会限制在区间内。
+// api 服务的 counselor_level_promote 任务按晋升条件每天自动升级（可在任务管理中手动触发），降级由管理员在此调整
+
+var (
+	errCounselorLevelNotFound = errors.New("咨询师等级不存在")
+	errCounselorLevelInUse    = errors.New("仍有咨询师处于该等级，不能删除")
+	errPriceOutOfBand         = errors.New("单价超出咨询师等级的价格区间")
+)
+
+// CounselorLevelRequest 创建或修改咨询师等级，等级代码创建后不能修改
+type CounselorLevelRequest struct {
+	Code               string  `json:"code" binding:"required,max=20"`
+	Name               string  `json:"name" binding:"required,max=50"`
+	Rank               int     `json:"rank" binding:"min=0"`
+	PriceMin           float64 `json:"price_min" binding:"min=0"`
+	PriceMax           float64 `json:"price_max" binding:"min=0"` // 0 表示不限
+	MinCompletedOrders int     `json:"min_completed_orders" binding:"min=0"`
+	MinReviewCount     int     `json:"min_review_count" binding:"min=0"`
+	MinAvgRating       float64 `json:"min_avg_rating" binding:"min=0,max=5"`
+	MinTotalDuration   int     `json:"min_total_duration" binding:"min=0"`
+}
+
+// SetCounselorLevelRequest 手动调整咨询师等级
+type SetCounselorLevelRequest struct {
+	Level  string `json:"level" binding:"required,max=20"`
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// GetCounselorLevelList godoc
+// @Summary 获取咨询师等级列表
+// @Description 按等级从低到高返回等级、单价区间、晋升条件和各等级咨询师人数
+// @Tags 咨询师等级
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{levels,counts}"
+// @Router /api/admin/counselor/levels [get]
+func GetCounselorLevelList(c *gin.Context) {
+	var levels []models.CounselorLevel
+	if err := database.DB.Order("`rank`").Find(&levels).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	var rows []struct {
+		Level string
+		Count int64
+	}
+	database.DB.Model(&models.Counselor{}).Select("level, COUNT(*) AS count").Group("level").Scan(&rows)
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Level] = r.Count
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"levels": levels,
+			"counts": counts,
+		},
+	})
+}
+
+// CreateCounselorLevel godoc
+// @Summary 创建咨询师等级
+// @Tags 咨询师等级
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CounselorLevelRequest true "等级信息"
+// @Success 200 {object} map[string]interface{} "code:200,msg:创建成功,data:level"
+// @Failure 400 {object} map[string]interface{} "参数错误或等级代码已存在"
+// @Router /api/admin/counselor/levels [post]
+func CreateCounselorLevel(c *gin.Context) {
+	var req CounselorLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.PriceMax > 0 && req.PriceMax < req.PriceMin {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "最高单价不能低于最低单价",
+		})
+		return
+	}
+
+	level := models.CounselorLevel{Code: req.Code}
+	applyCounselorLevelRequest(&level, &req)
+	if err := database.DB.Create(&level).Error; err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "创建失败，等级代码可能已存在: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "创建成功",
+		"data": level,
+	})
+}
+
+// UpdateCounselorLevel godoc
+// @Summary 修改咨询师等级
+// @Description 修改名称、单价区间和晋升条件，等级代码不能修改；修改单价区间不影响已下单的订单
+// @Tags 咨询师等级
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "等级ID"
+// @Param request body CounselorLevelRequest true "等级信息"
+// @Success 200 {object} map[string]interface{} "code:200,msg:修改成功,data:level"
+// @Failure 404 {object} map[string]interface{} "等级不存在"
+// @Router /api/admin/counselor/levels/{id} [put]
+func UpdateCounselorLevel(c *gin.Context) {
+	var req CounselorLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.PriceMax > 0 && req.PriceMax < req.PriceMin {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "最高单价不能低于最低单价",
+		})
+		return
+	}
+
+	var level models.CounselorLevel
+	if err := database.DB.First(&level, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  errCounselorLevelNotFound.Error(),
+		})
+		return
+	}
+
+	applyCounselorLevelRequest(&level, &req)
+	if err := database.DB.Save(&level).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "修改失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "修改成功",
+		"data": level,
+	})
+}
+
+// DeleteCounselorLevel godoc
+// @Summary 删除咨询师等级
+// @Description 仍有咨询师处于该等级时不能删除
+// @Tags 咨询师等级
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "等级ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:删除成功"
+// @Failure 400 {object} map[string]interface{} "仍有咨询师处于该等级"
+// @Failure 404 {object} map[string]interface{} "等级不存在"
+// @Router /api/admin/counselor/levels/{id} [delete]
+func DeleteCounselorLevel(c *gin.Context) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var level models.CounselorLevel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&level, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errCounselorLevelNotFound
+			}
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.Counselor{}).Where("level = ?", level.Code).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errCounselorLevelInUse
+		}
+		return tx.Delete(&level).Error
+	})
+	switch {
+	case errors.Is(err, errCounselorLevelNotFound):
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  err.Error(),
+		})
+		return
+	case errors.Is(err, errCounselorLevelInUse):
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "删除失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// SetCounselorLevel godoc
+// @Summary 调整咨询师等级
+// @Description 手动升级或降级咨询师并通知咨询师；咨询师的单价不在新等级区间内时，下单时按区间上下限计费
+// @Tags 咨询师等级
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "咨询师ID"
+// @Param request body SetCounselorLevelRequest true "新等级代码和原因"
+// @Success 200 {object} map[string]interface{} "code:200,msg:调整成功,data:counselor"
+// @Failure 404 {object} map[string]interface{} "咨询师或等级不存在"
+// @Router /api/admin/counselors/{id}/level [put]
+func SetCounselorLevel(c *gin.Context) {
+	var req SetCounselorLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var level models.CounselorLevel
+	if err := database.DB.Where("code = ?", req.Level).First(&level).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  errCounselorLevelNotFound.Error(),
+		})
+		return
+	}
+
+	var counselor models.Counselor
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&counselor, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if counselor.Level == level.Code {
+			return nil
+		}
+		if err := tx.Model(&counselor).Update("level", level.Code).Error; err != nil {
+			return err
+		}
+		if counselor.UserID == 0 {
+			return nil
+		}
+		content := fmt.Sprintf("您的咨询师等级已调整为%s", level.Name)
+		if req.Reason != "" {
+			content += "，原因：" + req.Reason
+		}
+		return tx.Create(&models.Notification{
+			UserID:  counselor.UserID,
+			Type:    models.NotificationTypeSystem,
+			Level:   models.NotificationLevelInfo,
+			Title:   "咨询师等级调整",
+			Content: content,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "咨询师不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "调整失败: " + err.Error(),
+		})
+		return
+	}
+
+	if cache.Rdb != nil {
+		cache.DeleteCounselorCache(context.Background(), counselor.ID)
+	}
+	notifyCounselorSearch(counselor.ID)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "调整成功",
+		"data": counselor,
+	})
+}
+
+func applyCounselorLevelRequest(level *models.CounselorLevel, req *CounselorLevelRequest) {
+	level.Name = req.Name
+	level.Rank = req.Rank
+	level.PriceMin = req.PriceMin
+	level.PriceMax = req.PriceMax
+	level.MinCompletedOrders = req.MinCompletedOrders
+	level.MinReviewCount = req.MinReviewCount
+	level.MinAvgRating = req.MinAvgRating
+	level.MinTotalDuration = req.MinTotalDuration
+}
+
+// checkPriceBand 单价修改生效前校验基础单价和时长档位单价都在咨询师当前等级的单价区间内（定价规则格式由 api 服务提交时校验）
+func checkPriceBand(db *gorm.DB, counselor *models.Counselor, change *models.CounselorProfileChange) error {
+	price, rules := counselor.Price, counselor.PriceRules
+	if change.Price != nil {
+		price = *change.Price
+	}
+	if change.PriceRules != nil {
+		rules = *change.PriceRules
+	}
+	var level models.CounselorLevel
+	if err := db.Where("code = ?", counselor.Level).First(&level).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	prices := []float64{price}
+	if rules != "" {
+		var parsed struct {
+			Durations []struct {
+				Price float64 `json:"price"`
+			} `json:"durations"`
+		}
+		if err := json.Unmarshal([]byte(rules), &parsed); err != nil {
+			return fmt.Errorf("定价规则格式错误: %w", err)
+		}
+		for _, d := range parsed.Durations {
+			prices = append(prices, d.Price)
+		}
+	}
+	for _, p := range prices {
+		if !level.InBand(p) {
+			if level.PriceMax > 0 {
+				return fmt.Errorf("%w（%s：%.2f-%.2f 元/分钟）", errPriceOutOfBand, level.Name, level.PriceMin, level.PriceMax)
+			}
+			return fmt.Errorf("%w（%s：不低于 %.2f 元/分钟）", errPriceOutOfBand, level.Name, level.PriceMin)
+		}
+	}
+	return nil
+}
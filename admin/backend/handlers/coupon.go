@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/admin/backend/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CouponRequest 创建或修改优惠券
+type CouponRequest struct {
+	Code           string    `json:"code" binding:"required,max=32"`
+	Name           string    `json:"name" binding:"required,max=100"`
+	Description    string    `json:"description" binding:"max=500"`
+	Type           string    `json:"type" binding:"required,oneof=fixed percent"`
+	Value          float64   `json:"value" binding:"required,gt=0"`
+	MaxDiscount    float64   `json:"max_discount" binding:"min=0"`
+	MinAmount      float64   `json:"min_amount" binding:"min=0"`
+	FirstOrderOnly bool      `json:"first_order_only"`
+	CounselorID    *uint     `json:"counselor_id"`
+	StartAt        time.Time `json:"start_at" binding:"required"`
+	EndAt          time.Time `json:"end_at" binding:"required"`
+	TotalQuantity  int       `json:"total_quantity" binding:"min=0"`
+	PerUserLimit   int       `json:"per_user_limit" binding:"min=0"` // 0 表示不限
+	Status         *int      `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// GetCouponList godoc
+// @Summary 获取优惠券列表
+// @Description 分页获取优惠券列表（管理员）
+// @Tags 优惠券
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param keyword query string false "券码或名称"
+// @Param type query string false "类型:fixed/percent"
+// @Param status query int false "状态:0-停用,1-启用"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{coupons,total}"
+// @Router /api/admin/coupons [get]
+func GetCouponList(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.Coupon{})
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("code LIKE ? OR name LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	if couponType := c.Query("type"); couponType != "" {
+		query = query.Where("type = ?", couponType)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var coupons []models.Coupon
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id DESC").Find(&coupons).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"coupons": coupons,
+			"total":   total,
+		},
+	})
+}
+
+// CreateCoupon godoc
+// @Summary 创建优惠券
+// @Description 立减券 value 为金额，折扣券 value 为百分比（20 表示减 20%）；首单和咨询师专属为附加条件
+// @Tags 优惠券
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CouponRequest true "优惠券信息"
+// @Success 200 {object} map[string]interface{} "code:200,msg:创建成功,data:coupon"
+// @Router /api/admin/coupons [post]
+func CreateCoupon(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
+
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if msg := validateCouponRequest(&req); msg != "" {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  msg,
+		})
+		return
+	}
+
+	status := models.CouponStatusOn
+	coupon := models.Coupon{Status: &status, CreatedBy: adminID.(uint)}
+	applyCouponRequest(&coupon, &req)
+	if err := database.DB.Create(&coupon).Error; err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "创建失败，券码可能已存在: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "创建成功",
+		"data": coupon,
+	})
+}
+
+// UpdateCoupon godoc
+// @Summary 修改优惠券
+// @Description 修改只影响之后的下单，已使用的记录保留原抵扣金额
+// @Tags 优惠券
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "优惠券ID"
+// @Param request body CouponRequest true "优惠券信息"
+// @Success 200 {object} map[string]interface{} "code:200,msg:修改成功,data:coupon"
+// @Router /api/admin/coupons/{id} [put]
+func UpdateCoupon(c *gin.Context) {
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if msg := validateCouponRequest(&req); msg != "" {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  msg,
+		})
+		return
+	}
+
+	var coupon models.Coupon
+	if err := database.DB.First(&coupon, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "优惠券不存在",
+		})
+		return
+	}
+	if req.TotalQuantity > 0 && req.TotalQuantity < coupon.UsedQuantity {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "发放总量不能小于已使用数量",
+		})
+		return
+	}
+
+	applyCouponRequest(&coupon, &req)
+	// 不覆盖 used_quantity，避免与下单时的并发核销冲突
+	if err := database.DB.Model(&coupon).Omit("used_quantity", "created_by").Save(&coupon).Error; err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "修改失败，券码可能已存在: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "修改成功",
+		"data": coupon,
+	})
+}
+
+// GetCouponRedemptions godoc
+// @Summary 获取优惠券使用记录
+// @Tags 优惠券
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "优惠券ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param status query int false "状态:1-已使用,2-已退回"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{redemptions,total}"
+// @Router /api/admin/coupons/{id}/redemptions [get]
+func GetCouponRedemptions(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.CouponRedemption{}).Where("coupon_redemptions.coupon_id = ?", c.Param("id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("coupon_redemptions.status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	type redemptionRow struct {
+		models.CouponRedemption
+		Username    string  `json:"username"`
+		OrderNo     string  `json:"order_no"`
+		OrderStatus int     `json:"order_status"`
+		OrderAmount float64 `json:"order_amount"`
+	}
+	var rows []redemptionRow
+	if err := query.Select("coupon_redemptions.*, users.username, orders.order_no, orders.status as order_status, orders.amount as order_amount").
+		Joins("LEFT JOIN users ON users.id = coupon_redemptions.user_id").
+		Joins("LEFT JOIN orders ON orders.id = coupon_redemptions.order_id").
+		Offset((page - 1) * pageSize).Limit(pageSize).Order("coupon_redemptions.id DESC").
+		Scan(&rows).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"redemptions": rows,
+			"total":       total,
+		},
+	})
+}
+
+func validateCouponRequest(req *CouponRequest) string {
+	if req.Type == models.CouponTypePercent && req.Value >= 100 {
+		return "折扣比例必须小于100"
+	}
+	if !req.EndAt.After(req.StartAt) {
+		return "失效时间必须晚于生效时间"
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		return "券码不能为空"
+	}
+	return ""
+}
+
+func applyCouponRequest(coupon *models.Coupon, req *CouponRequest) {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	coupon.Name = req.Name
+	coupon.Description = req.Description
+	coupon.Type = req.Type
+	coupon.Value = req.Value
+	coupon.MaxDiscount = req.MaxDiscount
+	coupon.MinAmount = req.MinAmount
+	coupon.FirstOrderOnly = req.FirstOrderOnly
+	coupon.CounselorID = req.CounselorID
+	coupon.StartAt = req.StartAt
+	coupon.EndAt = req.EndAt
+	coupon.TotalQuantity = req.TotalQuantity
+	coupon.PerUserLimit = &req.PerUserLimit
+	if req.Status != nil {
+		coupon.Status = req.Status
+	}
+}
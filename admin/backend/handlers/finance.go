@@ -75,6 +75,20 @@ func GetFinanceStats(c *gin.Context) {
 	// 平台佣金 (假设佣金率为20%)
 	totalCommission = totalRevenue * 0.2
 
+	// 优惠券抵扣（与总营收同口径，营收为抵扣后的实付金额）
+	var coupon struct {
+		Discount float64
+		Orders   int64
+	}
+	couponQuery := database.DB.Model(&models.Order{}).Where("status = ? AND coupon_id IS NOT NULL", models.OrderStatusPaid)
+	if startDate != "" {
+		couponQuery = couponQuery.Where("created_at >= ?", startDate)
+	}
+	if endDate != "" {
+		couponQuery = couponQuery.Where("created_at <= ?", endDate)
+	}
+	couponQuery.Select("COALESCE(SUM(discount), 0) as discount, COUNT(*) as orders").Scan(&coupon)
+
 	// 咨询师总收益
 	totalCounselorEarnings := totalRevenue - totalCommission
 
@@ -97,6 +111,8 @@ func GetFinanceStats(c *gin.Context) {
 			"approved_withdraws":       approvedWithdraws,
 			"today_revenue":            todayRevenue,
 			"today_orders":             todayOrders,
+			"coupon_discount":          coupon.Discount,
+			"coupon_orders":            coupon.Orders,
 		},
 	})
 }
@@ -408,7 +424,7 @@ func ConfirmWithdrawTransfer(c *gin.Context) {
 // @Security BearerAuth
 // @Param start_date query string false "开始日期"
 // @Param end_date query string false "结束日期"
-// @Param type query string false "报表类型:income,withdraw,account" Enums(income,withdraw,account)
+// @Param type query string false "报表类型:income,withdraw,account,coupon" Enums(income,withdraw,account,coupon)
 // @Success 200 {object} map[string]interface{} "code:200,msg:获取成功"
 // @Router /api/admin/finance/reports [get]
 func GetFinanceReports(c *gin.Context) {
@@ -499,6 +515,43 @@ func GetFinanceReports(c *gin.Context) {
 			Scan(&accountData)
 
 		data = accountData
+
+	case "coupon":
+		// 优惠券报表：按券统计使用、退回和已支付订单的抵扣金额
+		type CouponData struct {
+			CouponID      uint    `json:"coupon_id"`
+			Code          string  `json:"code"`
+			Name          string  `json:"name"`
+			Type          string  `json:"type"`
+			UsedCount     int64   `json:"used_count"`
+			PaidCount     int64   `json:"paid_count"`
+			ReleasedCount int64   `json:"released_count"`
+			TotalDiscount float64 `json:"total_discount"`
+			OrderAmount   float64 `json:"order_amount"`
+		}
+		var couponData []CouponData
+
+		query := database.DB.Model(&models.CouponRedemption{}).
+			Select("coupon_redemptions.coupon_id, coupons.code, coupons.name, coupons.type, "+
+				"SUM(CASE WHEN coupon_redemptions.status = 1 THEN 1 ELSE 0 END) as used_count, "+
+				"SUM(CASE WHEN coupon_redemptions.status = 1 AND orders.pay_time IS NOT NULL THEN 1 ELSE 0 END) as paid_count, "+
+				"SUM(CASE WHEN coupon_redemptions.status = 2 THEN 1 ELSE 0 END) as released_count, "+
+				"COALESCE(SUM(CASE WHEN coupon_redemptions.status = 1 AND orders.pay_time IS NOT NULL THEN coupon_redemptions.discount ELSE 0 END), 0) as total_discount, "+
+				"COALESCE(SUM(CASE WHEN coupon_redemptions.status = 1 AND orders.pay_time IS NOT NULL THEN orders.amount ELSE 0 END), 0) as order_amount").
+			Joins("LEFT JOIN coupons ON coupons.id = coupon_redemptions.coupon_id").
+			Joins("LEFT JOIN orders ON orders.id = coupon_redemptions.order_id")
+
+		if startDate != "" {
+			query = query.Where("coupon_redemptions.created_at >= ?", startDate)
+		}
+		if endDate != "" {
+			query = query.Where("coupon_redemptions.created_at <= ?", endDate)
+		}
+
+		query.Group("coupon_redemptions.coupon_id, coupons.code, coupons.name, coupons.type").
+			Order("total_discount DESC").Scan(&couponData)
+
+		data = couponData
 	}
 
 	c.JSON(200, gin.H{
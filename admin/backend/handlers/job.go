@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"akrick.com/mychat/admin/backend/cache"
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/admin/backend/utils"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 定时任务由 api 服务注册和执行（见 api/jobs），管理后台只修改任务表中的暂停标记和手动触发请求，
+// 并发布唤醒消息让调度器立即检查（Redis 不可用时最迟一个轮询周期生效）
+const jobsWakeChannel = "jobs:wake"
+
+// GetJobList godoc
+// @Summary 获取定时任务列表
+// @Description 返回所有定时任务的计划、暂停状态、租约持有实例以及最近24小时的执行统计
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:[]job"
+// @Router /api/admin/jobs [get]
+func GetJobList(c *gin.Context) {
+	var jobs []models.ScheduledJob
+	if err := database.DB.Order("name ASC").Find(&jobs).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	type runStats struct {
+		JobName       string
+		Success       int64
+		Failed        int64
+		AvgDurationMs float64
+	}
+	var stats []runStats
+	database.DB.Model(&models.JobRun{}).
+		Select("job_name, "+
+			"SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) as success, "+
+			"SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) as failed, "+
+			"COALESCE(AVG(CASE WHEN status = ? THEN duration_ms END), 0) as avg_duration_ms",
+			models.JobRunSuccess, models.JobRunFailed, models.JobRunSuccess).
+		Where("started_at >= ?", time.Now().Add(-24*time.Hour)).
+		Group("job_name").Scan(&stats)
+	byName := make(map[string]runStats, len(stats))
+	for _, s := range stats {
+		byName[s.JobName] = s
+	}
+
+	now := time.Now()
+	list := make([]gin.H, 0, len(jobs))
+	for _, job := range jobs {
+		s := byName[job.Name]
+		list = append(list, gin.H{
+			"job":                 job,
+			"running":             job.LeaseUntil != nil && now.Before(*job.LeaseUntil),
+			"success_24h":         s.Success,
+			"failed_24h":          s.Failed,
+			"avg_duration_ms_24h": s.AvgDurationMs,
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": list,
+	})
+}
+
+// GetJobRuns godoc
+// @Summary 获取任务执行记录
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "任务名"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param status query string false "状态:running/success/failed"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{runs,total}"
+// @Router /api/admin/jobs/{name}/runs [get]
+func GetJobRuns(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.JobRun{}).Where("job_name = ?", c.Param("name"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var runs []models.JobRun
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id DESC").Find(&runs).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"runs":  runs,
+			"total": total,
+		},
+	})
+}
+
+// TriggerJob godoc
+// @Summary 手动触发任务
+// @Description 请求立即执行一次（暂停的任务也可触发）；任务正在执行时，本次执行结束后再执行
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "任务名"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已触发"
+// @Router /api/admin/jobs/{name}/trigger [post]
+func TriggerJob(c *gin.Context) {
+	username, _ := c.Get("username")
+	updateJob(c, map[string]interface{}{
+		"trigger_requested_at": time.Now(),
+		"triggered_by":         fmt.Sprint(username),
+	}, "已触发")
+}
+
+// PauseJob godoc
+// @Summary 暂停任务
+// @Description 暂停后不再按计划执行，正在执行的本次不受影响
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "任务名"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已暂停"
+// @Router /api/admin/jobs/{name}/pause [post]
+func PauseJob(c *gin.Context) {
+	updateJob(c, map[string]interface{}{"paused": true}, "已暂停")
+}
+
+// ResumeJob godoc
+// @Summary 恢复任务
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "任务名"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已恢复"
+// @Router /api/admin/jobs/{name}/resume [post]
+func ResumeJob(c *gin.Context) {
+	updateJob(c, map[string]interface{}{"paused": false}, "已恢复")
+}
+
+func updateJob(c *gin.Context, updates map[string]interface{}, msg string) {
+	result := database.DB.Model(&models.ScheduledJob{}).Where("name = ?", c.Param("name")).Updates(updates)
+	if result.Error != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "操作失败: " + result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "任务不存在",
+		})
+		return
+	}
+	if cache.Rdb != nil {
+		cache.Rdb.Publish(context.Background(), jobsWakeChannel, c.Param("name"))
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  msg,
+	})
+}
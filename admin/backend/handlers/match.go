@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/admin/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// 咨询师匹配由 api 服务执行（见 api/matching），排序策略及流量比例在系统配置 match_strategies 中维护，
+// 管理后台按策略汇总匹配请求、展示和由展示产生的预约，用于比较各策略的转化
+
+// matchStrategyStats 单个策略的转化汇总
+type matchStrategyStats struct {
+	Strategy          string  `json:"strategy"`
+	Requests          int64   `json:"requests"`            // 匹配请求数
+	EmptyRequests     int64   `json:"empty_requests"`      // 没有匹配结果的请求数
+	Impressions       int64   `json:"impressions"`         // 展示的咨询师数
+	BookedRequests    int64   `json:"booked_requests"`     // 产生预约的请求数
+	Bookings          int64   `json:"bookings"`            // 预约订单数
+	PaidBookings      int64   `json:"paid_bookings"`       // 已支付的预约订单数
+	BookingRate       float64 `json:"booking_rate"`        // 产生预约的请求占比
+	AvgBookedPosition float64 `json:"avg_booked_position"` // 被预约咨询师的平均展示位置
+}
+
+// GetMatchStats godoc
+// @Summary 匹配策略效果统计
+// @Description 按排序策略汇总时间范围内的匹配请求、展示、预约和支付，并返回当前的策略配置
+// @Tags 咨询师匹配
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param start_date query string false "开始日期(2006-01-02)"
+// @Param end_date query string false "结束日期(2006-01-02)"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{stats,strategies}"
+// @Router /api/admin/match/stats [get]
+func GetMatchStats(c *gin.Context) {
+	requests := database.DB.Model(&models.MatchRequest{})
+	impressions := database.DB.Model(&models.MatchImpression{}).
+		Joins("JOIN match_requests r ON r.id = match_impressions.request_id")
+	if startDate := c.Query("start_date"); startDate != "" {
+		requests = requests.Where("created_at >= ?", startDate)
+		impressions = impressions.Where("r.created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		requests = requests.Where("created_at < DATE_ADD(?, INTERVAL 1 DAY)", endDate)
+		impressions = impressions.Where("r.created_at < DATE_ADD(?, INTERVAL 1 DAY)", endDate)
+	}
+
+	var requestRows []struct {
+		Strategy      string
+		Requests      int64
+		EmptyRequests int64
+	}
+	if err := requests.Select("strategy, COUNT(*) AS requests, COALESCE(SUM(result_count = 0), 0) AS empty_requests").
+		Group("strategy").Scan(&requestRows).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	var impressionRows []struct {
+		Strategy          string
+		Impressions       int64
+		BookedRequests    int64
+		Bookings          int64
+		PaidBookings      int64
+		AvgBookedPosition float64
+	}
+	if err := impressions.Joins("LEFT JOIN orders o ON o.id = match_impressions.order_id").
+		Select(`match_impressions.strategy, COUNT(*) AS impressions,
+			COUNT(DISTINCT IF(match_impressions.order_id IS NOT NULL, match_impressions.request_id, NULL)) AS booked_requests,
+			COUNT(match_impressions.order_id) AS bookings,
+			COALESCE(SUM(o.pay_time IS NOT NULL), 0) AS paid_bookings,
+			COALESCE(AVG(IF(match_impressions.order_id IS NOT NULL, match_impressions.position, NULL)), 0) AS avg_booked_position`).
+		Group("match_impressions.strategy").Scan(&impressionRows).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	byStrategy := make(map[string]*matchStrategyStats)
+	stats := []*matchStrategyStats{}
+	get := func(name string) *matchStrategyStats {
+		if s, ok := byStrategy[name]; ok {
+			return s
+		}
+		s := &matchStrategyStats{Strategy: name}
+		byStrategy[name] = s
+		stats = append(stats, s)
+		return s
+	}
+	for _, r := range requestRows {
+		s := get(r.Strategy)
+		s.Requests, s.EmptyRequests = r.Requests, r.EmptyRequests
+	}
+	for _, r := range impressionRows {
+		s := get(r.Strategy)
+		s.Impressions, s.BookedRequests, s.Bookings, s.PaidBookings = r.Impressions, r.BookedRequests, r.Bookings, r.PaidBookings
+		s.AvgBookedPosition = float64(int(r.AvgBookedPosition*100+0.5)) / 100
+	}
+	for _, s := range stats {
+		if s.Requests > 0 {
+			s.BookingRate = float64(int(float64(s.BookedRequests)/float64(s.Requests)*10000+0.5)) / 10000
+		}
+	}
+
+	var strategies interface{}
+	var config models.SystemConfig
+	if err := database.DB.Where("`key` = ?", "match_strategies").First(&config).Error; err == nil {
+		json.Unmarshal([]byte(config.Value), &strategies)
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"stats":      stats,
+			"strategies": strategies,
+		},
+	})
+}
+
+// GetMatchRequests godoc
+// @Summary 匹配请求记录
+// @Description 分页查看匹配请求（问卷、策略）及展示的咨询师和预约情况
+// @Tags 咨询师匹配
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param strategy query string false "排序策略"
+// @Param user_id query int false "用户ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{requests,total}"
+// @Router /api/admin/match/requests [get]
+func GetMatchRequests(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.MatchRequest{})
+	if strategy := c.Query("strategy"); strategy != "" {
+		query = query.Where("strategy = ?", strategy)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var requests []models.MatchRequest
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id DESC").Find(&requests).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	ids := make([]uint, len(requests))
+	for i, r := range requests {
+		ids[i] = r.ID
+	}
+	var impressions []models.MatchImpression
+	if len(ids) > 0 {
+		database.DB.Where("request_id IN ?", ids).Order("request_id, position").Find(&impressions)
+	}
+	byRequest := make(map[uint][]models.MatchImpression)
+	for _, imp := range impressions {
+		byRequest[imp.RequestID] = append(byRequest[imp.RequestID], imp)
+	}
+
+	items := make([]gin.H, 0, len(requests))
+	for _, r := range requests {
+		list := byRequest[r.ID]
+		if list == nil {
+			list = []models.MatchImpression{}
+		}
+		items = append(items, gin.H{
+			"request":     r,
+			"impressions": list,
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"requests": items,
+			"total":    total,
+		},
+	})
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"akrick.com/mychat/admin/backend/cache"
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/admin/backend/utils"
+	"akrick.com/mychat/admin/backend/websocket"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// 词库变更后通知聊天服务立即重新加载（聊天服务同时会定期比对词库，Redis 不可用时最迟30秒生效）
+const wordsReloadChannel = "moderation:words:reload"
+
+var (
+	sensitiveCategories = map[string]bool{
+		models.SensitiveCategoryCrisis:   true,
+		models.SensitiveCategoryAbuse:    true,
+		models.SensitiveCategoryPorn:     true,
+		models.SensitiveCategoryFraud:    true,
+		models.SensitiveCategoryPolitics: true,
+		models.SensitiveCategoryOther:    true,
+	}
+	moderationActions = map[string]bool{
+		models.ModerationActionBlock: true,
+		models.ModerationActionMask:  true,
+		models.ModerationActionFlag:  true,
+	}
+)
+
+// GetSensitiveWords godoc
+// @Summary 获取敏感词列表
+// @Description 分页获取敏感词列表（管理员）
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param keyword query string false "关键词"
+// @Param category query string false "分类:crisis/abuse/porn/fraud/politics/other"
+// @Param action query string false "动作:block/mask/flag"
+// @Param status query int false "状态:0-停用,1-启用"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{words,total}"
+// @Router /api/admin/moderation/words [get]
+func GetSensitiveWords(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.SensitiveWord{})
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("word LIKE ?", "%"+keyword+"%")
+	}
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var words []models.SensitiveWord
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id DESC").Find(&words).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"words": words,
+			"total": total,
+		},
+	})
+}
+
+// CreateSensitiveWords godoc
+// @Summary 添加敏感词
+// @Description 批量添加同一分类、同一动作的敏感词，已存在的词会更新为新的分类和动作
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body map[string]interface{} true "words:词列表,category:分类,action:动作,remark:备注"
+// @Success 200 {object} map[string]interface{} "code:200,msg:添加成功,data:{count}"
+// @Router /api/admin/moderation/words [post]
+func CreateSensitiveWords(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
+
+	var req struct {
+		Words    []string `json:"words" binding:"required,min=1"`
+		Category string   `json:"category" binding:"required"`
+		Action   string   `json:"action" binding:"required"`
+		Remark   string   `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if !sensitiveCategories[req.Category] || !moderationActions[req.Action] {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "分类或动作不合法",
+		})
+		return
+	}
+
+	words := make([]models.SensitiveWord, 0, len(req.Words))
+	seen := make(map[string]bool, len(req.Words))
+	for _, w := range req.Words {
+		w = strings.TrimSpace(w)
+		if w == "" || seen[w] || len([]rune(w)) > 100 {
+			continue
+		}
+		seen[w] = true
+		words = append(words, models.SensitiveWord{
+			Word:      w,
+			Category:  req.Category,
+			Action:    req.Action,
+			Status:    1,
+			Remark:    req.Remark,
+			CreatedBy: adminID.(uint),
+		})
+	}
+	if len(words) == 0 {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "没有有效的敏感词",
+		})
+		return
+	}
+
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "word"}},
+		DoUpdates: clause.AssignmentColumns([]string{"category", "action", "status", "remark", "updated_at"}),
+	}).CreateInBatches(&words, 200).Error
+	if err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "添加失败: " + err.Error(),
+		})
+		return
+	}
+
+	notifyWordsReload()
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "添加成功",
+		"data": gin.H{
+			"count": len(words),
+		},
+	})
+}
+
+// UpdateSensitiveWord godoc
+// @Summary 更新敏感词
+// @Description 修改敏感词的分类、动作、状态或备注
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "敏感词ID"
+// @Param request body map[string]interface{} true "category,action,status,remark"
+// @Success 200 {object} map[string]interface{} "code:200,msg:更新成功"
+// @Router /api/admin/moderation/words/{id} [put]
+func UpdateSensitiveWord(c *gin.Context) {
+	var word models.SensitiveWord
+	if err := database.DB.First(&word, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "敏感词不存在",
+		})
+		return
+	}
+
+	var req struct {
+		Category *string `json:"category"`
+		Action   *string `json:"action"`
+		Status   *int    `json:"status" binding:"omitempty,oneof=0 1"`
+		Remark   *string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Category != nil {
+		if !sensitiveCategories[*req.Category] {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "分类不合法",
+			})
+			return
+		}
+		updates["category"] = *req.Category
+	}
+	if req.Action != nil {
+		if !moderationActions[*req.Action] {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "动作不合法",
+			})
+			return
+		}
+		updates["action"] = *req.Action
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+	if req.Remark != nil {
+		updates["remark"] = *req.Remark
+	}
+
+	if err := database.DB.Model(&word).Updates(updates).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "更新失败: " + err.Error(),
+		})
+		return
+	}
+
+	notifyWordsReload()
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+	})
+}
+
+// DeleteSensitiveWord godoc
+// @Summary 删除敏感词
+// @Description 删除敏感词
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "敏感词ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:删除成功"
+// @Router /api/admin/moderation/words/{id} [delete]
+func DeleteSensitiveWord(c *gin.Context) {
+	if err := database.DB.Delete(&models.SensitiveWord{}, c.Param("id")).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "删除失败: " + err.Error(),
+		})
+		return
+	}
+
+	notifyWordsReload()
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// GetModerationIncidents godoc
+// @Summary 获取审核事件列表
+// @Description 分页获取内容审核事件（拦截、标记、危机信号），危机事件排在最前
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param status query int false "状态:0-待处理,1-处理中,2-已处理,3-误报"
+// @Param severity query int false "严重程度:1-一般,2-严重,3-危机"
+// @Param category query string false "分类"
+// @Param session_id query int false "会话ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{incidents,total,on_duty}"
+// @Router /api/admin/moderation/incidents [get]
+func GetModerationIncidents(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.ModerationIncident{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if sessionID := c.Query("session_id"); sessionID != "" {
+		query = query.Where("session_id = ?", sessionID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var incidents []models.ModerationIncident
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).
+		Order("status ASC, severity DESC, id DESC").Find(&incidents).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"incidents": incidents,
+			"total":     total,
+			"on_duty":   websocket.OnDutyAdmins(),
+		},
+	})
+}
+
+// GetModerationIncident godoc
+// @Summary 获取审核事件详情
+// @Description 获取审核事件详情及会话上下文（事件前后各10条消息）
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "事件ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{incident,session,context}"
+// @Router /api/admin/moderation/incidents/{id} [get]
+func GetModerationIncident(c *gin.Context) {
+	var incident models.ModerationIncident
+	if err := database.DB.First(&incident, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "事件不存在",
+		})
+		return
+	}
+
+	var session models.ChatSession
+	database.DB.Preload("User").Preload("Counselor").First(&session, incident.SessionID)
+
+	// 会话上下文：以事件时间为界前后各取10条
+	var before, after []models.ChatMessage
+	database.DB.Where("session_id = ? AND created_at <= ?", incident.SessionID, incident.CreatedAt).
+		Order("created_at DESC").Limit(10).Find(&before)
+	database.DB.Where("session_id = ? AND created_at > ?", incident.SessionID, incident.CreatedAt).
+		Order("created_at ASC").Limit(10).Find(&after)
+	messages := make([]models.ChatMessage, 0, len(before)+len(after))
+	for i := len(before) - 1; i >= 0; i-- {
+		messages = append(messages, before[i])
+	}
+	messages = append(messages, after...)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"incident": incident,
+			"session":  session,
+			"context":  messages,
+		},
+	})
+}
+
+// HandleModerationIncident godoc
+// @Summary 处理审核事件
+// @Description 更新审核事件的处理状态并填写处理备注
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "事件ID"
+// @Param request body map[string]interface{} true "status:1-处理中,2-已处理,3-误报;note:处理备注"
+// @Success 200 {object} map[string]interface{} "code:200,msg:处理成功"
+// @Router /api/admin/moderation/incidents/{id}/handle [put]
+func HandleModerationIncident(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
+
+	var req struct {
+		Status int    `json:"status" binding:"required,oneof=1 2 3"`
+		Note   string `json:"note" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var incident models.ModerationIncident
+	if err := database.DB.First(&incident, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "事件不存在",
+		})
+		return
+	}
+
+	handlerID := adminID.(uint)
+	now := time.Now()
+	if err := database.DB.Model(&incident).Updates(map[string]interface{}{
+		"status":      req.Status,
+		"handle_note": req.Note,
+		"handler_id":  handlerID,
+		"handled_at":  now,
+	}).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "处理失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "处理成功",
+	})
+}
+
+// notifyWordsReload 通知聊天服务重新加载词库
+func notifyWordsReload() {
+	if cache.Rdb != nil {
+		cache.Rdb.Publish(context.Background(), wordsReloadChannel, time.Now().Unix())
+	}
+}
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 	"akrick.com/mychat/admin/backend/cache"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	apimodels "akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -20,7 +23,8 @@ type CreateOrderRequest struct {
 }
 
 type UpdateOrderRequest struct {
-	Status int `json:"status" binding:"required,oneof=0 1 2 3 4"`
+	Status int    `json:"status" binding:"required,oneof=0 1 2 3 4"`
+	Reason string `json:"reason" binding:"max=255"`
 }
 
 // CreateOrder godoc
@@ -74,18 +78,28 @@ func CreateOrder(c *gin.Context) {
 	orderNo := fmt.Sprintf("ORD%d%d", time.Now().Unix(), userID.(uint))
 
 	// 创建订单
-	order := models.Order{
+	order := apimodels.Order{
 		OrderNo:      orderNo,
 		UserID:       userID.(uint),
 		CounselorID:  req.CounselorID,
 		Duration:     req.Duration,
 		Amount:       amount,
+		UnitPrice:    counselor.Price,
 		Status:       models.OrderStatusPending,
 		ScheduleTime: req.ScheduleTime,
 		Notes:        req.Notes,
 	}
 
-	if err := database.DB.Create(&order).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		return orderflow.Record(tx, &order, orderflow.Request{
+			Event: models.OrderEventCreate,
+			Actor: orderflow.Actor{Type: models.OrderActorUser, ID: order.UserID},
+		})
+	})
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "创建订单失败: " + err.Error(),
@@ -353,7 +367,6 @@ func GetCounselorOrders(c *gin.Context) {
 func UpdateOrderStatus(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	orderID := c.Param("id")
-	ctx := context.Background()
 
 	var req UpdateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -365,7 +378,7 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// 查询订单
-	var order models.Order
+	var order apimodels.Order
 	if err := database.DB.First(&order, orderID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
@@ -383,30 +396,24 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// 更新订单状态
-	updates := map[string]interface{}{
-		"status": req.Status,
-	}
-
-	// 如果是已支付状态，记录支付时间
-	if req.Status == models.OrderStatusPaid {
-		now := time.Now()
-		updates["pay_time"] = &now
-	}
-
-	if err := database.DB.Model(&order).Updates(updates).Error; err != nil {
-		c.JSON(500, gin.H{
-			"code": 500,
-			"msg":  "更新失败: " + err.Error(),
+	actor := orderflow.Actor{Type: models.OrderActorCounselor, ID: order.CounselorID}
+	event, ok := orderflow.EventFor(&order, req.Status, actor)
+	if !ok {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "当前订单状态不允许变更为该状态",
 		})
 		return
 	}
 
-	// 删除缓存
-	if cache.Rdb != nil {
-		cache.DeleteOrderCache(ctx, order.ID)
-		cache.InvalidateUserOrdersCache(ctx, order.UserID)
-		cache.InvalidateCounselorOrdersCache(ctx, order.CounselorID)
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID: order.ID,
+		Event:   event,
+		Actor:   actor,
+		Reason:  req.Reason,
+	}); err != nil {
+		respondOrderError(c, err)
+		return
 	}
 
 	c.JSON(200, gin.H{
@@ -432,7 +439,20 @@ func UpdateOrderStatus(c *gin.Context) {
 func CancelOrder(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	orderID := c.Param("id")
-	ctx := context.Background()
+
+	// 取消原因可选，允许空请求体
+	var req struct {
+		Reason string `json:"reason" binding:"max=255"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
 
 	var order models.Order
 	if err := database.DB.First(&order, orderID).Error; err != nil {
@@ -452,33 +472,44 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
-	// 检查订单状态
-	if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaid {
-		c.JSON(400, gin.H{
-			"code": 400,
-			"msg":  "当前状态不允许取消订单",
-		})
+	// 已支付订单取消时由状态机自动退款
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID: order.ID,
+		Event:   models.OrderEventCancel,
+		Actor:   orderflow.Actor{Type: models.OrderActorUser, ID: userID.(uint)},
+		Reason:  req.Reason,
+	}); err != nil {
+		respondOrderError(c, err)
 		return
 	}
 
-	if err := database.DB.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "取消成功",
+	})
+}
+
+// respondOrderError 将订单状态机错误映射为HTTP响应
+func respondOrderError(c *gin.Context, err error) {
+	code := 400
+	switch {
+	case errors.Is(err, orderflow.ErrNotFound):
+		code = 404
+	case errors.Is(err, orderflow.ErrForbidden):
+		code = 403
+	case errors.Is(err, orderflow.ErrInvalidTransition), errors.Is(err, orderflow.ErrScheduleStarted),
+		errors.Is(err, orderflow.ErrScheduleNotReached), errors.Is(err, orderflow.ErrRefundAmount),
+		errors.Is(err, orderflow.ErrSessionStarted), errors.Is(err, orderflow.ErrPackageOrder):
+	default:
 		c.JSON(500, gin.H{
 			"code": 500,
-			"msg":  "取消失败: " + err.Error(),
+			"msg":  "操作失败: " + err.Error(),
 		})
 		return
 	}
-
-	// 删除缓存
-	if cache.Rdb != nil {
-		cache.DeleteOrderCache(ctx, order.ID)
-		cache.InvalidateUserOrdersCache(ctx, order.UserID)
-		cache.InvalidateCounselorOrdersCache(ctx, order.CounselorID)
-	}
-
-	c.JSON(200, gin.H{
-		"code": 200,
-		"msg":  "取消成功",
+	c.JSON(code, gin.H{
+		"code": code,
+		"msg":  err.Error(),
 	})
 }
 
@@ -1,28 +1,32 @@
 package handlers
 
 import (
-	"fmt"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
-	"akrick.com/mychat/admin/backend/utils"
+	apimodels "akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
 	"github.com/gin-gonic/gin"
 )
 
 // OrderValidation 订单验证工具
+// 状态相关的校验委托给订单状态机，这里只补充状态机之外的业务规则
 type OrderValidation struct {
-	Order    *models.Order
+	Order     *apimodels.Order
 	Counselor *models.Counselor
-	Errors   []string
+	Actor     orderflow.Actor
+	Errors    []string
 }
 
-// NewOrderValidation 创建订单验证器
+// NewOrderValidation 创建订单验证器，默认以管理员身份校验
 func NewOrderValidation(orderID uint) *OrderValidation {
 	v := &OrderValidation{
+		Actor:  orderflow.Actor{Type: models.OrderActorAdmin},
 		Errors: make([]string, 0),
 	}
 
 	// 查询订单
 	if err := database.DB.First(&v.Order, orderID).Error; err != nil {
+		v.Order = nil
 		v.Errors = append(v.Errors, "订单不存在")
 		return v
 	}
@@ -33,15 +37,22 @@ func NewOrderValidation(orderID uint) *OrderValidation {
 	return v
 }
 
-// CanPay 检查订单是否可以支付
-func (v *OrderValidation) CanPay() bool {
+// can 按状态机校验事件是否可执行
+func (v *OrderValidation) can(event string, actor orderflow.Actor) bool {
 	if v.Order == nil {
 		v.Errors = append(v.Errors, "订单不存在")
 		return false
 	}
+	if err := orderflow.Check(v.Order, event, actor); err != nil {
+		v.Errors = append(v.Errors, err.Error())
+		return false
+	}
+	return true
+}
 
-	if v.Order.Status != models.OrderStatusPending {
-		v.Errors = append(v.Errors, "订单状态不允许支付")
+// CanPay 检查订单是否可以支付（支付由支付回调以系统身份推进）
+func (v *OrderValidation) CanPay() bool {
+	if !v.can(models.OrderEventPay, orderflow.System) {
 		return false
 	}
 
@@ -55,38 +66,12 @@ func (v *OrderValidation) CanPay() bool {
 
 // CanCancel 检查订单是否可以取消
 func (v *OrderValidation) CanCancel() bool {
-	if v.Order == nil {
-		v.Errors = append(v.Errors, "订单不存在")
-		return false
-	}
-
-	if v.Order.Status != models.OrderStatusPending && v.Order.Status != models.OrderStatusPaid {
-		v.Errors = append(v.Errors, "订单状态不允许取消")
-		return false
-	}
-
-	// 检查预约时间，如果预约时间在24小时内，不允许取消
-	if v.Order.ScheduleTime.Before(utils.GetPaymentExpiryTime()) {
-		v.Errors = append(v.Errors, "预约时间过近，无法取消")
-		return false
-	}
-
-	return true
+	return v.can(models.OrderEventCancel, v.Actor)
 }
 
 // CanRefund 检查订单是否可以退款
 func (v *OrderValidation) CanRefund() bool {
-	if v.Order == nil {
-		v.Errors = append(v.Errors, "订单不存在")
-		return false
-	}
-
-	if v.Order.Status != models.OrderStatusPaid && v.Order.Status != models.OrderStatusCompleted {
-		v.Errors = append(v.Errors, "订单状态不允许退款")
-		return false
-	}
-
-	return true
+	return v.can(models.OrderEventRefund, v.Actor)
 }
 
 // CanReview 检查订单是否可以评价
@@ -113,17 +98,7 @@ func (v *OrderValidation) CanReview() bool {
 
 // CanComplete 检查订单是否可以完成
 func (v *OrderValidation) CanComplete() bool {
-	if v.Order == nil {
-		v.Errors = append(v.Errors, "订单不存在")
-		return false
-	}
-
-	if v.Order.Status != models.OrderStatusPaid {
-		v.Errors = append(v.Errors, "订单未支付，无法完成")
-		return false
-	}
-
-	return true
+	return v.can(models.OrderEventComplete, v.Actor)
 }
 
 // ValidateOrderStatus godoc
@@ -161,8 +136,13 @@ func ValidateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// 创建验证器
+	// 创建验证器，按请求人在订单中的角色校验
 	validation := NewOrderValidation(order.ID)
+	if order.UserID == userID.(uint) {
+		validation.Actor = orderflow.Actor{Type: models.OrderActorUser, ID: order.UserID}
+	} else {
+		validation.Actor = orderflow.Actor{Type: models.OrderActorCounselor, ID: order.CounselorID}
+	}
 
 	var valid bool
 	switch action {
@@ -204,21 +184,17 @@ func ValidateOrderStatus(c *gin.Context) {
 
 // GetOrderTimeline godoc
 // @Summary 获取订单时间线
-// @Description 获取订单的状态变化时间线
-// @Tags 订单
+// @Description 按订单事件流返回时间线，包含每一步的操作人和原因（管理员接口）
+// @Tags 订单管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "订单ID"
 // @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{timeline}"
-// @Router /api/order/{id}/timeline [get]
+// @Router /api/admin/orders/{id}/timeline [get]
 func GetOrderTimeline(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	orderID := c.Param("id")
-
-	// 查询订单
 	var order models.Order
-	if err := database.DB.Preload("User").Preload("Counselor").First(&order, orderID).Error; err != nil {
+	if err := database.DB.First(&order, c.Param("id")).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
 			"msg":  "订单不存在",
@@ -226,60 +202,29 @@ func GetOrderTimeline(c *gin.Context) {
 		return
 	}
 
-	// 检查权限
-	if order.UserID != userID.(uint) && order.CounselorID != userID.(uint) {
-		c.JSON(403, gin.H{
-			"code": 403,
-			"msg":  "无权访问此订单",
+	events, err := orderflow.Events(order.ID)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
 		})
 		return
 	}
 
-	// 构建时间线
-	timeline := make([]map[string]interface{}, 0)
-
-	// 创建订单
-	timeline = append(timeline, map[string]interface{}{
-		"event":   "创建订单",
-		"time":    order.CreatedAt,
-		"message": fmt.Sprintf("用户 %s 创建了订单", order.User.Username),
-	})
-
-	// 支付订单
-	if order.PayTime != nil {
-		timeline = append(timeline, map[string]interface{}{
-			"event":   "支付订单",
-			"time":    *order.PayTime,
-			"message": fmt.Sprintf("订单已支付，金额：%.2f元", order.Amount),
-		})
-	}
-
-	// 预约时间
-	timeline = append(timeline, map[string]interface{}{
-		"event":   "预约咨询",
-		"time":    order.ScheduleTime,
-		"message": fmt.Sprintf("预约咨询时间：%s", order.ScheduleTime.Format("2006-01-02 15:04:05")),
-	})
-
-	// 根据订单状态添加时间线
-	switch order.Status {
-	case models.OrderStatusCompleted:
-		timeline = append(timeline, map[string]interface{}{
-			"event":   "完成咨询",
-			"time":    order.UpdatedAt,
-			"message": fmt.Sprintf("咨询已完成，咨询师：%s", order.Counselor.Name),
-		})
-	case models.OrderStatusCancelled:
-		timeline = append(timeline, map[string]interface{}{
-			"event":   "取消订单",
-			"time":    order.UpdatedAt,
-			"message": "订单已取消",
-		})
-	case models.OrderStatusRefunded:
-		timeline = append(timeline, map[string]interface{}{
-			"event":   "退款成功",
-			"time":    order.UpdatedAt,
-			"message": "订单已退款",
+	timeline := make([]gin.H, 0, len(events))
+	for i := range events {
+		e := &events[i]
+		timeline = append(timeline, gin.H{
+			"event":       e.Event,
+			"title":       orderflow.Title(e.Event),
+			"message":     orderflow.Describe(e),
+			"time":        e.CreatedAt,
+			"actor_type":  e.ActorType,
+			"actor_id":    e.ActorID,
+			"from_status": e.FromStatus,
+			"to_status":   e.ToStatus,
+			"reason":      e.Reason,
+			"metadata":    e.Metadata,
 		})
 	}
 
@@ -2,15 +2,24 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 	"akrick.com/mychat/admin/backend/cache"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	apimodels "akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+func init() {
+	orderflow.RefundGateway = channelRefund
+}
+
 type CreatePaymentRequest struct {
 	OrderID       uint   `json:"order_id" binding:"required"`
 	PaymentMethod string `json:"payment_method" binding:"required,oneof=wechat alipay"`
@@ -51,7 +60,7 @@ func CreatePayment(c *gin.Context) {
 	}
 
 	// 查询订单信息
-	var order models.Order
+	var order apimodels.Order
 	if err := database.DB.First(&order, req.OrderID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
@@ -101,6 +110,13 @@ func CreatePayment(c *gin.Context) {
 		return
 	}
 
+	orderflow.Record(database.DB, &order, orderflow.Request{
+		Event:    models.OrderEventPaymentCreate,
+		Actor:    orderflow.Actor{Type: models.OrderActorUser, ID: order.UserID},
+		Amount:   payment.Amount,
+		Metadata: map[string]interface{}{"payment_no": payment.PaymentNo, "payment_method": payment.PaymentMethod},
+	})
+
 	var payURL string
 	var payParams map[string]string
 
@@ -176,7 +192,7 @@ func WeChatPayCallback(c *gin.Context) {
 		"notify_data":   string(notifyData),
 	}
 
-	if err := database.DB.Model(&payment).Updates(updates).Error; err != nil {
+	if err := confirmPayment(&payment, updates); err != nil {
 		c.XML(200, gin.H{
 			"return_code": "FAIL",
 			"return_msg":  "更新支付记录失败",
@@ -184,20 +200,6 @@ func WeChatPayCallback(c *gin.Context) {
 		return
 	}
 
-	// 更新订单状态
-	var order models.Order
-	if err := database.DB.First(&order, payment.OrderID).Error; err == nil {
-		database.DB.Model(&order).Updates(map[string]interface{}{
-			"status":   models.OrderStatusPaid,
-			"pay_time": &now,
-		})
-
-		// 清除缓存
-		cache.DeleteOrderCache(ctx, order.ID)
-		cache.InvalidateUserOrdersCache(ctx, order.UserID)
-		cache.InvalidateCounselorOrdersCache(ctx, order.CounselorID)
-	}
-
 	// 清除支付缓存
 	cache.DeletePaymentCache(ctx, payment.ID)
 
@@ -261,25 +263,11 @@ func AlipayCallback(c *gin.Context) {
 		updates["notify_data"] = string(notifyBytes)
 	}
 
-	if err := database.DB.Model(&payment).Updates(updates).Error; err != nil {
+	if err := confirmPayment(&payment, updates); err != nil {
 		c.String(200, "fail")
 		return
 	}
 
-	// 更新订单状态
-	var order models.Order
-	if err := database.DB.First(&order, payment.OrderID).Error; err == nil {
-		database.DB.Model(&order).Updates(map[string]interface{}{
-			"status":   models.OrderStatusPaid,
-			"pay_time": &now,
-		})
-
-		// 清除缓存
-		cache.DeleteOrderCache(ctx, order.ID)
-		cache.InvalidateUserOrdersCache(ctx, order.UserID)
-		cache.InvalidateCounselorOrdersCache(ctx, order.CounselorID)
-	}
-
 	// 清除支付缓存
 	cache.DeletePaymentCache(ctx, payment.ID)
 
@@ -370,7 +358,7 @@ func GetPaymentStatus(c *gin.Context) {
 // @Security BearerAuth
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Param status query int false "支付状态:0-待支付,1-已支付,2-支付失败,3-已退款,4-已取消"
+// @Param status query int false "支付状态:0-待支付,1-已支付,2-支付失败,3-已退款,4-已取消,5-退款中"
 // @Param payment_method query string false "支付方式:wechat/alipay"
 // @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{payments,total}"
 // @Failure 401 {object} map[string]interface{} "未授权"
@@ -439,7 +427,6 @@ func GetUserPayments(c *gin.Context) {
 // @Router /api/payment/refund [post]
 func RefundPayment(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	ctx := context.Background()
 
 	var req RefundPaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -451,7 +438,7 @@ func RefundPayment(c *gin.Context) {
 	}
 
 	// 查询支付记录
-	var payment models.Payment
+	var payment apimodels.Payment
 	if err := database.DB.Preload("Order").First(&payment, req.PaymentID).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
@@ -487,48 +474,28 @@ func RefundPayment(c *gin.Context) {
 		return
 	}
 
-	// 调用第三方退款接口（这里模拟）
-	var refundSuccess bool
-	if payment.PaymentMethod == models.PaymentMethodWeChat {
-		refundSuccess = weChatRefund(&payment, req.RefundAmount, req.RefundReason)
-	} else if payment.PaymentMethod == models.PaymentMethodAlipay {
-		refundSuccess = alipayRefund(&payment, req.RefundAmount, req.RefundReason)
-	}
-
-	if !refundSuccess {
-		c.JSON(500, gin.H{
-			"code": 500,
-			"msg":  "退款失败",
-		})
-		return
-	}
-
-	// 更新支付状态
-	updates := map[string]interface{}{
-		"status": models.PaymentStatusRefunded,
-	}
+	// 先记录退款申请，无论渠道退款成功与否都可追溯
+	actor := orderflow.Actor{Type: models.OrderActorUser, ID: userID.(uint)}
+	orderflow.Record(database.DB, &payment.Order, orderflow.Request{
+		Event:    models.OrderEventRefundRequest,
+		Actor:    actor,
+		Reason:   req.RefundReason,
+		Amount:   req.RefundAmount,
+		Metadata: map[string]interface{}{"payment_no": payment.PaymentNo},
+	})
 
-	if err := database.DB.Model(&payment).Updates(updates).Error; err != nil {
-		c.JSON(500, gin.H{
-			"code": 500,
-			"msg":  "更新支付记录失败: " + err.Error(),
-		})
+	// 通过订单状态机退款（调用支付渠道并更新支付记录）
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID: payment.OrderID,
+		Event:   models.OrderEventRefund,
+		Actor:   actor,
+		Reason:  req.RefundReason,
+		Amount:  req.RefundAmount,
+	}); err != nil {
+		respondOrderError(c, err)
 		return
 	}
 
-	// 更新订单状态
-	if payment.Order.ID != 0 {
-		database.DB.Model(&payment.Order).Update("status", models.OrderStatusRefunded)
-
-		// 清除缓存
-		cache.DeleteOrderCache(ctx, payment.Order.ID)
-		cache.InvalidateUserOrdersCache(ctx, payment.Order.UserID)
-		cache.InvalidateCounselorOrdersCache(ctx, payment.Order.CounselorID)
-	}
-
-	// 清除支付缓存
-	cache.DeletePaymentCache(ctx, payment.ID)
-
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "退款申请成功",
@@ -536,7 +503,7 @@ func RefundPayment(c *gin.Context) {
 }
 
 // createWeChatPayment 创建微信支付
-func createWeChatPayment(order *models.Order, payment *models.Payment, clientIP string) (string, map[string]string) {
+func createWeChatPayment(order *apimodels.Order, payment *models.Payment, clientIP string) (string, map[string]string) {
 	// 初始化微信支付
 	wechatPay := utils.NewWeChatPay(
 		"wx_app_id",
@@ -580,7 +547,7 @@ func createWeChatPayment(order *models.Order, payment *models.Payment, clientIP
 }
 
 // createAlipayPayment 创建支付宝支付
-func createAlipayPayment(order *models.Order, payment *models.Payment, returnURL string) (string, map[string]string) {
+func createAlipayPayment(order *apimodels.Order, payment *models.Payment, returnURL string) (string, map[string]string) {
 	// 初始化支付宝
 	alipay := utils.NewAlipay(
 		"alipay_app_id",
@@ -621,14 +588,56 @@ func createAlipayPayment(order *models.Order, payment *models.Payment, returnURL
 	return payURL, payParams
 }
 
+// confirmPayment 记录支付成功并推进订单状态
+// 订单已不在待支付状态（如超时取消后才收到回调）时只记录支付，留待人工退款
+func confirmPayment(payment *models.Payment, updates map[string]interface{}) error {
+	var order *apimodels.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(payment).Updates(updates).Error; err != nil {
+			return err
+		}
+		var err error
+		order, err = orderflow.FireTx(tx, orderflow.Request{
+			OrderID: payment.OrderID,
+			Event:   models.OrderEventPay,
+			Actor:   orderflow.System,
+			Metadata: map[string]interface{}{
+				"payment_no":     payment.PaymentNo,
+				"payment_method": payment.PaymentMethod,
+				"transaction_id": updates["transaction_id"],
+			},
+		})
+		if errors.Is(err, orderflow.ErrInvalidTransition) || errors.Is(err, orderflow.ErrNotFound) {
+			log.Printf("支付成功但订单无法置为已支付，需人工处理: paymentNo=%s, orderID=%d, err=%v", payment.PaymentNo, payment.OrderID, err)
+			return nil
+		}
+		return err
+	})
+	if err == nil {
+		orderflow.Invalidate(order)
+	}
+	return err
+}
+
+// channelRefund 按支付方式调用对应渠道退款
+func channelRefund(payment *apimodels.Payment, amount float64, reason string) bool {
+	switch payment.PaymentMethod {
+	case models.PaymentMethodWeChat:
+		return weChatRefund(payment, amount, reason)
+	case models.PaymentMethodAlipay:
+		return alipayRefund(payment, amount, reason)
+	}
+	return false
+}
+
 // weChatRefund 微信退款（模拟）
-func weChatRefund(payment *models.Payment, refundAmount float64, reason string) bool {
-	// 实际项目中需要调用微信退款API
+func weChatRefund(payment *apimodels.Payment, refundAmount float64, reason string) bool {
+	// 实际项目中需要调用微信退款API，以 payment.RefundNo 作为商户退款单号保证幂等
 	return true
 }
 
 // alipayRefund 支付宝退款（模拟）
-func alipayRefund(payment *models.Payment, refundAmount float64, reason string) bool {
-	// 实际项目中需要调用支付宝退款API
+func alipayRefund(payment *apimodels.Payment, refundAmount float64, reason string) bool {
+	// 实际项目中需要调用支付宝退款API，以 payment.RefundNo 作为退款请求号保证幂等
 	return true
 }
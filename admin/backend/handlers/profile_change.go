@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"akrick.com/mychat/admin/backend/cache"
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/admin/backend/utils"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 咨询师的职称、简介、擅长领域、头像、单价和定价规则的修改（咨询师在 api 服务提交，或管理员在咨询师编辑中修改）记为 CounselorProfileChange，
+// 审核通过后才更新到咨询师资料；管理员提交的修改须由其他管理员审核。单价只影响之后创建的订单，已下单的咨询按订单记录的单价计费
+
+var (
+	errProfileChangeNotFound = errors.New("资料修改不存在")
+	errProfileChangeReviewed = errors.New("该资料修改已处理")
+	errProfileChangeSelf     = errors.New("不能审核自己提交的资料修改")
+	errProfileChangePending  = errors.New("该咨询师已有待审核的资料修改，请先处理")
+)
+
+// profileFieldLabels 须经审核字段的名称
+var profileFieldLabels = map[string]string{
+	models.ProfileFieldTitle:      "职称",
+	models.ProfileFieldBio:        "个人简介",
+	models.ProfileFieldSpecialty:  "擅长领域",
+	models.ProfileFieldAvatar:     "头像",
+	models.ProfileFieldPrice:      "单价(元/分钟)",
+	models.ProfileFieldPriceRules: "定价规则",
+}
+
+// ReviewProfileChangeRequest 审核资料修改
+type ReviewProfileChangeRequest struct {
+	Action  string `json:"action" binding:"required,oneof=approve reject"`
+	Comment string `json:"comment" binding:"max=500"`
+}
+
+// profileFieldDiff 单个字段的修改对比
+type profileFieldDiff struct {
+	Field   string      `json:"field"`
+	Label   string      `json:"label"`
+	Old     interface{} `json:"old"`     // 提交时的值
+	Current interface{} `json:"current"` // 咨询师资料当前的值
+	New     interface{} `json:"new"`     // 申请修改为的值
+	Stale   bool        `json:"stale"`   // 提交后资料已被其他途径修改，当前值与提交时不同
+}
+
+// GetProfileChangeList godoc
+// @Summary 咨询师资料修改列表
+// @Description 分页查看咨询师提交或管理员发起的资料修改，默认按提交时间倒序
+// @Tags 咨询师资料审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param status query int false "状态:0-待审核,1-已通过,2-已拒绝,3-已撤回"
+// @Param counselor_id query int false "咨询师ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{changes,total}"
+// @Router /api/admin/counselor/profile-changes [get]
+func GetProfileChangeList(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.CounselorProfileChange{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if counselorID := c.Query("counselor_id"); counselorID != "" {
+		query = query.Where("counselor_id = ?", counselorID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var changes []models.CounselorProfileChange
+	if err := query.Preload("Counselor").Order("id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&changes).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"changes": changes,
+			"total":   total,
+		},
+	})
+}
+
+// GetProfileChangeDetail godoc
+// @Summary 咨询师资料修改详情
+// @Description 返回修改申请和逐字段对比：提交时的值、咨询师资料当前的值和申请修改为的值
+// @Tags 咨询师资料审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "修改申请ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{change,diff}"
+// @Failure 404 {object} map[string]interface{} "资料修改不存在"
+// @Router /api/admin/counselor/profile-changes/{id} [get]
+func GetProfileChangeDetail(c *gin.Context) {
+	var change models.CounselorProfileChange
+	if err := database.DB.Preload("Counselor").First(&change, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  errProfileChangeNotFound.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"change": change,
+			"diff":   profileChangeDiff(&change, &change.Counselor),
+		},
+	})
+}
+
+// ReviewProfileChange godoc
+// @Summary 审核咨询师资料修改
+// @Description approve 将修改更新到咨询师资料（擅长领域同时重建擅长领域标签），reject 须填写意见；结果通知咨询师
+// @Tags 咨询师资料审核
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "修改申请ID"
+// @Param request body ReviewProfileChangeRequest true "审核决定:approve/reject"
+// @Success 200 {object} map[string]interface{} "code:200,msg:审核成功,data:change"
+// @Failure 400 {object} map[string]interface{} "已处理"
+// @Failure 403 {object} map[string]interface{} "不能审核自己提交的修改"
+// @Router /api/admin/counselor/profile-changes/{id}/review [post]
+func ReviewProfileChange(c *gin.Context) {
+	adminID, _ := c.Get("admin_id")
+	reviewerID := adminID.(uint)
+
+	var req ReviewProfileChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.Action == "reject" && req.Comment == "" {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "拒绝时须填写审核意见",
+		})
+		return
+	}
+
+	var change models.CounselorProfileChange
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&change, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errProfileChangeNotFound
+			}
+			return err
+		}
+		if change.Status != models.ProfileChangeStatusPending {
+			return errProfileChangeReviewed
+		}
+		if change.SubmitterType == models.ProfileChangeSubmitterAdmin && change.SubmitterID == reviewerID {
+			return errProfileChangeSelf
+		}
+		var counselor models.Counselor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&counselor, change.CounselorID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		status := models.ProfileChangeStatusRejected
+		title, content := "资料修改未通过", "您提交的资料修改未通过审核，原因："+req.Comment
+		if req.Action == "approve" {
+			status = models.ProfileChangeStatusApproved
+			title, content = "资料修改已生效", "您提交的资料修改已通过审核并更新到咨询师主页"
+			proposed := change.Proposed()
+			// 提交后等级可能已调整，按当前等级重新校验单价区间
+			if change.Price != nil || change.PriceRules != nil {
+				if err := checkPriceBand(tx, &counselor, &change); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&counselor).Updates(proposed).Error; err != nil {
+				return err
+			}
+			if specialty, ok := proposed[models.ProfileFieldSpecialty]; ok {
+				if err := replaceCounselorTags(tx, counselor.ID, models.CounselorTagSpecialty, models.SplitSpecialty(specialty.(string))); err != nil {
+					return err
+				}
+			}
+			if price, ok := proposed[models.ProfileFieldPrice]; ok {
+				content += fmt.Sprintf("，新单价 %.2f 元/分钟对之后的预约生效，已下单的咨询仍按原单价计费", price.(float64))
+			} else if _, ok := proposed[models.ProfileFieldPriceRules]; ok {
+				content += "，新定价规则对之后的预约生效，已下单的咨询仍按原单价计费"
+			}
+		}
+		if err := tx.Model(&change).Updates(map[string]interface{}{
+			"status":         status,
+			"review_comment": req.Comment,
+			"reviewed_by":    reviewerID,
+			"reviewed_at":    &now,
+		}).Error; err != nil {
+			return err
+		}
+		if counselor.UserID == 0 {
+			return nil
+		}
+		return tx.Create(&models.Notification{
+			UserID:  counselor.UserID,
+			Type:    models.NotificationTypeSystem,
+			Level:   models.NotificationLevelInfo,
+			Title:   title,
+			Content: content,
+		}).Error
+	})
+	switch {
+	case errors.Is(err, errProfileChangeNotFound):
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  err.Error(),
+		})
+		return
+	case errors.Is(err, errProfileChangeSelf):
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  err.Error(),
+		})
+		return
+	case errors.Is(err, errProfileChangeReviewed), errors.Is(err, errPriceOutOfBand):
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "审核失败: " + err.Error(),
+		})
+		return
+	}
+
+	if change.Status == models.ProfileChangeStatusApproved {
+		if cache.Rdb != nil {
+			cache.DeleteCounselorCache(context.Background(), change.CounselorID)
+		}
+		notifyCounselorSearch(change.CounselorID)
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "审核成功",
+		"data": change,
+	})
+}
+
+// profileChangeDiff 按字段顺序列出修改对比
+func profileChangeDiff(change *models.CounselorProfileChange, counselor *models.Counselor) []profileFieldDiff {
+	original := change.Original()
+	current := models.ProfileValues(counselor)
+	diff := []profileFieldDiff{}
+	proposed := change.Proposed()
+	for _, field := range models.ProfileReviewFields {
+		value, ok := proposed[field]
+		if !ok {
+			continue
+		}
+		diff = append(diff, profileFieldDiff{
+			Field:   field,
+			Label:   profileFieldLabels[field],
+			Old:     original[field],
+			Current: current[field],
+			New:     value,
+			Stale:   fmt.Sprint(original[field]) != fmt.Sprint(current[field]),
+		})
+	}
+	return diff
+}
+
+// newProfileChange 管理员修改须经审核的字段时生成修改申请，没有变化时返回 nil；单价须在咨询师等级的单价区间内
+func newProfileChange(counselor *models.Counselor, edit models.ProfileEdit) (*models.CounselorProfileChange, error) {
+	change := models.NewProfileChange(counselor, edit)
+	if change == nil {
+		return nil, nil
+	}
+	if change.Price != nil || change.PriceRules != nil {
+		if err := checkPriceBand(database.DB, counselor, change); err != nil {
+			return nil, err
+		}
+	}
+	var pending int64
+	database.DB.Model(&models.CounselorProfileChange{}).
+		Where("counselor_id = ? AND status = ?", counselor.ID, models.ProfileChangeStatusPending).Count(&pending)
+	if pending > 0 {
+		return nil, errProfileChangePending
+	}
+	return change, nil
+}
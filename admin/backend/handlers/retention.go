@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"akrick.com/mychat/admin/backend/cache"
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/admin/backend/utils"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 数据归档由 api 服务的 data_retention 任务按保留策略生成（见 api/retention），
+// 管理后台只申请恢复并触发 data_restore 任务；归档密钥只在 api 服务中配置
+const restoreJobName = "data_restore"
+
+// LegalHoldRequest 设置法律保留
+type LegalHoldRequest struct {
+	SubjectType string `json:"subject_type" binding:"required,oneof=session user"`
+	SubjectID   uint   `json:"subject_id" binding:"required"`
+	Reason      string `json:"reason" binding:"required,max=500"`
+}
+
+// GetDataArchives godoc
+// @Summary 获取数据归档列表
+// @Tags 数据归档
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param data_class query string false "数据类别:messages/attachments/billing"
+// @Param status query string false "状态:archived/purged/restore_requested/restored/failed"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{archives,total}"
+// @Router /api/admin/archives [get]
+func GetDataArchives(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.DataArchive{})
+	if dataClass := c.Query("data_class"); dataClass != "" {
+		query = query.Where("data_class = ?", dataClass)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var archives []models.DataArchive
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id DESC").Find(&archives).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"archives": archives,
+			"total":    total,
+		},
+	})
+}
+
+// RestoreDataArchive godoc
+// @Summary 申请恢复数据归档
+// @Description 将已删除源数据的归档写回数据库（附件写回存储目录），由恢复任务异步执行；恢复后涉及的会话自动加法律保留，避免再次被归档删除
+// @Tags 数据归档
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "归档ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已申请恢复"
+// @Router /api/admin/archives/{id}/restore [post]
+func RestoreDataArchive(c *gin.Context) {
+	username, _ := c.Get("username")
+	now := time.Now()
+
+	result := database.DB.Model(&models.DataArchive{}).
+		Where("id = ? AND status IN ?", c.Param("id"),
+			[]string{models.ArchiveStatusPurged, models.ArchiveStatusRestored, models.ArchiveStatusFailed}).
+		Updates(map[string]interface{}{
+			"status":               models.ArchiveStatusRestoreRequested,
+			"restore_requested_at": now,
+			"restore_requested_by": fmt.Sprint(username),
+			"error":                "",
+		})
+	if result.Error != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "操作失败: " + result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "归档不存在或当前状态不能恢复",
+		})
+		return
+	}
+
+	// 立即触发恢复任务，不必等下一个计划时间
+	database.DB.Model(&models.ScheduledJob{}).Where("name = ?", restoreJobName).Updates(map[string]interface{}{
+		"trigger_requested_at": now,
+		"triggered_by":         fmt.Sprint(username),
+	})
+	if cache.Rdb != nil {
+		cache.Rdb.Publish(context.Background(), jobsWakeChannel, restoreJobName)
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "已申请恢复",
+	})
+}
+
+// GetLegalHolds godoc
+// @Summary 获取法律保留列表
+// @Tags 数据归档
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param subject_type query string false "对象类型:session/user"
+// @Param subject_id query int false "会话ID或用户ID"
+// @Param active query bool false "只看生效中的保留"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{holds,total}"
+// @Router /api/admin/legal-holds [get]
+func GetLegalHolds(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.LegalHold{})
+	if subjectType := c.Query("subject_type"); subjectType != "" {
+		query = query.Where("subject_type = ?", subjectType)
+	}
+	if subjectID := c.Query("subject_id"); subjectID != "" {
+		query = query.Where("subject_id = ?", subjectID)
+	}
+	if c.Query("active") == "true" {
+		query = query.Where("released_at IS NULL")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var holds []models.LegalHold
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("id DESC").Find(&holds).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"holds": holds,
+			"total": total,
+		},
+	})
+}
+
+// CreateLegalHold godoc
+// @Summary 设置法律保留
+// @Description 保留期间会话（或用户参与的全部会话）的消息、附件和计费记录不会被归档删除，管理员也不能删除会话
+// @Tags 数据归档
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body LegalHoldRequest true "保留信息"
+// @Success 200 {object} map[string]interface{} "code:200,msg:设置成功,data:hold"
+// @Router /api/admin/legal-holds [post]
+func CreateLegalHold(c *gin.Context) {
+	username, _ := c.Get("username")
+
+	var req LegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var count int64
+	if req.SubjectType == models.LegalHoldSession {
+		database.DB.Model(&models.ChatSession{}).Where("id = ?", req.SubjectID).Count(&count)
+	} else {
+		database.DB.Model(&models.User{}).Where("id = ?", req.SubjectID).Count(&count)
+	}
+	if count == 0 {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "保留对象不存在",
+		})
+		return
+	}
+
+	database.DB.Model(&models.LegalHold{}).
+		Where("subject_type = ? AND subject_id = ? AND released_at IS NULL", req.SubjectType, req.SubjectID).
+		Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "该对象已处于法律保留中",
+		})
+		return
+	}
+
+	hold := models.LegalHold{
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+		Reason:      req.Reason,
+		CreatedBy:   fmt.Sprint(username),
+	}
+	if err := database.DB.Create(&hold).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "设置失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "设置成功",
+		"data": hold,
+	})
+}
+
+// ReleaseLegalHold godoc
+// @Summary 解除法律保留
+// @Description 解除后数据按保留策略在下一次归档任务中处理
+// @Tags 数据归档
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "保留ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已解除"
+// @Router /api/admin/legal-holds/{id}/release [post]
+func ReleaseLegalHold(c *gin.Context) {
+	username, _ := c.Get("username")
+
+	result := database.DB.Model(&models.LegalHold{}).Where("id = ? AND released_at IS NULL", c.Param("id")).
+		Updates(map[string]interface{}{
+			"released_at": time.Now(),
+			"released_by": fmt.Sprint(username),
+		})
+	if result.Error != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "操作失败: " + result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "保留不存在或已解除",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "已解除",
+	})
+}
+
+// sessionHeld 会话本身、会话用户或咨询师对应的用户处于法律保留中
+func sessionHeld(session *models.ChatSession) bool {
+	var count int64
+	database.DB.Model(&models.LegalHold{}).Where("released_at IS NULL").
+		Where("(subject_type = ? AND subject_id = ?) OR (subject_type = ? AND subject_id IN (?, (SELECT user_id FROM counselors WHERE id = ?)))",
+			models.LegalHoldSession, session.ID, models.LegalHoldUser, session.UserID, session.CounselorID).
+		Count(&count)
+	return count > 0
+}
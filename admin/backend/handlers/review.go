@@ -1,168 +1,166 @@
 package handlers
 
 import (
-	"context"
 	"akrick.com/mychat/admin/backend/cache"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	"akrick.com/mychat/counselorstats"
+	apimodels "akrick.com/mychat/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type CreateReviewRequest struct {
-	OrderID         uint   `json:"order_id" binding:"required"`
-	Rating          int    `json:"rating" binding:"required,min=1,max=5"`
-	ServiceRating   int    `json:"service_rating" binding:"required,min=1,max=5"`
-	Professionalism int   `json:"professionalism" binding:"required,min=1,max=5"`
-	Effectiveness  int    `json:"effectiveness" binding:"required,min=1,max=5"`
-	Content         string `json:"content" binding:"required,max=500"`
-	IsAnonymous     bool   `json:"is_anonymous"`
+// 评价由用户在 api 服务中提交和修改、咨询师回复，提交时自动检查内容，用户和咨询师可举报、咨询师可申诉（见 api/review）。
+// 管理后台处理审核队列：通过、隐藏或编辑打码，裁定申诉，删除不当回复；每次决定记入 ReviewDecision
+
+var (
+	errReviewNotFound   = errors.New("评价不存在")
+	errNoPendingAppeal  = errors.New("该评价没有待处理的申诉")
+	errReviewNotChanged = errors.New("打码后的内容与原内容相同")
+)
+
+// ReviewApproveRequest 审核通过
+type ReviewApproveRequest struct {
+	Note string `json:"note" binding:"max=500"`
 }
 
-type ReplyReviewRequest struct {
-	ReplyContent string `json:"reply_content" binding:"required,max=500"`
+// ReviewHideRequest 隐藏评价
+type ReviewHideRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
 }
 
-// CreateReview godoc
-// @Summary 创建评价
-// @Description 用户对已完成的订单进行评价
-// @Tags 评价
+// ReviewRedactRequest 编辑打码后公开
+type ReviewRedactRequest struct {
+	Content string `json:"content" binding:"required,max=500"`
+	Reason  string `json:"reason" binding:"max=500"`
+}
+
+// ReviewAppealHandleRequest 裁定申诉
+type ReviewAppealHandleRequest struct {
+	Result string `json:"result" binding:"required,oneof=upheld dismissed"`
+	Note   string `json:"note" binding:"required,max=500"`
+}
+
+// reviewDecision 一次管理员审核决定
+type reviewDecision struct {
+	action       string
+	reason       string
+	status       int
+	content      *string // 非空时替换评价内容（打码）
+	reportStatus string  // 非空时将待处理举报置为该状态
+	// extra 在同一事务内执行的附加处理（如更新申诉、通知咨询师）
+	extra func(tx *gorm.DB, rv *models.Review) error
+	// notice 返回通知评价者的标题和内容，为空时不通知
+	notice func(rv *models.Review) (string, string)
+}
+
+// GetReviewList godoc
+// @Summary 获取评价列表
+// @Description 分页获取评价列表（管理员），含隐藏、待审核的评价和匿名评价的真实用户
+// @Tags 评价管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body CreateReviewRequest true "评价信息"
-// @Success 200 {object} map[string]interface{} "code:200,msg:评价成功"
-// @Failure 400 {object} map[string]interface{} "参数错误"
-// @Failure 401 {object} map[string]interface{} "未授权"
-// @Failure 400 {object} map[string]interface{} "订单状态不允许评价"
-// @Router /api/review/create [post]
-func CreateReview(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
-	var req CreateReviewRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{
-			"code": 400,
-			"msg":  "参数错误: " + err.Error(),
-		})
-		return
-	}
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param counselor_id query int false "咨询师ID"
+// @Param user_id query int false "用户ID"
+// @Param rating query int false "评分"
+// @Param status query int false "状态:0-隐藏,1-显示,2-待审核"
+// @Param keyword query string false "评价内容或订单号"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{reviews,total}"
+// @Router /api/admin/reviews [get]
+func GetReviewList(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
 
-	// 查询订单信息
-	var order models.Order
-	if err := database.DB.First(&order, req.OrderID).Error; err != nil {
-		c.JSON(404, gin.H{
-			"code": 404,
-			"msg":  "订单不存在",
-		})
-		return
+	query := database.DB.Model(&models.Review{})
+	if counselorID := c.Query("counselor_id"); counselorID != "" {
+		query = query.Where("counselor_id = ?", counselorID)
 	}
-
-	// 检查订单是否属于当前用户
-	if order.UserID != userID.(uint) {
-		c.JSON(403, gin.H{
-			"code": 403,
-			"msg":  "无权评价此订单",
-		})
-		return
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
 	}
-
-	// 检查订单状态，只有已完成的订单才能评价
-	if order.Status != models.OrderStatusCompleted {
-		c.JSON(400, gin.H{
-			"code": 400,
-			"msg":  "订单状态不允许评价",
-		})
-		return
+	if rating := c.Query("rating"); rating != "" {
+		query = query.Where("rating = ?", rating)
 	}
-
-	// 检查是否已评价过
-	var existingReview models.Review
-	if err := database.DB.Where("order_id = ?", req.OrderID).First(&existingReview).Error; err == nil {
-		c.JSON(400, gin.H{
-			"code": 400,
-			"msg":  "该订单已评价",
-		})
-		return
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
 	}
-
-	// 创建评价
-	review := models.Review{
-		OrderID:         req.OrderID,
-		OrderNo:         order.OrderNo,
-		UserID:          userID.(uint),
-		CounselorID:     order.CounselorID,
-		Rating:          req.Rating,
-		ServiceRating:   req.ServiceRating,
-		Professionalism: req.Professionalism,
-		Effectiveness:  req.Effectiveness,
-		Content:         req.Content,
-		IsAnonymous:     req.IsAnonymous,
-		Status:          1,
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("content LIKE ? OR order_no LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
 	}
 
-	if err := database.DB.Create(&review).Error; err != nil {
+	var total int64
+	query.Count(&total)
+
+	var reviews []models.Review
+	if err := query.Preload("User").Preload("Counselor").Offset((page - 1) * pageSize).Limit(pageSize).
+		Order("id DESC").Find(&reviews).Error; err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
-			"msg":  "创建评价失败: " + err.Error(),
+			"msg":  "查询失败: " + err.Error(),
 		})
 		return
 	}
 
-	// 更新咨询师统计
-	updateCounselorStatistics(c, order.CounselorID, req.Rating, 1)
-
-	// 清除缓存
-	ctx := context.Background()
-	cache.DeleteOrderCache(ctx, order.ID)
-	cache.DeleteCounselorCache(ctx, order.CounselorID)
-
 	c.JSON(200, gin.H{
 		"code": 200,
-		"msg":  "评价成功",
+		"msg":  "获取成功",
 		"data": gin.H{
-			"review_id": review.ID,
+			"reviews": reviews,
+			"total":   total,
 		},
 	})
 }
 
-// GetReviewList godoc
-// @Summary 获取咨询师评价列表
-// @Description 获取指定咨询师的评价列表
-// @Tags 评价
+// GetReviewQueue godoc
+// @Summary 获取评价审核队列
+// @Description 待处理的评价：待审核（自动检查命中或举报达到阈值）、有待处理举报、有待处理申诉，按提交时间先后排列
+// @Tags 评价管理
 // @Accept json
 // @Produce json
-// @Param counselor_id path int true "咨询师ID"
+// @Security BearerAuth
 // @Param page query int false "页码" default(1)
-// @Param page_size query int false "每页数量" default(10)
-// @Param rating query int false "评分筛选"
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{reviews,total}"
-// @Router /api/review/counselor/{counselor_id} [get]
-func GetReviewList(c *gin.Context) {
-	counselorID := c.Param("counselor_id")
-	page := c.DefaultQuery("page", "1")
-	pageSize := c.DefaultQuery("page_size", "10")
-	rating := c.Query("rating")
-
-	query := database.DB.Model(&models.Review{}).Where("counselor_id = ? AND status = 1", counselorID)
-
-	// 评分筛选
-	if rating != "" {
-		query = query.Where("rating = ?", rating)
+// @Param page_size query int false "每页数量" default(20)
+// @Param type query string false "类型:held-待审核,reported-被举报,appealed-被申诉，默认全部"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{items:[{review,pending_reports}],total}"
+// @Router /api/admin/reviews/queue [get]
+func GetReviewQueue(c *gin.Context) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	held := database.DB.Where("reviews.status = ?", models.ReviewStatusPending)
+	reported := database.DB.Where("EXISTS (SELECT 1 FROM review_reports r WHERE r.review_id = reviews.id AND r.status = ?)",
+		models.ReviewCaseStatusPending)
+	appealed := database.DB.Where("EXISTS (SELECT 1 FROM review_appeals a WHERE a.review_id = reviews.id AND a.status = ?)",
+		models.ReviewCaseStatusPending)
+
+	query := database.DB.Model(&models.Review{})
+	switch c.Query("type") {
+	case "held":
+		query = query.Where(held)
+	case "reported":
+		query = query.Where(reported)
+	case "appealed":
+		query = query.Where(appealed)
+	default:
+		query = query.Where(held).Or(reported).Or(appealed)
 	}
 
 	var total int64
 	query.Count(&total)
 
 	var reviews []models.Review
-	offset := 0
-	if page == "1" {
-		offset = 0
-	} else {
-		offset = (utils.ParseInt(page) - 1) * utils.ParseInt(pageSize)
-	}
-
-	if err := query.Preload("User").Offset(offset).Limit(utils.ParseInt(pageSize)).Order("created_at DESC").Find(&reviews).Error; err != nil {
+	if err := query.Preload("User").Preload("Counselor").Preload("Appeal").Offset((page - 1) * pageSize).Limit(pageSize).
+		Order("created_at ASC").Find(&reviews).Error; err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "查询失败: " + err.Error(),
@@ -170,31 +168,57 @@ func GetReviewList(c *gin.Context) {
 		return
 	}
 
+	reviewIDs := make([]uint, 0, len(reviews))
+	for _, rv := range reviews {
+		reviewIDs = append(reviewIDs, rv.ID)
+	}
+	var counts []struct {
+		ReviewID uint
+		Count    int
+	}
+	if len(reviewIDs) > 0 {
+		database.DB.Model(&models.ReviewReport{}).Select("review_id, COUNT(*) AS count").
+			Where("review_id IN ? AND status = ?", reviewIDs, models.ReviewCaseStatusPending).
+			Group("review_id").Scan(&counts)
+	}
+	pending := make(map[uint]int, len(counts))
+	for _, r := range counts {
+		pending[r.ReviewID] = r.Count
+	}
+
+	items := make([]gin.H, 0, len(reviews))
+	for _, rv := range reviews {
+		items = append(items, gin.H{
+			"review":          rv,
+			"pending_reports": pending[rv.ID],
+		})
+	}
+
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "获取成功",
 		"data": gin.H{
-			"reviews": reviews,
-			"total":   total,
+			"items": items,
+			"total": total,
 		},
 	})
 }
 
 // GetReviewDetail godoc
 // @Summary 获取评价详情
-// @Description 获取评价详细信息
-// @Tags 评价
+// @Description 含举报、申诉和审核决定记录
+// @Tags 评价管理
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Param id path int true "评价ID"
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{review}"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{review,reports,decisions}"
 // @Failure 404 {object} map[string]interface{} "评价不存在"
-// @Router /api/review/{id} [get]
+// @Router /api/admin/reviews/{id} [get]
 func GetReviewDetail(c *gin.Context) {
-	reviewID := c.Param("id")
-
 	var review models.Review
-	if err := database.DB.Preload("Order").Preload("User").Preload("Counselor").First(&review, reviewID).Error; err != nil {
+	if err := database.DB.Preload("Order").Preload("User").Preload("Counselor").Preload("Appeal").
+		First(&review, c.Param("id")).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
 			"msg":  "评价不存在",
@@ -202,43 +226,69 @@ func GetReviewDetail(c *gin.Context) {
 		return
 	}
 
-	// 如果是匿名评价且不是评价者本人或咨询师，隐藏用户信息
-	if review.IsAnonymous {
-		userID, exists := c.Get("user_id")
-		if !exists || (userID.(uint) != review.UserID && userID.(uint) != review.CounselorID) {
-			review.User = models.User{
-				Username: "匿名用户",
-			}
-		}
-	}
+	var reports []models.ReviewReport
+	database.DB.Where("review_id = ?", review.ID).Order("id").Find(&reports)
+	var decisions []models.ReviewDecision
+	database.DB.Where("review_id = ?", review.ID).Order("id").Find(&decisions)
 
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "获取成功",
-		"data": review,
+		"data": gin.H{
+			"review":    review,
+			"reports":   reports,
+			"decisions": decisions,
+		},
 	})
 }
 
-// ReplyReview godoc
-// @Summary 咨询师回复评价
-// @Description 咨询师回复用户评价
-// @Tags 评价
+// ApproveReview godoc
+// @Summary 审核通过评价
+// @Description 待审核或已隐藏的评价公开显示并计入评分，待处理的举报置为不成立
+// @Tags 评价管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "评价ID"
-// @Param request body ReplyReviewRequest true "回复内容"
-// @Success 200 {object} map[string]interface{} "code:200,msg:回复成功"
-// @Failure 400 {object} map[string]interface{} "参数错误"
-// @Failure 401 {object} map[string]interface{} "未授权"
-// @Failure 403 {object} map[string]interface{} "无权操作"
-// @Router /api/review/{id}/reply [post]
-func ReplyReview(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	reviewID := c.Param("id")
-	ctx := context.Background()
-
-	var req ReplyReviewRequest
+// @Param request body ReviewApproveRequest false "说明"
+// @Success 200 {object} map[string]interface{} "code:200,msg:操作成功,data:review"
+// @Router /api/admin/reviews/{id}/approve [post]
+func ApproveReview(c *gin.Context) {
+	var req ReviewApproveRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	decideReview(c, reviewDecision{
+		action:       models.ReviewActionApprove,
+		reason:       req.Note,
+		status:       models.ReviewStatusVisible,
+		reportStatus: models.ReviewCaseStatusDismissed,
+		notice: func(rv *models.Review) (string, string) {
+			return "评价已公开", fmt.Sprintf("您对订单 %s 的评价已通过审核，现已公开显示", rv.OrderNo)
+		},
+	})
+}
+
+// HideReview godoc
+// @Summary 隐藏评价
+// @Description 隐藏的评价不在咨询师主页展示、不计入评分，用户不能再修改；原因对评价者和咨询师可见，待处理的举报置为成立
+// @Tags 评价管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "评价ID"
+// @Param request body ReviewHideRequest true "隐藏原因"
+// @Success 200 {object} map[string]interface{} "code:200,msg:操作成功,data:review"
+// @Router /api/admin/reviews/{id}/hide [post]
+func HideReview(c *gin.Context) {
+	var req ReviewHideRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{
 			"code": 400,
@@ -247,171 +297,269 @@ func ReplyReview(c *gin.Context) {
 		return
 	}
 
-	// 查询评价信息
-	var review models.Review
-	if err := database.DB.First(&review, reviewID).Error; err != nil {
-		c.JSON(404, gin.H{
-			"code": 404,
-			"msg":  "评价不存在",
-		})
-		return
-	}
+	decideReview(c, reviewDecision{
+		action:       models.ReviewActionHide,
+		reason:       req.Reason,
+		status:       models.ReviewStatusHidden,
+		reportStatus: models.ReviewCaseStatusUpheld,
+		notice: func(rv *models.Review) (string, string) {
+			return "评价已被隐藏", fmt.Sprintf("您对订单 %s 的评价已被隐藏，原因：%s", rv.OrderNo, req.Reason)
+		},
+	})
+}
 
-	// 检查是否为咨询师本人
-	if review.CounselorID != userID.(uint) {
-		c.JSON(403, gin.H{
-			"code": 403,
-			"msg":  "无权回复此评价",
+// RedactReview godoc
+// @Summary 编辑打码评价
+// @Description 用打码后的内容替换评价内容（如去掉联系方式、身份信息）并公开显示，原内容保留在审核决定记录中，待处理的举报置为成立
+// @Tags 评价管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "评价ID"
+// @Param request body ReviewRedactRequest true "打码后的内容"
+// @Success 200 {object} map[string]interface{} "code:200,msg:操作成功,data:review"
+// @Router /api/admin/reviews/{id}/redact [post]
+func RedactReview(c *gin.Context) {
+	var req ReviewRedactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
 		})
 		return
 	}
 
-	// 更新回复
-	now := database.DB.NowFunc()
-	if err := database.DB.Model(&review).Updates(map[string]interface{}{
-		"reply_content": req.ReplyContent,
-		"reply_time":    &now,
-	}).Error; err != nil {
-		c.JSON(500, gin.H{
-			"code": 500,
-			"msg":  "回复失败: " + err.Error(),
+	decideReview(c, reviewDecision{
+		action:       models.ReviewActionRedact,
+		reason:       req.Reason,
+		status:       models.ReviewStatusVisible,
+		content:      &req.Content,
+		reportStatus: models.ReviewCaseStatusUpheld,
+		notice: func(rv *models.Review) (string, string) {
+			return "评价已编辑后公开", fmt.Sprintf("您对订单 %s 的评价中不适合公开的内容已被处理，现已公开显示", rv.OrderNo)
+		},
+	})
+}
+
+// HandleReviewAppeal godoc
+// @Summary 裁定咨询师申诉
+// @Description 申诉成立时隐藏评价（说明作为隐藏原因），不成立时评价保持原状态；结果通知咨询师
+// @Tags 评价管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "评价ID"
+// @Param request body ReviewAppealHandleRequest true "裁定结果:upheld-成立,dismissed-不成立"
+// @Success 200 {object} map[string]interface{} "code:200,msg:操作成功,data:review"
+// @Router /api/admin/reviews/{id}/appeal [post]
+func HandleReviewAppeal(c *gin.Context) {
+	username, _ := c.Get("username")
+
+	var req ReviewAppealHandleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
 		})
 		return
 	}
 
-	// 清除缓存
-	cache.DeleteCounselorCache(ctx, review.CounselorID)
+	d := reviewDecision{
+		action: models.ReviewActionAppealRejected,
+		reason: req.Note,
+		status: -1,
+	}
+	if req.Result == models.ReviewCaseStatusUpheld {
+		d.action = models.ReviewActionAppealUpheld
+		d.status = models.ReviewStatusHidden
+		d.reportStatus = models.ReviewCaseStatusUpheld
+		d.notice = func(rv *models.Review) (string, string) {
+			return "评价已被隐藏", fmt.Sprintf("您对订单 %s 的评价已被隐藏，原因：%s", rv.OrderNo, req.Note)
+		}
+	}
+	d.extra = func(tx *gorm.DB, rv *models.Review) error {
+		now := time.Now()
+		result := tx.Model(&models.ReviewAppeal{}).
+			Where("review_id = ? AND status = ?", rv.ID, models.ReviewCaseStatusPending).
+			Updates(map[string]interface{}{
+				"status":      req.Result,
+				"handle_note": req.Note,
+				"handled_by":  fmt.Sprint(username),
+				"handled_at":  now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNoPendingAppeal
+		}
 
-	c.JSON(200, gin.H{
-		"code": 200,
-		"msg":  "回复成功",
-	})
+		title, content := "申诉未成立", fmt.Sprintf("您对订单 %s 评价的申诉未成立：%s", rv.OrderNo, req.Note)
+		if req.Result == models.ReviewCaseStatusUpheld {
+			title, content = "申诉成立", fmt.Sprintf("您对订单 %s 评价的申诉成立，该评价已隐藏", rv.OrderNo)
+		}
+		var counselorUserID uint
+		tx.Model(&models.Counselor{}).Select("user_id").Where("id = ?", rv.CounselorID).Scan(&counselorUserID)
+		if counselorUserID == 0 {
+			return nil
+		}
+		return tx.Create(&models.Notification{
+			UserID:  counselorUserID,
+			Type:    models.NotificationTypeReview,
+			Level:   models.NotificationLevelInfo,
+			Title:   title,
+			Content: content,
+		}).Error
+	}
+	decideReview(c, d)
 }
 
-// GetUserReviews godoc
-// @Summary 获取用户评价列表
-// @Description 获取当前用户的评价列表
-// @Tags 评价
+// DeleteReviewReply godoc
+// @Summary 删除咨询师回复
+// @Tags 评价管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param page query int false "页码" default(1)
-// @Param page_size query int false "每页数量" default(10)
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{reviews,total}"
-// @Router /api/review/my [get]
-func GetUserReviews(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+// @Param id path int true "评价ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:操作成功,data:review"
+// @Router /api/admin/reviews/{id}/reply [delete]
+func DeleteReviewReply(c *gin.Context) {
+	decideReview(c, reviewDecision{
+		action: models.ReviewActionReplyDeleted,
+		status: -1,
+		extra: func(tx *gorm.DB, rv *models.Review) error {
+			rv.ReplyContent = ""
+			rv.ReplyTime = nil
+			return tx.Model(rv).Updates(map[string]interface{}{
+				"reply_content": "",
+				"reply_time":    nil,
+			}).Error
+		},
+	})
+}
 
-	page := c.DefaultQuery("page", "1")
-	pageSize := c.DefaultQuery("page_size", "10")
+// reviewState 评价对咨询师统计的贡献，规则见 counselorstats.StateOf
+func reviewState(rv *models.Review) counselorstats.ReviewState {
+	return counselorstats.StateOf(&apimodels.Review{Status: rv.Status, Rating: rv.Rating})
+}
 
-	query := database.DB.Model(&models.Review{}).Where("user_id = ?", userID)
+// decideReview 锁定评价执行审核决定：更新状态和内容、增量更新咨询师评分、处理举报、记录决定并通知评价者
+// d.status 为 -1 时不改变评价状态
+func decideReview(c *gin.Context, d reviewDecision) {
+	username, _ := c.Get("username")
 
-	var total int64
-	query.Count(&total)
+	var review models.Review
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&review, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errReviewNotFound
+			}
+			return err
+		}
+		before := reviewState(&review)
+		decision := models.ReviewDecision{
+			ReviewID:   review.ID,
+			Action:     d.action,
+			ActorType:  models.OrderActorAdmin,
+			Actor:      fmt.Sprint(username),
+			Reason:     d.reason,
+			FromStatus: review.Status,
+			ToStatus:   review.Status,
+		}
 
-	var reviews []models.Review
-	offset := 0
-	if page == "1" {
-		offset = 0
-	} else {
-		offset = (utils.ParseInt(page) - 1) * utils.ParseInt(pageSize)
-	}
+		if d.status >= 0 {
+			updates := map[string]interface{}{
+				"status":        d.status,
+				"hidden_reason": "",
+			}
+			if d.status == models.ReviewStatusHidden {
+				updates["hidden_reason"] = d.reason
+			} else {
+				// 公开即视为已处理自动检查的命中
+				updates["moderation_flags"] = ""
+			}
+			if d.content != nil {
+				if *d.content == review.Content {
+					return errReviewNotChanged
+				}
+				decision.BeforeContent = review.Content
+				decision.AfterContent = *d.content
+				updates["content"] = *d.content
+			}
+			if err := tx.Model(&review).Updates(updates).Error; err != nil {
+				return err
+			}
+			review.Status = d.status
+			review.HiddenReason, _ = updates["hidden_reason"].(string)
+			if d.content != nil {
+				review.Content = *d.content
+			}
+			decision.ToStatus = d.status
+			if err := counselorstats.ReviewChanged(tx, review.CounselorID, before, reviewState(&review)); err != nil {
+				return err
+			}
+		}
 
-	if err := query.Preload("Counselor").Preload("Order").Offset(offset).Limit(utils.ParseInt(pageSize)).Order("created_at DESC").Find(&reviews).Error; err != nil {
+		if d.reportStatus != "" {
+			if err := tx.Model(&models.ReviewReport{}).
+				Where("review_id = ? AND status = ?", review.ID, models.ReviewCaseStatusPending).
+				Updates(map[string]interface{}{
+					"status":     d.reportStatus,
+					"handled_by": fmt.Sprint(username),
+					"handled_at": time.Now(),
+				}).Error; err != nil {
+				return err
+			}
+		}
+		if d.extra != nil {
+			if err := d.extra(tx, &review); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&decision).Error; err != nil {
+			return err
+		}
+
+		// 状态未变化（如已公开的评价驳回举报）时不通知评价者
+		if d.notice == nil || (decision.FromStatus == decision.ToStatus && d.content == nil) {
+			return nil
+		}
+		title, content := d.notice(&review)
+		return tx.Create(&models.Notification{
+			UserID:  review.UserID,
+			Type:    models.NotificationTypeReview,
+			Level:   models.NotificationLevelInfo,
+			Title:   title,
+			Content: content,
+		}).Error
+	})
+	switch {
+	case errors.Is(err, errReviewNotFound):
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  err.Error(),
+		})
+		return
+	case errors.Is(err, errNoPendingAppeal) || errors.Is(err, errReviewNotChanged):
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	case err != nil:
 		c.JSON(500, gin.H{
 			"code": 500,
-			"msg":  "查询失败: " + err.Error(),
+			"msg":  "操作失败: " + err.Error(),
 		})
 		return
 	}
-
-	c.JSON(200, gin.H{
-		"code": 200,
-		"msg":  "获取成功",
-		"data": gin.H{
-			"reviews": reviews,
-			"total":   total,
-		},
-	})
-}
-
-// GetCounselorStatistics godoc
-// @Summary 获取咨询师统计数据
-// @Description 获取指定咨询师的统计数据
-// @Tags 评价
-// @Accept json
-// @Produce json
-// @Param counselor_id path int true "咨询师ID"
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{statistics}"
-// @Router /api/review/counselor/{counselor_id}/statistics [get]
-func GetCounselorStatistics(c *gin.Context) {
-	counselorID := c.Param("counselor_id")
-
-	var statistics models.CounselorStatistics
-	if err := database.DB.Preload("Counselor").Where("counselor_id = ?", counselorID).First(&statistics).Error; err != nil {
-		// 如果统计不存在，返回默认值
-		c.JSON(200, gin.H{
-			"code": 200,
-			"msg":  "获取成功",
-			"data": gin.H{
-				"total_orders":      0,
-				"completed_orders": 0,
-				"cancelled_orders": 0,
-				"total_duration":   0,
-				"total_amount":     0,
-				"review_count":     0,
-				"avg_rating":       0,
-			},
-		})
-		return
+	if cache.Rdb != nil {
+		cache.DeleteCounselorCache(context.Background(), review.CounselorID)
 	}
 
 	c.JSON(200, gin.H{
 		"code": 200,
-		"msg":  "获取成功",
-		"data": statistics,
+		"msg":  "操作成功",
+		"data": review,
 	})
 }
-
-// updateCounselorStatistics 更新咨询师统计数据
-func updateCounselorStatistics(c *gin.Context, counselorID uint, rating int, isCompleted int) {
-	_ = c // 参数暂时未使用
-
-	var statistics models.CounselorStatistics
-
-	// 查找或创建统计记录
-	if err := database.DB.Where("counselor_id = ?", counselorID).First(&statistics).Error; err != nil {
-		// 创建新统计
-		statistics = models.CounselorStatistics{
-			CounselorID:     counselorID,
-			TotalOrders:     0,
-			CompletedOrders: 0,
-			CancelledOrders: 0,
-			TotalDuration:   0,
-			TotalAmount:     0,
-			ReviewCount:     0,
-			AvgRating:       0,
-			SumRating:       0,
-		}
-		database.DB.Create(&statistics)
-	}
-
-	// 更新统计
-	updates := map[string]interface{}{
-		"total_orders":  statistics.TotalOrders + 1,
-		"sum_rating":   statistics.SumRating + rating,
-		"review_count": statistics.ReviewCount + 1,
-	}
-
-	if isCompleted == 1 {
-		updates["completed_orders"] = statistics.CompletedOrders + 1
-	}
-
-	// 计算平均评分
-	newReviewCount := statistics.ReviewCount + 1
-	newAvgRating := float64(statistics.SumRating+rating) / float64(newReviewCount)
-	updates["avg_rating"] = newAvgRating
-
-	database.DB.Model(&statistics).Updates(updates)
-}
@@ -5,6 +5,10 @@ import (
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
 	"akrick.com/mychat/admin/backend/websocket"
+	"akrick.com/mychat/chatmsg"
+	"akrick.com/mychat/identity"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -603,35 +607,35 @@ func MarkMessagesRead(c *gin.Context) {
 
 // SearchMessages godoc
 // @Summary 搜索消息
-// @Description 在会话中搜索包含关键词的消息
+// @Description 在会话中全文检索消息，返回高亮片段
 // @Tags WebSocket
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param session_id path int true "会话ID"
-// @Param keyword query string true "搜索关键词"
+// @Param keyword query string true "搜索关键词，多个词用空格分隔"
+// @Param sender_id query int false "发送者用户ID"
+// @Param content_type query string false "内容类型:text/image/audio/file"
+// @Param start_date query string false "开始日期(2006-01-02)"
+// @Param end_date query string false "结束日期(2006-01-02，含当天)"
+// @Param sort query string false "排序:time-按时间,relevance-按相关度" default(time)
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(20)
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{messages,total}"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{messages(含snippet高亮片段),total}"
 // @Router /api/ws/session/:session_id/search [get]
 func SearchMessages(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	sessionID := c.Param("session_id")
-	keyword := c.Query("keyword")
-	page := c.DefaultQuery("page", "1")
-	pageSize := c.DefaultQuery("page_size", "20")
-
-	if keyword == "" {
-		c.JSON(400, gin.H{
-			"code": 400,
-			"msg":  "请输入搜索关键词",
+	principal, err := identity.Current(c)
+	if err != nil {
+		c.JSON(401, gin.H{
+			"code": 401,
+			"msg":  "身份校验失败: " + err.Error(),
 		})
 		return
 	}
 
 	// 查询会话
 	var session models.ChatSession
-	if err := database.DB.First(&session, sessionID).Error; err != nil {
+	if err := database.DB.First(&session, c.Param("session_id")).Error; err != nil {
 		c.JSON(404, gin.H{
 			"code": 404,
 			"msg":  "会话不存在",
@@ -640,7 +644,7 @@ func SearchMessages(c *gin.Context) {
 	}
 
 	// 检查权限
-	if session.UserID != userID.(uint) && session.CounselorID != userID.(uint) {
+	if !principal.IsParticipant(session.UserID, session.CounselorID) {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "无权访问此会话",
@@ -648,36 +652,27 @@ func SearchMessages(c *gin.Context) {
 		return
 	}
 
-	// 搜索消息
-	query := database.DB.Model(&models.ChatMessage{}).
-		Where("session_id = ? AND content LIKE ?", sessionID, "%"+keyword+"%")
-
-	var total int64
-	query.Count(&total)
-
-	var messages []models.ChatMessage
-	offset := 0
-	if page == "1" {
-		offset = 0
-	} else {
-		offset = (utils.ParseInt(page) - 1) * utils.ParseInt(pageSize)
-	}
-
-	if err := query.Offset(offset).Limit(utils.ParseInt(pageSize)).Order("created_at DESC").Find(&messages).Error; err != nil {
-		c.JSON(500, gin.H{
-			"code": 500,
-			"msg":  "查询失败: " + err.Error(),
+	q, msg := chatSearchQuery(c)
+	if q == nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  msg,
 		})
 		return
 	}
+	// 只检索本会话，排除本人"仅自己删除"的消息
+	q.SessionID = 0
+	q.SessionIDs = []uint{session.ID}
+	q.ViewerID = principal.UserID
+	result, ok := runChatSearch(c, q)
+	if !ok {
+		return
+	}
 
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "获取成功",
-		"data": gin.H{
-			"messages": messages,
-			"total":    total,
-		},
+		"data": result,
 	})
 }
 
@@ -692,42 +687,36 @@ func SearchMessages(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "code:200,msg:撤回成功"
 // @Router /api/ws/message/:message_id/revoke [post]
 func RevokeMessage(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	messageID := c.Param("message_id")
-
-	// 查询消息
-	var message models.ChatMessage
-	if err := database.DB.First(&message, messageID).Error; err != nil {
-		c.JSON(404, gin.H{
-			"code": 404,
-			"msg":  "消息不存在",
-		})
-		return
-	}
-
-	// 检查是否为发送者
-	if message.SenderID != userID.(uint) {
-		c.JSON(403, gin.H{
-			"code": 403,
-			"msg":  "只能撤回自己的消息",
+	principal, err := identity.Current(c)
+	if err != nil {
+		c.JSON(401, gin.H{
+			"code": 401,
+			"msg":  "身份校验失败: " + err.Error(),
 		})
 		return
 	}
-
-	// 检查时间（2分钟内可撤回）
-	if time.Since(message.CreatedAt) > 2*time.Minute {
-		c.JSON(400, gin.H{
-			"code": 400,
-			"msg":  "超过2分钟，无法撤回",
+	messageID := c.Param("message_id")
+	id, _ := strconv.ParseUint(messageID, 10, 64)
+
+	// 与 API 服务共用撤回实现：原内容和附件ID写入修订审计表，清除消息附件并停用文件，同步检索索引
+	message, err := chatmsg.Recall(principal, uint(id))
+	if err != nil {
+		code, msg := 500, "撤回失败: "+err.Error()
+		switch {
+		case errors.Is(err, chatmsg.ErrNotFound):
+			code, msg = 404, err.Error()
+		case errors.Is(err, chatmsg.ErrForbidden), errors.Is(err, chatmsg.ErrNotSender):
+			code, msg = 403, err.Error()
+		case errors.Is(err, chatmsg.ErrRecalled), errors.Is(err, chatmsg.ErrRecallExpired):
+			code, msg = 400, err.Error()
+		}
+		c.JSON(code, gin.H{
+			"code": code,
+			"msg":  msg,
 		})
 		return
 	}
 
-	// 标记为已撤回
-	message.Content = "[消息已撤回]"
-	message.ContentType = "system"
-	database.DB.Save(&message)
-
 	// 通知会话内所有客户端
 	websocket.BroadcastToSession(message.SessionID, websocket.BuildRevokeMessage(messageID))
 
@@ -113,6 +113,133 @@ func InitSystemConfigs() {
 			Sort:      5,
 		},
 
+		// 订单配置（取消、改约和爽约政策）
+		{
+			Key:      "cancel_full_refund_hours",
+			Value:     `24`,
+			Category:  "order",
+			Label:     "距预约开始多少小时前取消全额退款",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      1,
+		},
+		{
+			Key:      "cancel_partial_refund_percent",
+			Value:     `50`,
+			Category:  "order",
+			Label:     "晚于上述时间取消的退款比例(%)",
+			Type:      "slider",
+			IsSystem:  true,
+			Sort:      2,
+		},
+		{
+			Key:      "reschedule_max_times",
+			Value:     `2`,
+			Category:  "order",
+			Label:     "每单最多改约次数",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      3,
+		},
+		{
+			Key:      "reschedule_min_hours",
+			Value:     `12`,
+			Category:  "order",
+			Label:     "改约最少提前小时数",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      4,
+		},
+		{
+			Key:      "no_show_grace_minutes",
+			Value:     `15`,
+			Category:  "order",
+			Label:     "爽约判定宽限时间(分钟)",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      5,
+		},
+		{
+			Key:      "no_show_user_refund_percent",
+			Value:     `0`,
+			Category:  "order",
+			Label:     "用户爽约退款比例(%)",
+			Type:      "slider",
+			IsSystem:  true,
+			Sort:      6,
+		},
+		{
+			Key:      "no_show_counselor_refund_percent",
+			Value:     `100`,
+			Category:  "order",
+			Label:     "咨询师爽约退款比例(%)",
+			Type:      "slider",
+			IsSystem:  true,
+			Sort:      7,
+		},
+		{
+			Key:      "reminder_offsets_minutes",
+			Value:     `[1440, 60, 10]`,
+			Category:  "order",
+			Label:     "预约提醒时间点(提前分钟数)",
+			Type:      "json",
+			IsSystem:  true,
+			Sort:      8,
+		},
+		{
+			Key:      "review_window_days",
+			Value:     `30`,
+			Category:  "order",
+			Label:     "订单完成后可评价天数",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      9,
+		},
+		{
+			Key:      "review_edit_hours",
+			Value:     `72`,
+			Category:  "order",
+			Label:     "评价可修改时长(小时)",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      10,
+		},
+		{
+			Key:      "rating_prior_mean",
+			Value:     `4.5`,
+			Category:  "order",
+			Label:     "评分平滑先验均值(1-5)",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      11,
+		},
+		{
+			Key:      "rating_prior_weight",
+			Value:     `5`,
+			Category:  "order",
+			Label:     "评分平滑先验权重(虚拟评价数,0不平滑)",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      12,
+		},
+		{
+			Key:      "review_auto_screen",
+			Value:     `true`,
+			Category:  "order",
+			Label:     "自动检查评价内容(联系方式/敏感词/身份信息)",
+			Type:      "boolean",
+			IsSystem:  true,
+			Sort:      13,
+		},
+		{
+			Key:      "review_report_hold_threshold",
+			Value:     `3`,
+			Category:  "order",
+			Label:     "评价被举报多少次转为待审核(0不自动)",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      14,
+		},
 		// 聊天配置
 		{
 			Key:      "free_chat_duration",
@@ -345,6 +472,84 @@ func InitSystemConfigs() {
 			IsSystem:  true,
 			Sort:      6,
 		},
+
+		// 数据保留配置（消息保留天数沿用聊天配置中的 message_retention_days，0 表示永久保留）
+		{
+			Key:      "retention_enabled",
+			Value:     `false`,
+			Category:  "retention",
+			Label:     "启用数据归档",
+			Type:      "boolean",
+			IsSystem:  true,
+			Sort:      1,
+		},
+		{
+			Key:      "attachment_retention_days",
+			Value:     `365`,
+			Category:  "retention",
+			Label:     "附件保留天数",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      2,
+		},
+		{
+			Key:      "billing_retention_days",
+			Value:     `1825`,
+			Category:  "retention",
+			Label:     "计费记录保留天数",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      3,
+		},
+		{
+			Key:      "archive_storage",
+			Value:     `"local"`,
+			Category:  "retention",
+			Label:     "归档存储方式",
+			Type:      "radio",
+			IsSystem:  true,
+			Sort:      4,
+		},
+		{
+			Key:      "archive_path",
+			Value:     `"./storage/archive"`,
+			Category:  "retention",
+			Label:     "归档目录",
+			Type:      "string",
+			IsSystem:  true,
+			Sort:      5,
+		},
+
+		// 咨询师匹配（各策略按 traffic 比例分配用户，weights 为擅长领域、可约时段、评分、回头客、负荷的权重）
+		{
+			Key:      "match_strategies",
+			Value:     `[{"name": "balanced", "traffic": 100, "weights": {"specialty": 0.35, "availability": 0.2, "rating": 0.2, "repeat": 0.15, "load": 0.1}}]`,
+			Category:  "match",
+			Label:     "匹配排序策略(A/B)",
+			Type:      "json",
+			IsSystem:  true,
+			Sort:      1,
+		},
+
+		// 咨询师入驻审核（各阶段可处理的管理员角色；同一管理员不能通过同一申请的多个阶段）
+		{
+			Key:      "application_stage_roles",
+			Value:     `{"qualification": ["super_admin", "admin", "reviewer"], "interview": ["super_admin", "admin", "interviewer"], "final": ["super_admin"]}`,
+			Category:  "application",
+			Label:     "入驻审核阶段角色",
+			Type:      "json",
+			IsSystem:  true,
+			Sort:      1,
+		},
+		{
+			Key:      "application_material_days",
+			Value:     `7`,
+			Category:  "application",
+			Label:     "补充材料期限(天)",
+			Type:      "number",
+			IsSystem:  true,
+			Sort:      2,
+		},
 	}
 
 	for _, config := range configs {
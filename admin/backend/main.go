@@ -1,12 +1,17 @@
 package main
 
 import (
+	"akrick.com/mychat/admin/backend/cache"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/handlers"
 	middlewarepkg "akrick.com/mychat/admin/backend/middleware"
 	"akrick.com/mychat/admin/backend/websocket"
+	apicache "akrick.com/mychat/cache"
+	apidatabase "akrick.com/mychat/database"
+	"akrick.com/mychat/search"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,8 +23,25 @@ func main() {
 	// 初始化系统配置
 	InitSystemConfigs()
 
+	// 初始化 Redis（用于词库热加载通知和危机告警唤醒，不可用时退化为轮询）
+	if err := cache.InitRedis(); err != nil {
+		log.Printf("Redis 不可用: %v", err)
+		cache.Rdb = nil
+	}
+
+	// api 服务的领域包（orderflow、counselorstats、chatmsg、search）与管理后台共用数据库和 Redis 连接
+	apidatabase.DB = database.DB
+	apicache.Rdb = cache.Rdb
+
+	// 聊天记录检索与 API 服务使用同一种引擎（CHAT_SEARCH_ENGINE）；Bleve 索引目录不能被多个进程同时打开，
+	// 管理后台在自己的工作目录下维护一份索引，启动后从消息表补齐，之后经 Redis 同步通知跟随新建、编辑和撤回
+	if err := search.Init(os.Getenv("CHAT_SEARCH_ENGINE"), search.DefaultBleveDir); err != nil {
+		log.Printf("检索服务初始化失败（聊天记录搜索不可用）: %v", err)
+	}
+
 	// 初始化 WebSocket Hub
 	websocket.InitHub()
+	websocket.StartAlertRelay()
 	fmt.Println("✅ WebSocket Hub 已初始化")
 
 	// 创建路由
@@ -58,6 +80,9 @@ func main() {
 		})
 		public.GET("/counselor/list", handlers.GetCounselorList)
 		public.GET("/counselor/:id", handlers.GetCounselorDetail)
+
+		// 值班管理员危机告警通道（token 通过查询参数传递）
+		public.GET("/admin/ws/alerts", websocket.HandleAlertWebSocket)
 	}
 
 	// 需要认证的路由
@@ -104,15 +129,36 @@ func main() {
 			admin.POST("/counselors", handlers.CreateCounselor)
 			admin.PUT("/counselors/:id", handlers.UpdateCounselor)
 			admin.DELETE("/counselors/:id", handlers.DeleteCounselor)
+			admin.POST("/counselors/:id/statistics/rebuild", handlers.RebuildCounselorStatistics)
+			admin.PUT("/counselors/:id/level", handlers.SetCounselorLevel)
+
+			// 咨询师等级
+			admin.GET("/counselor/levels", handlers.GetCounselorLevelList)
+			admin.POST("/counselor/levels", handlers.CreateCounselorLevel)
+			admin.PUT("/counselor/levels/:id", handlers.UpdateCounselorLevel)
+			admin.DELETE("/counselor/levels/:id", handlers.DeleteCounselorLevel)
+
+			// 咨询师匹配
+			admin.GET("/match/stats", handlers.GetMatchStats)
+			admin.GET("/match/requests", handlers.GetMatchRequests)
+
+			// 咨询师资料修改审核
+			admin.GET("/counselor/profile-changes", handlers.GetProfileChangeList)
+			admin.GET("/counselor/profile-changes/:id", handlers.GetProfileChangeDetail)
+			admin.POST("/counselor/profile-changes/:id/review", handlers.ReviewProfileChange)
 
 			// 入驻申请管理
 			admin.GET("/counselor/applications", handlers.GetApplicationList)
 			admin.GET("/counselor/applications/:id", handlers.GetApplicationDetail)
-			admin.PUT("/counselor/applications/:id/review", handlers.ReviewApplication)
+			admin.POST("/counselor/applications/:id/documents/:doc_id/verify", handlers.VerifyApplicationDocument)
+			admin.POST("/counselor/applications/:id/decision", handlers.DecideApplication)
 
 			// 订单管理
 			admin.GET("/orders", handlers.GetOrderList)
 			admin.GET("/orders/statistics", handlers.GetOrderStatistics)
+			admin.GET("/orders/events", handlers.GetOrderEvents)
+			admin.GET("/orders/:id", handlers.AdminGetOrderDetail)
+			admin.GET("/orders/:id/timeline", handlers.GetOrderTimeline)
 			admin.PUT("/orders/:id/status", handlers.AdminUpdateOrderStatus)
 
 			// 统计数据
@@ -124,8 +170,18 @@ func main() {
 			admin.GET("/chat/sessions/:session_id/messages", handlers.GetAdminChatMessages)
 			admin.GET("/chat/statistics", handlers.GetChatStatistics)
 			admin.GET("/chat/messages/search", handlers.SearchChatMessages)
+			admin.GET("/chat/messages/:message_id/revisions", handlers.GetMessageRevisions)
 			admin.DELETE("/chat/sessions/:id", handlers.DeleteChatSession)
 
+			// 内容审核
+			admin.GET("/moderation/words", handlers.GetSensitiveWords)
+			admin.POST("/moderation/words", handlers.CreateSensitiveWords)
+			admin.PUT("/moderation/words/:id", handlers.UpdateSensitiveWord)
+			admin.DELETE("/moderation/words/:id", handlers.DeleteSensitiveWord)
+			admin.GET("/moderation/incidents", handlers.GetModerationIncidents)
+			admin.GET("/moderation/incidents/:id", handlers.GetModerationIncident)
+			admin.PUT("/moderation/incidents/:id/handle", handlers.HandleModerationIncident)
+
 			// 财务管理
 			admin.GET("/withdraws/pending", handlers.GetPendingWithdraws)
 			admin.POST("/withdraw/:id/approve", handlers.ApproveWithdraw)
@@ -138,6 +194,22 @@ func main() {
 			admin.GET("/finance/accounts/:id", handlers.GetCounselorAccountDetail)
 			admin.GET("/statistics", handlers.GetAdminStatistics)
 
+			// 评价管理
+			admin.GET("/reviews", handlers.GetReviewList)
+			admin.GET("/reviews/queue", handlers.GetReviewQueue)
+			admin.GET("/reviews/:id", handlers.GetReviewDetail)
+			admin.POST("/reviews/:id/approve", handlers.ApproveReview)
+			admin.POST("/reviews/:id/hide", handlers.HideReview)
+			admin.POST("/reviews/:id/redact", handlers.RedactReview)
+			admin.POST("/reviews/:id/appeal", handlers.HandleReviewAppeal)
+			admin.DELETE("/reviews/:id/reply", handlers.DeleteReviewReply)
+
+			// 优惠券
+			admin.GET("/coupons", handlers.GetCouponList)
+			admin.POST("/coupons", handlers.CreateCoupon)
+			admin.PUT("/coupons/:id", handlers.UpdateCoupon)
+			admin.GET("/coupons/:id/redemptions", handlers.GetCouponRedemptions)
+
 			// 系统管理
 			admin.GET("/user/info", handlers.GetAdminUserInfo)
 			admin.GET("/user/permissions", handlers.GetAdminPermissions)
@@ -157,6 +229,20 @@ func main() {
 			admin.POST("/configs/batch", handlers.BatchSaveConfigs)
 			admin.DELETE("/configs/:id", handlers.DeleteSystemConfig)
 
+			// 定时任务
+			admin.GET("/jobs", handlers.GetJobList)
+			admin.GET("/jobs/:name/runs", handlers.GetJobRuns)
+			admin.POST("/jobs/:name/trigger", handlers.TriggerJob)
+			admin.POST("/jobs/:name/pause", handlers.PauseJob)
+			admin.POST("/jobs/:name/resume", handlers.ResumeJob)
+
+			// 数据归档与法律保留
+			admin.GET("/archives", handlers.GetDataArchives)
+			admin.POST("/archives/:id/restore", handlers.RestoreDataArchive)
+			admin.GET("/legal-holds", handlers.GetLegalHolds)
+			admin.POST("/legal-holds", handlers.CreateLegalHold)
+			admin.POST("/legal-holds/:id/release", handlers.ReleaseLegalHold)
+
 			// RBAC 权限管理
 			admin.GET("/roles", handlers.GetRoleList)
 			admin.POST("/roles", handlers.CreateRole)
@@ -31,17 +31,37 @@ type ChatMessage struct {
 	SessionID   uint       `gorm:"not null;index;comment:会话ID" json:"session_id"`
 	SenderID    uint       `gorm:"not null;index;comment:发送者ID" json:"sender_id"`
 	SenderType  string     `gorm:"type:varchar(20);not null;comment:发送者类型:user/counselor" json:"sender_type"`
-	ContentType string     `gorm:"type:varchar(20);default:text;comment:内容类型:text/image/file" json:"content_type"`
+	ContentType string     `gorm:"type:varchar(20);default:text;comment:内容类型:text/image/audio/file/system" json:"content_type"`
 	Content     string     `gorm:"type:text;comment:消息内容" json:"content"`
+	FileID      *uint      `gorm:"index;comment:附件文件ID" json:"file_id,omitempty"`
 	FileURL     string     `gorm:"type:varchar(255);comment:文件URL" json:"file_url"`
 	IsRead      bool       `gorm:"default:false;comment:是否已读" json:"is_read"`
 	ReadTime    *time.Time `json:"read_time"`
+	Revision    int        `gorm:"not null;default:0;comment:修订次数" json:"revision"`
+	EditedAt    *time.Time `gorm:"comment:最后编辑时间" json:"edited_at"`
+	RecalledAt  *time.Time `gorm:"comment:撤回时间" json:"recalled_at"`
 	CreatedAt   time.Time  `json:"created_at"`
 
 	// 关联
 	Session ChatSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
 }
 
+// ChatMessageRevision 消息修订审计表（保存编辑、撤回前的原始内容，仅特权管理员可查）
+type ChatMessageRevision struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	MessageID    uint      `gorm:"not null;index;comment:消息ID" json:"message_id"`
+	SessionID    uint      `gorm:"not null;index;comment:会话ID" json:"session_id"`
+	Revision     int       `gorm:"not null;comment:修订序号" json:"revision"`
+	Action       string    `gorm:"type:varchar(20);not null;comment:动作:edit/recall" json:"action"`
+	ContentType  string    `gorm:"type:varchar(20);comment:原内容类型" json:"content_type"`
+	Content      string    `gorm:"type:text;comment:原消息内容" json:"content"`
+	FileID       *uint     `gorm:"comment:原附件文件ID" json:"file_id"`
+	FileURL      string    `gorm:"type:varchar(255);comment:原文件URL" json:"file_url"`
+	OperatorID   uint      `gorm:"not null;comment:操作人ID" json:"operator_id"`
+	OperatorType string    `gorm:"type:varchar(20);not null;comment:操作人类型:user/counselor/admin" json:"operator_type"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 // ChatBilling 聊天计费记录表
 type ChatBilling struct {
 	ID              uint      `gorm:"primaryKey" json:"id"`
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// 默认咨询师等级
+const (
+	CounselorLevelJunior = "junior" // 初级
+	CounselorLevelSenior = "senior" // 资深
+	CounselorLevelExpert = "expert" // 专家
+)
+
+// CounselorLevel 咨询师等级
+// 每个等级有单价区间，咨询师的基础单价、时长档位单价和时段加价后的成交单价都限制在区间内；
+// 晋升条件按 CounselorStatistics 判断，定时任务只升级不降级，降级由管理员手动调整
+type CounselorLevel struct {
+	ID                 uint      `gorm:"primaryKey" json:"id"`
+	Code               string    `gorm:"type:varchar(20);uniqueIndex;not null;comment:等级代码" json:"code"`
+	Name               string    `gorm:"type:varchar(50);not null;comment:等级名称" json:"name"`
+	Rank               int       `gorm:"not null;default:0;comment:等级高低，数值越大等级越高" json:"rank"`
+	PriceMin           float64   `gorm:"type:decimal(10,2);not null;default:0;comment:最低单价(元/分钟)" json:"price_min"`
+	PriceMax           float64   `gorm:"type:decimal(10,2);not null;default:0;comment:最高单价(元/分钟)，0 表示不限" json:"price_max"`
+	MinCompletedOrders int       `gorm:"not null;default:0;comment:晋升条件:已完成订单数" json:"min_completed_orders"`
+	MinReviewCount     int       `gorm:"not null;default:0;comment:晋升条件:评价数" json:"min_review_count"`
+	MinAvgRating       float64   `gorm:"type:decimal(3,2);not null;default:0;comment:晋升条件:平均评分" json:"min_avg_rating"`
+	MinTotalDuration   int       `gorm:"not null;default:0;comment:晋升条件:累计咨询时长(分钟)" json:"min_total_duration"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// DefaultCounselorLevels 等级表为空时写入的默认等级
+func DefaultCounselorLevels() []CounselorLevel {
+	return []CounselorLevel{
+		{Code: CounselorLevelJunior, Name: "初级咨询师", Rank: 1, PriceMin: 1, PriceMax: 5},
+		{Code: CounselorLevelSenior, Name: "资深咨询师", Rank: 2, PriceMin: 3, PriceMax: 10,
+			MinCompletedOrders: 50, MinReviewCount: 20, MinAvgRating: 4.5, MinTotalDuration: 3000},
+		{Code: CounselorLevelExpert, Name: "专家咨询师", Rank: 3, PriceMin: 6, PriceMax: 30,
+			MinCompletedOrders: 200, MinReviewCount: 80, MinAvgRating: 4.7, MinTotalDuration: 12000},
+	}
+}
+
+// Qualifies 统计是否达到该等级的晋升条件
+func (l *CounselorLevel) Qualifies(s *CounselorStatistics) bool {
+	return s.CompletedOrders >= l.MinCompletedOrders &&
+		s.ReviewCount >= l.MinReviewCount &&
+		s.AvgRating >= l.MinAvgRating &&
+		s.TotalDuration >= l.MinTotalDuration
+}
+
+// InBand 单价是否在等级单价区间内
+func (l *CounselorLevel) InBand(price float64) bool {
+	return price >= l.PriceMin && (l.PriceMax <= 0 || price <= l.PriceMax)
+}
+
+// Clamp 将单价限制在等级单价区间内
+func (l *CounselorLevel) Clamp(price float64) float64 {
+	if price < l.PriceMin {
+		return l.PriceMin
+	}
+	if l.PriceMax > 0 && price > l.PriceMax {
+		return l.PriceMax
+	}
+	return price
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 咨询师标签类型
+const (
+	CounselorTagSpecialty = "specialty" // 擅长领域
+	CounselorTagTag       = "tag"       // 服务标签（如"青少年""夜间可约"）
+	CounselorTagLanguage  = "language"  // 咨询语言
+)
+
+// 咨询师性别
+const (
+	GenderMale   = "male"
+	GenderFemale = "female"
+)
+
+// CounselorTag 咨询师的结构化标签，用于分面筛选；Counselor.Specialty 保留为擅长领域的展示文本
+type CounselorTag struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CounselorID uint      `gorm:"not null;uniqueIndex:idx_counselor_tag;comment:咨询师ID" json:"counselor_id"`
+	Kind        string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_counselor_tag;index:idx_counselor_tag_value;comment:类型:specialty/tag/language" json:"kind"`
+	Value       string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_counselor_tag;index:idx_counselor_tag_value;comment:标签值" json:"value"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NormalizeGender 将"男""女"等写法统一为 GenderMale/GenderFemale，无法识别时返回空
+func NormalizeGender(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case GenderMale, "男", "m":
+		return GenderMale
+	case GenderFemale, "女", "f":
+		return GenderFemale
+	}
+	return ""
+}
+
+// SplitSpecialty 将擅长领域文本按顿号、逗号、分号、斜杠或空白拆分为标签值（去重，超长的丢弃）
+func SplitSpecialty(text string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, v := range strings.FieldsFunc(text, func(r rune) bool {
+		return strings.ContainsRune("、,，;；/ \t\n", r)
+	}) {
+		if seen[v] || utf8.RuneCountInString(v) > 50 {
+			continue
+		}
+		seen[v] = true
+		values = append(values, v)
+	}
+	return values
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+// 优惠券类型（优惠计算方式）
+const (
+	CouponTypeFixed   = "fixed"   // 立减固定金额
+	CouponTypePercent = "percent" // 按比例折扣
+)
+
+// 优惠券状态
+const (
+	CouponStatusOff = 0 // 停用
+	CouponStatusOn  = 1 // 启用
+)
+
+// 优惠券核销状态
+const (
+	CouponRedemptionUsed     = 1 // 已使用
+	CouponRedemptionReleased = 2 // 订单取消后已退回
+)
+
+// Coupon 优惠券，凭券码在下单时使用
+// 首单券（FirstOrderOnly）和咨询师专属券（CounselorID）是附加使用条件，可与立减或折扣任意组合
+// PerUserLimit、Status 的零值有意义（不限、停用），用指针避免创建时被 default 标签替换为 1
+type Coupon struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Code           string    `gorm:"type:varchar(32);uniqueIndex;not null;comment:券码" json:"code"`
+	Name           string    `gorm:"type:varchar(100);not null;comment:名称" json:"name"`
+	Description    string    `gorm:"type:varchar(500);comment:说明" json:"description"`
+	Type           string    `gorm:"type:varchar(20);not null;comment:类型:fixed-立减,percent-折扣" json:"type"`
+	Value          float64   `gorm:"type:decimal(10,2);not null;comment:立减金额或折扣百分比(20表示减20%)" json:"value"`
+	MaxDiscount    float64   `gorm:"type:decimal(10,2);not null;default:0;comment:折扣券最高抵扣金额,0不限" json:"max_discount"`
+	MinAmount      float64   `gorm:"type:decimal(10,2);not null;default:0;comment:订单满多少可用" json:"min_amount"`
+	FirstOrderOnly bool      `gorm:"not null;default:false;comment:仅限首单" json:"first_order_only"`
+	CounselorID    *uint     `gorm:"index;comment:仅限该咨询师,为空不限" json:"counselor_id"`
+	StartAt        time.Time `gorm:"not null;comment:生效时间" json:"start_at"`
+	EndAt          time.Time `gorm:"not null;comment:失效时间" json:"end_at"`
+	TotalQuantity  int       `gorm:"not null;default:0;comment:发放总量,0不限" json:"total_quantity"`
+	UsedQuantity   int       `gorm:"not null;default:0;comment:已使用数量(取消订单后退回)" json:"used_quantity"`
+	PerUserLimit   *int      `gorm:"not null;default:1;comment:每人限用次数,0不限" json:"per_user_limit"`
+	Status         *int      `gorm:"not null;default:1;index;comment:状态:1-启用,0-停用" json:"status"`
+	CreatedBy      uint      `gorm:"comment:创建管理员ID" json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CouponRedemption 优惠券使用记录，每个订单最多使用一张券
+type CouponRedemption struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	CouponID   uint       `gorm:"not null;index;comment:优惠券ID" json:"coupon_id"`
+	UserID     uint       `gorm:"not null;index;comment:用户ID" json:"user_id"`
+	OrderID    uint       `gorm:"not null;uniqueIndex;comment:订单ID" json:"order_id"`
+	Discount   float64    `gorm:"type:decimal(10,2);not null;comment:抵扣金额" json:"discount"`
+	Status     int        `gorm:"not null;default:1;index;comment:状态:1-已使用,2-已退回" json:"status"`
+	ReleasedAt *time.Time `gorm:"comment:退回时间" json:"released_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	Coupon Coupon `gorm:"foreignKey:CouponID" json:"coupon,omitempty"`
+}
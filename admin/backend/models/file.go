@@ -14,6 +14,12 @@ const (
 	FileTypeOther    = "other"    // 其他
 )
 
+// 文件关联类型
+const (
+	FileRelationSession     = "session"     // 聊天会话附件
+	FileRelationApplication = "application" // 咨询师入驻申请材料
+)
+
 // File 文件表
 type File struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// 任务执行状态
+const (
+	JobRunRunning = "running"
+	JobRunSuccess = "success"
+	JobRunFailed  = "failed"
+)
+
+// 任务触发方式
+const (
+	JobTriggerSchedule = "schedule" // 按 cron 表达式定时触发
+	JobTriggerManual   = "manual"   // 管理员手动触发
+)
+
+// ScheduledJob 定时任务注册表，由 api 服务启动时按代码中的任务定义同步
+// 租约（LeaseOwner/LeaseUntil）保证同一任务在集群内同一时间只有一个实例执行
+type ScheduledJob struct {
+	ID                 uint       `gorm:"primaryKey" json:"id"`
+	Name               string     `gorm:"type:varchar(64);uniqueIndex;not null;comment:任务名" json:"name"`
+	Description        string     `gorm:"type:varchar(255);comment:说明" json:"description"`
+	Cron               string     `gorm:"type:varchar(64);not null;comment:cron表达式" json:"cron"`
+	MaxRetries         int        `gorm:"not null;default:0;comment:失败重试次数" json:"max_retries"`
+	TimeoutSeconds     int        `gorm:"not null;default:600;comment:单次执行超时(秒)" json:"timeout_seconds"`
+	Paused             bool       `gorm:"not null;default:false;comment:是否暂停(暂停后仍可手动触发)" json:"paused"`
+	NextRunAt          time.Time  `gorm:"not null;index;comment:下次执行时间" json:"next_run_at"`
+	LastRunAt          *time.Time `gorm:"comment:最近一次开始时间" json:"last_run_at"`
+	LastStatus         string     `gorm:"type:varchar(20);comment:最近一次结果" json:"last_status"`
+	TriggerRequestedAt *time.Time `gorm:"comment:手动触发请求时间,执行后清空" json:"trigger_requested_at"`
+	TriggeredBy        string     `gorm:"type:varchar(64);comment:手动触发人" json:"triggered_by"`
+	LeaseOwner         string     `gorm:"type:varchar(128);comment:持有租约的实例" json:"lease_owner"`
+	LeaseUntil         *time.Time `gorm:"comment:租约到期时间" json:"lease_until"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// JobRun 任务执行记录，每次尝试（含重试）一条
+type JobRun struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	JobName     string     `gorm:"type:varchar(64);not null;index;comment:任务名" json:"job_name"`
+	TriggerType string     `gorm:"type:varchar(20);not null;comment:触发方式:schedule,manual" json:"trigger_type"`
+	TriggeredBy string     `gorm:"type:varchar(64);comment:手动触发人" json:"triggered_by"`
+	Attempt     int        `gorm:"not null;default:1;comment:第几次尝试" json:"attempt"`
+	Status      string     `gorm:"type:varchar(20);not null;index;comment:状态:running,success,failed" json:"status"`
+	Instance    string     `gorm:"type:varchar(128);comment:执行实例" json:"instance"`
+	StartedAt   time.Time  `gorm:"not null;index;comment:开始时间" json:"started_at"`
+	FinishedAt  *time.Time `gorm:"comment:结束时间" json:"finished_at"`
+	DurationMs  int64      `gorm:"not null;default:0;comment:耗时(毫秒)" json:"duration_ms"`
+	Error       string     `gorm:"type:text;comment:错误信息" json:"error"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
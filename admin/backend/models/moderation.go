@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+)
+
+// 敏感词处理动作
+const (
+	ModerationActionBlock = "block" // 拦截，消息不发送
+	ModerationActionMask  = "mask"  // 打码后发送
+	ModerationActionFlag  = "flag"  // 照常发送，记录事件待人工复核
+)
+
+// 敏感词分类
+const (
+	SensitiveCategoryCrisis   = "crisis"   // 自伤、自杀等危机信号，命中后立即通知值班管理员
+	SensitiveCategoryAbuse    = "abuse"    // 辱骂、骚扰
+	SensitiveCategoryPorn     = "porn"     // 色情
+	SensitiveCategoryFraud    = "fraud"    // 诈骗、私下交易
+	SensitiveCategoryPolitics = "politics" // 政治敏感
+	SensitiveCategoryOther    = "other"    // 其它
+)
+
+// 事件严重程度
+const (
+	IncidentSeverityNormal = 1 // 一般
+	IncidentSeverityHigh   = 2 // 严重
+	IncidentSeverityCrisis = 3 // 危机
+)
+
+// 事件处理状态
+const (
+	IncidentStatusPending    = 0 // 待处理
+	IncidentStatusProcessing = 1 // 处理中
+	IncidentStatusResolved   = 2 // 已处理
+	IncidentStatusFalseAlarm = 3 // 误报
+)
+
+// SensitiveWord 敏感词表（管理员维护，聊天服务热加载）
+type SensitiveWord struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Word      string    `gorm:"type:varchar(100);not null;uniqueIndex;comment:敏感词" json:"word"`
+	Category  string    `gorm:"type:varchar(30);not null;index;comment:分类:crisis/abuse/porn/fraud/politics/other" json:"category"`
+	Action    string    `gorm:"type:varchar(20);not null;comment:动作:block/mask/flag" json:"action"`
+	Status    int       `gorm:"not null;default:1;comment:状态:0-停用,1-启用" json:"status"`
+	Remark    string    `gorm:"type:varchar(255);comment:备注" json:"remark"`
+	CreatedBy uint      `gorm:"comment:创建人(管理员ID)" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ModerationIncident 内容审核事件表（拦截、标记、危机信号）
+type ModerationIncident struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	SessionID    uint       `gorm:"not null;index;comment:会话ID" json:"session_id"`
+	MessageID    *uint      `gorm:"index;comment:消息ID(拦截的消息为空)" json:"message_id"`
+	SenderID     uint       `gorm:"not null;index;comment:发送者用户ID" json:"sender_id"`
+	SenderType   string     `gorm:"type:varchar(20);comment:发送者类型:user/counselor" json:"sender_type"`
+	Category     string     `gorm:"type:varchar(30);not null;index;comment:最高优先级命中分类" json:"category"`
+	Action       string     `gorm:"type:varchar(20);not null;comment:执行的动作:block/mask/flag" json:"action"`
+	Severity     int        `gorm:"not null;index;comment:严重程度:1-一般,2-严重,3-危机" json:"severity"`
+	MatchedWords string     `gorm:"type:varchar(500);comment:命中的敏感词(逗号分隔)" json:"matched_words"`
+	Content      string     `gorm:"type:text;comment:原始消息内容" json:"content"`
+	Status       int        `gorm:"not null;default:0;index;comment:状态:0-待处理,1-处理中,2-已处理,3-误报" json:"status"`
+	HandlerID    *uint      `gorm:"comment:处理人(管理员ID)" json:"handler_id"`
+	HandleNote   string     `gorm:"type:varchar(500);comment:处理备注" json:"handle_note"`
+	HandledAt    *time.Time `json:"handled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -17,6 +17,7 @@ const (
 	PaymentStatusFailed    = 2 // 支付失败
 	PaymentStatusRefunded  = 3 // 已退款
 	PaymentStatusCancelled = 4 // 已取消
+	PaymentStatusRefunding = 5 // 退款中（订单已取消或退款，等待支付渠道退款）
 )
 
 // 支付交易类型
@@ -44,6 +45,9 @@ type Payment struct {
 	NotifyTime      *time.Time `json:"notify_time"`
 	NotifyData      string    `gorm:"type:text;comment:支付回调原始数据" json:"notify_data"`
 	FailureReason   string    `gorm:"type:varchar(255);comment:失败原因" json:"failure_reason"`
+	RefundNo        string    `gorm:"type:varchar(32);index;comment:退款单号，按订单生成，支付渠道据此幂等退款" json:"refund_no"`
+	RefundAmount    float64   `gorm:"type:decimal(10,2);not null;default:0;comment:退款金额" json:"refund_amount"`
+	RefundReason    string    `gorm:"type:varchar(255);comment:退款原因" json:"refund_reason"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 
@@ -68,3 +72,26 @@ type PaymentConfig struct {
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
+
+// 用户交易类型
+const (
+	TransactionTypeRecharge = "recharge" // 充值
+	TransactionTypeConsume  = "consume"  // 消费
+	TransactionTypeRefund   = "refund"   // 退款
+)
+
+// UserTransaction 用户交易记录表
+type UserTransaction struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index;comment:用户ID" json:"user_id"`
+	Type        string    `gorm:"type:varchar(20);not null;comment:交易类型:recharge/consume/refund" json:"type"`
+	Amount      float64   `gorm:"type:decimal(10,2);not null;comment:金额" json:"amount"`
+	Description string    `gorm:"type:varchar(255);comment:交易描述" json:"description"`
+	OrderID     *uint     `gorm:"index;comment:关联订单ID" json:"order_id,omitempty"`
+	Balance     float64   `gorm:"type:decimal(10,2);not null;comment:交易后余额" json:"balance"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// 关联
+	User  User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Order *Order `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 咨询师资料修改申请状态
+const (
+	ProfileChangeStatusPending   = 0 // 待审核
+	ProfileChangeStatusApproved  = 1 // 已通过，已更新到咨询师资料
+	ProfileChangeStatusRejected  = 2 // 已拒绝
+	ProfileChangeStatusCancelled = 3 // 提交人已撤回
+)
+
+// 资料修改提交人类型
+const (
+	ProfileChangeSubmitterCounselor = "counselor"
+	ProfileChangeSubmitterAdmin     = "admin"
+)
+
+// 须经审核的咨询师资料字段
+const (
+	ProfileFieldTitle      = "title"
+	ProfileFieldBio        = "bio"
+	ProfileFieldSpecialty  = "specialty"
+	ProfileFieldAvatar     = "avatar"
+	ProfileFieldPrice      = "price"
+	ProfileFieldPriceRules = "price_rules"
+)
+
+// ProfileReviewFields 修改须经审核的字段，按展示顺序排列
+var ProfileReviewFields = []string{ProfileFieldTitle, ProfileFieldBio, ProfileFieldSpecialty, ProfileFieldAvatar, ProfileFieldPrice, ProfileFieldPriceRules}
+
+// CounselorProfileChange 咨询师资料修改申请
+// 标题、简介、擅长领域、头像、单价和定价规则的修改先记为申请，管理员审核通过后才更新到咨询师资料；
+// 字段为空表示不修改，Snapshot 记录提交时这些字段的原值（JSON），用于审核时对比
+type CounselorProfileChange struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	CounselorID   uint       `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
+	SubmitterType string     `gorm:"type:varchar(20);not null;comment:提交人类型:counselor/admin" json:"submitter_type"`
+	SubmitterID   uint       `gorm:"not null;comment:提交人ID(用户ID/管理员ID)" json:"submitter_id"`
+	Title         *string    `gorm:"type:varchar(50);comment:新职称" json:"title,omitempty"`
+	Bio           *string    `gorm:"type:text;comment:新简介" json:"bio,omitempty"`
+	Specialty     *string    `gorm:"type:varchar(255);comment:新擅长领域" json:"specialty,omitempty"`
+	Avatar        *string    `gorm:"type:varchar(255);comment:新头像" json:"avatar,omitempty"`
+	Price         *float64   `gorm:"type:decimal(10,2);comment:新单价(元/分钟)" json:"price,omitempty"`
+	PriceRules    *string    `gorm:"type:text;comment:新定价规则(JSON)" json:"price_rules,omitempty"`
+	Snapshot      string     `gorm:"type:text;comment:提交时的原值(JSON)" json:"-"`
+	Reason        string     `gorm:"type:varchar(500);comment:修改说明" json:"reason"`
+	Status        int        `gorm:"not null;default:0;index;comment:状态:0-待审核,1-已通过,2-已拒绝,3-已撤回" json:"status"`
+	ReviewComment string     `gorm:"type:varchar(500);comment:审核意见" json:"review_comment"`
+	ReviewedBy    uint       `gorm:"comment:审核管理员ID" json:"reviewed_by"`
+	ReviewedAt    *time.Time `gorm:"comment:审核时间" json:"reviewed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// 关联
+	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
+}
+
+// ProfileValues 咨询师须经审核字段的当前值
+func ProfileValues(c *Counselor) map[string]interface{} {
+	return map[string]interface{}{
+		ProfileFieldTitle:      c.Title,
+		ProfileFieldBio:        c.Bio,
+		ProfileFieldSpecialty:  c.Specialty,
+		ProfileFieldAvatar:     c.Avatar,
+		ProfileFieldPrice:      c.Price,
+		ProfileFieldPriceRules: c.PriceRules,
+	}
+}
+
+// Proposed 申请修改的字段及新值
+func (p *CounselorProfileChange) Proposed() map[string]interface{} {
+	values := make(map[string]interface{})
+	if p.Title != nil {
+		values[ProfileFieldTitle] = *p.Title
+	}
+	if p.Bio != nil {
+		values[ProfileFieldBio] = *p.Bio
+	}
+	if p.Specialty != nil {
+		values[ProfileFieldSpecialty] = *p.Specialty
+	}
+	if p.Avatar != nil {
+		values[ProfileFieldAvatar] = *p.Avatar
+	}
+	if p.Price != nil {
+		values[ProfileFieldPrice] = *p.Price
+	}
+	if p.PriceRules != nil {
+		values[ProfileFieldPriceRules] = *p.PriceRules
+	}
+	return values
+}
+
+// Original 提交时被修改字段的原值
+func (p *CounselorProfileChange) Original() map[string]interface{} {
+	values := make(map[string]interface{})
+	json.Unmarshal([]byte(p.Snapshot), &values)
+	return values
+}
+
+// ProfileEdit 对须经审核字段的修改，nil 表示不修改
+type ProfileEdit struct {
+	Title      *string
+	Bio        *string
+	Specialty  *string
+	Avatar     *string
+	Price      *float64
+	PriceRules *string
+}
+
+// NewProfileChange 按修改内容与咨询师当前资料的差异生成待审核的修改申请，与当前资料相同的字段不计入，没有差异时返回 nil
+func NewProfileChange(c *Counselor, edit ProfileEdit) *CounselorProfileChange {
+	change := &CounselorProfileChange{CounselorID: c.ID, Status: ProfileChangeStatusPending}
+	original := make(map[string]interface{})
+	if edit.Title != nil && *edit.Title != c.Title {
+		change.Title, original[ProfileFieldTitle] = edit.Title, c.Title
+	}
+	if edit.Bio != nil && *edit.Bio != c.Bio {
+		change.Bio, original[ProfileFieldBio] = edit.Bio, c.Bio
+	}
+	if edit.Specialty != nil && *edit.Specialty != c.Specialty {
+		change.Specialty, original[ProfileFieldSpecialty] = edit.Specialty, c.Specialty
+	}
+	if edit.Avatar != nil && *edit.Avatar != c.Avatar {
+		change.Avatar, original[ProfileFieldAvatar] = edit.Avatar, c.Avatar
+	}
+	if edit.Price != nil && *edit.Price != c.Price {
+		change.Price, original[ProfileFieldPrice] = edit.Price, c.Price
+	}
+	if edit.PriceRules != nil && *edit.PriceRules != c.PriceRules {
+		change.PriceRules, original[ProfileFieldPriceRules] = edit.PriceRules, c.PriceRules
+	}
+	if len(original) == 0 {
+		return nil
+	}
+	snapshot, _ := json.Marshal(original)
+	change.Snapshot = string(snapshot)
+	return change
+}
@@ -9,29 +9,120 @@ const (
 	ReviewTypeCounselor = "counselor" // 评价咨询师
 )
 
-// Review 评价表
+// 评价状态
+const (
+	ReviewStatusHidden  = 0 // 管理员隐藏，不计入评分
+	ReviewStatusVisible = 1 // 公开显示
+	ReviewStatusPending = 2 // 待审核（自动检查命中或被多次举报），不展示、不计入评分
+)
+
+// 自动检查命中类型
+const (
+	ReviewFlagContact   = "contact"   // 联系方式（手机号、邮箱、微信/QQ、链接）
+	ReviewFlagProfanity = "profanity" // 敏感词
+	ReviewFlagIdentity  = "identity"  // 身份信息（身份证号、银行卡号）
+)
+
+// 举报原因
+const (
+	ReviewReportAbuse   = "abuse"   // 辱骂、人身攻击
+	ReviewReportPrivacy = "privacy" // 泄露隐私
+	ReviewReportFalse   = "false"   // 不实内容
+	ReviewReportSpam    = "spam"    // 广告、引流
+	ReviewReportOther   = "other"   // 其它
+)
+
+// 举报和申诉处理状态
+const (
+	ReviewCaseStatusPending   = "pending"   // 待处理
+	ReviewCaseStatusUpheld    = "upheld"    // 成立（评价被隐藏或打码）
+	ReviewCaseStatusDismissed = "dismissed" // 不成立
+)
+
+// 审核决定
+const (
+	ReviewActionAutoHold       = "auto_hold"       // 自动检查命中，转为待审核
+	ReviewActionReportHold     = "report_hold"     // 举报数达到阈值，转为待审核
+	ReviewActionApprove        = "approve"         // 审核通过，公开显示
+	ReviewActionHide           = "hide"            // 隐藏
+	ReviewActionRedact         = "redact"          // 编辑打码后公开显示
+	ReviewActionAppealUpheld   = "appeal_upheld"   // 申诉成立，隐藏评价
+	ReviewActionAppealRejected = "appeal_rejected" // 申诉驳回
+	ReviewActionReplyDeleted   = "reply_deleted"   // 删除咨询师回复
+)
+
+// Review 评价表（用户端提交和修改、咨询师回复、管理后台审核共用）
+// 分项评分为 0 表示未评（由旧评价表合并而来的记录只有总评分）
 type Review struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	OrderID     uint      `gorm:"not null;uniqueIndex:idx_reviews_order;comment:订单ID" json:"order_id"`
-	OrderNo     string    `gorm:"type:varchar(32);not null;index;comment:订单号" json:"order_no"`
-	UserID      uint      `gorm:"not null;index;comment:用户ID" json:"user_id"`
-	CounselorID uint      `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
-	Rating      int       `gorm:"not null;comment:评分(1-5)" json:"rating"`
-	ServiceRating int     `gorm:"not null;default:0;comment:服务评分" json:"service_rating"`
-	Professionalism int   `gorm:"not null;default:0;comment:专业度评分" json:"professionalism"`
-	Effectiveness int    `gorm:"not null;default:0;comment:有效性评分" json:"effectiveness"`
-	Content     string    `gorm:"type:text;comment:评价内容" json:"content"`
-	IsAnonymous  bool      `gorm:"default:false;comment:是否匿名" json:"is_anonymous"`
-	Status       int       `gorm:"not null;default:1;index;comment:状态:1-显示,0-隐藏" json:"status"`
-	ReplyContent string    `gorm:"type:text;comment:咨询师回复" json:"reply_content"`
-	ReplyTime    *time.Time `json:"reply_time"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	OrderID         uint       `gorm:"not null;uniqueIndex:idx_reviews_order;comment:订单ID" json:"order_id"`
+	OrderNo         string     `gorm:"type:varchar(32);not null;index;comment:订单号" json:"order_no"`
+	UserID          uint       `gorm:"not null;index;comment:用户ID" json:"user_id"`
+	CounselorID     uint       `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
+	Rating          int        `gorm:"not null;comment:评分(1-5)" json:"rating"`
+	ServiceRating   int        `gorm:"not null;default:0;comment:服务评分" json:"service_rating"`
+	Professionalism int        `gorm:"not null;default:0;comment:专业度评分" json:"professionalism"`
+	Effectiveness   int        `gorm:"not null;default:0;comment:有效性评分" json:"effectiveness"`
+	Content         string     `gorm:"type:text;comment:评价内容" json:"content"`
+	IsAnonymous     bool       `gorm:"default:false;comment:是否匿名" json:"is_anonymous"`
+	Status          int        `gorm:"not null;default:1;index;comment:状态:1-显示,0-隐藏,2-待审核" json:"status"`
+	HiddenReason    string     `gorm:"type:varchar(255);comment:隐藏原因" json:"hidden_reason,omitempty"`
+	ModerationFlags string     `gorm:"type:varchar(100);comment:自动检查命中类型(逗号分隔)" json:"moderation_flags,omitempty"`
+	ReplyContent    string     `gorm:"type:text;comment:咨询师回复" json:"reply_content"`
+	ReplyTime       *time.Time `json:"reply_time"`
+	EditCount       int        `gorm:"not null;default:0;comment:用户修改次数" json:"edit_count"`
+	EditedAt        *time.Time `gorm:"comment:用户最后修改时间" json:"edited_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 
 	// 关联
-	Order     Order     `gorm:"foreignKey:OrderID" json:"order,omitempty"`
-	User      User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
+	Order     Order         `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	User      User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Counselor Counselor     `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
+	Appeal    *ReviewAppeal `gorm:"foreignKey:ReviewID" json:"appeal,omitempty"`
+}
+
+// ReviewReport 评价举报，同一用户对同一评价只能举报一次
+type ReviewReport struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	ReviewID     uint       `gorm:"not null;uniqueIndex:idx_review_report;comment:评价ID" json:"review_id"`
+	ReporterID   uint       `gorm:"not null;uniqueIndex:idx_review_report;comment:举报人用户ID" json:"reporter_id"`
+	ReporterType string     `gorm:"type:varchar(20);not null;comment:举报人类型:user/counselor" json:"reporter_type"`
+	Reason       string     `gorm:"type:varchar(20);not null;comment:举报原因:abuse/privacy/false/spam/other" json:"reason"`
+	Detail       string     `gorm:"type:varchar(500);comment:补充说明" json:"detail"`
+	Status       string     `gorm:"type:varchar(20);not null;default:pending;index;comment:状态:pending/upheld/dismissed" json:"status"`
+	HandledBy    string     `gorm:"type:varchar(50);comment:处理人" json:"handled_by"`
+	HandledAt    *time.Time `json:"handled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ReviewAppeal 咨询师对评价的申诉，每条评价只能申诉一次
+type ReviewAppeal struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ReviewID    uint       `gorm:"not null;uniqueIndex;comment:评价ID" json:"review_id"`
+	CounselorID uint       `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
+	Reason      string     `gorm:"type:varchar(1000);not null;comment:申诉理由" json:"reason"`
+	Status      string     `gorm:"type:varchar(20);not null;default:pending;index;comment:状态:pending/upheld/dismissed" json:"status"`
+	HandleNote  string     `gorm:"type:varchar(500);comment:处理说明" json:"handle_note"`
+	HandledBy   string     `gorm:"type:varchar(50);comment:处理人" json:"handled_by"`
+	HandledAt   *time.Time `json:"handled_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ReviewDecision 评价审核决定记录（只追加），自动检查和管理员的每次处理都记录变更前后的状态和内容
+type ReviewDecision struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ReviewID      uint      `gorm:"not null;index;comment:评价ID" json:"review_id"`
+	Action        string    `gorm:"type:varchar(30);not null;index;comment:决定:auto_hold/report_hold/approve/hide/redact/appeal_upheld/appeal_rejected/reply_deleted" json:"action"`
+	ActorType     string    `gorm:"type:varchar(20);not null;comment:操作人类型:system/admin" json:"actor_type"`
+	Actor         string    `gorm:"type:varchar(50);comment:操作人(管理员用户名)" json:"actor"`
+	Reason        string    `gorm:"type:varchar(500);comment:原因或说明" json:"reason"`
+	FromStatus    int       `gorm:"not null;comment:变更前状态" json:"from_status"`
+	ToStatus      int       `gorm:"not null;comment:变更后状态" json:"to_status"`
+	BeforeContent string    `gorm:"type:text;comment:变更前内容(内容有变化时记录)" json:"before_content,omitempty"`
+	AfterContent  string    `gorm:"type:text;comment:变更后内容(内容有变化时记录)" json:"after_content,omitempty"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
 }
 
 // CounselorStatistics 咨询师统计表
@@ -46,6 +137,8 @@ type CounselorStatistics struct {
 	ReviewCount    int     `gorm:"not null;default:0;comment:评价数量" json:"review_count"`
 	AvgRating      float64 `gorm:"type:decimal(3,2);not null;default:0;comment:平均评分" json:"avg_rating"`
 	SumRating      int     `gorm:"not null;default:0;comment:总评分" json:"sum_rating"`
+	SessionCount   int     `gorm:"not null;default:0;comment:已结束会话数" json:"session_count"`
+	SessionDuration int    `gorm:"not null;default:0;comment:实际会话总时长(秒)" json:"session_duration"`
 	LastOrderTime  *time.Time `gorm:"comment:最后订单时间" json:"last_order_time"`
 	UpdatedAt      time.Time `json:"updated_at"`
 
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+// 排班例外类型
+const (
+	ScheduleExceptionOff   = "off"   // 休息（节假日、请假），时间为空表示全天
+	ScheduleExceptionExtra = "extra" // 额外加班时段
+)
+
+// 预约占用状态
+const (
+	BookingStatusActive   = 1 // 占用中
+	BookingStatusReleased = 0 // 已释放（订单取消、超时或退款）
+)
+
+// CounselorAvailability 咨询师每周排班模板，同一天可有多个时段
+type CounselorAvailability struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CounselorID uint      `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
+	Weekday     int       `gorm:"not null;comment:星期:0-周日,1-周一...6-周六" json:"weekday"`
+	StartTime   string    `gorm:"type:varchar(5);not null;comment:开始时间(HH:MM)" json:"start_time"`
+	EndTime     string    `gorm:"type:varchar(5);not null;comment:结束时间(HH:MM)" json:"end_time"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CounselorScheduleException 排班例外（节假日休息或额外时段），优先于每周模板
+type CounselorScheduleException struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CounselorID uint      `gorm:"not null;index:idx_schedule_exception_date;comment:咨询师ID" json:"counselor_id"`
+	Date        string    `gorm:"type:varchar(10);not null;index:idx_schedule_exception_date;comment:日期(YYYY-MM-DD)" json:"date"`
+	Type        string    `gorm:"type:varchar(10);not null;comment:类型:off-休息,extra-额外时段" json:"type"`
+	StartTime   string    `gorm:"type:varchar(5);comment:开始时间(HH:MM)，休息时为空表示全天" json:"start_time"`
+	EndTime     string    `gorm:"type:varchar(5);comment:结束时间(HH:MM)" json:"end_time"`
+	Reason      string    `gorm:"type:varchar(100);comment:原因" json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CounselorScheduleSetting 咨询师排班设置，同时作为预约时的行锁
+type CounselorScheduleSetting struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	CounselorID      uint      `gorm:"not null;uniqueIndex;comment:咨询师ID" json:"counselor_id"`
+	BufferMinutes    int       `gorm:"not null;default:10;comment:两次咨询之间的缓冲时间(分钟)" json:"buffer_minutes"`
+	SlotStepMinutes  int       `gorm:"not null;default:30;comment:可预约起始时间的间隔(分钟)" json:"slot_step_minutes"`
+	MinNoticeMinutes int       `gorm:"not null;default:120;comment:最少提前预约时间(分钟)" json:"min_notice_minutes"`
+	MaxAdvanceDays   int       `gorm:"not null;default:30;comment:最多提前预约天数" json:"max_advance_days"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// CounselorBooking 预约占用的时间段，订单创建时在同一事务内写入
+type CounselorBooking struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CounselorID uint      `gorm:"not null;index:idx_booking_counselor_time;comment:咨询师ID" json:"counselor_id"`
+	OrderID     uint      `gorm:"not null;uniqueIndex;comment:订单ID" json:"order_id"`
+	StartTime   time.Time `gorm:"not null;index:idx_booking_counselor_time;comment:开始时间" json:"start_time"`
+	EndTime     time.Time `gorm:"not null;comment:结束时间(不含缓冲)" json:"end_time"`
+	Status      int       `gorm:"not null;default:1;index;comment:状态:1-占用,0-已释放" json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,276 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"akrick.com/mychat/admin/backend/cache"
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/admin/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 危机告警
+// 聊天服务命中危机词后写入审核事件并发布 AlertChannel；这里拉取新的危机事件，
+// 推送给连接了告警通道的值班管理员。Redis 通知只用于唤醒，轮询兜底保证不漏报
+const (
+	AlertChannel       = "moderation:alert"
+	alertPollInterval  = 5 * time.Second
+	pendingAlertsLimit = 50
+
+	// alertRelayWindow 每次拉取回看的时间窗口
+	// 事件可能在消息事务中写入，ID 和创建时间早于提交时间，按ID水位增量拉取会漏掉晚提交的事件；
+	// 因此每次都重新扫描窗口内的危机事件，已广播的按ID去重
+	alertRelayWindow = 2 * time.Minute
+)
+
+// alertClient 值班管理员的告警连接
+type alertClient struct {
+	AdminID uint
+	Conn    *websocket.Conn
+	Send    chan []byte
+}
+
+var alertHub = struct {
+	clients map[*alertClient]struct{}
+	mu      sync.RWMutex
+}{clients: make(map[*alertClient]struct{})}
+
+// CrisisAlert 推送给管理员的危机告警
+type CrisisAlert struct {
+	Incident       models.ModerationIncident `json:"incident"`
+	SenderUsername string                    `json:"sender_username"`
+	OrderID        uint                      `json:"order_id"`
+}
+
+// HandleAlertWebSocket 管理员告警通道（连接期间视为值班）
+func HandleAlertWebSocket(c *gin.Context) {
+	claims, err := utils.ParseToken(c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token无效"})
+		return
+	}
+
+	var admin models.Administrator
+	if err := database.DB.Where("id = ? AND status = 1", claims.UserID).First(&admin).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "管理员不存在或已禁用"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket升级失败: %v", err)
+		return
+	}
+
+	client := &alertClient{AdminID: admin.ID, Conn: conn, Send: make(chan []byte, 64)}
+	alertHub.mu.Lock()
+	alertHub.clients[client] = struct{}{}
+	alertHub.mu.Unlock()
+	log.Printf("值班管理员上线: adminID=%d", admin.ID)
+
+	// 补发尚未处理的危机事件
+	var pending []models.ModerationIncident
+	database.DB.Where("severity = ? AND status = ?", models.IncidentSeverityCrisis, models.IncidentStatusPending).
+		Order("id DESC").Limit(pendingAlertsLimit).Find(&pending)
+	for i := len(pending) - 1; i >= 0; i-- {
+		select {
+		case client.Send <- buildCrisisAlert(pending[i]):
+		default:
+		}
+	}
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// OnDutyAdmins 返回当前在线的值班管理员ID
+func OnDutyAdmins() []uint {
+	alertHub.mu.RLock()
+	defer alertHub.mu.RUnlock()
+
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0, len(alertHub.clients))
+	for client := range alertHub.clients {
+		if !seen[client.AdminID] {
+			seen[client.AdminID] = true
+			ids = append(ids, client.AdminID)
+		}
+	}
+	return ids
+}
+
+// StartAlertRelay 启动危机告警转发
+func StartAlertRelay() {
+	relay := newAlertRelay()
+	// 启动前已写入的事件由管理员连接时的待处理补发覆盖，这里不再广播
+	if _, err := relay.poll(time.Now()); err != nil {
+		log.Printf("拉取危机事件失败: %v", err)
+	}
+
+	wake := make(chan struct{}, 1)
+	if cache.Rdb != nil {
+		go func() {
+			sub := cache.Rdb.Subscribe(context.Background(), AlertChannel)
+			for range sub.Channel() {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(alertPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-wake:
+			case <-ticker.C:
+			}
+
+			incidents, err := relay.poll(time.Now())
+			if err != nil {
+				log.Printf("拉取危机事件失败: %v", err)
+				continue
+			}
+			for _, incident := range incidents {
+				broadcastAlert(buildCrisisAlert(incident))
+			}
+		}
+	}()
+}
+
+// alertRelay 记录回看窗口内已广播的危机事件
+type alertRelay struct {
+	delivered map[uint]time.Time // 事件ID -> 创建时间，移出窗口后清理
+}
+
+func newAlertRelay() *alertRelay {
+	return &alertRelay{delivered: make(map[uint]time.Time)}
+}
+
+// poll 返回回看窗口内尚未广播过的危机事件，并记为已广播
+func (r *alertRelay) poll(now time.Time) ([]models.ModerationIncident, error) {
+	since := now.Add(-alertRelayWindow)
+	var incidents []models.ModerationIncident
+	if err := database.DB.Where("severity = ? AND created_at >= ?", models.IncidentSeverityCrisis, since).
+		Order("id ASC").Find(&incidents).Error; err != nil {
+		return nil, err
+	}
+
+	for id, createdAt := range r.delivered {
+		if createdAt.Before(since) {
+			delete(r.delivered, id)
+		}
+	}
+	fresh := incidents[:0]
+	for _, incident := range incidents {
+		if _, ok := r.delivered[incident.ID]; ok {
+			continue
+		}
+		r.delivered[incident.ID] = incident.CreatedAt
+		fresh = append(fresh, incident)
+	}
+	return fresh, nil
+}
+
+func buildCrisisAlert(incident models.ModerationIncident) []byte {
+	alert := CrisisAlert{Incident: incident}
+
+	var user models.User
+	if database.DB.Select("username").First(&user, incident.SenderID).Error == nil {
+		alert.SenderUsername = user.Username
+	}
+	var session models.ChatSession
+	if database.DB.Select("order_id").First(&session, incident.SessionID).Error == nil {
+		alert.OrderID = session.OrderID
+	}
+
+	msg, _ := json.Marshal(gin.H{
+		"type": "crisis_alert",
+		"data": alert,
+	})
+	return msg
+}
+
+func broadcastAlert(msg []byte) {
+	alertHub.mu.RLock()
+	defer alertHub.mu.RUnlock()
+
+	if len(alertHub.clients) == 0 {
+		log.Printf("危机告警无值班管理员在线")
+		return
+	}
+	for client := range alertHub.clients {
+		select {
+		case client.Send <- msg:
+		default:
+		}
+	}
+}
+
+func (c *alertClient) close() {
+	alertHub.mu.Lock()
+	if _, ok := alertHub.clients[c]; ok {
+		delete(alertHub.clients, c)
+		close(c.Send)
+		log.Printf("值班管理员下线: adminID=%d", c.AdminID)
+	}
+	alertHub.mu.Unlock()
+}
+
+// readPump 告警通道只下行，读取仅用于感知断开和心跳
+func (c *alertClient) readPump() {
+	defer func() {
+		c.close()
+		c.Conn.Close()
+	}()
+
+	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.Conn.SetPongHandler(func(string) error {
+		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+	for {
+		if _, _, err := c.Conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *alertClient) writePump() {
+	ticker := time.NewTicker(54 * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if !ok {
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
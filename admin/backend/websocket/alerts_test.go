@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"akrick.com/mychat/admin/backend/database"
+	"akrick.com/mychat/admin/backend/models"
+	"akrick.com/mychat/testutil"
+)
+
+func TestAlertRelayPicksUpLateCommits(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	database.DB = db
+	now := time.Now()
+
+	incident := func(id uint, severity int, createdAt time.Time) *models.ModerationIncident {
+		return &models.ModerationIncident{
+			ID: id, SessionID: ids.Session.ID, SenderID: ids.Client.ID, Category: "self_harm",
+			Action: "flag", Severity: severity, CreatedAt: createdAt,
+		}
+	}
+
+	relay := newAlertRelay()
+	db.Create(incident(10, models.IncidentSeverityCrisis, now))
+	db.Create(incident(11, models.IncidentSeverityHigh, now))
+	if got, _ := relay.poll(now); len(got) != 1 || got[0].ID != 10 {
+		t.Fatalf("first poll = %+v, want incident 10", got)
+	}
+	if got, _ := relay.poll(now); len(got) != 0 {
+		t.Fatalf("second poll rebroadcast %+v", got)
+	}
+
+	// 较早分配ID、较晚提交的危机事件不能因为ID低于已广播的事件而漏掉
+	db.Create(incident(5, models.IncidentSeverityCrisis, now.Add(-30*time.Second)))
+	if got, _ := relay.poll(now); len(got) != 1 || got[0].ID != 5 {
+		t.Fatalf("poll after late commit = %+v, want incident 5", got)
+	}
+
+	// 移出回看窗口的记录被清理
+	later := now.Add(alertRelayWindow + time.Minute)
+	if got, _ := relay.poll(later); len(got) != 0 {
+		t.Fatalf("poll outside window = %+v", got)
+	}
+	if len(relay.delivered) != 0 {
+		t.Fatalf("delivered not pruned: %v", relay.delivered)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
 	"akrick.com/mychat/admin/backend/utils"
+	"akrick.com/mychat/counselorstats"
+	apimodels "akrick.com/mychat/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -282,9 +284,7 @@ func (c *Client) handleJoin(wsMsg WSMessage) {
 
 	// 更新会话管理器
 	if session.Status == 1 {
-		var counselor models.Counselor
-		database.DB.First(&counselor, session.CounselorID)
-		sessionManager.StartSession(sessionID, session.UserID, session.CounselorID, counselor.Price)
+		sessionManager.StartSession(sessionID, session.UserID, session.CounselorID, sessionPrice(session.OrderID, session.CounselorID))
 	}
 
 	// 发送加入成功消息
@@ -322,7 +322,7 @@ func (c *Client) startSession(sessionID uint) {
 			SessionID: sessionID,
 			Data: gin.H{
 				"start_time": now,
-				"price":      session.Counselor.Price,
+				"price":      sessionPrice(session.OrderID, session.CounselorID),
 			},
 		})
 
@@ -414,8 +414,8 @@ func (c *Client) handleMessage(wsMsg WSMessage) {
 func (c *Client) handleLeave(wsMsg WSMessage) {
 	sessionID := wsMsg.SessionID
 
-	// 查询会话
-	var session models.ChatSession
+	// 查询会话（结束会话经 api 服务的 counselorstats，使用其模型）
+	var session apimodels.ChatSession
 	if err := database.DB.Where("id = ?", sessionID).First(&session).Error; err != nil {
 		return
 	}
@@ -460,18 +460,26 @@ func (c *Client) handleLeave(wsMsg WSMessage) {
 	}
 }
 
+// sessionPrice 会话计费单价：取下单时锁定的单价，咨询师调价不影响已下单的咨询；订单未记录单价时按咨询师当前单价
+func sessionPrice(orderID, counselorID uint) float64 {
+	var order models.Order
+	if err := database.DB.Select("unit_price").First(&order, orderID).Error; err == nil && order.UnitPrice > 0 {
+		return order.UnitPrice
+	}
+	var counselor models.Counselor
+	database.DB.Select("price").First(&counselor, counselorID)
+	return counselor.Price
+}
+
 // 结束会话并计费
-func (c *Client) endSession(sessionID uint, session models.ChatSession) {
+func (c *Client) endSession(sessionID uint, session apimodels.ChatSession) {
 	now := time.Now()
 	
 	// 计算时长
 	duration := int(now.Sub(*session.StartTime).Seconds())
 	
-	// 查询咨询师获取单价
-	var counselor models.Counselor
-	database.DB.First(&counselor, session.CounselorID)
-	
-	pricePerMinute := counselor.Price
+	// 按下单时锁定的单价计费
+	pricePerMinute := sessionPrice(session.OrderID, session.CounselorID)
 	
 	// 计算总金额（按分钟向上取整）
 	durationMinutes := (duration + 59) / 60
@@ -484,14 +492,19 @@ func (c *Client) endSession(sessionID uint, session models.ChatSession) {
 	platformFee := totalAmount * 0.30
 	counselorFee := totalAmount * 0.70
 	
-	// 更新会话
-	database.DB.Model(&session).Updates(map[string]interface{}{
-		"status":      2,
-		"end_time":    now,
-		"duration":    duration,
-		"price":       pricePerMinute,
+	// 更新会话；双方同时结束时只有一方继续计费
+	ended, err := counselorstats.EndSession(database.DB, &session, map[string]interface{}{
+		"end_time":     now,
+		"duration":     duration,
+		"price":        pricePerMinute,
 		"total_amount": totalAmount,
 	})
+	if err != nil || !ended {
+		if err != nil {
+			log.Printf("结束会话失败: sessionID=%d, err=%v", sessionID, err)
+		}
+		return
+	}
 	
 	// 创建计费记录
 	billing := models.ChatBilling{
@@ -510,7 +523,7 @@ func (c *Client) endSession(sessionID uint, session models.ChatSession) {
 	
 	// 更新咨询师账户
 	var account models.CounselorAccount
-	err := database.DB.Where("counselor_id = ?", session.CounselorID).First(&account).Error
+	err = database.DB.Where("counselor_id = ?", session.CounselorID).First(&account).Error
 	if err != nil {
 		account = models.CounselorAccount{
 			CounselorID: session.CounselorID,
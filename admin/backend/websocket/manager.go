@@ -10,6 +10,7 @@ import (
 	"akrick.com/mychat/admin/backend/cache"
 	"akrick.com/mychat/admin/backend/database"
 	"akrick.com/mychat/admin/backend/models"
+	apimodels "akrick.com/mychat/models"
 )
 
 // SessionManager 会话管理器
@@ -142,7 +143,7 @@ func (sm *SessionManager) handleSessionTimeout(sessionID uint) {
 	sm.EndSession(sessionID)
 
 	// 查询会话并计费
-	var sessionModel models.ChatSession
+	var sessionModel apimodels.ChatSession
 	if err := database.DB.First(&sessionModel, sessionID).Error; err == nil {
 		if sessionModel.Status == 1 {
 			// 使用client的endSession方法
@@ -0,0 +1,291 @@
+package attachment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+)
+
+// 会话附件参数
+const (
+	StorageDir       = "./storage/chat" // 附件存储目录（不对外静态暴露，只能经签名链接下载）
+	MaxFileSize      = 20 * 1024 * 1024 // 附件大小上限
+	MaxVoiceDuration = 60 * time.Second // 语音消息时长上限
+	URLTTL           = 2 * time.Hour    // 下载链接有效期
+)
+
+var (
+	ErrTooLarge     = errors.New("文件大小不能超过20MB")
+	ErrUnsupported  = errors.New("不支持的文件类型")
+	ErrVoiceTooLong = errors.New("语音时长不能超过60秒")
+	ErrNotFound     = errors.New("附件不存在")
+	ErrForbidden    = errors.New("附件不属于当前会话")
+	ErrNoSecret     = errors.New("未配置附件下载链接签名密钥 " + SecretEnv)
+)
+
+// SecretEnv 下载链接签名密钥环境变量（至少32个字符）；API 服务和 WebSocket 服务须配置相同的值，否则互相签发的链接无法校验
+const SecretEnv = "MYCHAT_FILE_URL_SECRET"
+
+const minSecretLen = 32
+
+// 下载链接签名密钥，由 Init 从环境变量读取
+var urlSecret []byte
+
+// Init 读取下载链接签名密钥；未配置或过短时返回错误，服务应拒绝启动
+func Init() error {
+	secret := strings.TrimSpace(os.Getenv(SecretEnv))
+	if secret == "" {
+		return ErrNoSecret
+	}
+	if len(secret) < minSecretLen {
+		return fmt.Errorf("%s 长度不能少于%d个字符", SecretEnv, minSecretLen)
+	}
+	urlSecret = []byte(secret)
+	return nil
+}
+
+// 允许作为语音消息的扩展名（浏览器录音多为 webm/ogg，小程序多为 mp3/aac）
+var audioExts = map[string]bool{
+	".mp3": true, ".wav": true, ".m4a": true, ".aac": true,
+	".amr": true, ".ogg": true, ".oga": true, ".opus": true, ".webm": true,
+}
+
+// 允许生成缩略图的图片类型
+var imageMimes = map[string]bool{
+	"image/jpeg": true, "image/png": true, "image/gif": true,
+}
+
+// Save 保存会话附件并生成元数据（图片尺寸和缩略图、语音时长）
+// kind 为消息内容类型 image/audio/file，为空时按文件内容推断；
+// declaredDuration 为客户端上报的语音时长(毫秒)，仅在服务端无法解析时使用
+func Save(sessionID, uploaderID uint, kind string, fh *multipart.FileHeader, declaredDuration int) (*models.File, error) {
+	if fh.Size > MaxFileSize {
+		return nil, ErrTooLarge
+	}
+
+	ext := strings.ToLower(filepath.Ext(fh.Filename))
+	if ext == "" {
+		return nil, ErrUnsupported
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// 按文件内容嗅探MIME，不信任扩展名
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	mimeType := http.DetectContentType(head[:n])
+	if strings.HasPrefix(mimeType, "text/html") || strings.Contains(mimeType, "xml") {
+		return nil, ErrUnsupported
+	}
+
+	if kind == "" {
+		switch {
+		case imageMimes[mimeType]:
+			kind = models.MessageTypeImage
+		case audioExts[ext]:
+			kind = models.MessageTypeAudio
+		default:
+			kind = models.MessageTypeFile
+		}
+	}
+	switch kind {
+	case models.MessageTypeImage:
+		if !imageMimes[mimeType] {
+			return nil, ErrUnsupported
+		}
+	case models.MessageTypeAudio:
+		if !audioExts[ext] {
+			return nil, ErrUnsupported
+		}
+	case models.MessageTypeFile:
+	default:
+		return nil, ErrUnsupported
+	}
+
+	dir := filepath.Join(StorageDir, strconv.FormatUint(uint64(sessionID), 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	fileName := fmt.Sprintf("%d_%d%s", uploaderID, time.Now().UnixNano(), ext)
+	filePath := filepath.Join(dir, fileName)
+	if err := writeFile(filePath, head[:n], src); err != nil {
+		return nil, err
+	}
+
+	file := models.File{
+		FileName:     fileName,
+		OriginalName: fh.Filename,
+		FilePath:     filePath,
+		FileSize:     fh.Size,
+		MimeType:     mimeType,
+		UploaderID:   uploaderID,
+		RelationID:   sessionID,
+		RelationType: models.FileRelationSession,
+		Status:       1,
+	}
+
+	switch kind {
+	case models.MessageTypeImage:
+		file.FileType = models.FileTypeImage
+		info, err := ProbeImage(filePath)
+		if err != nil {
+			os.Remove(filePath)
+			return nil, ErrUnsupported
+		}
+		file.Width, file.Height = info.Width, info.Height
+
+		thumbPath := strings.TrimSuffix(filePath, ext) + "_thumb.jpg"
+		if err := MakeThumbnail(filePath, thumbPath, info); err != nil {
+			os.Remove(filePath)
+			return nil, err
+		}
+		file.ThumbPath = thumbPath
+
+	case models.MessageTypeAudio:
+		file.FileType = models.FileTypeAudio
+		if file.MimeType == "application/octet-stream" {
+			file.MimeType = "audio/" + strings.TrimPrefix(ext, ".")
+		}
+		d, ok, err := ProbeAudioDuration(filePath)
+		if err != nil {
+			os.Remove(filePath)
+			return nil, err
+		}
+		if !ok {
+			d = time.Duration(max(declaredDuration, 0)) * time.Millisecond
+		}
+		if d > MaxVoiceDuration {
+			os.Remove(filePath)
+			return nil, ErrVoiceTooLong
+		}
+		file.Duration = int(d / time.Millisecond)
+
+	default:
+		file.FileType = models.FileTypeDocument
+	}
+
+	// 先占位保存，拿到ID后再写入稳定的下载路径
+	file.FileURL = "/api/chat/file"
+	if err := database.DB.Create(&file).Error; err != nil {
+		removeFiles(&file)
+		return nil, err
+	}
+	file.FileURL = fmt.Sprintf("/api/chat/file/%d", file.ID)
+	database.DB.Model(&file).Update("file_url", file.FileURL)
+
+	return &file, nil
+}
+
+// ForMessage 校验附件可用于发送消息：必须是发送者本人上传到该会话的有效文件
+func ForMessage(fileID, sessionID, senderID uint) (*models.File, error) {
+	var file models.File
+	if err := database.DB.Where("id = ? AND status = 1", fileID).First(&file).Error; err != nil {
+		return nil, ErrNotFound
+	}
+	if file.RelationType != models.FileRelationSession || file.RelationID != sessionID || file.UploaderID != senderID {
+		return nil, ErrForbidden
+	}
+	return &file, nil
+}
+
+// Kind 返回附件对应的消息内容类型
+func Kind(file *models.File) string {
+	switch file.FileType {
+	case models.FileTypeImage:
+		return models.MessageTypeImage
+	case models.FileTypeAudio:
+		return models.MessageTypeAudio
+	default:
+		return models.MessageTypeFile
+	}
+}
+
+// SignedURL 生成绑定查看者的限时下载链接
+func SignedURL(fileID, viewerID uint, thumb bool) string {
+	exp := time.Now().Add(URLTTL).Unix()
+	q := url.Values{}
+	q.Set("uid", strconv.FormatUint(uint64(viewerID), 10))
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	if thumb {
+		q.Set("thumb", "1")
+	}
+	q.Set("sig", sign(fileID, viewerID, exp, thumb))
+	return fmt.Sprintf("/api/chat/file/%d?%s", fileID, q.Encode())
+}
+
+// Verify 校验下载链接签名和有效期
+func Verify(fileID, viewerID uint, exp int64, thumb bool, sig string) bool {
+	if time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sign(fileID, viewerID, exp, thumb)), []byte(sig))
+}
+
+// Decorate 为消息列表填充查看者专属的下载链接
+func Decorate(messages []models.ChatMessage, viewerID uint) {
+	for i := range messages {
+		DecorateMessage(&messages[i], viewerID)
+	}
+}
+
+// DecorateMessage 为单条消息填充查看者专属的下载链接
+func DecorateMessage(message *models.ChatMessage, viewerID uint) {
+	if message.FileID == nil {
+		return
+	}
+	message.DownloadURL = SignedURL(*message.FileID, viewerID, false)
+	if message.ContentType == models.MessageTypeImage {
+		message.ThumbURL = SignedURL(*message.FileID, viewerID, true)
+	}
+}
+
+func sign(fileID, viewerID uint, exp int64, thumb bool) string {
+	// 空密钥签出的链接任何人都能伪造，未初始化时宁可请求失败
+	if len(urlSecret) == 0 {
+		panic(ErrNoSecret)
+	}
+	mac := hmac.New(sha256.New, urlSecret)
+	fmt.Fprintf(mac, "%d:%d:%d:%t", fileID, viewerID, exp, thumb)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeFile 写入文件（head 为嗅探时已读出的头部）
+func writeFile(path string, head []byte, rest io.Reader) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := dst.Write(head); err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, rest)
+	return err
+}
+
+func removeFiles(file *models.File) {
+	os.Remove(file.FilePath)
+	if file.ThumbPath != "" {
+		os.Remove(file.ThumbPath)
+	}
+}
@@ -0,0 +1,45 @@
+package attachment
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInitRequiresSecret(t *testing.T) {
+	t.Cleanup(func() { urlSecret = nil })
+
+	t.Setenv(SecretEnv, "")
+	if err := Init(); !errors.Is(err, ErrNoSecret) {
+		t.Fatalf("Init without secret = %v, want ErrNoSecret", err)
+	}
+	t.Setenv(SecretEnv, "too-short")
+	if err := Init(); err == nil {
+		t.Fatal("Init with short secret succeeded")
+	}
+	if urlSecret != nil {
+		t.Fatal("invalid secret was loaded")
+	}
+
+	t.Setenv(SecretEnv, "0123456789abcdef0123456789abcdef")
+	if err := Init(); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+	exp := time.Now().Add(URLTTL).Unix()
+	if !Verify(1, 2, exp, false, sign(1, 2, exp, false)) {
+		t.Fatal("signature does not verify")
+	}
+	if Verify(1, 3, exp, false, sign(1, 2, exp, false)) {
+		t.Fatal("signature verified for another viewer")
+	}
+}
+
+func TestSignWithoutSecretPanics(t *testing.T) {
+	urlSecret = nil
+	defer func() {
+		if recover() == nil {
+			t.Fatal("sign without secret did not panic")
+		}
+	}()
+	sign(1, 2, time.Now().Unix(), false)
+}
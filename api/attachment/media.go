@@ -0,0 +1,245 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"time"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// 缩略图参数
+const (
+	ThumbMaxSide   = 320        // 缩略图最长边(像素)
+	ThumbQuality   = 80         // 缩略图JPEG质量
+	MaxImagePixels = 40_000_000 // 允许解码的最大像素数，防止解压炸弹
+)
+
+var ErrImageTooLarge = errors.New("图片尺寸过大")
+
+// ImageInfo 图片探测结果
+type ImageInfo struct {
+	Width  int
+	Height int
+	Format string
+}
+
+// ProbeImage 读取图片尺寸（只解析头部，不解码像素）
+func ProbeImage(path string) (*ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageInfo{Width: cfg.Width, Height: cfg.Height, Format: format}, nil
+}
+
+// MakeThumbnail 生成JPEG缩略图，原图小于缩略图尺寸时按原尺寸输出
+func MakeThumbnail(srcPath, dstPath string, info *ImageInfo) error {
+	if info.Width*info.Height > MaxImagePixels {
+		return ErrImageTooLarge
+	}
+
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	w, h := fitSize(info.Width, info.Height, ThumbMaxSide)
+	thumb := downscale(src, w, h)
+
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return jpeg.Encode(out, thumb, &jpeg.Options{Quality: ThumbQuality})
+}
+
+// fitSize 按比例缩放到最长边不超过 maxSide
+func fitSize(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+	if w >= h {
+		return maxSide, max(h*maxSide/w, 1)
+	}
+	return max(w*maxSide/h, 1), maxSide
+}
+
+// downscale 区域平均缩放（透明区域按白色底合成，便于输出JPEG）
+func downscale(src image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*sh/h
+		y1 := max(b.Min.Y+(y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*sw/w
+			x1 := max(b.Min.X+(x+1)*sw/w, x0+1)
+
+			// 区域过大时抽样，最多每轴取4个点
+			stepX := max((x1-x0)/4, 1)
+			stepY := max((y1-y0)/4, 1)
+
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy += stepY {
+				for sx := x0; sx < x1; sx += stepX {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					// 与白色背景合成
+					r += pr + (0xffff - pa)
+					g += pg + (0xffff - pa)
+					bl += pb + (0xffff - pa)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// ProbeAudioDuration 解析音频时长，目前支持 WAV 和 MP3，其它格式返回 ok=false
+func ProbeAudioDuration(path string) (d time.Duration, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+
+	head := make([]byte, 64*1024)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, false, err
+	}
+	head = head[:n]
+
+	switch {
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		d, ok = wavDuration(head)
+	default:
+		d, ok = mp3Duration(head, stat.Size())
+	}
+	return d, ok, nil
+}
+
+// wavDuration 根据 fmt 块的字节率和 data 块大小计算时长
+func wavDuration(b []byte) (time.Duration, bool) {
+	var byteRate uint32
+	for off := 12; off+8 <= len(b); {
+		id := string(b[off : off+4])
+		size := binary.LittleEndian.Uint32(b[off+4 : off+8])
+		body := off + 8
+		switch id {
+		case "fmt ":
+			if body+12 > len(b) {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(b[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			return time.Duration(float64(size) / float64(byteRate) * float64(time.Second)), true
+		}
+		off = body + int(size) + int(size&1)
+	}
+	return 0, false
+}
+
+// MPEG1 Layer III 比特率表(kbps)，MPEG2/2.5 使用第二张表
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3Samplerate = map[int][3]int{
+		3: {44100, 48000, 32000}, // MPEG1
+		2: {22050, 24000, 16000}, // MPEG2
+		0: {11025, 12000, 8000},  // MPEG2.5
+	}
+)
+
+// mp3Duration 优先读取 Xing/Info 帧数，否则按首帧比特率估算（CBR）
+func mp3Duration(b []byte, fileSize int64) (time.Duration, bool) {
+	off := 0
+	// 跳过 ID3v2 标签
+	if len(b) >= 10 && string(b[0:3]) == "ID3" {
+		off = 10 + (int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f))
+	}
+
+	// 查找帧同步字
+	for ; off+4 <= len(b); off++ {
+		if b[off] == 0xff && b[off+1]&0xe0 == 0xe0 {
+			break
+		}
+	}
+	if off+4 > len(b) {
+		return 0, false
+	}
+
+	hdr := b[off : off+4]
+	version := int(hdr[1]>>3) & 0x03
+	layer := int(hdr[1]>>1) & 0x03
+	bitrateIdx := int(hdr[2]>>4) & 0x0f
+	srIdx := int(hdr[2]>>2) & 0x03
+	rates, okVer := mp3Samplerate[version]
+	if !okVer || layer != 1 || srIdx == 3 {
+		return 0, false
+	}
+	sampleRate := rates[srIdx]
+
+	bitrate := mp3BitratesV2[bitrateIdx]
+	samplesPerFrame := 576
+	if version == 3 {
+		bitrate = mp3BitratesV1[bitrateIdx]
+		samplesPerFrame = 1152
+	}
+	if bitrate == 0 {
+		return 0, false
+	}
+
+	// Xing/Info 头（VBR）记录总帧数
+	for _, tag := range [][]byte{[]byte("Xing"), []byte("Info")} {
+		if i := bytes.Index(b[off:min(off+64, len(b))], tag); i >= 0 {
+			p := off + i + 4
+			if p+8 <= len(b) && b[p+3]&0x01 != 0 {
+				frames := binary.BigEndian.Uint32(b[p+4 : p+8])
+				secs := float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+				return time.Duration(secs * float64(time.Second)), true
+			}
+		}
+	}
+
+	secs := float64(fileSize-int64(off)) * 8 / float64(bitrate*1000)
+	return time.Duration(secs * float64(time.Second)), true
+}
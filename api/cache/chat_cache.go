@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"akrick.com/mychat/models"
@@ -82,14 +84,33 @@ func ClearOnlineStatus(ctx context.Context, userID uint) {
 	Rdb.Del(ctx, cacheKey)
 }
 
+// OnlineUserIDs 返回当前在线的用户ID（扫描在线状态键）
+func OnlineUserIDs(ctx context.Context) ([]uint, error) {
+	var ids []uint
+	iter := Rdb.Scan(ctx, 0, "user:online:*", 500).Iterator()
+	for iter.Next(ctx) {
+		id, err := strconv.ParseUint(strings.TrimPrefix(iter.Val(), "user:online:"), 10, 64)
+		if err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, iter.Err()
+}
+
 // DeleteChatSessionCache 删除聊天会话缓存
 func DeleteChatSessionCache(ctx context.Context, sessionID uint) {
+	if Rdb == nil {
+		return
+	}
 	cacheKey := fmt.Sprintf("chat:session:%d", sessionID)
 	Rdb.Del(ctx, cacheKey)
 }
 
 // DeleteCounselorAccountCache 删除咨询师账户缓存
 func DeleteCounselorAccountCache(ctx context.Context, counselorID uint) {
+	if Rdb == nil {
+		return
+	}
 	cacheKey := fmt.Sprintf("counselor:account:%d", counselorID)
 	Rdb.Del(ctx, cacheKey)
 }
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// 身份映射缓存
+var IdentityGroup singleflight.Group
+
+func getUserCounselorCacheKey(userID uint) string {
+	return fmt.Sprintf("identity:user:%d:counselor", userID)
+}
+
+func getCounselorUserCacheKey(counselorID uint) string {
+	return fmt.Sprintf("identity:counselor:%d:user", counselorID)
+}
+
+// GetCounselorIDByUser 获取用户对应的咨询师ID（非咨询师返回0）
+// 咨询师表与用户表是两套ID，聊天相关的权限判断必须先经过这里换算
+func GetCounselorIDByUser(ctx context.Context, userID uint) (uint, error) {
+	return lookupIdentity(ctx, getUserCounselorCacheKey(userID), func() (uint, error) {
+		var counselor models.Counselor
+		err := database.DB.Select("id").Where("user_id = ? AND status = 1", userID).First(&counselor).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return counselor.ID, err
+	})
+}
+
+// GetUserIDByCounselor 获取咨询师对应的用户ID（未绑定用户返回0）
+func GetUserIDByCounselor(ctx context.Context, counselorID uint) (uint, error) {
+	return lookupIdentity(ctx, getCounselorUserCacheKey(counselorID), func() (uint, error) {
+		var counselor models.Counselor
+		err := database.DB.Select("user_id").First(&counselor, counselorID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return counselor.UserID, err
+	})
+}
+
+// DeleteIdentityCache 删除用户与咨询师的身份映射缓存（咨询师创建、绑定、禁用时调用）
+func DeleteIdentityCache(ctx context.Context, userID, counselorID uint) {
+	if Rdb == nil {
+		return
+	}
+	keys := make([]string, 0, 2)
+	if userID != 0 {
+		keys = append(keys, getUserCounselorCacheKey(userID))
+	}
+	if counselorID != 0 {
+		keys = append(keys, getCounselorUserCacheKey(counselorID))
+	}
+	if len(keys) > 0 {
+		Rdb.Del(ctx, keys...)
+	}
+}
+
+// lookupIdentity 带缓存和singleflight的ID映射查询，Redis不可用时直接查库
+func lookupIdentity(ctx context.Context, cacheKey string, load func() (uint, error)) (uint, error) {
+	if Rdb == nil {
+		return load()
+	}
+
+	result, err, _ := IdentityGroup.Do(cacheKey, func() (any, error) {
+		// 1. 先从缓存获取（"0" 表示无映射，同样命中缓存）
+		if cached, err := Rdb.Get(ctx, cacheKey).Result(); err == nil {
+			if id, err := strconv.ParseUint(cached, 10, 64); err == nil {
+				return uint(id), nil
+			}
+		}
+
+		// 2. 缓存未命中，从数据库查询
+		id, err := load()
+		if err != nil {
+			return uint(0), err
+		}
+
+		// 3. 写入缓存；无映射的结果只缓存5分钟，避免新入驻的咨询师长时间无法识别
+		ttl := 30*time.Minute + time.Duration(rand.Intn(10))*time.Minute
+		if id == 0 {
+			ttl = 5 * time.Minute
+		}
+		Rdb.Set(ctx, cacheKey, strconv.FormatUint(uint64(id), 10), ttl)
+
+		return id, nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.(uint), nil
+}
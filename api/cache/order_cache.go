@@ -19,12 +19,18 @@ type OrderCacheData struct {
 	CounselorID  uint       `json:"counselor_id"`
 	Duration     int        `json:"duration"`
 	Amount       float64    `json:"amount"`
+	UnitPrice    float64    `json:"unit_price"`
 	Status       int        `json:"status"`
 	ScheduleTime time.Time  `json:"schedule_time"`
 	Notes        string     `json:"notes"`
 	PayTime      *time.Time `json:"pay_time"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
+
+	OriginalAmount float64 `json:"original_amount"`
+	Discount       float64 `json:"discount"`
+	CouponID       *uint   `json:"coupon_id,omitempty"`
+	PriceBreakdown string  `json:"price_breakdown"`
 }
 
 type CounselorCacheData struct {
@@ -35,7 +41,10 @@ type CounselorCacheData struct {
 	Bio       string    `json:"bio"`
 	Specialty string    `json:"specialty"`
 	Price     float64   `json:"price"`
+	Level     string    `json:"level"`
+	PriceRules string   `json:"price_rules"`
 	YearsExp  int       `json:"years_exp"`
+	Gender    string    `json:"gender"`
 	Rating    float64   `json:"rating"`
 	Status    int       `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
@@ -78,12 +87,18 @@ func GetOrderWithCache(ctx context.Context, orderID uint) (*OrderCacheData, erro
 			CounselorID:  order.CounselorID,
 			Duration:     order.Duration,
 			Amount:       order.Amount,
+			UnitPrice:    order.UnitPrice,
 			Status:       order.Status,
 			ScheduleTime: order.ScheduleTime,
 			Notes:        order.Notes,
 			PayTime:      order.PayTime,
 			CreatedAt:    order.CreatedAt,
 			UpdatedAt:    order.UpdatedAt,
+
+			OriginalAmount: order.OriginalAmount,
+			Discount:       order.Discount,
+			CouponID:       order.CouponID,
+			PriceBreakdown: order.PriceBreakdown,
 		}
 
 		data, _ := json.Marshal(orderData)
@@ -131,7 +146,10 @@ func GetCounselorWithCache(ctx context.Context, counselorID uint) (*CounselorCac
 			Bio:       counselor.Bio,
 			Specialty: counselor.Specialty,
 			Price:     counselor.Price,
+			Level:     counselor.Level,
+			PriceRules: counselor.PriceRules,
 			YearsExp:  counselor.YearsExp,
+			Gender:    counselor.Gender,
 			Rating:    counselor.Rating,
 			Status:    counselor.Status,
 			CreatedAt: counselor.CreatedAt,
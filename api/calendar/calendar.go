@@ -0,0 +1,182 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/sysconfig"
+)
+
+// iCalendar（RFC 5545）订阅与导出
+// 每个订单对应一个 VEVENT，UID 固定；改约时 SEQUENCE 递增、取消后 STATUS:CANCELLED，日历客户端据此更新或移除
+
+const (
+	prodID     = "-//MyChat//Counseling Calendar//ZH"
+	timeLayout = "20060102T150405Z"
+
+	// historyDays 订阅中保留的历史预约天数
+	historyDays = 30
+)
+
+// Event 日历中的一次预约
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	Modified    time.Time
+	Sequence    int
+	Cancelled   bool
+}
+
+// FeedOrders 订阅中的订单：近30天及以后已支付、已完成的预约，以及支付后取消或退款的预约（用于从日历中移除）
+func FeedOrders(p *identity.Principal) ([]models.Order, error) {
+	query := database.DB.Preload("User").Preload("Counselor").
+		Where("type = ? AND schedule_time >= ?", models.OrderTypeSession, time.Now().AddDate(0, 0, -historyDays)).
+		Where("status IN ? OR (status IN ? AND pay_time IS NOT NULL)",
+			[]int{models.OrderStatusPaid, models.OrderStatusCompleted},
+			[]int{models.OrderStatusCancelled, models.OrderStatusRefunded})
+	if p.IsCounselor() {
+		query = query.Where("user_id = ? OR counselor_id = ?", p.UserID, p.CounselorID)
+	} else {
+		query = query.Where("user_id = ?", p.UserID)
+	}
+
+	var orders []models.Order
+	err := query.Order("schedule_time ASC").Find(&orders).Error
+	return orders, err
+}
+
+// Events 将订单转换为日历事件，订单需预加载 User 和 Counselor
+func Events(p *identity.Principal, orders []models.Order) []Event {
+	domain := SiteDomain()
+	events := make([]Event, 0, len(orders))
+	for i := range orders {
+		events = append(events, fromOrder(p, &orders[i], domain))
+	}
+	return events
+}
+
+func fromOrder(p *identity.Principal, order *models.Order, domain string) Event {
+	summary := "心理咨询 - " + order.Counselor.Name
+	with := "咨询师：" + order.Counselor.Name
+	if p.CounselorID != 0 && p.CounselorID == order.CounselorID {
+		summary = "心理咨询 - " + order.User.Username
+		with = "来访者：" + order.User.Username
+	}
+
+	link := DeepLink(domain, order)
+	cancelled := order.Status == models.OrderStatusCancelled || order.Status == models.OrderStatusRefunded
+	if cancelled {
+		summary = "[已取消] " + summary
+	}
+
+	return Event{
+		UID:     fmt.Sprintf("order-%d@mychat", order.ID),
+		Summary: summary,
+		Description: strings.Join([]string{
+			with,
+			fmt.Sprintf("时长：%d分钟", order.Duration),
+			"订单号：" + order.OrderNo,
+			"查看订单：" + link,
+		}, "\n"),
+		URL:      link,
+		Start:    order.ScheduleTime,
+		End:      order.ScheduleTime.Add(time.Duration(order.Duration) * time.Minute),
+		Modified: order.UpdatedAt,
+		// 改约和取消都需要递增序号，客户端才会覆盖旧版本
+		Sequence:  order.RescheduleCount + boolInt(cancelled),
+		Cancelled: cancelled,
+	}
+}
+
+// SiteDomain 网站地址（系统配置 site_domain）
+func SiteDomain() string {
+	return sysconfig.String(sysconfig.Values("site_domain"), "site_domain", "https://mychat.com")
+}
+
+// DeepLink 订单在网站中的地址
+func DeepLink(domain string, order *models.Order) string {
+	return fmt.Sprintf("%s/orders?order_id=%d", strings.TrimRight(domain, "/"), order.ID)
+}
+
+// Build 生成 VCALENDAR 文本
+func Build(name string, events []Event) []byte {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(fold(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + prodID)
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escape(name))
+
+	now := time.Now().UTC().Format(timeLayout)
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + now)
+		line("DTSTART:" + e.Start.UTC().Format(timeLayout))
+		line("DTEND:" + e.End.UTC().Format(timeLayout))
+		line("LAST-MODIFIED:" + e.Modified.UTC().Format(timeLayout))
+		line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		line("SUMMARY:" + escape(e.Summary))
+		line("DESCRIPTION:" + escape(e.Description))
+		line("URL:" + e.URL)
+		if e.Cancelled {
+			line("STATUS:CANCELLED")
+		} else {
+			line("STATUS:CONFIRMED")
+			line("BEGIN:VALARM")
+			line("ACTION:DISPLAY")
+			line("DESCRIPTION:" + escape(e.Summary))
+			line("TRIGGER:-PT15M")
+			line("END:VALARM")
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+// escape 转义 TEXT 类型的值（RFC 5545 3.3.11）
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold 按 75 字节折行，不拆分多字节字符（RFC 5545 3.1）
+func fold(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	width, limit := 0, 75
+	for _, r := range s {
+		n := len(string(r))
+		if width+n > limit {
+			b.WriteString("\r\n ")
+			// 续行以空格开头，占用一个字节
+			width, limit = 0, 74
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	return b.String()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,217 @@
+package chatmsg
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/moderation"
+	"akrick.com/mychat/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 消息修订规则
+const (
+	EditWindow      = 15 * time.Minute // 发送后可编辑的时间窗口
+	RecallWindow    = 2 * time.Minute  // 发送后可撤回的时间窗口
+	MaxContentLen   = 5000             // 编辑后内容长度上限(字符)
+	RecalledContent = "[消息已撤回]"        // 撤回后对双方展示的占位内容
+)
+
+var (
+	ErrNotFound       = errors.New("消息不存在")
+	ErrForbidden      = errors.New("无权操作此消息")
+	ErrNotSender      = errors.New("只能操作自己发送的消息")
+	ErrRecalled       = errors.New("消息已撤回")
+	ErrNotEditable    = errors.New("只能编辑文本消息")
+	ErrEditExpired    = errors.New("超过15分钟，无法编辑")
+	ErrRecallExpired  = errors.New("超过2分钟，无法撤回")
+	ErrEmptyContent   = errors.New("消息内容不能为空")
+	ErrContentTooLong = errors.New("消息内容过长")
+	ErrSessionClosed  = errors.New("会话已结束")
+)
+
+// Edit 编辑消息，原内容写入修订审计表
+func Edit(p *identity.Principal, messageID uint, content string) (*models.ChatMessage, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, ErrEmptyContent
+	}
+	if len([]rune(content)) > MaxContentLen {
+		return nil, ErrContentTooLong
+	}
+
+	var (
+		message models.ChatMessage
+		verdict *moderation.Verdict
+		src     moderation.Source
+	)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		session, err := lockOwnMessage(tx, p, messageID, &message)
+		if err != nil {
+			return err
+		}
+		if session.Status != 0 && session.Status != 1 {
+			return ErrSessionClosed
+		}
+		if message.ContentType != models.MessageTypeText {
+			return ErrNotEditable
+		}
+		if time.Since(message.CreatedAt) > EditWindow {
+			return ErrEditExpired
+		}
+
+		// 编辑后的内容同样经过内容审核
+		src = moderation.Source{SessionID: message.SessionID, SenderID: message.SenderID, SenderType: message.SenderType}
+		if verdict, err = moderation.Screen(content, src); err != nil {
+			return err
+		}
+		content = verdict.Content
+		if message.Content == content {
+			verdict = nil
+			return nil
+		}
+
+		if err := tx.Create(revisionOf(&message, models.MessageActionEdit, p.UserID, message.SenderType)).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		message.Content = content
+		message.Revision++
+		message.EditedAt = &now
+		return tx.Model(&message).Updates(map[string]any{
+			"content":   message.Content,
+			"revision":  message.Revision,
+			"edited_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	search.Notify(message.ID)
+	moderation.Report(verdict, src, &message.ID)
+	return &message, nil
+}
+
+// Recall 撤回消息，对会话双方都不再展示原内容；原内容写入修订审计表，附件停止下载
+func Recall(p *identity.Principal, messageID uint) (*models.ChatMessage, error) {
+	var message models.ChatMessage
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockOwnMessage(tx, p, messageID, &message); err != nil {
+			return err
+		}
+		if time.Since(message.CreatedAt) > RecallWindow {
+			return ErrRecallExpired
+		}
+		return recall(tx, &message, p.UserID, message.SenderType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	search.Notify(message.ID)
+	return &message, nil
+}
+
+// Hide 仅对自己删除消息（会话双方均可操作，不影响对方）
+func Hide(p *identity.Principal, messageID uint) (*models.ChatMessage, error) {
+	var message models.ChatMessage
+	if err := database.DB.First(&message, messageID).Error; err != nil {
+		return nil, ErrNotFound
+	}
+
+	var session models.ChatSession
+	if err := database.DB.First(&session, message.SessionID).Error; err != nil {
+		return nil, ErrNotFound
+	}
+	if !p.IsParticipant(session.UserID, session.CounselorID) {
+		return nil, ErrForbidden
+	}
+
+	deletion := models.ChatMessageDeletion{MessageID: message.ID, UserID: p.UserID}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&deletion).Error; err != nil {
+		return nil, err
+	}
+	search.Notify(message.ID)
+	return &message, nil
+}
+
+// Visible 过滤掉查看者已"仅自己删除"的消息，用于消息列表查询
+func Visible(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		hidden := database.DB.Model(&models.ChatMessageDeletion{}).Select("message_id").Where("user_id = ?", userID)
+		return db.Where("id NOT IN (?)", hidden)
+	}
+}
+
+// lockOwnMessage 加锁读取消息并校验操作人是发送者本人且消息未撤回
+func lockOwnMessage(tx *gorm.DB, p *identity.Principal, messageID uint, message *models.ChatMessage) (*models.ChatSession, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(message, messageID).Error; err != nil {
+		return nil, ErrNotFound
+	}
+
+	var session models.ChatSession
+	if err := tx.First(&session, message.SessionID).Error; err != nil {
+		return nil, ErrNotFound
+	}
+
+	if !p.IsParticipant(session.UserID, session.CounselorID) {
+		return nil, ErrForbidden
+	}
+	if message.SenderID != p.UserID {
+		return nil, ErrNotSender
+	}
+	if message.RecalledAt != nil {
+		return nil, ErrRecalled
+	}
+	return &session, nil
+}
+
+// recall 执行撤回：保存原内容、替换为占位内容并停用附件
+func recall(tx *gorm.DB, message *models.ChatMessage, operatorID uint, operatorType string) error {
+	if err := tx.Create(revisionOf(message, models.MessageActionRecall, operatorID, operatorType)).Error; err != nil {
+		return err
+	}
+
+	if message.FileID != nil {
+		if err := tx.Model(&models.File{}).Where("id = ?", *message.FileID).Update("status", 0).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	message.Content = RecalledContent
+	message.ContentType = models.MessageTypeSystem
+	message.FileID = nil
+	message.FileURL = ""
+	message.File = nil
+	message.Revision++
+	message.RecalledAt = &now
+	return tx.Model(message).Updates(map[string]any{
+		"content":      message.Content,
+		"content_type": message.ContentType,
+		"file_id":      nil,
+		"file_url":     "",
+		"revision":     message.Revision,
+		"recalled_at":  now,
+	}).Error
+}
+
+func revisionOf(message *models.ChatMessage, action string, operatorID uint, operatorType string) *models.ChatMessageRevision {
+	return &models.ChatMessageRevision{
+		MessageID:    message.ID,
+		SessionID:    message.SessionID,
+		Revision:     message.Revision,
+		Action:       action,
+		ContentType:  message.ContentType,
+		Content:      message.Content,
+		FileID:       message.FileID,
+		FileURL:      message.FileURL,
+		OperatorID:   operatorID,
+		OperatorType: operatorType,
+	}
+}
@@ -0,0 +1,61 @@
+package chatmsg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/testutil"
+)
+
+func TestRecallKeepsFileInRevisionAndDisablesFile(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+
+	file := models.File{
+		FileName: "a.png", OriginalName: "a.png", FilePath: "/tmp/a.png", FileURL: "/a.png",
+		FileSize: 1, FileType: "image", UploaderID: ids.CounselorUser.ID, Status: 1,
+	}
+	db.Create(&file)
+	message := models.ChatMessage{
+		SessionID: ids.Session.ID, SenderID: ids.CounselorUser.ID, SenderType: identity.SessionRoleCounselor,
+		ContentType: models.MessageTypeImage, FileID: &file.ID, FileURL: file.FileURL,
+	}
+	db.Create(&message)
+
+	resolve := func(userID uint) *identity.Principal {
+		p, err := identity.Resolve(context.Background(), userID, "")
+		if err != nil {
+			t.Fatalf("Resolve(%d) error: %v", userID, err)
+		}
+		return p
+	}
+
+	// 用户ID等于会话 counselor_id 的用户不是参与者
+	if _, err := Recall(resolve(ids.Other.ID), message.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Recall by other user = %v, want ErrForbidden", err)
+	}
+	if _, err := Recall(resolve(ids.Client.ID), message.ID); !errors.Is(err, ErrNotSender) {
+		t.Fatalf("Recall by client = %v, want ErrNotSender", err)
+	}
+	if _, err := Recall(resolve(ids.CounselorUser.ID), message.ID); err != nil {
+		t.Fatalf("Recall error: %v", err)
+	}
+
+	var saved models.ChatMessage
+	db.First(&saved, message.ID)
+	if saved.FileID != nil || saved.FileURL != "" || saved.RecalledAt == nil || saved.Content != RecalledContent {
+		t.Fatalf("recalled message = %+v", saved)
+	}
+	var revision models.ChatMessageRevision
+	db.Where("message_id = ?", message.ID).First(&revision)
+	if revision.Action != models.MessageActionRecall || revision.FileID == nil || *revision.FileID != file.ID {
+		t.Fatalf("revision = %+v, want recall keeping file %d", revision, file.ID)
+	}
+	db.First(&file, file.ID)
+	if file.Status != 0 {
+		t.Fatalf("file status = %d, want 0", file.Status)
+	}
+}
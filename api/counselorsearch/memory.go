@@ -0,0 +1,278 @@
+package counselorsearch
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+)
+
+// memoryReloadInterval 全量刷新快照的间隔；评分、服务数随订单和评价变化，不逐条通知
+const memoryReloadInterval = time.Minute
+
+// document 快照中的咨询师
+type document struct {
+	ID           uint
+	Name         string
+	Title        string
+	Specialty    string
+	Gender       string
+	Price        float64
+	YearsExp     int
+	Rating       float64
+	ServiceCount int
+	CreatedAt    time.Time
+	Tags         map[string][]string // 按标签类型
+}
+
+type memoryEngine struct {
+	mu   sync.RWMutex
+	docs map[uint]*document
+	stop chan struct{}
+}
+
+// NewMemory 创建进程内检索引擎，加载启用咨询师的快照
+func NewMemory() (Engine, error) {
+	e := &memoryEngine{stop: make(chan struct{})}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	go e.loop()
+	return e, nil
+}
+
+func (e *memoryEngine) Name() string { return EngineMemory }
+
+func (e *memoryEngine) Close() error {
+	close(e.stop)
+	return nil
+}
+
+func (e *memoryEngine) loop() {
+	ticker := time.NewTicker(memoryReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			if err := e.reload(); err != nil {
+				log.Printf("刷新咨询师检索快照失败: %v", err)
+			}
+		}
+	}
+}
+
+// reload 全量加载启用的咨询师
+func (e *memoryEngine) reload() error {
+	docs, err := loadDocuments(database.DB.Where("status = ?", 1))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.docs = docs
+	e.mu.Unlock()
+	return nil
+}
+
+// Sync 重新加载单个咨询师，已禁用或删除的从快照中移除
+func (e *memoryEngine) Sync(counselorID uint) error {
+	docs, err := loadDocuments(database.DB.Where("id = ? AND status = ?", counselorID, 1))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if doc, ok := docs[counselorID]; ok {
+		e.docs[counselorID] = doc
+	} else {
+		delete(e.docs, counselorID)
+	}
+	return nil
+}
+
+func (e *memoryEngine) Search(ctx context.Context, q *Query) ([]uint, int64, Facets, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var allowed map[uint]bool
+	if q.IDs != nil {
+		allowed = make(map[uint]bool, len(q.IDs))
+		for _, id := range q.IDs {
+			allowed[id] = true
+		}
+	}
+
+	var matched []*document
+	counts := map[string]map[string]int64{
+		FacetSpecialty: {},
+		FacetTag:       {},
+		FacetLanguage:  {},
+		FacetGender:    {},
+	}
+	for _, doc := range e.docs {
+		if allowed != nil && !allowed[doc.ID] {
+			continue
+		}
+		ok, failed := match(doc, q)
+		if !ok {
+			continue
+		}
+		if len(failed) == 0 {
+			matched = append(matched, doc)
+		}
+		// 分面计数：文档在本维度以外的条件都满足时计入本维度
+		for _, kind := range []string{FacetSpecialty, FacetTag, FacetLanguage} {
+			if len(failed) == 0 || (len(failed) == 1 && failed[0] == kind) {
+				for _, v := range doc.Tags[kind] {
+					counts[kind][v]++
+				}
+			}
+		}
+		if doc.Gender != "" && (len(failed) == 0 || (len(failed) == 1 && failed[0] == FacetGender)) {
+			counts[FacetGender][doc.Gender]++
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if c := compare(a, b, q.SortBy); c != 0 {
+			if q.SortOrder == "asc" {
+				return c < 0
+			}
+			return c > 0
+		}
+		return a.ID > b.ID
+	})
+
+	total := int64(len(matched))
+	ids := []uint{}
+	for i := (q.Page - 1) * q.PageSize; i < len(matched) && len(ids) < q.PageSize; i++ {
+		ids = append(ids, matched[i].ID)
+	}
+
+	facets := Facets{}
+	for kind, byValue := range counts {
+		list := make([]Facet, 0, len(byValue))
+		for v, n := range byValue {
+			list = append(list, Facet{Value: v, Count: n})
+		}
+		sortFacets(list)
+		facets[kind] = list
+	}
+	return ids, total, facets, nil
+}
+
+// match 检查文档是否满足非分面条件（关键词、价格、年限、评分），并返回未满足的分面维度
+func match(doc *document, q *Query) (bool, []string) {
+	if q.Keyword != "" {
+		kw := strings.ToLower(q.Keyword)
+		if !strings.Contains(strings.ToLower(doc.Name), kw) && !strings.Contains(strings.ToLower(doc.Specialty), kw) &&
+			!strings.Contains(strings.ToLower(doc.Title), kw) {
+			return false, nil
+		}
+	}
+	if (q.PriceMin != nil && doc.Price < *q.PriceMin) || (q.PriceMax != nil && doc.Price > *q.PriceMax) ||
+		doc.YearsExp < q.YearsMin || doc.Rating < q.RatingMin {
+		return false, nil
+	}
+
+	var failed []string
+	if q.Gender != "" && doc.Gender != q.Gender {
+		failed = append(failed, FacetGender)
+	}
+	for kind, values := range tagFilters(q) {
+		if len(values) > 0 && !hasAny(doc.Tags[kind], values) {
+			failed = append(failed, kind)
+		}
+	}
+	return true, failed
+}
+
+// compare 按排序字段比较两个文档
+func compare(a, b *document, field string) int {
+	var x, y float64
+	switch field {
+	case SortPrice:
+		x, y = a.Price, b.Price
+	case SortServiceCount:
+		x, y = float64(a.ServiceCount), float64(b.ServiceCount)
+	case SortYearsExp:
+		x, y = float64(a.YearsExp), float64(b.YearsExp)
+	case SortCreatedAt:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	default:
+		x, y = a.Rating, b.Rating
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func hasAny(have, want []string) bool {
+	for _, h := range have {
+		for _, w := range want {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadDocuments 按条件加载咨询师及其统计和标签
+func loadDocuments(query *gorm.DB) (map[uint]*document, error) {
+	var counselors []models.Counselor
+	if err := query.Find(&counselors).Error; err != nil {
+		return nil, err
+	}
+	docs := make(map[uint]*document, len(counselors))
+	ids := make([]uint, 0, len(counselors))
+	for _, c := range counselors {
+		docs[c.ID] = &document{
+			ID:        c.ID,
+			Name:      c.Name,
+			Title:     c.Title,
+			Specialty: c.Specialty,
+			Gender:    c.Gender,
+			Price:     c.Price,
+			YearsExp:  c.YearsExp,
+			Rating:    c.Rating,
+			CreatedAt: c.CreatedAt,
+			Tags:      make(map[string][]string),
+		}
+		ids = append(ids, c.ID)
+	}
+	if len(ids) == 0 {
+		return docs, nil
+	}
+
+	var statsList []models.CounselorStatistics
+	if err := database.DB.Where("counselor_id IN ?", ids).Find(&statsList).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range statsList {
+		docs[s.CounselorID].ServiceCount = s.CompletedOrders
+	}
+
+	var tags []models.CounselorTag
+	if err := database.DB.Where("counselor_id IN ?", ids).Order("id").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		doc := docs[t.CounselorID]
+		doc.Tags[t.Kind] = append(doc.Tags[t.Kind], t.Value)
+	}
+	return docs, nil
+}
@@ -0,0 +1,110 @@
+package counselorsearch
+
+import (
+	"context"
+	"strings"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+)
+
+// sortColumns 排序字段对应的列，服务数取统计表的完成订单数
+var sortColumns = map[string]string{
+	SortRating:       "counselors.rating",
+	SortPrice:        "counselors.price",
+	SortServiceCount: "COALESCE(s.completed_orders, 0)",
+	SortYearsExp:     "counselors.years_exp",
+	SortCreatedAt:    "counselors.created_at",
+}
+
+type mysqlEngine struct{}
+
+// NewMySQL 创建 MySQL 检索引擎，咨询师表和标签表即索引
+func NewMySQL() (Engine, error) {
+	return &mysqlEngine{}, nil
+}
+
+func (e *mysqlEngine) Name() string { return EngineMySQL }
+
+// Sync 直接查询数据库，无需同步
+func (e *mysqlEngine) Sync(counselorID uint) error { return nil }
+
+func (e *mysqlEngine) Close() error { return nil }
+
+func (e *mysqlEngine) Search(ctx context.Context, q *Query) ([]uint, int64, Facets, error) {
+	var total int64
+	if err := e.filtered(ctx, q, "").Count(&total).Error; err != nil {
+		return nil, 0, nil, err
+	}
+
+	ids := []uint{}
+	order := sortColumns[q.SortBy] + " " + strings.ToUpper(q.SortOrder) + ", counselors.id DESC"
+	if err := e.filtered(ctx, q, "").
+		Joins("LEFT JOIN counselor_statistics s ON s.counselor_id = counselors.id").
+		Order(order).Offset((q.Page-1)*q.PageSize).Limit(q.PageSize).
+		Pluck("counselors.id", &ids).Error; err != nil {
+		return nil, 0, nil, err
+	}
+
+	facets := Facets{}
+	for _, kind := range []string{FacetSpecialty, FacetTag, FacetLanguage} {
+		var list []Facet
+		if err := database.DB.WithContext(ctx).Model(&models.CounselorTag{}).
+			Select("value, COUNT(*) AS count").
+			Where("kind = ? AND counselor_id IN (?)", kind, e.filtered(ctx, q, kind).Select("counselors.id")).
+			Group("value").Scan(&list).Error; err != nil {
+			return nil, 0, nil, err
+		}
+		sortFacets(list)
+		facets[kind] = list
+	}
+	var genders []Facet
+	if err := e.filtered(ctx, q, FacetGender).Select("counselors.gender AS value, COUNT(*) AS count").
+		Where("counselors.gender <> ''").Group("counselors.gender").Scan(&genders).Error; err != nil {
+		return nil, 0, nil, err
+	}
+	sortFacets(genders)
+	facets[FacetGender] = genders
+	return ids, total, facets, nil
+}
+
+// filtered 按检索条件筛选启用的咨询师，except 维度的条件不参与（用于计算该维度的分面）
+func (e *mysqlEngine) filtered(ctx context.Context, q *Query, except string) *gorm.DB {
+	query := database.DB.WithContext(ctx).Table("counselors").Where("counselors.status = ?", 1)
+	if q.Keyword != "" {
+		kw := "%" + escapeLike(q.Keyword) + "%"
+		query = query.Where("counselors.name LIKE ? OR counselors.specialty LIKE ? OR counselors.title LIKE ?", kw, kw, kw)
+	}
+	if q.Gender != "" && except != FacetGender {
+		query = query.Where("counselors.gender = ?", q.Gender)
+	}
+	if q.PriceMin != nil {
+		query = query.Where("counselors.price >= ?", *q.PriceMin)
+	}
+	if q.PriceMax != nil {
+		query = query.Where("counselors.price <= ?", *q.PriceMax)
+	}
+	if q.YearsMin > 0 {
+		query = query.Where("counselors.years_exp >= ?", q.YearsMin)
+	}
+	if q.RatingMin > 0 {
+		query = query.Where("counselors.rating >= ?", q.RatingMin)
+	}
+	if q.IDs != nil {
+		query = query.Where("counselors.id IN ?", q.IDs)
+	}
+	for kind, values := range tagFilters(q) {
+		if len(values) == 0 || kind == except {
+			continue
+		}
+		tagged := database.DB.Model(&models.CounselorTag{}).Select("counselor_id").Where("kind = ? AND value IN ?", kind, values)
+		query = query.Where("counselors.id IN (?)", tagged)
+	}
+	return query
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
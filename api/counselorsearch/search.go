@@ -0,0 +1,407 @@
+package counselorsearch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/schedule"
+)
+
+// 咨询师检索
+// 结构化条件（擅长领域、服务标签、语言、性别、价格、从业年限、评分）由引擎过滤、排序和分页，
+// "当前在线"和"N 小时内可约"依赖 Redis 在线状态和排班，在引擎外求出咨询师ID集合后作为 IDs 限制传入。
+// 同一维度内多个取值为"任一命中"，不同维度之间为"同时满足"；分面计数不受本维度自身的筛选影响，
+// 便于前端展示"再勾选该项后会有多少结果"
+
+// 检索引擎
+const (
+	EngineMySQL  = "mysql"  // 直接查询 counselors、counselor_statistics 和 counselor_tags
+	EngineMemory = "memory" // 进程内快照，定期和收到同步通知时刷新
+)
+
+// 排序字段
+const (
+	SortRating       = "rating"
+	SortPrice        = "price"
+	SortServiceCount = "service_count"
+	SortYearsExp     = "years_exp"
+	SortCreatedAt    = "created_at"
+)
+
+// 分面维度
+const (
+	FacetSpecialty = models.CounselorTagSpecialty
+	FacetTag       = models.CounselorTagTag
+	FacetLanguage  = models.CounselorTagLanguage
+	FacetGender    = "gender"
+)
+
+// SyncChannel 咨询师资料或标签变更后（管理后台、入驻审核）通知检索进程同步
+const SyncChannel = "counselor:search:sync"
+
+// MaxAvailableHours "N 小时内可约"允许的最大 N
+const MaxAvailableHours = 72
+
+// availableDuration 判断近期可约时按 60 分钟的咨询计算
+const availableDuration = 60
+
+// availabilityTTL 近期可约的咨询师集合缓存时间
+const availabilityTTL = time.Minute
+
+// Query 检索条件
+type Query struct {
+	Keyword        string
+	Specialties    []string
+	Tags           []string
+	Languages      []string
+	Gender         string
+	PriceMin       *float64
+	PriceMax       *float64
+	YearsMin       int
+	RatingMin      float64
+	AvailableHours int  // 大于 0 时只返回该时间内有可约时段的咨询师
+	Online         bool // 只返回当前在线的咨询师
+	SortBy         string
+	SortOrder      string
+	Page           int
+	PageSize       int
+
+	// IDs 限制结果范围，nil 表示不限；由 Search 根据在线和可约条件填充
+	IDs []uint
+}
+
+// Facet 分面取值及命中数量
+type Facet struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facets 各维度的分面计数
+type Facets map[string][]Facet
+
+// Engine 咨询师检索引擎，返回当前页的咨询师ID（已排序）、总数和分面
+type Engine interface {
+	Name() string
+	Search(ctx context.Context, q *Query) ([]uint, int64, Facets, error)
+	Sync(counselorID uint) error
+	Close() error
+}
+
+// Result 检索结果
+type Result struct {
+	Counselors []models.Counselor `json:"counselors"`
+	Total      int64              `json:"total"`
+	Facets     Facets             `json:"facets"`
+}
+
+var engine Engine
+
+// Init 初始化检索引擎，未知引擎回退到 MySQL
+func Init(name string) error {
+	var (
+		e   Engine
+		err error
+	)
+	switch name {
+	case EngineMemory:
+		e, err = NewMemory()
+	default:
+		e, err = NewMySQL()
+	}
+	if err != nil {
+		return err
+	}
+	engine = e
+
+	if e.Name() != EngineMySQL {
+		go subscribe()
+	}
+	return nil
+}
+
+// Close 关闭检索引擎
+func Close() error {
+	if engine == nil {
+		return nil
+	}
+	return engine.Close()
+}
+
+// Search 执行检索并加载当前页的咨询师（含统计和标签）
+func Search(ctx context.Context, q *Query) (*Result, error) {
+	if engine == nil {
+		return nil, errors.New("咨询师检索服务未初始化")
+	}
+	normalize(q)
+
+	if q.Online {
+		ids, err := onlineCounselorIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		q.IDs = restrict(q.IDs, ids)
+	}
+	if q.AvailableHours > 0 {
+		ids, err := availableCounselorIDs(q.AvailableHours)
+		if err != nil {
+			return nil, err
+		}
+		q.IDs = restrict(q.IDs, ids)
+	}
+	if q.IDs != nil && len(q.IDs) == 0 {
+		return &Result{Counselors: []models.Counselor{}, Facets: Facets{}}, nil
+	}
+
+	ids, total, facets, err := engine.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var counselors []models.Counselor
+	if len(ids) > 0 {
+		if err := database.DB.Where("id IN ?", ids).Find(&counselors).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]models.Counselor, len(counselors))
+	for _, c := range counselors {
+		byID[c.ID] = c
+	}
+
+	// 保持引擎给出的顺序；快照滞后时已删除的咨询师直接丢弃
+	result := &Result{Counselors: make([]models.Counselor, 0, len(ids)), Total: total, Facets: facets}
+	for _, id := range ids {
+		if c, ok := byID[id]; ok {
+			result.Counselors = append(result.Counselors, c)
+		}
+	}
+	if err := Fill(result.Counselors); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Fill 为咨询师填充统计数据、推荐标记和结构化标签
+func Fill(counselors []models.Counselor) error {
+	if len(counselors) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(counselors))
+	for i, c := range counselors {
+		ids[i] = c.ID
+	}
+
+	var statsList []models.CounselorStatistics
+	if err := database.DB.Where("counselor_id IN ?", ids).Find(&statsList).Error; err != nil {
+		return err
+	}
+	statsMap := make(map[uint]models.CounselorStatistics, len(statsList))
+	for _, s := range statsList {
+		statsMap[s.CounselorID] = s
+	}
+
+	var tags []models.CounselorTag
+	if err := database.DB.Where("counselor_id IN ?", ids).Order("id").Find(&tags).Error; err != nil {
+		return err
+	}
+	tagMap := make(map[uint][]models.CounselorTag)
+	for _, t := range tags {
+		tagMap[t.CounselorID] = append(tagMap[t.CounselorID], t)
+	}
+
+	for i := range counselors {
+		c := &counselors[i]
+		if stats, ok := statsMap[c.ID]; ok {
+			c.ServiceCount = stats.CompletedOrders
+			c.ReviewCount = stats.ReviewCount
+		}
+		// 推荐逻辑：评分大于4.5且已完成订单数大于5
+		c.IsRecommended = c.Rating >= 4.5 && c.ServiceCount >= 5
+		c.Specialties, c.Tags, c.Languages = nil, nil, nil
+		for _, t := range tagMap[c.ID] {
+			switch t.Kind {
+			case models.CounselorTagSpecialty:
+				c.Specialties = append(c.Specialties, t.Value)
+			case models.CounselorTagTag:
+				c.Tags = append(c.Tags, t.Value)
+			case models.CounselorTagLanguage:
+				c.Languages = append(c.Languages, t.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// Sync 按数据库中的最新状态同步一个咨询师的索引（资料、状态或标签变更后调用）
+// 当前进程未持有索引时，通过 Redis 通知检索进程
+func Sync(counselorID uint) error {
+	if engine == nil {
+		if cache.Rdb == nil {
+			return nil
+		}
+		return cache.Rdb.Publish(context.Background(), SyncChannel, counselorID).Err()
+	}
+	return engine.Sync(counselorID)
+}
+
+// Notify 异步同步索引，失败只记录日志
+func Notify(counselorID uint) {
+	go func() {
+		if err := Sync(counselorID); err != nil {
+			log.Printf("同步咨询师索引失败: counselorID=%d, err=%v", counselorID, err)
+		}
+	}()
+}
+
+// subscribe 接收其他进程的同步通知
+func subscribe() {
+	if cache.Rdb == nil {
+		return
+	}
+	sub := cache.Rdb.Subscribe(context.Background(), SyncChannel)
+	for msg := range sub.Channel() {
+		id, err := strconv.ParseUint(msg.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		if err := Sync(uint(id)); err != nil {
+			log.Printf("同步咨询师索引失败: counselorID=%d, err=%v", id, err)
+		}
+	}
+}
+
+// normalize 校正分页、排序和筛选参数
+func normalize(q *Query) {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 || q.PageSize > 100 {
+		q.PageSize = 10
+	}
+	switch q.SortBy {
+	case SortRating, SortPrice, SortServiceCount, SortYearsExp, SortCreatedAt:
+	default:
+		q.SortBy = SortRating
+	}
+	if q.SortOrder != "asc" {
+		q.SortOrder = "desc"
+	}
+	if q.AvailableHours > MaxAvailableHours {
+		q.AvailableHours = MaxAvailableHours
+	}
+	q.Keyword = strings.TrimSpace(q.Keyword)
+	q.Specialties = cleanValues(q.Specialties)
+	q.Tags = cleanValues(q.Tags)
+	q.Languages = cleanValues(q.Languages)
+}
+
+// tagFilters 按维度返回标签筛选条件
+func tagFilters(q *Query) map[string][]string {
+	return map[string][]string{
+		FacetSpecialty: q.Specialties,
+		FacetTag:       q.Tags,
+		FacetLanguage:  q.Languages,
+	}
+}
+
+// onlineCounselorIDs 当前在线的咨询师（WebSocket 服务维护 Redis 在线状态）
+func onlineCounselorIDs(ctx context.Context) ([]uint, error) {
+	ids := []uint{}
+	if cache.Rdb == nil {
+		return ids, nil
+	}
+	userIDs, err := cache.OnlineUserIDs(ctx)
+	if err != nil || len(userIDs) == 0 {
+		return ids, err
+	}
+	err = database.DB.Model(&models.Counselor{}).Where("status = ? AND user_id IN ?", 1, userIDs).Pluck("id", &ids).Error
+	return ids, err
+}
+
+var availability = struct {
+	sync.Mutex
+	entries map[int]availabilityEntry
+}{entries: make(map[int]availabilityEntry)}
+
+type availabilityEntry struct {
+	at  time.Time
+	ids []uint
+}
+
+// availableCounselorIDs hours 小时内有可约时段的咨询师，按小时数缓存一分钟
+func availableCounselorIDs(hours int) ([]uint, error) {
+	availability.Lock()
+	defer availability.Unlock()
+	if e, ok := availability.entries[hours]; ok && time.Since(e.at) < availabilityTTL {
+		return e.ids, nil
+	}
+
+	var counselorIDs []uint
+	if err := database.DB.Model(&models.Counselor{}).Where("status = ?", 1).Pluck("id", &counselorIDs).Error; err != nil {
+		return nil, err
+	}
+	ids := []uint{}
+	for _, id := range counselorIDs {
+		ok, err := schedule.AvailableWithin(id, time.Duration(hours)*time.Hour, availableDuration)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	availability.entries[hours] = availabilityEntry{at: time.Now(), ids: ids}
+	return ids, nil
+}
+
+// restrict 求两个ID集合的交集，current 为 nil 表示尚未限制
+func restrict(current, ids []uint) []uint {
+	if current == nil {
+		return ids
+	}
+	allowed := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		allowed[id] = true
+	}
+	result := []uint{}
+	for _, id := range current {
+		if allowed[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// cleanValues 去除空白和重复的取值
+func cleanValues(values []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
+
+// sortFacets 分面按数量倒序、取值升序排列
+func sortFacets(facets []Facet) {
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+}
@@ -0,0 +1,170 @@
+package counselorstats
+
+import (
+	"encoding/json"
+	"time"
+
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 咨询师统计聚合
+// 订单（支付、完成、取消）、会话结束和评价变更都在各自的事务内调用本包，按增量原子更新 counselor_statistics，
+// 不做读-改-写；计数出现偏差（历史数据、手工改库）时由 Rebuild 按订单、会话和评价全量重算。
+// 咨询师评分 counselors.rating 为贝叶斯平滑评分：(先验权重×先验均值 + 评分总和) / (先验权重 + 评价数)，
+// 评价数少时向先验均值收敛，新咨询师的一两个差评不会让评分骤降；avg_rating 保留原始平均分
+
+// 配置键
+const (
+	ConfigPriorMean   = "rating_prior_mean"   // 先验均值（1-5）
+	ConfigPriorWeight = "rating_prior_weight" // 先验权重，相当于预先计入的虚拟评价数，0 表示不平滑
+)
+
+// Prior 评分平滑参数
+type Prior struct {
+	Mean   float64
+	Weight float64
+}
+
+// DefaultPrior 未配置时的平滑参数
+var DefaultPrior = Prior{Mean: 4.5, Weight: 5}
+
+// LoadPrior 读取评分平滑参数，缺失或超出范围的配置使用默认值
+func LoadPrior(db *gorm.DB) Prior {
+	p := DefaultPrior
+	var configs []models.SystemConfig
+	if err := db.Where("`key` IN ?", []string{ConfigPriorMean, ConfigPriorWeight}).Find(&configs).Error; err != nil {
+		return p
+	}
+	for _, c := range configs {
+		var v float64
+		if err := json.Unmarshal([]byte(c.Value), &v); err != nil {
+			continue
+		}
+		switch {
+		case c.Key == ConfigPriorMean && v >= 1 && v <= 5:
+			p.Mean = v
+		case c.Key == ConfigPriorWeight && v >= 0:
+			p.Weight = v
+		}
+	}
+	return p
+}
+
+// OrderPaid 咨询订单支付成功，套餐购买不计入（使用套餐预约的咨询单独计数）
+func OrderPaid(tx *gorm.DB, order *models.Order) error {
+	if order.Type == models.OrderTypePackage {
+		return nil
+	}
+	lastOrderTime := time.Now()
+	if order.PayTime != nil {
+		lastOrderTime = *order.PayTime
+	}
+	return bump(tx, order.CounselorID, map[string]interface{}{
+		"total_orders":    gorm.Expr("total_orders + 1"),
+		"last_order_time": lastOrderTime,
+	})
+}
+
+// OrderCompleted 咨询订单完成，计入完成数、预约时长和金额
+func OrderCompleted(tx *gorm.DB, order *models.Order) error {
+	return bump(tx, order.CounselorID, map[string]interface{}{
+		"completed_orders": gorm.Expr("completed_orders + 1"),
+		"total_duration":   gorm.Expr("total_duration + ?", order.Duration),
+		"total_amount":     gorm.Expr("total_amount + ?", order.Amount),
+	})
+}
+
+// OrderCancelled 已支付的咨询订单取消、退款或爽约
+func OrderCancelled(tx *gorm.DB, order *models.Order) error {
+	if order.Type == models.OrderTypePackage {
+		return nil
+	}
+	return bump(tx, order.CounselorID, map[string]interface{}{
+		"cancelled_orders": gorm.Expr("cancelled_orders + 1"),
+	})
+}
+
+// EndSession 将进行中的会话置为已结束（updates 为需同时写入的字段）并计入咨询师的会话数和实际时长
+// 只有状态仍为进行中时才更新，双方同时结束或重复请求时只有一方返回 true，调用方据此跳过计费等后续处理
+func EndSession(db *gorm.DB, session *models.ChatSession, updates map[string]interface{}) (bool, error) {
+	ended := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		updates["status"] = 2
+		result := tx.Model(&models.ChatSession{}).Where("id = ? AND status = ?", session.ID, 1).Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		ended = true
+		duration, _ := updates["duration"].(int)
+		return bump(tx, session.CounselorID, map[string]interface{}{
+			"session_count":    gorm.Expr("session_count + 1"),
+			"session_duration": gorm.Expr("session_duration + ?", duration),
+		})
+	})
+	return ended, err
+}
+
+// ReviewState 评价对统计的贡献：只有公开显示的评价计入评价数和评分
+type ReviewState struct {
+	Visible bool
+	Rating  int
+}
+
+// StateOf 评价当前的统计贡献，nil 表示评价不存在
+func StateOf(rv *models.Review) ReviewState {
+	if rv == nil {
+		return ReviewState{}
+	}
+	return ReviewState{Visible: rv.Status == models.ReviewStatusVisible, Rating: rv.Rating}
+}
+
+// ReviewChanged 评价新增、修改评分或显示状态变更，按变更前后的贡献差更新评价数、评分总和及评分
+// 调用方须保证同一条评价的变更串行（锁定评价行或按原状态条件更新）
+func ReviewChanged(tx *gorm.DB, counselorID uint, before, after ReviewState) error {
+	count, sum := 0, 0
+	if before.Visible {
+		count--
+		sum -= before.Rating
+	}
+	if after.Visible {
+		count++
+		sum += after.Rating
+	}
+	if count == 0 && sum == 0 {
+		return nil
+	}
+	if err := bump(tx, counselorID, map[string]interface{}{
+		"review_count": gorm.Expr("review_count + ?", count),
+		"sum_rating":   gorm.Expr("sum_rating + ?", sum),
+	}); err != nil {
+		return err
+	}
+	return refreshRating(tx, counselorID)
+}
+
+// bump 原子累加统计字段，统计行不存在时先创建
+func bump(tx *gorm.DB, counselorID uint, updates map[string]interface{}) error {
+	stats := models.CounselorStatistics{CounselorID: counselorID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&stats).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.CounselorStatistics{}).Where("counselor_id = ?", counselorID).Updates(updates).Error
+}
+
+// refreshRating 按统计行的评价数和评分总和更新原始平均分和平滑评分
+// 分两条语句：先更新统计行（同时持有行锁），再由统计行计算咨询师评分，不依赖 SET 子句的求值顺序
+func refreshRating(tx *gorm.DB, counselorID uint) error {
+	if err := tx.Model(&models.CounselorStatistics{}).Where("counselor_id = ?", counselorID).
+		Update("avg_rating", gorm.Expr("IF(review_count > 0, ROUND(sum_rating / review_count, 2), 0)")).Error; err != nil {
+		return err
+	}
+	p := LoadPrior(tx)
+	// 不平滑且没有评价时分母为 0，保留咨询师原有评分
+	return tx.Model(&models.Counselor{}).Where("id = ?", counselorID).
+		Update("rating", gorm.Expr(
+			"COALESCE((SELECT ROUND((? + sum_rating) / NULLIF(? + review_count, 0), 2) FROM counselor_statistics WHERE counselor_id = ?), rating)",
+			p.Weight*p.Mean, p.Weight, counselorID)).Error
+}
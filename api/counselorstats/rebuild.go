@@ -0,0 +1,113 @@
+package counselorstats
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RebuildJobName 全量重算任务名，管理后台可手动触发
+const RebuildJobName = "counselor_stats_rebuild"
+
+// Rebuild 按订单、会话和评价全量重算所有咨询师的统计和评分，用于修复计数偏差
+func Rebuild(ctx context.Context) error {
+	var counselorIDs []uint
+	if err := database.DB.Model(&models.Counselor{}).Order("id").Pluck("id", &counselorIDs).Error; err != nil {
+		return fmt.Errorf("查询咨询师失败: %w", err)
+	}
+	failed := 0
+	for _, id := range counselorIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := RebuildCounselor(id); err != nil {
+			failed++
+			log.Printf("重算咨询师统计失败: counselorID=%d, err=%v", id, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个咨询师统计重算失败", failed)
+	}
+	log.Printf("咨询师统计已重算: %d 个咨询师", len(counselorIDs))
+	return nil
+}
+
+// RebuildCounselor 重算单个咨询师的统计和评分
+// 先锁定统计行再汇总：并发的增量更新会等待重算提交后在新值上累加，不会丢失
+func RebuildCounselor(counselorID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		stats := models.CounselorStatistics{CounselorID: counselorID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&stats).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("counselor_id = ?", counselorID).First(&stats).Error; err != nil {
+			return err
+		}
+
+		// 与增量规则一致：支付过的咨询订单计入总数；完成后又退款的仍算完成；其余取消、退款算取消
+		var orders struct {
+			TotalOrders     int
+			CompletedOrders int
+			CancelledOrders int
+			TotalDuration   int
+			TotalAmount     float64
+			LastOrderTime   *time.Time
+		}
+		if err := tx.Raw(`SELECT COUNT(*) AS total_orders,
+				COALESCE(SUM(done), 0) AS completed_orders,
+				COALESCE(SUM(NOT done AND status IN (?, ?)), 0) AS cancelled_orders,
+				COALESCE(SUM(IF(done, duration, 0)), 0) AS total_duration,
+				COALESCE(SUM(IF(done, amount, 0)), 0) AS total_amount,
+				MAX(pay_time) AS last_order_time
+			FROM (SELECT o.status, o.duration, o.amount, o.pay_time,
+					(o.status = ? OR EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = o.id AND e.event = ?)) AS done
+				FROM orders o WHERE o.counselor_id = ? AND o.type = ? AND o.pay_time IS NOT NULL) t`,
+			models.OrderStatusCancelled, models.OrderStatusRefunded,
+			models.OrderStatusCompleted, models.OrderEventComplete,
+			counselorID, models.OrderTypeSession).Scan(&orders).Error; err != nil {
+			return err
+		}
+
+		var sessions struct {
+			Count    int
+			Duration int
+		}
+		if err := tx.Model(&models.ChatSession{}).Select("COUNT(*) AS count, COALESCE(SUM(duration), 0) AS duration").
+			Where("counselor_id = ? AND status = ?", counselorID, 2).Scan(&sessions).Error; err != nil {
+			return err
+		}
+
+		var reviews struct {
+			Count int
+			Sum   int
+		}
+		if err := tx.Model(&models.Review{}).Select("COUNT(*) AS count, COALESCE(SUM(rating), 0) AS sum").
+			Where("counselor_id = ? AND status = ?", counselorID, models.ReviewStatusVisible).Scan(&reviews).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&stats).Updates(map[string]interface{}{
+			"total_orders":     orders.TotalOrders,
+			"completed_orders": orders.CompletedOrders,
+			"cancelled_orders": orders.CancelledOrders,
+			"total_duration":   orders.TotalDuration,
+			"total_amount":     orders.TotalAmount,
+			"last_order_time":  orders.LastOrderTime,
+			"session_count":    sessions.Count,
+			"session_duration": sessions.Duration,
+			"review_count":     reviews.Count,
+			"sum_rating":       reviews.Sum,
+		}).Error; err != nil {
+			return err
+		}
+		return refreshRating(tx, counselorID)
+	})
+}
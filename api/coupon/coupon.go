@@ -0,0 +1,149 @@
+package coupon
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 优惠券校验与核销
+// 下单时在订单事务内锁定优惠券行后校验并占用数量，取消订单时由 orderflow 退回（见 orderflow/coupon.go）
+
+var (
+	ErrNotFound   = errors.New("优惠券不存在")
+	ErrInactive   = errors.New("优惠券未生效、已过期或已停用")
+	ErrSoldOut    = errors.New("优惠券已被领完")
+	ErrUserLimit  = errors.New("已达到该优惠券的使用次数上限")
+	ErrMinAmount  = errors.New("订单金额未达到优惠券使用门槛")
+	ErrCounselor  = errors.New("该优惠券不适用于此咨询师")
+	ErrFirstOrder = errors.New("该优惠券仅限首次下单使用")
+)
+
+// IsCouponError 是否为优惠券不可用的业务错误（用于映射为 400）
+func IsCouponError(err error) bool {
+	for _, e := range []error{ErrNotFound, ErrInactive, ErrSoldOut, ErrUserLimit, ErrMinAmount, ErrCounselor, ErrFirstOrder} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Discount 按券面计算抵扣金额，不超过订单金额
+func Discount(c *models.Coupon, amount float64) float64 {
+	var d float64
+	switch c.Type {
+	case models.CouponTypeFixed:
+		d = c.Value
+	case models.CouponTypePercent:
+		d = math.Round(amount*c.Value) / 100
+		if c.MaxDiscount > 0 && d > c.MaxDiscount {
+			d = c.MaxDiscount
+		}
+	}
+	return math.Min(math.Max(d, 0), amount)
+}
+
+// Preview 不占用数量，校验券码能否用于 userID 向 counselorID 下单 amount 元，返回抵扣金额
+func Preview(db *gorm.DB, code string, userID, counselorID uint, amount float64) (*models.Coupon, float64, error) {
+	var c models.Coupon
+	if err := db.Where("code = ?", normalize(code)).First(&c).Error; err != nil {
+		return nil, 0, ErrNotFound
+	}
+	if err := check(db, &c, userID, counselorID, 0, amount); err != nil {
+		return &c, 0, err
+	}
+	return &c, Discount(&c, amount), nil
+}
+
+// Redeem 在订单事务内核销优惠券：锁定优惠券、校验条件、占用数量并写入使用记录，同时更新订单金额
+// order 须已创建，Amount 为优惠前金额
+func Redeem(tx *gorm.DB, order *models.Order, code string) (*models.Coupon, error) {
+	var c models.Coupon
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", normalize(code)).First(&c).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := check(tx, &c, order.UserID, order.CounselorID, order.ID, order.Amount); err != nil {
+		return nil, err
+	}
+
+	discount := Discount(&c, order.Amount)
+	if err := tx.Model(&c).Update("used_quantity", gorm.Expr("used_quantity + 1")).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&models.CouponRedemption{
+		CouponID: c.ID,
+		UserID:   order.UserID,
+		OrderID:  order.ID,
+		Discount: discount,
+		Status:   models.CouponRedemptionUsed,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	couponID := c.ID
+	order.OriginalAmount = order.Amount
+	order.Discount = discount
+	order.Amount = math.Round((order.Amount-discount)*100) / 100
+	order.CouponID = &couponID
+	err := tx.Model(order).Updates(map[string]interface{}{
+		"original_amount": order.OriginalAmount,
+		"discount":        order.Discount,
+		"amount":          order.Amount,
+		"coupon_id":       couponID,
+	}).Error
+	return &c, err
+}
+
+// check 校验使用条件，orderID 为当前订单（首单判断时排除）
+func check(db *gorm.DB, c *models.Coupon, userID, counselorID, orderID uint, amount float64) error {
+	now := time.Now()
+	if c.Status != models.CouponStatusOn || now.Before(c.StartAt) || !now.Before(c.EndAt) {
+		return ErrInactive
+	}
+	if c.TotalQuantity > 0 && c.UsedQuantity >= c.TotalQuantity {
+		return ErrSoldOut
+	}
+	if c.CounselorID != nil && *c.CounselorID != counselorID {
+		return ErrCounselor
+	}
+	if amount < c.MinAmount {
+		return ErrMinAmount
+	}
+	if c.PerUserLimit > 0 {
+		var used int64
+		if err := db.Model(&models.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ? AND status = ?", c.ID, userID, models.CouponRedemptionUsed).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(c.PerUserLimit) {
+			return ErrUserLimit
+		}
+	}
+	if c.FirstOrderOnly {
+		var paid int64
+		if err := db.Model(&models.Order{}).
+			Where("user_id = ? AND id <> ? AND type = ? AND pay_time IS NOT NULL", userID, orderID, models.OrderTypeSession).
+			Count(&paid).Error; err != nil {
+			return err
+		}
+		if paid > 0 {
+			return ErrFirstOrder
+		}
+	}
+	return nil
+}
+
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
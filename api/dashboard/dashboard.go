@@ -0,0 +1,282 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/schedule"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// 咨询师工作台
+// 预约、收入趋势、评分趋势和时段利用率的汇总查询较重，按咨询师缓存 cacheTTL；缓存键以 order:counselor:{id}: 为前缀，
+// 订单创建或状态变更时随咨询师订单列表缓存一起失效（见 cache.InvalidateCounselorOrdersCache）。
+// 待处理事项（未读消息、待回复评价）查询轻且需要及时，每次请求实时计算
+
+const (
+	cacheTTL     = 5 * time.Minute
+	earningsDays = 30 // 收入趋势天数
+	ratingWeeks  = 12 // 评分趋势周数
+	reviewsDue   = 5  // 待回复评价列表条数
+)
+
+var group singleflight.Group
+
+// Appointment 工作台中的一条预约
+type Appointment struct {
+	OrderID      uint      `json:"order_id"`
+	OrderNo      string    `json:"order_no"`
+	UserID       uint      `json:"user_id"`
+	Username     string    `json:"username"`
+	Avatar       string    `json:"avatar"`
+	ScheduleTime time.Time `json:"schedule_time"`
+	Duration     int       `json:"duration"`
+	Notes        string    `json:"notes"`
+}
+
+// DailyEarning 某天的咨询收入（按会话计费记录的咨询师收入）
+type DailyEarning struct {
+	Date     string  `json:"date"`
+	Amount   float64 `json:"amount"`
+	Sessions int     `json:"sessions"`
+}
+
+// WeeklyRating 某周收到的公开评价的平均评分
+type WeeklyRating struct {
+	WeekStart string  `json:"week_start"`
+	AvgRating float64 `json:"avg_rating"`
+	Count     int     `json:"count"`
+}
+
+// Utilization 开放时长中已被预约的比例
+type Utilization struct {
+	OpenMinutes   int     `json:"open_minutes"`
+	BookedMinutes int     `json:"booked_minutes"`
+	Rate          float64 `json:"rate"` // 百分比
+}
+
+// Summary 缓存的工作台汇总数据
+type Summary struct {
+	Today            []Appointment  `json:"today"`
+	Week             []Appointment  `json:"week"` // 本周（周一至周日）已支付待完成的预约，含今天
+	Earnings         []DailyEarning `json:"earnings"`
+	EarningsTotal    float64        `json:"earnings_total"`
+	Ratings          []WeeklyRating `json:"ratings"`
+	TodayUtilization Utilization    `json:"today_utilization"`
+	WeekUtilization  Utilization    `json:"week_utilization"`
+	GeneratedAt      time.Time      `json:"generated_at"`
+}
+
+// DueReview 待回复的评价
+type DueReview struct {
+	ID        uint      `json:"id"`
+	Rating    int       `json:"rating"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Pending 待处理事项
+type Pending struct {
+	UnreadMessages   int64       `json:"unread_messages"`   // 来访者发送的未读消息数
+	UnreadSessions   int64       `json:"unread_sessions"`   // 有未读消息的会话数
+	UnrepliedReviews int64       `json:"unreplied_reviews"` // 公开显示且未回复的评价数
+	DueReviews       []DueReview `json:"due_reviews"`       // 最早的几条待回复评价
+}
+
+func cacheKey(counselorID uint) string {
+	return fmt.Sprintf("order:counselor:%d:dashboard", counselorID)
+}
+
+// Get 读取工作台汇总数据，缓存未命中时计算并写入缓存；同一咨询师的并发请求只计算一次
+func Get(ctx context.Context, counselorID uint) (*Summary, bool, error) {
+	if cache.Rdb == nil {
+		s, err := Build(counselorID, time.Now())
+		return s, false, err
+	}
+
+	key := cacheKey(counselorID)
+	if data, err := cache.Rdb.Get(ctx, key).Bytes(); err == nil {
+		var s Summary
+		if json.Unmarshal(data, &s) == nil {
+			return &s, true, nil
+		}
+	}
+
+	result, err, _ := group.Do(key, func() (interface{}, error) {
+		s, err := Build(counselorID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		data, _ := json.Marshal(s)
+		cache.Rdb.Set(ctx, key, data, cacheTTL)
+		return s, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return result.(*Summary), false, nil
+}
+
+// Build 计算工作台汇总数据
+func Build(counselorID uint, now time.Time) (*Summary, error) {
+	today := startOfDay(now)
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	weekEnd := weekStart.AddDate(0, 0, 7)
+	s := &Summary{GeneratedAt: now}
+
+	var err error
+	if s.Week, err = appointments(counselorID, weekStart, weekEnd); err != nil {
+		return nil, fmt.Errorf("查询预约失败: %w", err)
+	}
+	s.Today = []Appointment{}
+	for _, a := range s.Week {
+		if !a.ScheduleTime.Before(today) && a.ScheduleTime.Before(today.AddDate(0, 0, 1)) {
+			s.Today = append(s.Today, a)
+		}
+	}
+	if s.Earnings, s.EarningsTotal, err = earnings(counselorID, today); err != nil {
+		return nil, fmt.Errorf("查询收入失败: %w", err)
+	}
+	if s.Ratings, err = ratings(counselorID, weekStart); err != nil {
+		return nil, fmt.Errorf("查询评分失败: %w", err)
+	}
+	if s.TodayUtilization, err = utilization(counselorID, today, today.AddDate(0, 0, 1)); err != nil {
+		return nil, fmt.Errorf("计算时段利用率失败: %w", err)
+	}
+	if s.WeekUtilization, err = utilization(counselorID, weekStart, weekEnd); err != nil {
+		return nil, fmt.Errorf("计算时段利用率失败: %w", err)
+	}
+	return s, nil
+}
+
+// GetPending 实时查询待处理事项
+func GetPending(counselorID uint) (*Pending, error) {
+	p := &Pending{DueReviews: []DueReview{}}
+	var unread struct {
+		Messages int64
+		Sessions int64
+	}
+	if err := database.DB.Table("chat_messages AS m").
+		Select("COUNT(*) AS messages, COUNT(DISTINCT m.session_id) AS sessions").
+		Joins("JOIN chat_sessions s ON s.id = m.session_id").
+		Where("s.counselor_id = ? AND m.sender_type = ? AND m.is_read = ? AND m.recalled_at IS NULL", counselorID, "user", false).
+		Scan(&unread).Error; err != nil {
+		return nil, err
+	}
+	p.UnreadMessages, p.UnreadSessions = unread.Messages, unread.Sessions
+
+	query := database.DB.Model(&models.Review{}).
+		Where("counselor_id = ? AND status = ? AND reply_content = ''", counselorID, models.ReviewStatusVisible)
+	if err := query.Count(&p.UnrepliedReviews).Error; err != nil {
+		return nil, err
+	}
+	if p.UnrepliedReviews > 0 {
+		if err := query.Select("id", "rating", "content", "created_at").Order("created_at").
+			Limit(reviewsDue).Scan(&p.DueReviews).Error; err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// appointments [from, to) 内已支付待进行的预约，按预约时间排序
+func appointments(counselorID uint, from, to time.Time) ([]Appointment, error) {
+	list := []Appointment{}
+	err := database.DB.Table("orders AS o").
+		Select("o.id AS order_id, o.order_no, o.user_id, u.username, u.avatar, o.schedule_time, o.duration, o.notes").
+		Joins("LEFT JOIN users u ON u.id = o.user_id").
+		Where("o.counselor_id = ? AND o.type = ? AND o.status = ? AND o.schedule_time >= ? AND o.schedule_time < ?",
+			counselorID, models.OrderTypeSession, models.OrderStatusPaid, from, to).
+		Order("o.schedule_time").Scan(&list).Error
+	return list, err
+}
+
+// earnings 最近 earningsDays 天（含今天）每天的咨询师收入，没有收入的日期补 0
+func earnings(counselorID uint, today time.Time) ([]DailyEarning, float64, error) {
+	from := today.AddDate(0, 0, -(earningsDays - 1))
+	var rows []struct {
+		Day      time.Time
+		Amount   float64
+		Sessions int
+	}
+	if err := database.DB.Model(&models.ChatBilling{}).
+		Select("DATE(created_at) AS day, SUM(counselor_fee) AS amount, COUNT(*) AS sessions").
+		Where("counselor_id = ? AND created_at >= ?", counselorID, from).
+		Group("DATE(created_at)").Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	byDay := make(map[string]DailyEarning, len(rows))
+	for _, r := range rows {
+		date := r.Day.Format(schedule.DateLayout)
+		byDay[date] = DailyEarning{Date: date, Amount: r.Amount, Sessions: r.Sessions}
+	}
+
+	list := make([]DailyEarning, 0, earningsDays)
+	var total float64
+	for day := from; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format(schedule.DateLayout)
+		e, ok := byDay[date]
+		if !ok {
+			e = DailyEarning{Date: date}
+		}
+		total += e.Amount
+		list = append(list, e)
+	}
+	return list, math.Round(total*100) / 100, nil
+}
+
+// ratings 最近 ratingWeeks 周（含本周）每周收到的公开评价平均分，没有评价的周 count 为 0
+func ratings(counselorID uint, weekStart time.Time) ([]WeeklyRating, error) {
+	from := weekStart.AddDate(0, 0, -7*(ratingWeeks-1))
+	var rows []struct {
+		Week  time.Time
+		Avg   float64
+		Count int
+	}
+	if err := database.DB.Model(&models.Review{}).
+		Select("DATE(DATE_SUB(created_at, INTERVAL WEEKDAY(created_at) DAY)) AS week, AVG(rating) AS avg, COUNT(*) AS count").
+		Where("counselor_id = ? AND status = ? AND created_at >= ?", counselorID, models.ReviewStatusVisible, from).
+		Group("week").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	byWeek := make(map[string]WeeklyRating, len(rows))
+	for _, r := range rows {
+		week := r.Week.Format(schedule.DateLayout)
+		byWeek[week] = WeeklyRating{WeekStart: week, AvgRating: math.Round(r.Avg*100) / 100, Count: r.Count}
+	}
+
+	list := make([]WeeklyRating, 0, ratingWeeks)
+	for week := from; !week.After(weekStart); week = week.AddDate(0, 0, 7) {
+		date := week.Format(schedule.DateLayout)
+		r, ok := byWeek[date]
+		if !ok {
+			r = WeeklyRating{WeekStart: date}
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+func utilization(counselorID uint, from, to time.Time) (Utilization, error) {
+	open, booked, err := schedule.Utilization(counselorID, from, to)
+	if err != nil {
+		return Utilization{}, err
+	}
+	u := Utilization{OpenMinutes: open, BookedMinutes: booked}
+	if open > 0 {
+		u.Rate = math.Round(float64(booked)/float64(open)*10000) / 100
+	}
+	return u, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
@@ -2,9 +2,11 @@ package database
 
 import (
 	"fmt"
+
 	"akrick.com/mychat/models"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var DB *gorm.DB
@@ -22,29 +24,159 @@ func InitDB() error {
 		// 用户相关
 		&models.User{},
 		&models.Counselor{},
+		&models.CounselorTag{},
 		&models.CounselorAccount{},
 		&models.CounselorStatistics{},
-		&models.CounselorReview{},
 		&models.CounselorApplication{},
+		&models.CounselorApplicationDocument{},
+		&models.CounselorApplicationEvent{},
+		&models.CounselorProfileChange{},
+		&models.CounselorLevel{},
+		&models.CounselorFavorite{},
 
 		// 订单相关
 		&models.Order{},
+		&models.OrderEvent{},
+		&models.OrderReminder{},
+		&models.Review{},
+		&models.ReviewReport{},
+		&models.ReviewAppeal{},
+		&models.ReviewDecision{},
+		&models.CounselorPackage{},
+		&models.UserPackage{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
 		&models.Payment{},
 		&models.PaymentConfig{},
+		&models.UserTransaction{},
+
+		// 排班预约
+		&models.CounselorAvailability{},
+		&models.CounselorScheduleException{},
+		&models.CounselorScheduleSetting{},
+		&models.CounselorBooking{},
+		&models.CalendarToken{},
+
+		// 咨询师匹配
+		&models.MatchRequest{},
+		&models.MatchImpression{},
+
+		// 定时任务
+		&models.ScheduledJob{},
+		&models.JobRun{},
 
 		// 聊天相关
 		&models.ChatSession{},
 		&models.ChatMessage{},
+		&models.ChatMessageRevision{},
+		&models.ChatMessageDeletion{},
 		&models.ChatBilling{},
 		&models.WithdrawRecord{},
+		&models.DataArchive{},
+		&models.LegalHold{},
 
 		// 文件和通知
 		&models.File{},
 		&models.Notification{},
+
+		// 内容审核
+		&models.SensitiveWord{},
+		&models.ModerationIncident{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := mergeLegacyReviews(); err != nil {
+		return fmt.Errorf("failed to merge legacy reviews: %w", err)
+	}
+
+	if err := backfillCounselorSpecialties(); err != nil {
+		return fmt.Errorf("failed to backfill counselor specialties: %w", err)
+	}
+	if err := backfillOrderUnitPrice(); err != nil {
+		return fmt.Errorf("failed to backfill order unit price: %w", err)
+	}
+	if err := backfillOrderEvents(); err != nil {
+		return fmt.Errorf("failed to backfill order events: %w", err)
+	}
+	if err := seedCounselorLevels(); err != nil {
+		return fmt.Errorf("failed to seed counselor levels: %w", err)
+	}
+
 	return nil
 }
+
+// mergeLegacyReviews 将旧评价表 counselor_reviews 合并到 reviews（同一订单已有评价时保留 reviews 中的记录），
+// 合并后将旧表改名为 counselor_reviews_legacy，之后启动不再重复合并
+func mergeLegacyReviews() error {
+	migrator := DB.Migrator()
+	if !migrator.HasTable("counselor_reviews") {
+		return nil
+	}
+	err := DB.Exec(`INSERT INTO reviews (order_id, order_no, user_id, counselor_id, rating, content, is_anonymous, status, created_at, updated_at)
+		SELECT r.order_id, COALESCE(o.order_no, ''), r.user_id, r.counselor_id, r.rating, COALESCE(r.comment, ''), r.is_anonymous,
+			CASE WHEN r.is_visible THEN 1 ELSE 0 END, r.created_at, r.updated_at
+		FROM counselor_reviews r LEFT JOIN orders o ON o.id = r.order_id
+		WHERE NOT EXISTS (SELECT 1 FROM reviews WHERE reviews.order_id = r.order_id)`).Error
+	if err != nil {
+		return err
+	}
+	return migrator.RenameTable("counselor_reviews", "counselor_reviews_legacy")
+}
+
+// backfillCounselorSpecialties 标签表为空时，按 Counselor.Specialty 文本生成擅长领域标签；之后由管理后台维护结构化标签
+func backfillCounselorSpecialties() error {
+	var count int64
+	if err := DB.Model(&models.CounselorTag{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	var counselors []models.Counselor
+	if err := DB.Select("id", "specialty").Where("specialty <> ''").Find(&counselors).Error; err != nil {
+		return err
+	}
+	var tags []models.CounselorTag
+	for _, c := range counselors {
+		for _, v := range models.SplitSpecialty(c.Specialty) {
+			tags = append(tags, models.CounselorTag{CounselorID: c.ID, Kind: models.CounselorTagSpecialty, Value: v})
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(tags, 200).Error
+}
+
+// backfillOrderUnitPrice 早期订单没有记录下单单价，按咨询师当前单价补齐（与补齐前会话按咨询师当前单价计费一致），
+// 之后咨询师调价不再影响这些订单
+func backfillOrderUnitPrice() error {
+	return DB.Exec(`UPDATE orders o JOIN counselors c ON c.id = o.counselor_id
+		SET o.unit_price = c.price WHERE o.unit_price = 0 AND o.type = ?`, models.OrderTypeSession).Error
+}
+
+// backfillOrderEvents 事件流上线前的订单没有任何事件，时间线为空；按下单时间和支付时间补写创建、支付两条事件，
+// 之后的取消、完成、退款等无法还原操作人和原因，不做补写。补写过的订单已有事件，再次启动不会重复
+func backfillOrderEvents() error {
+	return DB.Exec(`INSERT INTO order_events (order_id, event, from_status, to_status, actor_type, actor_id, reason, amount, metadata, created_at)
+		SELECT order_id, event, from_status, to_status, actor_type, actor_id, '', amount, ?, created_at FROM (
+			SELECT o.id AS order_id, 0 AS seq, ? AS event, ? AS from_status, ? AS to_status, ? AS actor_type, o.user_id AS actor_id, o.amount, o.created_at
+			FROM orders o WHERE NOT EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = o.id)
+			UNION ALL
+			SELECT o.id, 1, ?, ?, ?, ?, 0, o.amount, o.pay_time
+			FROM orders o WHERE o.pay_time IS NOT NULL AND NOT EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = o.id)
+		) t ORDER BY order_id, seq`,
+		`{"backfill":true}`,
+		models.OrderEventCreate, models.OrderStatusPending, models.OrderStatusPending, models.OrderActorUser,
+		models.OrderEventPay, models.OrderStatusPending, models.OrderStatusPaid, models.OrderActorSystem,
+	).Error
+}
+
+// seedCounselorLevels 等级表为空时写入默认等级，之后由管理后台维护
+func seedCounselorLevels() error {
+	var count int64
+	if err := DB.Model(&models.CounselorLevel{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	levels := models.DefaultCounselorLevels()
+	return DB.Create(&levels).Error
+}
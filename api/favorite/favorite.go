@@ -0,0 +1,98 @@
+package favorite
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/notify"
+	"akrick.com/mychat/schedule"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 收藏咨询师的动态通知
+// 咨询师开放新时段（api 服务保存排班时）或从离线变为在线（WebSocket 服务连接时）后通知收藏了该咨询师的用户；
+// 每位用户对同一咨询师的同类通知在冷却时间内只发一次
+
+const (
+	SlotsCooldown  = 24 * time.Hour
+	OnlineCooldown = 6 * time.Hour
+
+	// slotsWithin 开放新时段后，近期有可预约时段才通知
+	slotsWithin   = 7 * 24 * time.Hour
+	slotsDuration = 60
+)
+
+// 通知事件，写入通知的 extra_data
+const (
+	EventSlots  = "favorite_slots"
+	EventOnline = "favorite_online"
+)
+
+// NotifySlots 咨询师保存排班后调用，近期有可预约时段时通知开启了时段通知的收藏用户
+func NotifySlots(counselorID uint) error {
+	available, err := schedule.AvailableWithin(counselorID, slotsWithin, slotsDuration)
+	if err != nil || !available {
+		return err
+	}
+	return notifyFollowers(counselorID, EventSlots, "notify_slots", "slots_notified_at", SlotsCooldown,
+		"收藏的咨询师开放了新时段", "您收藏的咨询师%s开放了新的可预约时段，快去看看吧")
+}
+
+// NotifyOnline 咨询师从离线变为在线时调用，通知开启了上线通知的收藏用户
+func NotifyOnline(counselorID uint) error {
+	return notifyFollowers(counselorID, EventOnline, "notify_online", "online_notified_at", OnlineCooldown,
+		"收藏的咨询师上线了", "您收藏的咨询师%s现在在线")
+}
+
+// notifyFollowers 锁定开启了 flag 且已过冷却时间的收藏，更新通知时间并写入通知；多实例同时触发时不会重复通知
+func notifyFollowers(counselorID uint, event, flag, notifiedColumn string, cooldown time.Duration, title, format string) error {
+	var counselor models.Counselor
+	if err := database.DB.Select("id", "name", "status").First(&counselor, counselorID).Error; err != nil {
+		return err
+	}
+	if counselor.Status != 1 {
+		return nil
+	}
+	extra, _ := json.Marshal(map[string]interface{}{"event": event, "counselor_id": counselorID})
+
+	now := time.Now()
+	var notifications []models.Notification
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var favorites []models.CounselorFavorite
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("counselor_id = ? AND "+flag+" = ?", counselorID, true).
+			Where(notifiedColumn+" IS NULL OR "+notifiedColumn+" < ?", now.Add(-cooldown)).
+			Find(&favorites).Error; err != nil {
+			return err
+		}
+		if len(favorites) == 0 {
+			return nil
+		}
+		ids := make([]uint, 0, len(favorites))
+		for _, f := range favorites {
+			ids = append(ids, f.ID)
+			notifications = append(notifications, models.Notification{
+				UserID:    f.UserID,
+				Type:      models.NotificationTypeSystem,
+				Level:     models.NotificationLevelInfo,
+				Title:     title,
+				Content:   fmt.Sprintf(format, counselor.Name),
+				ExtraData: string(extra),
+			})
+		}
+		if err := tx.Model(&models.CounselorFavorite{}).Where("id IN ?", ids).Update(notifiedColumn, now).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(&notifications, 200).Error
+	})
+	if err != nil {
+		return err
+	}
+	notify.Deliver(notifications...)
+	return nil
+}
@@ -1,109 +1,201 @@
 package handlers
 
 import (
-	"akrick.com/mychat/database"
-	"akrick.com/mychat/models"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"os"
+	"path/filepath"
 	"time"
 
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// 咨询师入驻流程：用户上传证明材料（files 表）后提交申请，管理后台依次进行资质审核、面试和终审，
+// 任一阶段可拒绝或要求补充材料；补充材料超过期限未提交的申请由定时任务置为失效；终审通过时创建咨询师及其账户
+
+// ApplicationDocumentRequest 申请材料，file_id 为上传接口返回的文件ID
+type ApplicationDocumentRequest struct {
+	FileID uint   `json:"file_id" binding:"required"`
+	Kind   string `json:"kind" binding:"required,oneof=id_card certificate degree other"`
+}
+
+// CreateApplicationRequest 提交入驻申请
+type CreateApplicationRequest struct {
+	Name      string                       `json:"name" binding:"required,max=50"`
+	Gender    string                       `json:"gender" binding:"omitempty,oneof=male female"`
+	Phone     string                       `json:"phone" binding:"required,max=20"`
+	Email     string                       `json:"email" binding:"omitempty,email,max=100"`
+	Title     string                       `json:"title" binding:"required,max=50"`
+	Specialty string                       `json:"specialty" binding:"required,max=500"`
+	YearsExp  int                          `json:"years_exp" binding:"min=0,max=60"`
+	Bio       string                       `json:"bio" binding:"max=5000"`
+	Documents []ApplicationDocumentRequest `json:"documents" binding:"required,min=1,max=10,dive"`
+}
+
+// SupplementApplicationRequest 补充材料
+type SupplementApplicationRequest struct {
+	Documents []ApplicationDocumentRequest `json:"documents" binding:"max=10,dive"`
+	Comment   string                       `json:"comment" binding:"max=1000"`
+}
+
 // CreateCounselorApplication 提交咨询师入驻申请
 // @Summary 提交咨询师入驻申请
+// @Description 提交申请信息和证明材料（先通过上传接口获得文件ID，至少包含一份资质证书）。被拒绝或已失效的申请可重新提交，审核从资质审核阶段重新开始
 // @Tags 咨询师入驻
 // @Accept json
 // @Produce json
-// @Param request body models.CounselorApplication true "申请信息"
+// @Security BearerAuth
+// @Param request body CreateApplicationRequest true "申请信息，材料类型:id_card/certificate/degree/other"
 // @Success 200 {object} map[string]interface{} "成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未登录"
 // @Failure 403 {object} map[string]interface{} "已有申请或已是咨询师"
 // @Router /api/counselor/application [post]
 func CreateCounselorApplication(c *gin.Context) {
-	var req models.CounselorApplication
-
-	// 绑定JSON参数
+	var req CreateApplicationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"code": 400,
-			"msg":  "请求参数错误",
+			"code":  400,
+			"msg":   "请求参数错误",
 			"error": err.Error(),
 		})
 		return
 	}
+	userID := c.GetUint("user_id")
 
-	// 从JWT获取用户ID
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code": 401,
-			"msg":  "未登录",
+	// 检查用户是否已经是咨询师
+	var count int64
+	database.DB.Model(&models.Counselor{}).Where("user_id = ?", userID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
+			"msg":  "您已是认证咨询师",
 		})
 		return
 	}
-	req.UserID = uint(userID.(float64))
 
-	// 检查是否已有申请
-	var existingApp models.CounselorApplication
-	result := database.DB.Where("user_id = ?", req.UserID).First(&existingApp)
-	if result.Error == nil {
-		if existingApp.Status == 0 {
+	// 检查是否已有申请，被拒绝或已失效的申请允许重新提交
+	var application models.CounselorApplication
+	err := database.DB.Where("user_id = ?", userID).First(&application).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"msg":   "查询申请失败",
+			"error": err.Error(),
+		})
+		return
+	}
+	switch application.Status {
+	case models.ApplicationStatusPending, models.ApplicationStatusNeedMaterial:
+		if application.ID != 0 {
 			c.JSON(http.StatusForbidden, gin.H{
 				"code": 403,
 				"msg":  "您已提交入驻申请，请等待审核",
 			})
 			return
-		} else if existingApp.Status == 1 {
-			c.JSON(http.StatusForbidden, gin.H{
-				"code": 403,
-				"msg":  "您的申请已审核通过",
-			})
-			return
 		}
-		// 如果是拒绝状态，允许重新申请
-	}
-
-	// 检查用户是否已经是咨询师
-	var counselor models.Counselor
-	result = database.DB.Where("user_id = ?", req.UserID).First(&counselor)
-	if result.Error == nil {
+	case models.ApplicationStatusApproved:
 		c.JSON(http.StatusForbidden, gin.H{
 			"code": 403,
-			"msg":  "您已是认证咨询师",
+			"msg":  "您的申请已审核通过",
 		})
 		return
 	}
 
-	// 验证必填字段
-	if req.Name == "" || req.Phone == "" || req.Title == "" || req.Specialty == "" {
+	hasCertificate := false
+	for _, d := range req.Documents {
+		if d.Kind == models.ApplicationDocumentCertificate {
+			hasCertificate = true
+		}
+	}
+	if !hasCertificate {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code": 400,
-			"msg":  "姓名、电话、职称和擅长领域为必填项",
+			"msg":  "至少需要上传一份资质证书",
 		})
 		return
 	}
-
-	// 至少需要一张证书
-	if req.CertificateImg1 == "" && req.CertificateImg2 == "" && req.CertificateImg3 == "" {
+	if msg := checkApplicationFiles(userID, application.ID, req.Documents); msg != "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code": 400,
-			"msg":  "至少需要上传一张资质证书",
+			"msg":  msg,
 		})
 		return
 	}
 
-	// 设置状态为待审核
-	req.Status = 0
-
-	// 创建申请
-	if err := database.DB.Create(&req).Error; err != nil {
+	resubmit := application.ID != 0
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		fields := map[string]interface{}{
+			"name":              req.Name,
+			"gender":            req.Gender,
+			"phone":             req.Phone,
+			"email":             req.Email,
+			"title":             req.Title,
+			"specialty":         req.Specialty,
+			"years_exp":         req.YearsExp,
+			"bio":               req.Bio,
+			"status":            models.ApplicationStatusPending,
+			"stage":             models.ApplicationStageQualification,
+			"reject_reason":     "",
+			"material_request":  "",
+			"material_deadline": nil,
+			"submitted_at":      &now,
+			"reviewed_by":       0,
+			"reviewed_at":       nil,
+		}
+		if resubmit {
+			if err := tx.Model(&application).Updates(fields).Error; err != nil {
+				return err
+			}
+			// 重新提交时旧材料作废，处理记录保留
+			if err := tx.Where("application_id = ?", application.ID).Delete(&models.CounselorApplicationDocument{}).Error; err != nil {
+				return err
+			}
+		} else {
+			application = models.CounselorApplication{
+				UserID:      userID,
+				Name:        req.Name,
+				Gender:      req.Gender,
+				Phone:       req.Phone,
+				Email:       req.Email,
+				Title:       req.Title,
+				Specialty:   req.Specialty,
+				YearsExp:    req.YearsExp,
+				Bio:         req.Bio,
+				Status:      models.ApplicationStatusPending,
+				Stage:       models.ApplicationStageQualification,
+				SubmittedAt: &now,
+			}
+			if err := tx.Create(&application).Error; err != nil {
+				return err
+			}
+		}
+		if err := attachApplicationDocuments(tx, application.ID, req.Documents); err != nil {
+			return err
+		}
+		comment := ""
+		if resubmit {
+			comment = "重新提交申请"
+		}
+		return tx.Create(&models.CounselorApplicationEvent{
+			ApplicationID: application.ID,
+			Stage:         models.ApplicationStageQualification,
+			Action:        models.ApplicationActionSubmit,
+			ActorType:     models.ApplicationActorUser,
+			ActorID:       userID,
+			Comment:       comment,
+		}).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"code": 500,
-			"msg":  "提交申请失败",
+			"code":  500,
+			"msg":   "提交申请失败",
 			"error": err.Error(),
 		})
 		return
@@ -113,122 +205,109 @@ func CreateCounselorApplication(c *gin.Context) {
 		"code": 200,
 		"msg":  "申请提交成功，请等待审核",
 		"data": gin.H{
-			"id": req.ID,
+			"id": application.ID,
 		},
 	})
 }
 
-// GetMyApplication 获取我的入驻申请
-// @Summary 获取我的入驻申请
+// SupplementApplication 补充入驻申请材料
+// @Summary 补充入驻申请材料
+// @Description 申请处于待补充材料状态时，在截止时间前上传补充材料或填写说明，申请回到当前阶段继续审核
 // @Tags 咨询师入驻
+// @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Param request body SupplementApplicationRequest true "补充材料，材料和说明至少填写一项"
 // @Success 200 {object} map[string]interface{} "成功"
-// @Failure 401 {object} map[string]interface{} "未登录"
-// @Router /api/counselor/my-application [get]
-func GetMyApplication(c *gin.Context) {
-	// 从JWT获取用户ID
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code": 401,
-			"msg":  "未登录",
+// @Failure 400 {object} map[string]interface{} "请求参数错误或申请不需要补充材料"
+// @Failure 404 {object} map[string]interface{} "申请不存在"
+// @Router /api/counselor/application/supplement [post]
+func SupplementApplication(c *gin.Context) {
+	var req SupplementApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  400,
+			"msg":   "请求参数错误",
+			"error": err.Error(),
 		})
 		return
 	}
-
-	var application models.CounselorApplication
-	result := database.DB.Where("user_id = ?", userID).Order("id desc").First(&application)
-
-	if result.Error == gorm.ErrRecordNotFound {
-		c.JSON(http.StatusOK, gin.H{
-			"code": 200,
-			"msg":  "暂无入驻申请",
-			"data": nil,
+	if len(req.Documents) == 0 && req.Comment == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请上传补充材料或填写说明",
 		})
 		return
 	}
+	userID := c.GetUint("user_id")
 
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code": 500,
-			"msg":  "查询申请失败",
-			"error": result.Error.Error(),
+	var application models.CounselorApplication
+	if err := database.DB.Where("user_id = ?", userID).First(&application).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "申请不存在",
 		})
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"msg":  "查询成功",
-		"data": application,
-	})
-}
-
-// GetAllApplications 获取所有入驻申请（管理员）
-// @Summary 获取所有入驻申请
-// @Tags 咨询师入驻
-// @Produce json
-// @Param status query int false "状态筛选:0-待审核,1-审核通过,2-审核拒绝"
-// @Param page query int false "页码" default(1)
-// @Param page_size query int false "每页数量" default(20)
-// @Success 200 {object} map[string]interface{} "成功"
-// @Failure 401 {object} map[string]interface{} "未登录"
-// @Failure 403 {object} map[string]interface{} "无权限"
-// @Router /api/counselor/applications [get]
-func GetAllApplications(c *gin.Context) {
-	// 从JWT获取用户ID和是否管理员
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code": 401,
-			"msg":  "未登录",
+	if application.Status != models.ApplicationStatusNeedMaterial {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "当前申请不需要补充材料",
 		})
 		return
 	}
-
-	// 检查是否管理员
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code": 401,
-			"msg":  "用户不存在",
+	if application.MaterialDeadline != nil && time.Now().After(*application.MaterialDeadline) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "已超过补充材料期限，请重新提交申请",
 		})
 		return
 	}
-
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{
-			"code": 403,
-			"msg":  "无权限访问",
+	if msg := checkApplicationFiles(userID, application.ID, req.Documents); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  msg,
 		})
 		return
 	}
 
-	// 获取查询参数
-	statusStr := c.Query("status")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-
-	// 构建查询
-	query := database.DB.Model(&models.CounselorApplication{})
-	if statusStr != "" {
-		status, err := strconv.Atoi(statusStr)
-		if err == nil {
-			query = query.Where("status = ?", status)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新，避免与超时失效任务并发时覆盖已失效的状态
+		result := tx.Model(&models.CounselorApplication{}).
+			Where("id = ? AND status = ?", application.ID, models.ApplicationStatusNeedMaterial).
+			Updates(map[string]interface{}{
+				"status":            models.ApplicationStatusPending,
+				"material_deadline": nil,
+			})
+		if result.Error != nil {
+			return result.Error
 		}
+		if result.RowsAffected == 0 {
+			return errApplicationStateChanged
+		}
+		if err := attachApplicationDocuments(tx, application.ID, req.Documents); err != nil {
+			return err
+		}
+		return tx.Create(&models.CounselorApplicationEvent{
+			ApplicationID: application.ID,
+			Stage:         application.Stage,
+			Action:        models.ApplicationActionSupplement,
+			ActorType:     models.ApplicationActorUser,
+			ActorID:       userID,
+			Comment:       req.Comment,
+		}).Error
+	})
+	if errors.Is(err, errApplicationStateChanged) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "申请状态已变化，请刷新后重试",
+		})
+		return
 	}
-
-	// 获取总数
-	var total int64
-	query.Count(&total)
-
-	// 分页查询
-	var applications []models.CounselorApplication
-	offset := (page - 1) * pageSize
-	if err := query.Preload("User").Preload("Reviewer").Offset(offset).Limit(pageSize).Order("created_at desc").Find(&applications).Error; err != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"code": 500,
-			"msg":  "查询失败",
+			"code":  500,
+			"msg":   "提交补充材料失败",
 			"error": err.Error(),
 		})
 		return
@@ -236,215 +315,134 @@ func GetAllApplications(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
-		"msg":  "查询成功",
-		"data": gin.H{
-			"list":      applications,
-			"total":     total,
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"msg":  "补充材料已提交，请等待审核",
 	})
 }
 
-// ReviewApplication 审核入驻申请（管理员）
-// @Summary 审核入驻申请
-// @Tags 咨询师入驻
-// @Accept json
-// @Produce json
-// @Param id path int true "申请ID"
-// @Param request body object true "审核信息: status(1-通过,2-拒绝), reject_reason(拒绝时必填)"
-// @Success 200 {object} map[string]interface{} "成功"
-// @Failure 400 {object} map[string]interface{} "请求参数错误"
-// @Failure 401 {object} map[string]interface{} "未登录"
-// @Failure 403 {object} map[string]interface{} "无权限"
-// @Router /api/counselor/application/:id/review [put]
-func ReviewApplication(c *gin.Context) {
-	// 从JWT获取用户ID和是否管理员
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code": 401,
-			"msg":  "未登录",
-		})
-		return
-	}
+var errApplicationStateChanged = errors.New("申请状态已变化")
 
-	// 检查是否管理员
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code": 401,
-			"msg":  "用户不存在",
-		})
-		return
+// checkApplicationFiles 校验申请材料：文件须为本人上传、未删除，且未被其他申请或业务使用，返回错误提示
+func checkApplicationFiles(userID, applicationID uint, documents []ApplicationDocumentRequest) string {
+	if len(documents) == 0 {
+		return ""
 	}
-
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{
-			"code": 403,
-			"msg":  "无权限访问",
-		})
-		return
-	}
-
-	// 获取申请ID
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code": 400,
-			"msg":  "申请ID错误",
-		})
-		return
+	ids := make([]uint, 0, len(documents))
+	seen := make(map[uint]bool)
+	for _, d := range documents {
+		if seen[d.FileID] {
+			return "材料文件重复"
+		}
+		seen[d.FileID] = true
+		ids = append(ids, d.FileID)
 	}
 
-	// 绑定请求参数
-	var req struct {
-		Status       int    `json:"status" binding:"required"`
-		RejectReason string `json:"reject_reason"`
+	var files []models.File
+	database.DB.Where("id IN ? AND uploader_id = ? AND status = 1", ids, userID).Find(&files)
+	if len(files) != len(ids) {
+		return "材料文件不存在"
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code": 400,
-			"msg":  "请求参数错误",
-			"error": err.Error(),
-		})
-		return
+	for _, f := range files {
+		if f.RelationType == "" && f.RelationID == 0 {
+			continue
+		}
+		if f.RelationType == models.FileRelationApplication && (f.RelationID == 0 || f.RelationID == applicationID) {
+			continue
+		}
+		return fmt.Sprintf("文件 %s 不能作为申请材料", f.OriginalName)
 	}
+	return ""
+}
 
-	// 验证状态
-	if req.Status != 1 && req.Status != 2 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code": 400,
-			"msg":  "状态错误，1-通过，2-拒绝",
+// attachApplicationDocuments 创建申请材料记录并将文件关联到申请
+func attachApplicationDocuments(tx *gorm.DB, applicationID uint, documents []ApplicationDocumentRequest) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	records := make([]models.CounselorApplicationDocument, 0, len(documents))
+	ids := make([]uint, 0, len(documents))
+	for _, d := range documents {
+		records = append(records, models.CounselorApplicationDocument{
+			ApplicationID: applicationID,
+			FileID:        d.FileID,
+			Kind:          d.Kind,
+			Status:        models.ApplicationDocumentPending,
 		})
-		return
+		ids = append(ids, d.FileID)
 	}
-
-	// 拒绝时必须有拒绝原因
-	if req.Status == 2 && req.RejectReason == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code": 400,
-			"msg":  "拒绝时必须填写拒绝原因",
-		})
-		return
+	if err := tx.Create(&records).Error; err != nil {
+		return err
 	}
+	return tx.Model(&models.File{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"relation_type": models.FileRelationApplication,
+		"relation_id":   applicationID,
+	}).Error
+}
+
+// GetMyApplication 获取我的入驻申请
+// @Summary 获取我的入驻申请
+// @Description 返回申请信息、所处审核阶段、材料核验结果和处理记录
+// @Tags 咨询师入驻
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 401 {object} map[string]interface{} "未登录"
+// @Router /api/counselor/my-application [get]
+func GetMyApplication(c *gin.Context) {
+	userID := c.GetUint("user_id")
 
-	// 查询申请
 	var application models.CounselorApplication
-	if err := database.DB.First(&application, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"code": 404,
-			"msg":  "申请不存在",
-		})
-		return
-	}
+	result := database.DB.Preload("Documents", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Documents.File").Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("user_id = ?", userID).First(&application)
 
-	// 检查状态
-	if application.Status != 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code": 400,
-			"msg":  "该申请已审核",
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 200,
+			"msg":  "暂无入驻申请",
+			"data": nil,
 		})
 		return
 	}
 
-	// 开启事务
-	tx := database.DB.Begin()
-
-	// 更新申请状态
-	now := database.DB.NowFunc()
-	application.Status = req.Status
-	application.RejectReason = req.RejectReason
-	application.ReviewedBy = uint(userID.(float64))
-	application.ReviewedAt = &now
-	if err := tx.Save(&application).Error; err != nil {
-		tx.Rollback()
+	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"code": 500,
-			"msg":  "更新申请失败",
-			"error": err.Error(),
+			"code":  500,
+			"msg":   "查询申请失败",
+			"error": result.Error.Error(),
 		})
 		return
 	}
 
-	// 如果审核通过，创建咨询师账户
-	if req.Status == 1 {
-		// 创建咨询师记录
-		counselor := models.Counselor{
-			UserID:    application.UserID,
-			Name:      application.Name,
-			Title:     application.Title,
-			Avatar:    application.User.Avatar,
-			Bio:       application.Bio,
-			Specialty: application.Specialty,
-			Price:     5.0, // 默认价格5元/分钟
-			YearsExp:  application.YearsExp,
-			Rating:    5.0,
-			Status:    1,
-		}
-
-		if err := tx.Create(&counselor).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code": 500,
-				"msg":  "创建咨询师失败",
-				"error": err.Error(),
-			})
-			return
+	// 处理记录中管理员ID仅供后台使用
+	for i := range application.Events {
+		if application.Events[i].ActorType == models.ApplicationActorAdmin {
+			application.Events[i].ActorID = 0
 		}
-
-		// 创建统计记录
-		statistics := models.CounselorStatistics{
-			CounselorID: counselor.ID,
-		}
-		if err := tx.Create(&statistics).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code": 500,
-				"msg":  "创建统计记录失败",
-				"error": err.Error(),
-			})
-			return
-		}
-	}
-
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code": 500,
-			"msg":  "审核失败",
-			"error": err.Error(),
-		})
-		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
-		"msg":  "审核成功",
+		"msg":  "查询成功",
+		"data": application,
 	})
 }
 
-// UploadCertificate 上传证书图片
-// @Summary 上传证书图片
+// UploadCertificate 上传入驻申请材料
+// @Summary 上传入驻申请材料
+// @Description 上传证书、身份证明等材料（JPG/PNG/PDF，不超过5MB），返回的文件ID用于提交申请或补充材料
 // @Tags 咨询师入驻
 // @Accept multipart/form-data
 // @Produce json
-// @Param file formData file true "证书图片"
+// @Security BearerAuth
+// @Param file formData file true "材料文件"
 // @Success 200 {object} map[string]interface{} "成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未登录"
 // @Router /api/counselor/upload-certificate [post]
 func UploadCertificate(c *gin.Context) {
-	// 从JWT获取用户ID
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code": 401,
-			"msg":  "未登录",
-		})
-		return
-	}
+	userID := c.GetUint("user_id")
 
 	// 获取上传的文件
 	file, err := c.FormFile("file")
@@ -457,19 +455,18 @@ func UploadCertificate(c *gin.Context) {
 	}
 
 	// 验证文件类型
-	allowedTypes := []string{"image/jpeg", "image/jpg", "image/png"}
-	isValidType := false
-	for _, t := range allowedTypes {
-		if file.Header.Get("Content-Type") == t {
-			isValidType = true
-			break
-		}
-	}
-
-	if !isValidType {
+	allowedTypes := map[string]string{
+		"image/jpeg":      ".jpg",
+		"image/jpg":       ".jpg",
+		"image/png":       ".png",
+		"application/pdf": ".pdf",
+	}
+	mimeType := file.Header.Get("Content-Type")
+	ext, ok := allowedTypes[mimeType]
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code": 400,
-			"msg":  "仅支持JPG、JPEG、PNG格式的图片",
+			"msg":  "仅支持JPG、JPEG、PNG格式的图片或PDF文件",
 		})
 		return
 	}
@@ -478,40 +475,63 @@ func UploadCertificate(c *gin.Context) {
 	if file.Size > 5*1024*1024 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code": 400,
-			"msg":  "图片大小不能超过5MB",
+			"msg":  "文件大小不能超过5MB",
 		})
 		return
 	}
 
-	// 生成文件名
-	ext := ".jpg"
-	if file.Header.Get("Content-Type") == "image/png" {
-		ext = ".png"
+	// 按用户分目录保存
+	uploadDir := fmt.Sprintf("./uploads/certificates/%d", userID)
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "创建上传目录失败",
+		})
+		return
 	}
-	filename := fmt.Sprintf("certificate_%d_%d%s", uint(c.GetFloat64("user_id")), time.Now().Unix(), ext)
-
-	// 保存文件路径
-	uploadPath := "./uploads/certificates/"
-	filePath := uploadPath + filename
-
-	// 创建目录
+	filename := fmt.Sprintf("certificate_%d%s", time.Now().UnixNano(), ext)
+	filePath := filepath.Join(uploadDir, filename)
 	if err := c.SaveUploadedFile(file, filePath); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"code": 500,
-			"msg":  "文件上传失败",
+			"code":  500,
+			"msg":   "文件上传失败",
 			"error": err.Error(),
 		})
 		return
 	}
 
-	// 返回文件URL
-	fileURL := "/uploads/certificates/" + filename
+	fileType := models.FileTypeImage
+	if mimeType == "application/pdf" {
+		fileType = models.FileTypeDocument
+	}
+	record := models.File{
+		FileName:     filename,
+		OriginalName: file.Filename,
+		FilePath:     filePath,
+		FileURL:      fmt.Sprintf("/uploads/certificates/%d/%s", userID, filename),
+		FileSize:     file.Size,
+		FileType:     fileType,
+		MimeType:     mimeType,
+		UploaderID:   userID,
+		RelationType: models.FileRelationApplication,
+		Status:       1,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		os.Remove(filePath)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"msg":   "保存文件记录失败",
+			"error": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "上传成功",
 		"data": gin.H{
-			"url": fileURL,
+			"id":  record.ID,
+			"url": record.FileURL,
 		},
 	})
 }
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"akrick.com/mychat/calendar"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GetCalendarToken godoc
+// @Summary 获取日历订阅地址
+// @Description 返回当前用户的 iCalendar 订阅地址（首次调用时生成），可添加到手机或电脑日历
+// @Tags 日历
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,data:{feed_url}"
+// @Router /api/calendar/token [get]
+func GetCalendarToken(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var token models.CalendarToken
+	err := database.DB.Where("user_id = ?", principal.UserID).First(&token).Error
+	if err != nil {
+		token = models.CalendarToken{UserID: principal.UserID, Token: newCalendarToken()}
+		if err := database.DB.Create(&token).Error; err != nil {
+			// 并发请求已创建，读取已有令牌
+			if err := database.DB.Where("user_id = ?", principal.UserID).First(&token).Error; err != nil {
+				c.JSON(500, gin.H{"code": 500, "msg": "生成订阅地址失败: " + err.Error()})
+				return
+			}
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{"feed_url": calendarFeedURL(c, token.Token)},
+	})
+}
+
+// ResetCalendarToken godoc
+// @Summary 重置日历订阅地址
+// @Description 生成新的订阅令牌，旧的订阅地址立即失效
+// @Tags 日历
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,data:{feed_url}"
+// @Router /api/calendar/token/reset [post]
+func ResetCalendarToken(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	token := models.CalendarToken{UserID: principal.UserID, Token: newCalendarToken()}
+	result := database.DB.Model(&models.CalendarToken{}).Where("user_id = ?", principal.UserID).Update("token", token.Token)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result = database.DB.Create(&token)
+	}
+	if result.Error != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "重置订阅地址失败: " + result.Error.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "重置成功",
+		"data": gin.H{"feed_url": calendarFeedURL(c, token.Token)},
+	})
+}
+
+// GetCalendarFeed godoc
+// @Summary 日历订阅
+// @Description iCalendar（RFC 5545）订阅源，凭订阅令牌访问，包含近30天及以后的预约；改约、取消后自动更新
+// @Tags 日历
+// @Produce text/calendar
+// @Param token path string true "订阅令牌（可带 .ics 后缀）"
+// @Success 200 {string} string "text/calendar"
+// @Failure 404 {object} map[string]interface{} "订阅地址无效"
+// @Router /api/calendar/feed/{token} [get]
+func GetCalendarFeed(c *gin.Context) {
+	value := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var token models.CalendarToken
+	if value == "" || database.DB.Where("token = ?", value).First(&token).Error != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "订阅地址无效"})
+		return
+	}
+	principal, err := identity.Resolve(c.Request.Context(), token.UserID, "")
+	if err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "订阅地址无效"})
+		return
+	}
+
+	orders, err := calendar.FeedOrders(principal)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询预约失败: " + err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(200, "text/calendar; charset=utf-8", calendar.Build("MyChat 咨询预约", calendar.Events(principal, orders)))
+}
+
+// GetOrderICS godoc
+// @Summary 下载订单日历文件
+// @Description 将单个订单导出为 .ics 附件
+// @Tags 日历
+// @Produce text/calendar
+// @Security BearerAuth
+// @Param id path int true "订单ID"
+// @Success 200 {string} string "text/calendar"
+// @Failure 403 {object} map[string]interface{} "无权查看"
+// @Failure 404 {object} map[string]interface{} "订单不存在"
+// @Router /api/order/{id}/ics [get]
+func GetOrderICS(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.Preload("User").Preload("Counselor").First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "订单不存在"})
+		return
+	}
+	if !principal.IsParticipant(order.UserID, order.CounselorID) {
+		c.JSON(403, gin.H{"code": 403, "msg": "无权查看此订单"})
+		return
+	}
+	if order.Type == models.OrderTypePackage {
+		c.JSON(400, gin.H{"code": 400, "msg": "套餐购买订单没有预约时间"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="order-%s.ics"`, order.OrderNo))
+	c.Data(200, "text/calendar; charset=utf-8", calendar.Build("MyChat 咨询预约", calendar.Events(principal, []models.Order{order})))
+}
+
+func newCalendarToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// calendarFeedURL 订阅地址，日历客户端使用 webcal 协议时可将 https 替换为 webcal
+func calendarFeedURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/calendar/feed/%s.ics", scheme, c.Request.Host, token)
+}
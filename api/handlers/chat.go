@@ -1,13 +1,35 @@
 package handlers
 
 import (
+	"akrick.com/mychat/attachment"
+	"akrick.com/mychat/chatmsg"
+	"akrick.com/mychat/counselorstats"
 	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
 	"akrick.com/mychat/models"
+	"akrick.com/mychat/moderation"
+	"akrick.com/mychat/orderflow"
+	"akrick.com/mychat/search"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"log"
 	"strconv"
 	"time"
 )
 
+// currentPrincipal 获取当前请求的身份主体，失败时直接返回401
+func currentPrincipal(c *gin.Context) (*identity.Principal, bool) {
+	principal, err := identity.Current(c)
+	if err != nil {
+		c.JSON(401, gin.H{
+			"code": 401,
+			"msg":  "身份校验失败: " + err.Error(),
+		})
+		return nil, false
+	}
+	return principal, true
+}
+
 // StartChatSession godoc
 // @Summary 开始聊天会话
 // @Description 创建聊天会话（咨询师发起）
@@ -19,7 +41,10 @@ import (
 // @Success 200 {object} map[string]interface{} "code:200,msg:创建成功,data:{session_id}"
 // @Router /api/chat/start/{order_id} [post]
 func StartChatSession(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
 	orderID := c.Param("order_id")
 
 	// 查询订单
@@ -32,8 +57,8 @@ func StartChatSession(c *gin.Context) {
 		return
 	}
 
-	// 检查是否为咨询师
-	if order.CounselorID != userID.(uint) {
+	// 检查是否为该订单的咨询师
+	if !principal.IsCounselor() || order.CounselorID != principal.CounselorID {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "只有咨询师可以发起会话",
@@ -42,7 +67,7 @@ func StartChatSession(c *gin.Context) {
 	}
 
 	// 检查订单状态
-	if order.Status != models.OrderStatusPaid {
+	if order.Status != models.OrderStatusPaid || order.Type == models.OrderTypePackage {
 		c.JSON(400, gin.H{
 			"code": 400,
 			"msg":  "订单状态不允许开始会话",
@@ -84,8 +109,11 @@ func StartChatSession(c *gin.Context) {
 	// 发送通知给用户
 	go CreateNotification(order.UserID, models.NotificationTypeChat, models.NotificationLevelInfo, "咨询会话已开始", "您的咨询会话已经开始，请及时参与", "")
 
-	// 更新订单状态
-	database.DB.Model(&order).Update("status", models.OrderStatusCompleted)
+	orderflow.Record(database.DB, &order, orderflow.Request{
+		Event:    models.OrderEventSessionStart,
+		Actor:    orderflow.Actor{Type: models.OrderActorCounselor, ID: principal.CounselorID},
+		Metadata: map[string]interface{}{"session_id": session.ID},
+	})
 
 	c.JSON(200, gin.H{
 		"code": 200,
@@ -104,18 +132,21 @@ func StartChatSession(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Param session_id path int true "会话ID"
-// @Param request body map[string]interface{} true "消息内容:content,sender_type,content_type,file_url"
+// @Param request body map[string]interface{} true "消息内容:content,file_id（附件消息的 content_type 由附件决定，sender_type 可选，由身份自动判定）"
 // @Success 200 {object} map[string]interface{} "code:200,msg:发送成功,data:{message}"
 // @Router /api/chat/session/{session_id}/message [post]
 func SendMessage(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
 	sessionID := c.Param("session_id")
 
 	var req struct {
-		Content     string `json:"content" binding:"required"`
-		SenderType  string `json:"sender_type" binding:"required,oneof=user counselor"`
+		Content     string `json:"content"`
+		SenderType  string `json:"sender_type" binding:"omitempty,oneof=user counselor"`
 		ContentType string `json:"content_type"`
-		FileURL     string `json:"file_url"`
+		FileID      *uint  `json:"file_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -126,6 +157,14 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
+	if req.Content == "" && req.FileID == nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "消息内容不能为空",
+		})
+		return
+	}
+
 	// 查询会话
 	var session models.ChatSession
 	if err := database.DB.First(&session, sessionID).Error; err != nil {
@@ -145,8 +184,9 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
-	// 检查发送者权限
-	if req.SenderType == "user" && session.UserID != userID.(uint) {
+	// 检查发送者权限（发送者身份以服务端判定为准）
+	senderType := principal.SessionRole(session.UserID, session.CounselorID)
+	if senderType == "" || (req.SenderType != "" && req.SenderType != senderType) {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "无权发送消息",
@@ -154,30 +194,43 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
-	if req.SenderType == "counselor" && session.CounselorID != userID.(uint) {
-		c.JSON(403, gin.H{
-			"code": 403,
-			"msg":  "无权发送消息",
+	// 内容审核：拦截的消息不保存，打码的消息以打码后的内容保存
+	src := moderation.Source{SessionID: session.ID, SenderID: principal.UserID, SenderType: senderType}
+	verdict, err := moderation.Screen(req.Content, src)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
 		})
 		return
 	}
 
-	// 设置默认内容类型
-	if req.ContentType == "" {
-		req.ContentType = "text"
-	}
-
 	// 创建消息
 	message := models.ChatMessage{
 		SessionID:   session.ID,
-		SenderID:    userID.(uint),
-		SenderType:  req.SenderType,
-		ContentType: req.ContentType,
-		Content:     req.Content,
-		FileURL:     req.FileURL,
+		SenderID:    principal.UserID,
+		SenderType:  senderType,
+		ContentType: models.MessageTypeText,
+		Content:     verdict.Content,
 		IsRead:      false,
 	}
 
+	// 附件消息：内容类型以附件为准
+	if req.FileID != nil {
+		file, err := attachment.ForMessage(*req.FileID, session.ID, principal.UserID)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  err.Error(),
+			})
+			return
+		}
+		message.FileID = &file.ID
+		message.FileURL = file.FileURL
+		message.ContentType = attachment.Kind(file)
+		message.File = file
+	}
+
 	if err := database.DB.Create(&message).Error; err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
@@ -185,16 +238,19 @@ func SendMessage(c *gin.Context) {
 		})
 		return
 	}
+	search.Notify(message.ID)
+	moderation.Report(verdict, src, &message.ID)
 
 	// 发送通知给接收者
-	var receiverID uint
-	if req.SenderType == "user" {
-		receiverID = session.CounselorID
-	} else {
-		receiverID = session.UserID
+	receiverRole := identity.SessionRoleCounselor
+	if senderType == identity.SessionRoleCounselor {
+		receiverRole = identity.SessionRoleUser
+	}
+	if receiverID, err := identity.UserIDForSessionRole(c.Request.Context(), receiverRole, session.UserID, session.CounselorID); err == nil && receiverID != 0 {
+		go CreateNotification(receiverID, models.NotificationTypeChat, models.NotificationLevelInfo, "新消息", "您收到一条新消息", "")
 	}
 
-	go CreateNotification(receiverID, models.NotificationTypeChat, models.NotificationLevelInfo, "新消息", "您收到一条新消息", "")
+	attachment.DecorateMessage(&message, principal.UserID)
 
 	c.JSON(200, gin.H{
 		"code": 200,
@@ -216,7 +272,10 @@ func SendMessage(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{messages,total}"
 // @Router /api/chat/messages/{session_id} [get]
 func GetMessages(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
 	sessionID := c.Param("session_id")
 	page := c.DefaultQuery("page", "1")
 	pageSize := c.DefaultQuery("page_size", "20")
@@ -231,8 +290,8 @@ func GetMessages(c *gin.Context) {
 		return
 	}
 
-	// 检查权限
-	if session.UserID != userID.(uint) && session.CounselorID != userID.(uint) {
+	// 检查权限（会话参与者或管理员）
+	if !principal.CanView(session.UserID, session.CounselorID) {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "无权访问此会话",
@@ -241,7 +300,7 @@ func GetMessages(c *gin.Context) {
 	}
 
 	// 查询消息
-	query := database.DB.Model(&models.ChatMessage{}).Where("session_id = ?", sessionID)
+	query := database.DB.Model(&models.ChatMessage{}).Where("session_id = ?", sessionID).Scopes(chatmsg.Visible(principal.UserID))
 
 	var total int64
 	query.Count(&total)
@@ -255,7 +314,7 @@ func GetMessages(c *gin.Context) {
 	}
 
 	ps, _ := strconv.Atoi(pageSize)
-	if err := query.Preload("Sender").Preload("Session").Preload("Session.Counselor").Offset(offset).Limit(ps).Order("created_at ASC").Find(&messages).Error; err != nil {
+	if err := query.Preload("Session").Preload("Session.Counselor").Preload("File").Offset(offset).Limit(ps).Order("created_at ASC").Find(&messages).Error; err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "查询失败: " + err.Error(),
@@ -263,6 +322,8 @@ func GetMessages(c *gin.Context) {
 		return
 	}
 
+	attachment.Decorate(messages, principal.UserID)
+
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "获取成功",
@@ -273,6 +334,225 @@ func GetMessages(c *gin.Context) {
 	})
 }
 
+// EditMessage godoc
+// @Summary 编辑消息
+// @Description 编辑自己发送的文本消息（发送后15分钟内），原内容保留在审计记录中
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param message_id path int true "消息ID"
+// @Param request body map[string]interface{} true "content:新内容"
+// @Success 200 {object} map[string]interface{} "code:200,msg:编辑成功,data:消息"
+// @Router /api/chat/message/{message_id} [put]
+func EditMessage(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	messageID, _ := strconv.ParseUint(c.Param("message_id"), 10, 64)
+
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	message, err := chatmsg.Edit(principal, uint(messageID), req.Content)
+	if err != nil {
+		respondMessageError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "编辑成功",
+		"data": message,
+	})
+}
+
+// RecallMessage godoc
+// @Summary 撤回消息
+// @Description 撤回自己发送的消息（发送后2分钟内），会话双方均不再看到原内容
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param message_id path int true "消息ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:撤回成功,data:消息"
+// @Router /api/chat/message/{message_id}/recall [post]
+func RecallMessage(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	messageID, _ := strconv.ParseUint(c.Param("message_id"), 10, 64)
+
+	message, err := chatmsg.Recall(principal, uint(messageID))
+	if err != nil {
+		respondMessageError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "撤回成功",
+		"data": message,
+	})
+}
+
+// DeleteMessageForMe godoc
+// @Summary 删除消息（仅自己）
+// @Description 从自己的消息列表中删除消息，不影响会话对方
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param message_id path int true "消息ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:删除成功"
+// @Router /api/chat/message/{message_id} [delete]
+func DeleteMessageForMe(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	messageID, _ := strconv.ParseUint(c.Param("message_id"), 10, 64)
+
+	if _, err := chatmsg.Hide(principal, uint(messageID)); err != nil {
+		respondMessageError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// SearchChatMessages godoc
+// @Summary 搜索聊天记录
+// @Description 全文检索当前用户可见的聊天记录（普通用户限本人会话，咨询师含接待的会话，管理员不限），返回高亮片段
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param keyword query string true "搜索关键词，多个词用空格分隔"
+// @Param session_id query int false "会话ID"
+// @Param sender_id query int false "发送者用户ID"
+// @Param content_type query string false "内容类型:text/image/audio/file"
+// @Param start_date query string false "开始日期(2006-01-02)"
+// @Param end_date query string false "结束日期(2006-01-02，含当天)"
+// @Param sort query string false "排序:time/relevance" default(time)
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{messages,total}"
+// @Router /api/chat/search [get]
+func SearchChatMessages(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	sessionID, _ := strconv.ParseUint(c.Query("session_id"), 10, 64)
+	senderID, _ := strconv.ParseUint(c.Query("sender_id"), 10, 64)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	q := &search.Query{
+		Keyword:     c.Query("keyword"),
+		SessionID:   uint(sessionID),
+		SenderID:    uint(senderID),
+		ContentType: c.Query("content_type"),
+		Sort:        c.DefaultQuery("sort", search.SortTime),
+		Page:        page,
+		PageSize:    pageSize,
+		ViewerID:    principal.UserID,
+	}
+	if v := c.Query("start_date"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "开始日期格式错误",
+			})
+			return
+		}
+		q.StartTime = &t
+	}
+	if v := c.Query("end_date"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "结束日期格式错误",
+			})
+			return
+		}
+		t = t.AddDate(0, 0, 1)
+		q.EndTime = &t
+	}
+
+	// 只能检索有权查看的会话
+	scope, err := search.ScopeFor(principal)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+	q.SessionIDs = scope
+
+	result, err := search.Search(c.Request.Context(), q)
+	if err != nil {
+		code := 500
+		if errors.Is(err, search.ErrEmptyKeyword) {
+			code = 400
+		}
+		c.JSON(code, gin.H{
+			"code": code,
+			"msg":  "搜索失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": result,
+	})
+}
+
+// respondMessageError 将消息修订错误映射为HTTP响应
+func respondMessageError(c *gin.Context, err error) {
+	code := 400
+	switch {
+	case errors.Is(err, chatmsg.ErrNotFound):
+		code = 404
+	case errors.Is(err, chatmsg.ErrForbidden), errors.Is(err, chatmsg.ErrNotSender):
+		code = 403
+	case errors.Is(err, chatmsg.ErrRecalled), errors.Is(err, chatmsg.ErrNotEditable),
+		errors.Is(err, chatmsg.ErrEditExpired), errors.Is(err, chatmsg.ErrRecallExpired),
+		errors.Is(err, chatmsg.ErrEmptyContent), errors.Is(err, chatmsg.ErrContentTooLong),
+		errors.Is(err, chatmsg.ErrSessionClosed), errors.Is(err, moderation.ErrBlocked):
+	default:
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "操作失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(code, gin.H{
+		"code": code,
+		"msg":  err.Error(),
+	})
+}
+
 // EndChatSession godoc
 // @Summary 结束聊天会话
 // @Description 结束聊天会话
@@ -284,7 +564,10 @@ func GetMessages(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "code:200,msg:结束成功"
 // @Router /api/chat/end/{session_id} [post]
 func EndChatSession(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
 	sessionID := c.Param("session_id")
 
 	// 查询会话
@@ -298,7 +581,7 @@ func EndChatSession(c *gin.Context) {
 	}
 
 	// 检查权限（只有咨询师可以结束会话）
-	if session.CounselorID != userID.(uint) {
+	if principal.SessionRole(session.UserID, session.CounselorID) != identity.SessionRoleCounselor {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "只有咨询师可以结束会话",
@@ -319,20 +602,42 @@ func EndChatSession(c *gin.Context) {
 	now := time.Now()
 	duration := int(now.Sub(*session.StartTime).Seconds())
 
-	if err := database.DB.Model(&session).Updates(map[string]any{
-		"status":   2,
+	ended, err := counselorstats.EndSession(database.DB, &session, map[string]any{
 		"end_time": &now,
 		"duration": duration,
-	}).Error; err != nil {
+	})
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "结束失败: " + err.Error(),
 		})
 		return
 	}
+	if !ended {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "会话已结束",
+		})
+		return
+	}
 
-	// 发送通知给用户
-	go CreateNotification(session.UserID, models.NotificationTypeChat, models.NotificationLevelSuccess, "咨询已结束", "您的咨询会话已结束", "")
+	// 记录会话结束；会话结束即咨询完成（完成通知由订单状态机发送）
+	var order models.Order
+	if err := database.DB.First(&order, session.OrderID).Error; err == nil {
+		orderflow.Record(database.DB, &order, orderflow.Request{
+			Event:    models.OrderEventSessionEnd,
+			Actor:    orderflow.Actor{Type: models.OrderActorCounselor, ID: principal.CounselorID},
+			Metadata: map[string]interface{}{"session_id": session.ID, "duration": duration},
+		})
+	}
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID:  session.OrderID,
+		Event:    models.OrderEventComplete,
+		Actor:    orderflow.System,
+		Metadata: map[string]interface{}{"session_id": session.ID},
+	}); err != nil {
+		log.Printf("会话结束后完成订单失败: sessionID=%d, orderID=%d, err=%v", session.ID, session.OrderID, err)
+	}
 
 	c.JSON(200, gin.H{
 		"code": 200,
@@ -355,11 +660,19 @@ func EndChatSession(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{sessions,total}"
 // @Router /api/chat/sessions [get]
 func GetChatSessions(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
 	page := c.DefaultQuery("page", "1")
 	pageSize := c.DefaultQuery("page_size", "10")
 
-	query := database.DB.Model(&models.ChatSession{}).Where("user_id = ? OR counselor_id = ?", userID, userID)
+	query := database.DB.Model(&models.ChatSession{})
+	if principal.IsCounselor() {
+		query = query.Where("user_id = ? OR counselor_id = ?", principal.UserID, principal.CounselorID)
+	} else {
+		query = query.Where("user_id = ?", principal.UserID)
+	}
 
 	var total int64
 	query.Count(&total)
@@ -393,7 +706,7 @@ func GetChatSessions(c *gin.Context) {
 
 // GetOrderSessionId godoc
 // @Summary 获取订单的会话ID
-// @Description 根据订单ID获取聊天会话（用户端使用）
+// @Description 根据订单ID获取聊天会话（订单用户或咨询师使用）
 // @Tags 聊天
 // @Accept json
 // @Produce json
@@ -403,7 +716,10 @@ func GetChatSessions(c *gin.Context) {
 // @Failure 404 {object} map[string]interface{} "会话不存在"
 // @Router /api/chat/order/{order_id}/session [get]
 func GetOrderSessionId(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
 	orderID := c.Param("order_id")
 
 	// 查询订单
@@ -417,7 +733,7 @@ func GetOrderSessionId(c *gin.Context) {
 	}
 
 	// 检查权限
-	if order.UserID != userID.(uint) {
+	if !principal.IsParticipant(order.UserID, order.CounselorID) {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "无权访问此订单",
@@ -443,3 +759,177 @@ func GetOrderSessionId(c *gin.Context) {
 		},
 	})
 }
+
+// UploadChatAttachment godoc
+// @Summary 上传聊天附件
+// @Description 上传会话内的图片、语音或文件，返回的 file_id 用于发送附件消息（HTTP 或 WebSocket）
+// @Tags 聊天
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param session_id path int true "会话ID"
+// @Param file formData file true "文件"
+// @Param content_type formData string false "内容类型:image/audio/file，不传时按文件内容推断"
+// @Param duration formData int false "语音时长(毫秒)，服务端无法解析时使用"
+// @Success 200 {object} map[string]interface{} "code:200,msg:上传成功,data:{file_id,content_type,download_url,thumb_url}"
+// @Router /api/chat/session/{session_id}/attachment [post]
+func UploadChatAttachment(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	sessionID := c.Param("session_id")
+
+	// 查询会话
+	var session models.ChatSession
+	if err := database.DB.First(&session, sessionID).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "会话不存在",
+		})
+		return
+	}
+
+	// 只有会话参与者可以上传
+	if !principal.IsParticipant(session.UserID, session.CounselorID) {
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  "无权向此会话上传文件",
+		})
+		return
+	}
+
+	if session.Status != 0 && session.Status != 1 {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "会话已结束",
+		})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "文件不存在: " + err.Error(),
+		})
+		return
+	}
+
+	contentType := c.PostForm("content_type")
+	duration, _ := strconv.Atoi(c.PostForm("duration"))
+
+	file, err := attachment.Save(session.ID, principal.UserID, contentType, fileHeader, duration)
+	if err != nil {
+		code := 500
+		if errors.Is(err, attachment.ErrTooLarge) || errors.Is(err, attachment.ErrUnsupported) ||
+			errors.Is(err, attachment.ErrVoiceTooLong) || errors.Is(err, attachment.ErrImageTooLarge) {
+			code = 400
+		}
+		c.JSON(code, gin.H{
+			"code": code,
+			"msg":  "上传失败: " + err.Error(),
+		})
+		return
+	}
+
+	kind := attachment.Kind(file)
+	data := gin.H{
+		"file_id":       file.ID,
+		"content_type":  kind,
+		"original_name": file.OriginalName,
+		"file_size":     file.FileSize,
+		"mime_type":     file.MimeType,
+		"width":         file.Width,
+		"height":        file.Height,
+		"duration":      file.Duration,
+		"download_url":  attachment.SignedURL(file.ID, principal.UserID, false),
+	}
+	if kind == models.MessageTypeImage {
+		data["thumb_url"] = attachment.SignedURL(file.ID, principal.UserID, true)
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "上传成功",
+		"data": data,
+	})
+}
+
+// DownloadChatFile godoc
+// @Summary 下载聊天附件
+// @Description 通过签名链接下载会话附件，链接绑定查看者且限时有效，下载时会再次校验会话成员身份
+// @Tags 聊天
+// @Produce octet-stream
+// @Param id path int true "文件ID"
+// @Param uid query int true "查看者用户ID"
+// @Param exp query int true "过期时间戳"
+// @Param sig query string true "签名"
+// @Param thumb query int false "是否下载缩略图"
+// @Success 200 {file} file "文件内容"
+// @Router /api/chat/file/{id} [get]
+func DownloadChatFile(c *gin.Context) {
+	fileID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	viewerID, _ := strconv.ParseUint(c.Query("uid"), 10, 64)
+	exp, _ := strconv.ParseInt(c.Query("exp"), 10, 64)
+	thumb := c.Query("thumb") == "1"
+
+	if !attachment.Verify(uint(fileID), uint(viewerID), exp, thumb, c.Query("sig")) {
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  "下载链接无效或已过期",
+		})
+		return
+	}
+
+	var file models.File
+	if err := database.DB.Where("id = ? AND status = 1 AND relation_type = ?", fileID, models.FileRelationSession).First(&file).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "文件不存在",
+		})
+		return
+	}
+
+	// 链接签发后身份可能已变化，重新校验会话成员身份
+	var session models.ChatSession
+	if err := database.DB.First(&session, file.RelationID).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "会话不存在",
+		})
+		return
+	}
+	principal, err := identity.Resolve(c.Request.Context(), uint(viewerID), "")
+	if err != nil || !principal.CanView(session.UserID, session.CounselorID) {
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  "无权访问此文件",
+		})
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=3600")
+
+	if thumb {
+		if file.ThumbPath == "" {
+			c.JSON(404, gin.H{
+				"code": 404,
+				"msg":  "缩略图不存在",
+			})
+			return
+		}
+		c.Header("Content-Type", "image/jpeg")
+		c.File(file.ThumbPath)
+		return
+	}
+
+	// 图片和语音内联展示，其它文件一律作为附件下载
+	if file.FileType == models.FileTypeImage || file.FileType == models.FileTypeAudio {
+		c.Header("Content-Type", file.MimeType)
+		c.File(file.FilePath)
+		return
+	}
+	c.FileAttachment(file.FilePath, file.OriginalName)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/testutil"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chatRouter 注册聊天接口，以 userID 的身份发起请求（代替 AuthMiddleware）
+func chatRouter(userID uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	r.POST("/api/chat/start/:order_id", StartChatSession)
+	r.POST("/api/chat/session/:session_id/message", SendMessage)
+	r.GET("/api/chat/messages/:session_id", GetMessages)
+	r.POST("/api/chat/end/:session_id", EndChatSession)
+	r.GET("/api/chat/sessions", GetChatSessions)
+	return r
+}
+
+type chatResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+func chatRequest(t *testing.T, userID uint, method, path string, body interface{}) chatResponse {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	chatRouter(userID).ServeHTTP(w, req)
+
+	var resp chatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: invalid response %q", method, path, w.Body.String())
+	}
+	if resp.Code != w.Code {
+		t.Fatalf("%s %s: body code %d != status %d", method, path, resp.Code, w.Code)
+	}
+	return resp
+}
+
+func TestSendMessageUsesSessionRoleNotRawIDs(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	path := fmt.Sprintf("/api/chat/session/%d/message", ids.Session.ID)
+
+	// 用户ID等于会话 counselor_id 的用户不能以任何身份发送
+	for _, senderType := range []string{"", "counselor", "user"} {
+		resp := chatRequest(t, ids.Other.ID, http.MethodPost, path, gin.H{"content": "hi", "sender_type": senderType})
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("other user with sender_type %q: code = %d, want 403", senderType, resp.Code)
+		}
+	}
+
+	// 咨询师的咨询师ID等于另一会话的 user_id，不能在该会话中发送
+	otherPath := fmt.Sprintf("/api/chat/session/%d/message", ids.OtherSession.ID)
+	if resp := chatRequest(t, ids.CounselorUser.ID, http.MethodPost, otherPath, gin.H{"content": "hi"}); resp.Code != http.StatusForbidden {
+		t.Fatalf("counselor in foreign session: code = %d, want 403", resp.Code)
+	}
+
+	// 来访者不能冒充咨询师
+	if resp := chatRequest(t, ids.Client.ID, http.MethodPost, path, gin.H{"content": "hi", "sender_type": "counselor"}); resp.Code != http.StatusForbidden {
+		t.Fatalf("client spoofing counselor: code = %d, want 403", resp.Code)
+	}
+
+	resp := chatRequest(t, ids.CounselorUser.ID, http.MethodPost, path, gin.H{"content": "您好"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("counselor send: code = %d (%s), want 200", resp.Code, resp.Msg)
+	}
+	var message models.ChatMessage
+	json.Unmarshal(resp.Data, &message)
+	if message.SenderType != "counselor" || message.SenderID != ids.CounselorUser.ID {
+		t.Fatalf("counselor message sender = (%s, %d), want (counselor, %d)", message.SenderType, message.SenderID, ids.CounselorUser.ID)
+	}
+
+	resp = chatRequest(t, ids.Client.ID, http.MethodPost, path, gin.H{"content": "您好"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("client send: code = %d (%s), want 200", resp.Code, resp.Msg)
+	}
+	json.Unmarshal(resp.Data, &message)
+	if message.SenderType != "user" || message.SenderID != ids.Client.ID {
+		t.Fatalf("client message sender = (%s, %d), want (user, %d)", message.SenderType, message.SenderID, ids.Client.ID)
+	}
+
+	var count int64
+	db.Model(&models.ChatMessage{}).Where("session_id = ?", ids.Session.ID).Count(&count)
+	if count != 2 {
+		t.Fatalf("saved %d messages, want 2", count)
+	}
+}
+
+func TestGetMessagesRequiresParticipant(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	path := fmt.Sprintf("/api/chat/messages/%d", ids.Session.ID)
+
+	if resp := chatRequest(t, ids.Other.ID, http.MethodGet, path, nil); resp.Code != http.StatusForbidden {
+		t.Fatalf("other user: code = %d, want 403", resp.Code)
+	}
+	otherPath := fmt.Sprintf("/api/chat/messages/%d", ids.OtherSession.ID)
+	if resp := chatRequest(t, ids.CounselorUser.ID, http.MethodGet, otherPath, nil); resp.Code != http.StatusForbidden {
+		t.Fatalf("counselor in foreign session: code = %d, want 403", resp.Code)
+	}
+	for _, userID := range []uint{ids.Client.ID, ids.CounselorUser.ID} {
+		if resp := chatRequest(t, userID, http.MethodGet, path, nil); resp.Code != http.StatusOK {
+			t.Fatalf("participant %d: code = %d (%s), want 200", userID, resp.Code, resp.Msg)
+		}
+	}
+}
+
+func TestGetChatSessionsScopesByRole(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+
+	sessionIDs := func(userID uint) []uint {
+		resp := chatRequest(t, userID, http.MethodGet, "/api/chat/sessions", nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("user %d: code = %d (%s), want 200", userID, resp.Code, resp.Msg)
+		}
+		var data struct {
+			Sessions []models.ChatSession `json:"sessions"`
+		}
+		json.Unmarshal(resp.Data, &data)
+		var list []uint
+		for _, s := range data.Sessions {
+			list = append(list, s.ID)
+		}
+		return list
+	}
+
+	if got := sessionIDs(ids.CounselorUser.ID); len(got) != 1 || got[0] != ids.Session.ID {
+		t.Fatalf("counselor sessions = %v, want [%d]", got, ids.Session.ID)
+	}
+	if got := sessionIDs(ids.Other.ID); len(got) != 1 || got[0] != ids.OtherSession.ID {
+		t.Fatalf("other user sessions = %v, want [%d]", got, ids.OtherSession.ID)
+	}
+}
+
+func TestStartAndEndChatSessionRequireCounselor(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+
+	// 订单的 counselor_id 等于 Other 的用户ID
+	var order models.Order
+	db.First(&order, ids.Session.OrderID)
+	db.Delete(&models.ChatSession{}, ids.Session.ID)
+	startPath := fmt.Sprintf("/api/chat/start/%d", order.ID)
+	if resp := chatRequest(t, ids.Other.ID, http.MethodPost, startPath, nil); resp.Code != http.StatusForbidden {
+		t.Fatalf("other user start: code = %d, want 403", resp.Code)
+	}
+	if resp := chatRequest(t, ids.Client.ID, http.MethodPost, startPath, nil); resp.Code != http.StatusForbidden {
+		t.Fatalf("client start: code = %d, want 403", resp.Code)
+	}
+	resp := chatRequest(t, ids.CounselorUser.ID, http.MethodPost, startPath, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("counselor start: code = %d (%s), want 200", resp.Code, resp.Msg)
+	}
+	var started struct {
+		SessionID uint `json:"session_id"`
+	}
+	json.Unmarshal(resp.Data, &started)
+
+	endPath := fmt.Sprintf("/api/chat/end/%d", started.SessionID)
+	for _, userID := range []uint{ids.Other.ID, ids.Client.ID} {
+		if resp := chatRequest(t, userID, http.MethodPost, endPath, nil); resp.Code != http.StatusForbidden {
+			t.Fatalf("user %d end: code = %d, want 403", userID, resp.Code)
+		}
+	}
+	otherEnd := fmt.Sprintf("/api/chat/end/%d", ids.OtherSession.ID)
+	if resp := chatRequest(t, ids.CounselorUser.ID, http.MethodPost, otherEnd, nil); resp.Code != http.StatusForbidden {
+		t.Fatalf("counselor ending foreign session: code = %d, want 403", resp.Code)
+	}
+
+	if resp := chatRequest(t, ids.CounselorUser.ID, http.MethodPost, endPath, nil); resp.Code != http.StatusOK {
+		t.Fatalf("counselor end: code = %d (%s), want 200", resp.Code, resp.Msg)
+	}
+	assertSessionEnded(t, db, started.SessionID, ids.Counselor.ID)
+}
+
+// assertSessionEnded 会话已结束，且会话数计入咨询师ID（而不是其用户ID）的统计
+func assertSessionEnded(t *testing.T, db *gorm.DB, sessionID, counselorID uint) {
+	t.Helper()
+
+	var session models.ChatSession
+	db.First(&session, sessionID)
+	if session.Status != 2 {
+		t.Fatalf("session status = %d, want 2", session.Status)
+	}
+	var stats []models.CounselorStatistics
+	db.Find(&stats)
+	if len(stats) != 1 || stats[0].CounselorID != counselorID || stats[0].SessionCount != 1 {
+		t.Fatalf("counselor statistics = %+v, want one row for counselor %d with session_count 1", stats, counselorID)
+	}
+}
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"context"
-	"sort"
+	"errors"
 	"strconv"
+	"strings"
 	"akrick.com/mychat/cache"
+	"akrick.com/mychat/counselorsearch"
 	"akrick.com/mychat/database"
 	"akrick.com/mychat/models"
+	"akrick.com/mychat/review"
+	"akrick.com/mychat/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CreateCounselorRequest struct {
@@ -89,58 +94,76 @@ func CreateCounselor(c *gin.Context) {
 
 // GetCounselorList godoc
 // @Summary 获取咨询师列表
-// @Description 获取所有启用的咨询师列表，包含统计信息
+// @Description 按擅长领域、服务标签、语言、性别、价格、从业年限、评分、近期可约和在线状态筛选启用的咨询师，包含统计信息、结构化标签和分面计数。同一条件的多个取值用逗号分隔，命中任一即可；分面计数不受本维度自身筛选的影响
 // @Tags 咨询师
 // @Accept json
 // @Produce json
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Param keyword query string false "关键词"
-// @Param sort_by query string false "排序字段(rating,price,service_count)" default(rating)
+// @Param keyword query string false "关键词（姓名、职称、擅长领域）"
+// @Param specialty query string false "擅长领域，多个用逗号分隔"
+// @Param tag query string false "服务标签，多个用逗号分隔"
+// @Param language query string false "咨询语言，多个用逗号分隔"
+// @Param gender query string false "性别:male/female"
+// @Param price_min query number false "最低单价(元/分钟)"
+// @Param price_max query number false "最高单价(元/分钟)"
+// @Param years_min query int false "最低从业年限"
+// @Param rating_min query number false "最低评分"
+// @Param available_hours query int false "只看N小时内可约（最大72）"
+// @Param online query bool false "只看当前在线"
+// @Param sort_by query string false "排序字段(rating,price,service_count,years_exp,created_at)" default(rating)
 // @Param sort_order query string false "排序方式(asc,desc)" default(desc)
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{counselors,total}"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{counselors,total,facets}"
+// @Failure 400 {object} map[string]interface{} "参数错误"
 // @Router /api/counselor/list [get]
 func GetCounselorList(c *gin.Context) {
-	page := c.DefaultQuery("page", "1")
-	pageSize := c.DefaultQuery("page_size", "10")
-	keyword := c.Query("keyword")
-	sortBy := c.DefaultQuery("sort_by", "rating")
-	sortOrder := c.DefaultQuery("sort_order", "desc")
-
-	var total int64
-	query := database.DB.Model(&models.Counselor{}).Where("status = ?", 1)
-
-	// 关键词搜索
-	if keyword != "" {
-		query = query.Where("name LIKE ? OR specialty LIKE ? OR title LIKE ?",
-			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
-	}
-
-	query.Count(&total)
-
-	var counselors []models.Counselor
-	offset := 0
-	if page != "1" {
-		p, _ := strconv.Atoi(page)
-		ps, _ := strconv.Atoi(pageSize)
-		offset = (p - 1) * ps
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	yearsMin, _ := strconv.Atoi(c.Query("years_min"))
+	availableHours, _ := strconv.Atoi(c.Query("available_hours"))
+	ratingMin, _ := strconv.ParseFloat(c.Query("rating_min"), 64)
+	online, _ := strconv.ParseBool(c.Query("online"))
+
+	q := &counselorsearch.Query{
+		Keyword:        c.Query("keyword"),
+		Specialties:    queryList(c, "specialty"),
+		Tags:           queryList(c, "tag"),
+		Languages:      queryList(c, "language"),
+		Gender:         c.Query("gender"),
+		YearsMin:       yearsMin,
+		RatingMin:      ratingMin,
+		AvailableHours: availableHours,
+		Online:         online,
+		SortBy:         c.DefaultQuery("sort_by", counselorsearch.SortRating),
+		SortOrder:      c.DefaultQuery("sort_order", "desc"),
+		Page:           page,
+		PageSize:       pageSize,
+	}
+	if q.Gender != "" && q.Gender != models.GenderMale && q.Gender != models.GenderFemale {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "性别参数错误",
+		})
+		return
 	}
-
-	ps, _ := strconv.Atoi(pageSize)
-
-	// 构建排序
-	orderClause := "rating DESC, created_at DESC"
-	validSortFields := map[string]bool{"rating": true, "price": true, "service_count": true, "created_at": true}
-	if validSortFields[sortBy] {
-		if sortOrder == "asc" {
-			orderClause = sortBy + " ASC"
-		} else {
-			orderClause = sortBy + " DESC"
+	for name, dest := range map[string]**float64{"price_min": &q.PriceMin, "price_max": &q.PriceMax} {
+		v := c.Query(name)
+		if v == "" {
+			continue
 		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "价格参数错误",
+			})
+			return
+		}
+		*dest = &f
 	}
 
-	// 先查询基础数据
-	if err := query.Offset(offset).Limit(ps).Order(orderClause).Find(&counselors).Error; err != nil {
+	result, err := counselorsearch.Search(c.Request.Context(), q)
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "查询失败: " + err.Error(),
@@ -148,54 +171,22 @@ func GetCounselorList(c *gin.Context) {
 		return
 	}
 
-	// 为每个咨询师添加统计信息
-	counselorIDs := make([]uint, len(counselors))
-	for i, counselor := range counselors {
-		counselorIDs[i] = counselor.ID
-	}
-
-	// 批量查询统计信息
-	var statsList []models.CounselorStatistics
-	database.DB.Where("counselor_id IN ?", counselorIDs).Find(&statsList)
-	statsMap := make(map[uint]models.CounselorStatistics)
-	for _, stats := range statsList {
-		statsMap[stats.CounselorID] = stats
-	}
-
-	// 填充统计数据
-	for i := range counselors {
-		if stats, ok := statsMap[counselors[i].ID]; ok {
-			counselors[i].ServiceCount = stats.CompletedOrders
-			counselors[i].ReviewCount = stats.ReviewCount
-		}
-
-		// 推荐逻辑：评分大于4.5且已完成订单数大于5
-		counselors[i].IsRecommended = counselors[i].Rating >= 4.5 && counselors[i].ServiceCount >= 5
-	}
-
-	// 如果按服务数排序，需要重新排序
-	if sortBy == "service_count" {
-		if sortOrder == "asc" {
-			sort.Slice(counselors, func(i, j int) bool {
-				return counselors[i].ServiceCount < counselors[j].ServiceCount
-			})
-		} else {
-			sort.Slice(counselors, func(i, j int) bool {
-				return counselors[i].ServiceCount > counselors[j].ServiceCount
-			})
-		}
-	}
-
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "获取成功",
-		"data": gin.H{
-			"counselors": counselors,
-			"total":      total,
-		},
+		"data": result,
 	})
 }
 
+// queryList 读取逗号分隔或重复出现的查询参数
+func queryList(c *gin.Context, name string) []string {
+	var values []string
+	for _, v := range c.QueryArray(name) {
+		values = append(values, strings.Split(v, ",")...)
+	}
+	return values
+}
+
 // GetCounselorDetail godoc
 // @Summary 获取咨询师详情
 // @Description 根据ID获取咨询师详细信息（使用Redis缓存和SingleFlight防穿透）
@@ -227,7 +218,10 @@ func GetCounselorDetail(c *gin.Context) {
 				Bio:       counselorData.Bio,
 				Specialty: counselorData.Specialty,
 				Price:     counselorData.Price,
+				Level:     counselorData.Level,
+				PriceRules: counselorData.PriceRules,
 				YearsExp:  counselorData.YearsExp,
+				Gender:    counselorData.Gender,
 				Rating:    counselorData.Rating,
 				Status:    counselorData.Status,
 				CreatedAt: counselorData.CreatedAt,
@@ -248,6 +242,12 @@ func GetCounselorDetail(c *gin.Context) {
 		}
 	}
 
+	// 填充统计和结构化标签
+	list := []models.Counselor{counselor}
+	if err := counselorsearch.Fill(list); err == nil {
+		counselor = list[0]
+	}
+
 	msg := "获取成功"
 	if fromCache {
 		msg = "获取成功（来自缓存）"
@@ -262,15 +262,15 @@ func GetCounselorDetail(c *gin.Context) {
 
 // UpdateCounselor godoc
 // @Summary 更新咨询师信息
-// @Description 更新咨询师信息（仅咨询师本人或管理员）
+// @Description 更新咨询师信息（仅咨询师本人或管理员）；职称、头像、简介、擅长领域和单价的修改记为资料修改申请，审核通过后生效
 // @Tags 咨询师
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "咨询师ID"
 // @Param request body UpdateCounselorRequest true "更新信息"
-// @Success 200 {object} map[string]interface{} "code:200,msg:更新成功"
-// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Success 200 {object} map[string]interface{} "code:200,msg:更新成功,data:{change}"
+// @Failure 400 {object} map[string]interface{} "参数错误或已有待审核的资料修改"
 // @Failure 401 {object} map[string]interface{} "未授权"
 // @Failure 403 {object} map[string]interface{} "无权操作"
 // @Failure 404 {object} map[string]interface{} "咨询师不存在"
@@ -296,24 +296,36 @@ func UpdateCounselor(c *gin.Context) {
 		return
 	}
 
-	updates := make(map[string]interface{})
-	if req.Name != "" {
-		updates["name"] = req.Name
-	}
+	// 职称、头像、简介、擅长领域和单价的修改须经审核，记为修改申请
+	var edit models.ProfileEdit
 	if req.Title != "" {
-		updates["title"] = req.Title
+		edit.Title = &req.Title
 	}
 	if req.Avatar != "" {
-		updates["avatar"] = req.Avatar
+		edit.Avatar = &req.Avatar
 	}
 	if req.Bio != "" {
-		updates["bio"] = req.Bio
+		edit.Bio = &req.Bio
 	}
 	if req.Specialty != "" {
-		updates["specialty"] = req.Specialty
+		edit.Specialty = &req.Specialty
 	}
 	if req.Price > 0 {
-		updates["price"] = req.Price
+		edit.Price = &req.Price
+	}
+	// 没有需审核的修改时只更新其余字段；价格超出等级区间、已有待审核申请等错误直接返回
+	change, err := newProfileChange(&counselor, edit)
+	if err != nil && !errors.Is(err, errProfileUnchanged) {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		updates["name"] = req.Name
 	}
 	if req.YearsExp > 0 {
 		updates["years_exp"] = req.YearsExp
@@ -325,7 +337,20 @@ func UpdateCounselor(c *gin.Context) {
 		updates["status"] = *req.Status
 	}
 
-	if err := database.DB.Model(&counselor).Updates(updates).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&counselor).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if change != nil {
+			change.SubmitterType = models.ProfileChangeSubmitterCounselor
+			change.SubmitterID = c.GetUint("user_id")
+			return tx.Create(change).Error
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "更新失败: " + err.Error(),
@@ -333,14 +358,22 @@ func UpdateCounselor(c *gin.Context) {
 		return
 	}
 
-	// 删除缓存
+	// 删除缓存（状态变化会影响身份映射）
 	if cache.Rdb != nil {
 		cache.DeleteCounselorCache(context.Background(), counselor.ID)
+		cache.DeleteIdentityCache(context.Background(), counselor.UserID, counselor.ID)
 	}
 
+	msg := "更新成功"
+	if change != nil {
+		msg = "更新成功，职称、头像、简介、擅长领域和单价的修改已提交审核"
+	}
 	c.JSON(200, gin.H{
 		"code": 200,
-		"msg":  "更新成功",
+		"msg":  msg,
+		"data": gin.H{
+			"change": change,
+		},
 	})
 }
 
@@ -381,6 +414,7 @@ func DeleteCounselor(c *gin.Context) {
 	// 删除缓存
 	if cache.Rdb != nil {
 		cache.DeleteCounselorCache(ctx, counselor.ID)
+		cache.DeleteIdentityCache(ctx, counselor.UserID, counselor.ID)
 	}
 
 	c.JSON(200, gin.H{
@@ -391,19 +425,20 @@ func DeleteCounselor(c *gin.Context) {
 
 // GetCounselorReviews godoc
 // @Summary 获取咨询师评价列表
-// @Description 获取指定咨询师的公开评价列表
+// @Description 获取指定咨询师的公开评价列表，附总评分分布和各分项平均分（匿名评价隐藏用户信息）
 // @Tags 咨询师
 // @Accept json
 // @Produce json
 // @Param id path int true "咨询师ID"
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{reviews,total}"
+// @Param rating query int false "评分筛选"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{reviews,total,summary}"
 // @Router /api/counselor/{id}/reviews [get]
 func GetCounselorReviews(c *gin.Context) {
 	counselorID := c.Param("id")
-	page := c.DefaultQuery("page", "1")
-	pageSize := c.DefaultQuery("page_size", "10")
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "10"))
 
 	// 验证咨询师存在
 	var counselor models.Counselor
@@ -415,21 +450,38 @@ func GetCounselorReviews(c *gin.Context) {
 		return
 	}
 
-	var total int64
-	query := database.DB.Model(&models.CounselorReview{}).
-		Where("counselor_id = ? AND is_visible = ?", counselorID, true)
-	query.Count(&total)
+	visible := database.DB.Model(&models.Review{}).
+		Where("counselor_id = ? AND status = ?", counselor.ID, models.ReviewStatusVisible)
+
+	// 分项评分为 0 的是旧评价（只有总评分），不计入分项平均
+	var summary struct {
+		Count           int64   `json:"count"`
+		AvgRating       float64 `json:"avg_rating"`
+		ServiceRating   float64 `json:"service_rating"`
+		Professionalism float64 `json:"professionalism"`
+		Effectiveness   float64 `json:"effectiveness"`
+	}
+	visible.Session(&gorm.Session{}).Select("COUNT(*) as count, COALESCE(AVG(rating), 0) as avg_rating, " +
+		"COALESCE(AVG(NULLIF(service_rating, 0)), 0) as service_rating, " +
+		"COALESCE(AVG(NULLIF(professionalism, 0)), 0) as professionalism, " +
+		"COALESCE(AVG(NULLIF(effectiveness, 0)), 0) as effectiveness").Scan(&summary)
+
+	type ratingCount struct {
+		Rating int   `json:"rating"`
+		Count  int64 `json:"count"`
+	}
+	var distribution []ratingCount
+	visible.Session(&gorm.Session{}).Select("rating, COUNT(*) as count").Group("rating").Order("rating DESC").Scan(&distribution)
 
-	var reviews []models.CounselorReview
-	offset := 0
-	if page != "1" {
-		p, _ := strconv.Atoi(page)
-		ps, _ := strconv.Atoi(pageSize)
-		offset = (p - 1) * ps
+	query := visible.Session(&gorm.Session{})
+	if rating := c.Query("rating"); rating != "" {
+		query = query.Where("rating = ?", rating)
 	}
+	var total int64
+	query.Count(&total)
 
-	ps, _ := strconv.Atoi(pageSize)
-	if err := query.Offset(offset).Limit(ps).
+	var reviews []models.Review
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).
 		Preload("User").
 		Order("created_at DESC").
 		Find(&reviews).Error; err != nil {
@@ -439,13 +491,20 @@ func GetCounselorReviews(c *gin.Context) {
 		})
 		return
 	}
+	var viewerID uint
+	if userID, exists := c.Get("user_id"); exists {
+		viewerID = userID.(uint)
+	}
+	review.Mask(reviews, viewerID)
 
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "获取成功",
 		"data": gin.H{
-			"reviews": reviews,
-			"total":   total,
+			"reviews":      reviews,
+			"total":        total,
+			"summary":      summary,
+			"distribution": distribution,
 		},
 	})
 }
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"math"
+
+	"akrick.com/mychat/coupon"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/pricing"
+	"akrick.com/mychat/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewCouponRequest 下单前试算优惠
+type PreviewCouponRequest struct {
+	Code        string `json:"code" binding:"required,max=32"`
+	CounselorID uint   `json:"counselor_id" binding:"required"`
+	Duration    int    `json:"duration" binding:"required,min=15,max=180"`
+	// ScheduleTime 预约时间，用于计算时段加价；不传时不计时段加价
+	ScheduleTime CustomTime `json:"schedule_time"`
+}
+
+// PreviewCoupon godoc
+// @Summary 优惠券试算
+// @Description 下单前校验优惠券是否可用并计算抵扣金额，不占用优惠券
+// @Tags 优惠券
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body PreviewCouponRequest true "券码和订单信息"
+// @Success 200 {object} map[string]interface{} "code:200,data:{coupon,original_amount,price_breakdown,discount,amount}"
+// @Failure 400 {object} map[string]interface{} "优惠券不可用"
+// @Router /api/coupon/preview [post]
+func PreviewCoupon(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req PreviewCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, req.CounselorID).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+
+	quote, err := pricing.Quote(database.DB, &counselor, req.ScheduleTime.Time, req.Duration)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "计算价格失败: " + err.Error()})
+		return
+	}
+	amount := quote.Amount
+	cp, discount, err := coupon.Preview(database.DB, req.Code, userID.(uint), counselor.ID, amount)
+	if err != nil {
+		code := 500
+		if coupon.IsCouponError(err) {
+			code = 400
+		}
+		c.JSON(code, gin.H{"code": code, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "优惠券可用",
+		"data": gin.H{
+			"coupon":          cp,
+			"original_amount": amount,
+			"price_breakdown": quote,
+			"discount":        discount,
+			"amount":          math.Round((amount-discount)*100) / 100,
+		},
+	})
+}
+
+// GetMyCoupons godoc
+// @Summary 我的优惠券使用记录
+// @Tags 优惠券
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} map[string]interface{} "code:200,data:{redemptions,total}"
+// @Router /api/user/coupons [get]
+func GetMyCoupons(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	query := database.DB.Model(&models.CouponRedemption{}).Where("user_id = ?", userID)
+	var total int64
+	query.Count(&total)
+
+	var redemptions []models.CouponRedemption
+	query.Preload("Coupon").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&redemptions)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"redemptions": redemptions,
+			"total":       total,
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"akrick.com/mychat/dashboard"
+	"github.com/gin-gonic/gin"
+)
+
+// GetCounselorDashboard godoc
+// @Summary 咨询师工作台
+// @Description 今日和本周预约、近30天收入趋势（会话计费的咨询师收入）、近12周评分趋势、今日和本周时段利用率，以及待处理事项（未读消息、待回复评价）；汇总数据缓存5分钟，订单变更时刷新，待处理事项实时计算
+// @Tags 咨询师工作台
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,data:{summary,pending,from_cache}"
+// @Failure 403 {object} map[string]interface{} "不是咨询师"
+// @Router /api/counselor/dashboard [get]
+func GetCounselorDashboard(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	summary, fromCache, err := dashboard.Get(c.Request.Context(), principal.CounselorID)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "获取工作台失败: " + err.Error()})
+		return
+	}
+	pending, err := dashboard.GetPending(principal.CounselorID)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "获取待处理事项失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"summary":    summary,
+			"pending":    pending,
+			"from_cache": fromCache,
+		},
+	})
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/favorite"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 收藏咨询师、我的咨询师（按历史订单汇总）、咨询师的回访来访者和一键再约
+
+// UpdateFavoriteRequest 收藏的通知设置，不传的字段不修改
+type UpdateFavoriteRequest struct {
+	NotifySlots  *bool `json:"notify_slots"`
+	NotifyOnline *bool `json:"notify_online"`
+}
+
+// RebookRequest 一键再约，时长、备注和可继续使用的套餐沿用上一次订单
+type RebookRequest struct {
+	ScheduleTime CustomTime `json:"schedule_time" binding:"required"`
+	CouponCode   string     `json:"coupon_code" binding:"max=32"`
+}
+
+// orderHistory 按咨询师或来访者汇总的订单记录
+type orderHistory struct {
+	CounselorID      uint      `json:"counselor_id,omitempty"`
+	UserID           uint      `json:"user_id,omitempty"`
+	OrderCount       int       `json:"order_count"`
+	CompletedCount   int       `json:"completed_count"`
+	FirstOrderTime   time.Time `json:"first_order_time"`
+	LastScheduleTime time.Time `json:"last_schedule_time"`
+	LastOrderID      uint      `json:"last_order_id"`
+}
+
+// historyStatuses 计入我的咨询师和回访来访者的订单状态（已支付、已完成）
+var historyStatuses = []int{models.OrderStatusPaid, models.OrderStatusCompleted}
+
+// AddFavorite godoc
+// @Summary 收藏咨询师
+// @Description 收藏后咨询师开放新时段或上线时会收到通知（可在收藏设置中关闭）；重复收藏不报错
+// @Tags 收藏
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "咨询师ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:收藏成功,data:favorite"
+// @Failure 400 {object} map[string]interface{} "不能收藏自己"
+// @Failure 404 {object} map[string]interface{} "咨询师不存在"
+// @Router /api/counselor/{id}/favorite [post]
+func AddFavorite(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var counselor models.Counselor
+	if err := database.DB.Where("status = ?", 1).First(&counselor, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+	if counselor.UserID == userID {
+		c.JSON(400, gin.H{"code": 400, "msg": "不能收藏自己"})
+		return
+	}
+
+	fav := models.CounselorFavorite{UserID: userID, CounselorID: counselor.ID, NotifySlots: true, NotifyOnline: true}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&fav).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "收藏失败: " + err.Error()})
+		return
+	}
+	database.DB.Where("user_id = ? AND counselor_id = ?", userID, counselor.ID).First(&fav)
+
+	c.JSON(200, gin.H{"code": 200, "msg": "收藏成功", "data": fav})
+}
+
+// RemoveFavorite godoc
+// @Summary 取消收藏咨询师
+// @Tags 收藏
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "咨询师ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已取消收藏"
+// @Router /api/counselor/{id}/favorite [delete]
+func RemoveFavorite(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	if err := database.DB.Where("user_id = ? AND counselor_id = ?", userID, c.Param("id")).
+		Delete(&models.CounselorFavorite{}).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "取消收藏失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "已取消收藏"})
+}
+
+// UpdateFavorite godoc
+// @Summary 修改收藏的通知设置
+// @Tags 收藏
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "咨询师ID"
+// @Param request body UpdateFavoriteRequest true "通知设置"
+// @Success 200 {object} map[string]interface{} "code:200,msg:保存成功,data:favorite"
+// @Failure 404 {object} map[string]interface{} "未收藏该咨询师"
+// @Router /api/counselor/{id}/favorite [put]
+func UpdateFavorite(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req UpdateFavoriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	var fav models.CounselorFavorite
+	if err := database.DB.Where("user_id = ? AND counselor_id = ?", userID, c.Param("id")).First(&fav).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "未收藏该咨询师"})
+		return
+	}
+	updates := make(map[string]interface{})
+	if req.NotifySlots != nil {
+		updates["notify_slots"] = *req.NotifySlots
+	}
+	if req.NotifyOnline != nil {
+		updates["notify_online"] = *req.NotifyOnline
+	}
+	if len(updates) > 0 {
+		if err := database.DB.Model(&fav).Updates(updates).Error; err != nil {
+			c.JSON(500, gin.H{"code": 500, "msg": "保存失败: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "保存成功", "data": fav})
+}
+
+// GetMyFavorites godoc
+// @Summary 我收藏的咨询师
+// @Description 按收藏时间倒序返回收藏的咨询师及其在线状态
+// @Tags 收藏
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{} "code:200,data:{favorites,online,total}"
+// @Router /api/user/favorites [get]
+func GetMyFavorites(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	page, pageSize := favoritePage(c)
+
+	query := database.DB.Model(&models.CounselorFavorite{}).Where("user_id = ?", userID)
+	var total int64
+	query.Count(&total)
+
+	var favorites []models.CounselorFavorite
+	if err := query.Preload("Counselor").Order("id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&favorites).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询失败: " + err.Error()})
+		return
+	}
+	counselors := make([]models.Counselor, 0, len(favorites))
+	for _, f := range favorites {
+		counselors = append(counselors, f.Counselor)
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"favorites": favorites,
+			"online":    counselorsOnline(counselors),
+			"total":     total,
+		},
+	})
+}
+
+// GetMyCounselors godoc
+// @Summary 我的咨询师
+// @Description 按历史订单（已支付、已完成）汇总咨询过的咨询师，按最近一次预约时间倒序，附收藏和在线状态，可按咨询师ID一键再约
+// @Tags 收藏
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{} "code:200,data:{counselors,total}"
+// @Router /api/user/counselors [get]
+func GetMyCounselors(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	page, pageSize := favoritePage(c)
+
+	base := database.DB.Model(&models.Order{}).
+		Where("user_id = ? AND type = ? AND status IN ?", userID, models.OrderTypeSession, historyStatuses)
+	var total int64
+	base.Session(&gorm.Session{}).Distinct("counselor_id").Count(&total)
+
+	var histories []orderHistory
+	if err := base.Session(&gorm.Session{}).Select(historySelect + ", counselor_id").Group("counselor_id").
+		Order("last_schedule_time DESC").Offset((page - 1) * pageSize).Limit(pageSize).Scan(&histories).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询失败: " + err.Error()})
+		return
+	}
+
+	ids := make([]uint, 0, len(histories))
+	for _, h := range histories {
+		ids = append(ids, h.CounselorID)
+	}
+	var counselors []models.Counselor
+	database.DB.Where("id IN ?", ids).Find(&counselors)
+	byID := make(map[uint]models.Counselor, len(counselors))
+	for _, co := range counselors {
+		byID[co.ID] = co
+	}
+	var favorited []uint
+	database.DB.Model(&models.CounselorFavorite{}).Where("user_id = ? AND counselor_id IN ?", userID, ids).Pluck("counselor_id", &favorited)
+	favoriteSet := make(map[uint]bool, len(favorited))
+	for _, id := range favorited {
+		favoriteSet[id] = true
+	}
+	online := counselorsOnline(counselors)
+
+	items := make([]gin.H, 0, len(histories))
+	for _, h := range histories {
+		items = append(items, gin.H{
+			"counselor": byID[h.CounselorID],
+			"history":   h,
+			"favorited": favoriteSet[h.CounselorID],
+			"online":    online[h.CounselorID],
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"counselors": items,
+			"total":      total,
+		},
+	})
+}
+
+// GetMyClients godoc
+// @Summary 咨询师查看来访者
+// @Description 按历史订单（已支付、已完成）汇总来访者，returning 为预约两次及以上的回访来访者，favorited 表示来访者收藏了自己
+// @Tags 收藏
+// @Produce json
+// @Security BearerAuth
+// @Param returning query bool false "只看回访来访者"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{} "code:200,data:{clients,total}"
+// @Failure 403 {object} map[string]interface{} "不是咨询师"
+// @Router /api/counselor/clients [get]
+func GetMyClients(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+	page, pageSize := favoritePage(c)
+
+	base := database.DB.Model(&models.Order{}).
+		Where("counselor_id = ? AND type = ? AND status IN ?", principal.CounselorID, models.OrderTypeSession, historyStatuses)
+	grouped := base.Session(&gorm.Session{}).Select(historySelect + ", user_id").Group("user_id")
+	if returning, _ := strconv.ParseBool(c.Query("returning")); returning {
+		grouped = grouped.Having("COUNT(*) >= 2")
+	}
+
+	var total int64
+	database.DB.Table("(?) AS h", grouped.Session(&gorm.Session{})).Count(&total)
+
+	var histories []orderHistory
+	if err := grouped.Order("last_schedule_time DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&histories).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询失败: " + err.Error()})
+		return
+	}
+
+	ids := make([]uint, 0, len(histories))
+	for _, h := range histories {
+		ids = append(ids, h.UserID)
+	}
+	var users []models.User
+	database.DB.Select("id", "username", "avatar").Where("id IN ?", ids).Find(&users)
+	byID := make(map[uint]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	var favorited []uint
+	database.DB.Model(&models.CounselorFavorite{}).Where("counselor_id = ? AND user_id IN ?", principal.CounselorID, ids).Pluck("user_id", &favorited)
+	favoriteSet := make(map[uint]bool, len(favorited))
+	for _, id := range favorited {
+		favoriteSet[id] = true
+	}
+
+	items := make([]gin.H, 0, len(histories))
+	for _, h := range histories {
+		u := byID[h.UserID]
+		items = append(items, gin.H{
+			"user":      gin.H{"id": u.ID, "username": u.Username, "avatar": u.Avatar},
+			"history":   h,
+			"returning": h.OrderCount >= 2,
+			"favorited": favoriteSet[h.UserID],
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"clients": items,
+			"total":   total,
+		},
+	})
+}
+
+// Rebook godoc
+// @Summary 一键再约
+// @Description 沿用与该咨询师最近一次咨询订单的时长和备注创建新订单；上次使用的套餐仍可用且未使用优惠券时继续使用该套餐
+// @Tags 收藏
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "咨询师ID"
+// @Param request body RebookRequest true "新的预约时间"
+// @Success 200 {object} map[string]interface{} "code:200,msg:创建订单成功,data:{order_id,order_no,amount,unit_price,discount,status}"
+// @Failure 400 {object} map[string]interface{} "时段不可用等"
+// @Failure 404 {object} map[string]interface{} "没有与该咨询师的历史订单"
+// @Router /api/counselor/{id}/rebook [post]
+func Rebook(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req RebookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	var last models.Order
+	err := database.DB.Where("user_id = ? AND counselor_id = ? AND type = ?", userID, c.Param("id"), models.OrderTypeSession).
+		Order("id DESC").First(&last).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"code": 404, "msg": "没有与该咨询师的历史订单"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询失败: " + err.Error()})
+		return
+	}
+
+	order := CreateOrderRequest{
+		CounselorID:  last.CounselorID,
+		Duration:     last.Duration,
+		ScheduleTime: req.ScheduleTime,
+		Notes:        last.Notes,
+		CouponCode:   req.CouponCode,
+	}
+	if last.UserPackageID != nil && req.CouponCode == "" {
+		var up models.UserPackage
+		if database.DB.First(&up, *last.UserPackageID).Error == nil && up.Usable(time.Now()) && up.Duration == last.Duration {
+			order.UserPackageID = &up.ID
+		}
+	}
+	createOrder(c, order)
+}
+
+// historySelect 订单汇总字段
+var historySelect = fmt.Sprintf("COUNT(*) AS order_count, SUM(CASE WHEN status = %d THEN 1 ELSE 0 END) AS completed_count, "+
+	"MIN(created_at) AS first_order_time, MAX(schedule_time) AS last_schedule_time, MAX(id) AS last_order_id", models.OrderStatusCompleted)
+
+// counselorsOnline 咨询师在线状态（按咨询师账号在 WebSocket 服务的在线状态），Redis 不可用时均为离线
+func counselorsOnline(counselors []models.Counselor) map[uint]bool {
+	online := make(map[uint]bool, len(counselors))
+	if cache.Rdb == nil {
+		return online
+	}
+	ctx := context.Background()
+	for _, co := range counselors {
+		if co.UserID != 0 {
+			online[co.ID] = cache.GetOnlineStatus(ctx, co.UserID)
+		}
+	}
+	return online
+}
+
+// notifyFavoriteSlots 咨询师保存排班后异步通知收藏用户
+func notifyFavoriteSlots(counselorID uint) {
+	go func() {
+		if err := favorite.NotifySlots(counselorID); err != nil {
+			log.Printf("收藏咨询师新时段通知失败: counselorID=%d, err=%v", counselorID, err)
+		}
+	}()
+}
+
+func favoritePage(c *gin.Context) (int, int) {
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/matching"
+	"akrick.com/mychat/models"
+	"github.com/gin-gonic/gin"
+)
+
+// MatchCounselorsRequest 匹配问卷
+type MatchCounselorsRequest struct {
+	IssueAreas      []string `json:"issue_areas" binding:"max=10,dive,min=1,max=50"`
+	PreferredGender string   `json:"preferred_gender" binding:"omitempty,oneof=male female"`
+	BudgetMax       float64  `json:"budget_max" binding:"min=0"`
+	TimePreferences []string `json:"time_preferences" binding:"max=5,dive,oneof=morning afternoon evening weekday weekend"`
+	Limit           int      `json:"limit" binding:"omitempty,min=1,max=20"`
+}
+
+// MatchCounselors godoc
+// @Summary 匹配咨询师
+// @Description 根据问卷（困扰领域、偏好性别、预算、时间偏好）为用户推荐咨询师。性别和预算为硬性条件，其余按擅长领域匹配度、未来一周符合时间偏好的可约时段、评分、回头客比例和预约负荷综合排序。返回的 request_id 在创建订单时作为 match_request_id 回传
+// @Tags 咨询师匹配
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MatchCounselorsRequest true "匹配问卷，时间偏好:morning/afternoon/evening/weekday/weekend"
+// @Success 200 {object} map[string]interface{} "code:200,msg:匹配成功,data:{request_id,strategy,matches}"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Router /api/match [post]
+func MatchCounselors(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req MatchCounselorsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := matching.Recommend(userID.(uint), &matching.Intake{
+		IssueAreas:      req.IssueAreas,
+		PreferredGender: req.PreferredGender,
+		BudgetMax:       req.BudgetMax,
+		TimePreferences: req.TimePreferences,
+	}, req.Limit)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "匹配失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "匹配成功",
+		"data": result,
+	})
+}
+
+// GetMatchOptions godoc
+// @Summary 获取匹配问卷选项
+// @Description 返回可选的困扰领域（启用咨询师的擅长领域及人数）和时间偏好
+// @Tags 咨询师匹配
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{issue_areas,time_preferences}"
+// @Router /api/match/options [get]
+func GetMatchOptions(c *gin.Context) {
+	var areas []struct {
+		Value string `json:"value"`
+		Count int64  `json:"count"`
+	}
+	if err := database.DB.Model(&models.CounselorTag{}).
+		Select("counselor_tags.value, COUNT(*) AS count").
+		Joins("JOIN counselors ON counselors.id = counselor_tags.counselor_id AND counselors.status = ?", 1).
+		Where("counselor_tags.kind = ?", models.CounselorTagSpecialty).
+		Group("counselor_tags.value").Order("count DESC").Scan(&areas).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"issue_areas": areas,
+			"time_preferences": []gin.H{
+				{"value": models.MatchTimeMorning, "label": "上午(6-12点)"},
+				{"value": models.MatchTimeAfternoon, "label": "下午(12-18点)"},
+				{"value": models.MatchTimeEvening, "label": "晚上(18-24点)"},
+				{"value": models.MatchTimeWeekday, "label": "工作日"},
+				{"value": models.MatchTimeWeekend, "label": "周末"},
+			},
+		},
+	})
+}
@@ -2,14 +2,23 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 	"akrick.com/mychat/cache"
+	"akrick.com/mychat/coupon"
 	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/matching"
 	"akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
+	"akrick.com/mychat/pricing"
+	"akrick.com/mychat/schedule"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CustomTime 自定义时间类型，支持解析多种格式
@@ -17,38 +26,33 @@ type CustomTime struct {
 	time.Time
 }
 
-// UnmarshalJSON 自定义JSON反序列化
+// UnmarshalJSON 自定义JSON反序列化，不带时区的时间按服务器本地时区解析（与排班时段一致）
 func (ct *CustomTime) UnmarshalJSON(data []byte) error {
-	// 尝试解析带时区的格式
-	layout := "2006-01-02T15:04:05Z07:00"
-	t, err := time.Parse(layout, string(data))
-	if err == nil {
-		ct.Time = t
-		return nil
-	}
+	value := strings.Trim(string(data), `"`)
 
-	// 尝试解析不带时区的格式
-	layout = "2006-01-02T15:04:05"
-	t, err = time.Parse(layout, string(data))
+	// 尝试解析带时区的格式
+	t, err := time.Parse(time.RFC3339, value)
 	if err == nil {
 		ct.Time = t
 		return nil
 	}
 
-	// 尝试解析其他常见格式
+	// 尝试解析不带时区的格式和其他常见格式
 	layouts := []string{
+		"2006-01-02T15:04:05",
 		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
 		"2006-01-02",
 	}
 	for _, l := range layouts {
-		t, err = time.Parse(l, string(data))
+		t, err = time.ParseInLocation(l, value, time.Local)
 		if err == nil {
 			ct.Time = t
 			return nil
 		}
 	}
 
-	return fmt.Errorf("无法解析时间: %s", string(data))
+	return fmt.Errorf("无法解析时间: %s", value)
 }
 
 // MarshalJSON 自定义JSON序列化
@@ -61,10 +65,17 @@ type CreateOrderRequest struct {
 	Duration     int         `json:"duration" binding:"required,min=15,max=180"`
 	ScheduleTime CustomTime  `json:"schedule_time" binding:"required"`
 	Notes        string      `json:"notes"`
+	// UserPackageID 使用已购套餐预约，无需再次支付；时长须与套餐一致
+	UserPackageID *uint `json:"user_package_id"`
+	// CouponCode 优惠券码，不能与套餐同时使用
+	CouponCode string `json:"coupon_code" binding:"max=32"`
+	// MatchRequestID 从匹配结果预约时回传的匹配请求ID，用于策略效果归因
+	MatchRequestID uint `json:"match_request_id"`
 }
 
 type UpdateOrderRequest struct {
-	Status int `json:"status" binding:"required,oneof=0 1 2 3 4"`
+	Status int    `json:"status" binding:"required,oneof=0 1 2 3 4"`
+	Reason string `json:"reason" binding:"max=255"`
 }
 
 // CreateOrder godoc
@@ -81,8 +92,6 @@ type UpdateOrderRequest struct {
 // @Failure 404 {object} map[string]interface{} "咨询师不存在"
 // @Router /api/order/create [post]
 func CreateOrder(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
 	var req CreateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{
@@ -92,6 +101,13 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
+	createOrder(c, req)
+}
+
+// createOrder 校验并创建咨询订单，下单和一键再约共用
+func createOrder(c *gin.Context, req CreateOrderRequest) {
+	userID, _ := c.Get("user_id")
+
 	// 查询咨询师信息
 	var counselor models.Counselor
 	if err := database.DB.First(&counselor, req.CounselorID).Error; err != nil {
@@ -111,8 +127,27 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// 计算订单金额
-	amount := float64(req.Duration) * counselor.Price
+	if req.UserPackageID != nil && req.CouponCode != "" {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "使用套餐预约时不能使用优惠券",
+		})
+		return
+	}
+
+	// 按咨询师等级和定价规则计算订单金额
+	quote, err := pricing.Quote(database.DB, &counselor, req.ScheduleTime.Time, req.Duration)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "计算价格失败: " + err.Error(),
+		})
+		return
+	}
+	amount := quote.Amount
+	if req.UserPackageID != nil {
+		amount = 0 // 使用套餐时在事务中按套餐折合单价记账
+	}
 
 	// 生成订单号
 	orderNo := fmt.Sprintf("ORD%d%d", time.Now().Unix(), userID.(uint))
@@ -124,12 +159,71 @@ func CreateOrder(c *gin.Context) {
 		CounselorID:  req.CounselorID,
 		Duration:     req.Duration,
 		Amount:       amount,
+		UnitPrice:    quote.UnitPrice,
+		PriceBreakdown: quote.JSON(),
 		Status:       models.OrderStatusPending,
 		ScheduleTime: req.ScheduleTime.Time,
 		Notes:        req.Notes,
 	}
 
-	if err := database.DB.Create(&order).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.UserPackageID != nil {
+			if err := useCredit(tx, &order, *req.UserPackageID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		// 占用预约时段，与订单同一事务，时段已被占用则整单回滚
+		if err := schedule.Book(tx, &order); err != nil {
+			return err
+		}
+		if err := matching.RecordBooking(tx, &order, req.MatchRequestID); err != nil {
+			return err
+		}
+		created := orderflow.Request{
+			Event: models.OrderEventCreate,
+			Actor: orderflow.Actor{Type: models.OrderActorUser, ID: order.UserID},
+		}
+		if req.CouponCode != "" {
+			redeemed, err := coupon.Redeem(tx, &order, req.CouponCode)
+			if err != nil {
+				return err
+			}
+			created.Metadata = map[string]interface{}{"coupon_code": redeemed.Code, "discount": order.Discount}
+		}
+		if err := orderflow.Record(tx, &order, created); err != nil {
+			return err
+		}
+
+		// 套餐预约和优惠券全额抵扣的订单无需支付，直接进入已支付状态
+		var pay orderflow.Request
+		switch {
+		case order.UserPackageID != nil:
+			pay.Metadata = map[string]interface{}{"user_package_id": *order.UserPackageID}
+		case order.CouponID != nil && order.Amount <= 0:
+			pay.Metadata = map[string]interface{}{"coupon_id": *order.CouponID}
+		default:
+			return nil
+		}
+		pay.OrderID, pay.Event, pay.Actor = order.ID, models.OrderEventPay, orderflow.System
+		paid, err := orderflow.FireTx(tx, pay)
+		if err != nil {
+			return err
+		}
+		order = *paid
+		return nil
+	})
+	if errors.Is(err, schedule.ErrSlotUnavailable) || errors.Is(err, schedule.ErrTooSoon) || errors.Is(err, schedule.ErrTooFar) ||
+		errors.Is(err, errPackageUnusable) || errors.Is(err, errPackageDuration) || coupon.IsCouponError(err) {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
 			"msg":  "创建订单失败: " + err.Error(),
@@ -150,12 +244,40 @@ func CreateOrder(c *gin.Context) {
 			"order_id":  order.ID,
 			"order_no":  order.OrderNo,
 			"amount":    order.Amount,
+			"unit_price": order.UnitPrice,
+			"discount":  order.Discount,
 			"status":    order.Status,
 			"create_at": order.CreatedAt,
 		},
 	})
 }
 
+var (
+	errPackageUnusable = errors.New("套餐不可用（已用完、已过期或已退款）")
+	errPackageDuration = errors.New("预约时长与套餐不一致")
+)
+
+// useCredit 锁定用户套餐并扣减一次，订单按套餐折合单价记账
+func useCredit(tx *gorm.DB, order *models.Order, userPackageID uint) error {
+	var up models.UserPackage
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ? AND counselor_id = ?", userPackageID, order.UserID, order.CounselorID).
+		First(&up).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && !up.Usable(time.Now()) {
+		return errPackageUnusable
+	}
+	if err != nil {
+		return err
+	}
+	if order.Duration != up.Duration {
+		return fmt.Errorf("%w（每次%d分钟）", errPackageDuration, up.Duration)
+	}
+
+	order.UserPackageID = &up.ID
+	order.Amount = up.UnitPrice
+	return tx.Model(&up).Update("remaining_sessions", gorm.Expr("remaining_sessions - 1")).Error
+}
+
 // GetOrderDetail godoc
 // @Summary 获取订单详情
 // @Description 获取订单详细信息（使用Redis缓存和SingleFlight防穿透）
@@ -170,7 +292,6 @@ func CreateOrder(c *gin.Context) {
 // @Failure 404 {object} map[string]interface{} "订单不存在"
 // @Router /api/order/{id} [get]
 func GetOrderDetail(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	orderID := c.Param("id")
 
 	ctx := context.Background()
@@ -190,12 +311,18 @@ func GetOrderDetail(c *gin.Context) {
 				CounselorID:  orderData.CounselorID,
 				Duration:     orderData.Duration,
 				Amount:       orderData.Amount,
+				UnitPrice:    orderData.UnitPrice,
 				Status:       orderData.Status,
 				ScheduleTime: orderData.ScheduleTime,
 				Notes:        orderData.Notes,
 				PayTime:      orderData.PayTime,
 				CreatedAt:    orderData.CreatedAt,
 				UpdatedAt:    orderData.UpdatedAt,
+
+				OriginalAmount: orderData.OriginalAmount,
+				Discount:       orderData.Discount,
+				CouponID:       orderData.CouponID,
+				PriceBreakdown: orderData.PriceBreakdown,
 			}
 			fromCache = true
 		}
@@ -224,7 +351,11 @@ func GetOrderDetail(c *gin.Context) {
 	}
 
 	// 检查权限：只有订单用户和咨询师可以查看
-	if order.UserID != userID.(uint) && order.CounselorID != userID.(uint) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	if !principal.IsParticipant(order.UserID, order.CounselorID) {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "无权访问此订单",
@@ -246,13 +377,18 @@ func GetOrderDetail(c *gin.Context) {
 			"user":          order.User,
 			"counselor":     order.Counselor,
 			"duration":      order.Duration,
-			"amount":        order.Amount,
-			"status":        order.Status,
-			"schedule_time": order.ScheduleTime,
-			"notes":         order.Notes,
-			"pay_time":      order.PayTime,
-			"created_at":    order.CreatedAt,
-			"updated_at":    order.UpdatedAt,
+			"amount":          order.Amount,
+			"unit_price":      order.UnitPrice,
+			"original_amount": order.OriginalAmount,
+			"discount":        order.Discount,
+			"coupon_id":       order.CouponID,
+			"price_breakdown": pricing.ParseBreakdown(order.PriceBreakdown),
+			"status":          order.Status,
+			"schedule_time":   order.ScheduleTime,
+			"notes":           order.Notes,
+			"pay_time":        order.PayTime,
+			"created_at":      order.CreatedAt,
+			"updated_at":      order.UpdatedAt,
 		},
 	})
 }
@@ -329,11 +465,13 @@ func GetUserOrders(c *gin.Context) {
 // @Failure 403 {object} map[string]interface{} "不是咨询师"
 // @Router /api/counselor/orders [get]
 func GetCounselorOrders(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
 
 	// 检查是否为咨询师
-	var counselor models.Counselor
-	if err := database.DB.First(&counselor, userID).Error; err != nil {
+	if !principal.IsCounselor() {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "不是咨询师",
@@ -345,7 +483,7 @@ func GetCounselorOrders(c *gin.Context) {
 	pageSize := c.DefaultQuery("page_size", "10")
 	status := c.Query("status")
 
-	query := database.DB.Model(&models.Order{}).Where("counselor_id = ?", counselor.ID)
+	query := database.DB.Model(&models.Order{}).Where("counselor_id = ?", principal.CounselorID)
 
 	// 状态筛选
 	if status != "" {
@@ -384,7 +522,7 @@ func GetCounselorOrders(c *gin.Context) {
 
 // UpdateOrderStatus godoc
 // @Summary 更新订单状态
-// @Description 更新订单状态（仅咨询师或管理员可操作）
+// @Description 咨询师更新订单状态（仅允许订单状态机中咨询师可执行的变更：完成或取消已支付订单）
 // @Tags 订单
 // @Accept json
 // @Produce json
@@ -398,9 +536,7 @@ func GetCounselorOrders(c *gin.Context) {
 // @Failure 404 {object} map[string]interface{} "订单不存在"
 // @Router /api/order/{id}/status [put]
 func UpdateOrderStatus(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	orderID := c.Param("id")
-	ctx := context.Background()
 
 	var req UpdateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -421,8 +557,12 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// 检查权限：只有咨询师可以更新订单状态
-	if order.CounselorID != userID.(uint) {
+	// 只有订单的咨询师可以操作，可用的状态变更由订单状态机决定
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	if !principal.IsCounselor() || order.CounselorID != principal.CounselorID {
 		c.JSON(403, gin.H{
 			"code": 403,
 			"msg":  "无权操作此订单",
@@ -430,30 +570,24 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// 更新订单状态
-	updates := map[string]interface{}{
-		"status": req.Status,
-	}
-
-	// 如果是已支付状态，记录支付时间
-	if req.Status == models.OrderStatusPaid {
-		now := time.Now()
-		updates["pay_time"] = &now
-	}
-
-	if err := database.DB.Model(&order).Updates(updates).Error; err != nil {
-		c.JSON(500, gin.H{
-			"code": 500,
-			"msg":  "更新失败: " + err.Error(),
+	actor := orderflow.Actor{Type: models.OrderActorCounselor, ID: principal.CounselorID}
+	event, ok := orderflow.EventFor(&order, req.Status, actor)
+	if !ok {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "当前订单状态不允许变更为该状态",
 		})
 		return
 	}
 
-	// 删除缓存
-	if cache.Rdb != nil {
-		cache.DeleteOrderCache(ctx, order.ID)
-		cache.InvalidateUserOrdersCache(ctx, order.UserID)
-		cache.InvalidateCounselorOrdersCache(ctx, order.CounselorID)
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID: order.ID,
+		Event:   event,
+		Actor:   actor,
+		Reason:  req.Reason,
+	}); err != nil {
+		respondOrderError(c, err)
+		return
 	}
 
 	c.JSON(200, gin.H{
@@ -464,12 +598,13 @@ func UpdateOrderStatus(c *gin.Context) {
 
 // CancelOrder godoc
 // @Summary 取消订单
-// @Description 用户取消订单（仅待支付或已支付状态可取消）
+// @Description 用户取消订单（待支付订单直接取消；已支付订单需在预约开始前取消，并按取消政策自动退款）
 // @Tags 订单
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "订单ID"
+// @Param request body map[string]interface{} false "reason:取消原因"
 // @Success 200 {object} map[string]interface{} "code:200,msg:取消成功"
 // @Failure 401 {object} map[string]interface{} "未授权"
 // @Failure 403 {object} map[string]interface{} "无权操作"
@@ -479,7 +614,20 @@ func UpdateOrderStatus(c *gin.Context) {
 func CancelOrder(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	orderID := c.Param("id")
-	ctx := context.Background()
+
+	// 取消原因可选，允许空请求体
+	var req struct {
+		Reason string `json:"reason" binding:"max=255"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  "参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
 
 	var order models.Order
 	if err := database.DB.First(&order, orderID).Error; err != nil {
@@ -499,32 +647,293 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
-	// 检查订单状态
-	if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaid {
-		c.JSON(400, gin.H{
-			"code": 400,
-			"msg":  "当前状态不允许取消订单",
+	// 已支付订单取消时由状态机自动退款
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID: order.ID,
+		Event:   models.OrderEventCancel,
+		Actor:   orderflow.Actor{Type: models.OrderActorUser, ID: userID.(uint)},
+		Reason:  req.Reason,
+	}); err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "取消成功",
+	})
+}
+
+// GetOrderTimeline godoc
+// @Summary 获取订单时间线
+// @Description 按事件流返回订单全过程：创建、支付、会话开始与结束、取消、退款等，包含操作人类型和原因
+// @Tags 订单
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "订单ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{timeline}"
+// @Failure 403 {object} map[string]interface{} "无权访问"
+// @Failure 404 {object} map[string]interface{} "订单不存在"
+// @Router /api/order/{id}/timeline [get]
+func GetOrderTimeline(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "订单不存在",
+		})
+		return
+	}
+
+	if !principal.IsParticipant(order.UserID, order.CounselorID) {
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  "无权访问此订单",
 		})
 		return
 	}
 
-	if err := database.DB.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
+	events, err := orderflow.Events(order.ID)
+	if err != nil {
 		c.JSON(500, gin.H{
 			"code": 500,
-			"msg":  "取消失败: " + err.Error(),
+			"msg":  "查询失败: " + err.Error(),
 		})
 		return
 	}
 
-	// 删除缓存
-	if cache.Rdb != nil {
-		cache.DeleteOrderCache(ctx, order.ID)
-		cache.InvalidateUserOrdersCache(ctx, order.UserID)
-		cache.InvalidateCounselorOrdersCache(ctx, order.CounselorID)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"status":   order.Status,
+			"timeline": orderflow.Timeline(events),
+		},
+	})
+}
+
+// respondOrderError 将订单状态机错误映射为HTTP响应
+func respondOrderError(c *gin.Context, err error) {
+	code := 400
+	switch {
+	case errors.Is(err, orderflow.ErrNotFound):
+		code = 404
+	case errors.Is(err, orderflow.ErrForbidden):
+		code = 403
+	case errors.Is(err, orderflow.ErrInvalidTransition), errors.Is(err, orderflow.ErrScheduleStarted),
+		errors.Is(err, orderflow.ErrScheduleNotReached), errors.Is(err, orderflow.ErrRefundAmount),
+		errors.Is(err, orderflow.ErrSessionStarted), errors.Is(err, orderflow.ErrPackageOrder):
+	default:
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "操作失败: " + err.Error(),
+		})
+		return
 	}
+	c.JSON(code, gin.H{
+		"code": code,
+		"msg":  err.Error(),
+	})
+}
 
+// RescheduleOrderRequest 改约请求
+type RescheduleOrderRequest struct {
+	ScheduleTime CustomTime `json:"schedule_time" binding:"required"`
+	Reason       string     `json:"reason" binding:"max=255"`
+}
+
+// GetOrderPolicy godoc
+// @Summary 获取订单政策
+// @Description 取消退款、改约次数和爽约处理规则
+// @Tags 订单
+// @Produce json
+// @Success 200 {object} map[string]interface{} "code:200,data:{policy}"
+// @Router /api/order/policy [get]
+func GetOrderPolicy(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"code": 200,
-		"msg":  "取消成功",
+		"msg":  "获取成功",
+		"data": orderflow.LoadPolicy(database.DB),
+	})
+}
+
+// RescheduleOrder godoc
+// @Summary 改约
+// @Description 用户或咨询师修改待支付/已支付订单的预约时间：新时段须可预约，距原预约开始不少于政策规定的小时数，且不超过改约次数上限
+// @Tags 订单
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "订单ID"
+// @Param request body RescheduleOrderRequest true "新的预约时间"
+// @Success 200 {object} map[string]interface{} "code:200,msg:改约成功"
+// @Failure 400 {object} map[string]interface{} "不允许改约或时段不可预约"
+// @Failure 403 {object} map[string]interface{} "无权操作"
+// @Failure 404 {object} map[string]interface{} "订单不存在"
+// @Router /api/order/{id}/reschedule [post]
+func RescheduleOrder(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var req RescheduleOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	policy := orderflow.LoadPolicy(database.DB)
+	var order models.Order
+	var actor orderflow.Actor
+	from := ""
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return orderflow.ErrNotFound
+			}
+			return err
+		}
+		if !principal.IsParticipant(order.UserID, order.CounselorID) {
+			return orderflow.ErrForbidden
+		}
+		actor = participantActor(principal, &order)
+
+		if order.Type == models.OrderTypePackage || order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaid {
+			return errRescheduleStatus
+		}
+		if order.RescheduleCount >= policy.RescheduleMaxTimes {
+			return fmt.Errorf("%w（最多%d次）", errRescheduleLimit, policy.RescheduleMaxTimes)
+		}
+		if time.Until(order.ScheduleTime) < time.Duration(policy.RescheduleMinHours)*time.Hour {
+			return fmt.Errorf("%w（需提前%d小时）", errRescheduleTooLate, policy.RescheduleMinHours)
+		}
+
+		from = order.ScheduleTime.Format("2006-01-02 15:04")
+		order.ScheduleTime = req.ScheduleTime.Time
+		order.RescheduleCount++
+		if err := schedule.Rebook(tx, &order); err != nil {
+			return err
+		}
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"schedule_time":    order.ScheduleTime,
+			"reschedule_count": order.RescheduleCount,
+		}).Error; err != nil {
+			return err
+		}
+
+		to := order.ScheduleTime.Format("2006-01-02 15:04")
+		if err := orderflow.Record(tx, &order, orderflow.Request{
+			Event:    models.OrderEventReschedule,
+			Actor:    actor,
+			Reason:   req.Reason,
+			Metadata: map[string]interface{}{"from": from, "to": to},
+		}); err != nil {
+			return err
+		}
+		return orderflow.NotifyOther(tx, &order, actor, "预约时间已变更",
+			fmt.Sprintf("订单 %s 的预约时间已由 %s 改为 %s", order.OrderNo, from, to))
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errRescheduleStatus), errors.Is(err, errRescheduleLimit), errors.Is(err, errRescheduleTooLate),
+			errors.Is(err, schedule.ErrSlotUnavailable), errors.Is(err, schedule.ErrTooSoon), errors.Is(err, schedule.ErrTooFar):
+			c.JSON(400, gin.H{
+				"code": 400,
+				"msg":  err.Error(),
+			})
+		default:
+			respondOrderError(c, err)
+		}
+		return
+	}
+	orderflow.Invalidate(&order)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "改约成功",
+		"data": gin.H{
+			"order_id":         order.ID,
+			"schedule_time":    order.ScheduleTime,
+			"reschedule_count": order.RescheduleCount,
+			"remaining":        policy.RescheduleMaxTimes - order.RescheduleCount,
+		},
 	})
 }
+
+// CheckInOrder godoc
+// @Summary 到场签到
+// @Description 用户或咨询师在预约时间前后进入等候时签到，会话未开始时据此判定爽约方
+// @Tags 订单
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "订单ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:签到成功"
+// @Failure 400 {object} map[string]interface{} "订单状态不允许签到"
+// @Failure 403 {object} map[string]interface{} "无权操作"
+// @Router /api/order/{id}/checkin [post]
+func CheckInOrder(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{
+			"code": 404,
+			"msg":  "订单不存在",
+		})
+		return
+	}
+	if !principal.IsParticipant(order.UserID, order.CounselorID) {
+		c.JSON(403, gin.H{
+			"code": 403,
+			"msg":  "无权操作此订单",
+		})
+		return
+	}
+	if order.Status != models.OrderStatusPaid || order.Type == models.OrderTypePackage {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "订单状态不允许签到",
+		})
+		return
+	}
+
+	if err := orderflow.CheckIn(database.DB, &order, participantActor(principal, &order)); err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "签到失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "签到成功",
+	})
+}
+
+var (
+	errRescheduleStatus  = errors.New("当前订单状态不允许改约")
+	errRescheduleLimit   = errors.New("改约次数已达上限")
+	errRescheduleTooLate = errors.New("距预约开始时间过近，无法改约")
+)
+
+// participantActor 订单参与方对应的操作人：订单的咨询师按咨询师身份，否则按用户身份
+func participantActor(principal *identity.Principal, order *models.Order) orderflow.Actor {
+	if principal.IsCounselor() && principal.CounselorID == order.CounselorID {
+		return orderflow.Actor{Type: models.OrderActorCounselor, ID: principal.CounselorID}
+	}
+	return orderflow.Actor{Type: models.OrderActorUser, ID: principal.UserID}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/pricing"
+	"akrick.com/mychat/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetOrderDetailIncludesPricing(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+
+	couponID := uint(4)
+	breakdown := pricing.Breakdown{BasePrice: 2, UnitPrice: 2.5, Duration: 30, Amount: 75}
+	db.Model(&models.Order{}).Where("id = ?", ids.Session.OrderID).Updates(map[string]any{
+		"unit_price":      2.5,
+		"original_amount": 75,
+		"discount":        15,
+		"amount":          60,
+		"coupon_id":       couponID,
+		"price_breakdown": breakdown.JSON(),
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", ids.Client.ID)
+		c.Next()
+	})
+	r.GET("/api/order/:id", GetOrderDetail)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/order/%d", ids.Session.OrderID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, body %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			UnitPrice      float64            `json:"unit_price"`
+			OriginalAmount float64            `json:"original_amount"`
+			Discount       float64            `json:"discount"`
+			CouponID       *uint              `json:"coupon_id"`
+			PriceBreakdown *pricing.Breakdown `json:"price_breakdown"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	d := resp.Data
+	if d.UnitPrice != 2.5 || d.OriginalAmount != 75 || d.Discount != 15 || d.CouponID == nil || *d.CouponID != couponID {
+		t.Fatalf("order pricing = %+v", d)
+	}
+	if d.PriceBreakdown == nil || d.PriceBreakdown.UnitPrice != 2.5 || d.PriceBreakdown.Amount != 75 {
+		t.Fatalf("price_breakdown = %+v, want %+v", d.PriceBreakdown, breakdown)
+	}
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PackageRequest 创建或修改咨询套餐
+type PackageRequest struct {
+	Name        string  `json:"name" binding:"required,max=100"`
+	Description string  `json:"description" binding:"max=500"`
+	Sessions    int     `json:"sessions" binding:"required,min=2,max=100"`
+	Duration    int     `json:"duration" binding:"required,min=15,max=180"`
+	Price       float64 `json:"price" binding:"required,gt=0"`
+	ValidDays   int     `json:"valid_days" binding:"required,min=1,max=730"`
+	Status      *int    `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// GetCounselorPackages godoc
+// @Summary 获取咨询师的在售套餐
+// @Description 返回咨询师在售的多次咨询套餐，附单次折合价和相对单次购买的优惠金额
+// @Tags 咨询套餐
+// @Produce json
+// @Param id path int true "咨询师ID"
+// @Success 200 {object} map[string]interface{} "code:200,data:[]package"
+// @Router /api/counselor/{id}/packages [get]
+func GetCounselorPackages(c *gin.Context) {
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+
+	var packages []models.CounselorPackage
+	database.DB.Where("counselor_id = ? AND status = ?", counselor.ID, models.PackageStatusOn).
+		Order("sessions ASC").Find(&packages)
+
+	list := make([]gin.H, 0, len(packages))
+	for _, p := range packages {
+		original := float64(p.Sessions*p.Duration) * counselor.Price
+		list = append(list, gin.H{
+			"package":      p,
+			"unit_price":   math.Round(p.Price/float64(p.Sessions)*100) / 100,
+			"original":     original,
+			"saved_amount": math.Round((original-p.Price)*100) / 100,
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": list,
+	})
+}
+
+// GetMyPackageProducts godoc
+// @Summary 咨询师获取自己的套餐
+// @Description 包括已下架的套餐
+// @Tags 咨询套餐
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,data:[]package"
+// @Router /api/counselor/packages [get]
+func GetMyPackageProducts(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var packages []models.CounselorPackage
+	database.DB.Where("counselor_id = ?", principal.CounselorID).Order("id DESC").Find(&packages)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": packages,
+	})
+}
+
+// CreatePackageProduct godoc
+// @Summary 咨询师创建套餐
+// @Tags 咨询套餐
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body PackageRequest true "套餐信息"
+// @Success 200 {object} map[string]interface{} "code:200,data:package"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Router /api/counselor/packages [post]
+func CreatePackageProduct(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var req PackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	pkg := models.CounselorPackage{CounselorID: principal.CounselorID, Status: models.PackageStatusOn}
+	applyPackageRequest(&pkg, &req)
+	if err := database.DB.Create(&pkg).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "创建套餐失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "创建成功",
+		"data": pkg,
+	})
+}
+
+// UpdatePackageProduct godoc
+// @Summary 咨询师修改套餐或上下架
+// @Description 修改只影响之后的购买，已购套餐按购买时的次数、时长和价格使用
+// @Tags 咨询套餐
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "套餐ID"
+// @Param request body PackageRequest true "套餐信息"
+// @Success 200 {object} map[string]interface{} "code:200,data:package"
+// @Failure 404 {object} map[string]interface{} "套餐不存在"
+// @Router /api/counselor/packages/{id} [put]
+func UpdatePackageProduct(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var req PackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	var pkg models.CounselorPackage
+	if err := database.DB.Where("id = ? AND counselor_id = ?", c.Param("id"), principal.CounselorID).First(&pkg).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "套餐不存在"})
+		return
+	}
+	applyPackageRequest(&pkg, &req)
+	if err := database.DB.Save(&pkg).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "修改套餐失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "修改成功",
+		"data": pkg,
+	})
+}
+
+// PurchasePackage godoc
+// @Summary 购买套餐
+// @Description 创建套餐购买订单，之后通过 /api/payment/create 支付；支付成功后发放次数
+// @Tags 咨询套餐
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "套餐ID"
+// @Success 200 {object} map[string]interface{} "code:200,data:{order_id,order_no,amount}"
+// @Failure 404 {object} map[string]interface{} "套餐不存在或已下架"
+// @Router /api/packages/{id}/purchase [post]
+func PurchasePackage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var pkg models.CounselorPackage
+	if err := database.DB.Where("id = ? AND status = ?", c.Param("id"), models.PackageStatusOn).First(&pkg).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "套餐不存在或已下架"})
+		return
+	}
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, pkg.CounselorID).Error; err != nil || counselor.Status != 1 {
+		c.JSON(400, gin.H{"code": 400, "msg": "咨询师暂不可用"})
+		return
+	}
+
+	packageID := pkg.ID
+	order := models.Order{
+		OrderNo:      fmt.Sprintf("PKG%d%d", time.Now().Unix(), userID.(uint)),
+		UserID:       userID.(uint),
+		CounselorID:  pkg.CounselorID,
+		Type:         models.OrderTypePackage,
+		PackageID:    &packageID,
+		Duration:     pkg.Sessions * pkg.Duration,
+		Amount:       pkg.Price,
+		Status:       models.OrderStatusPending,
+		ScheduleTime: time.Now(),
+		Notes:        pkg.Name,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		return orderflow.Record(tx, &order, orderflow.Request{
+			Event:    models.OrderEventCreate,
+			Actor:    orderflow.Actor{Type: models.OrderActorUser, ID: order.UserID},
+			Metadata: map[string]interface{}{"package_id": pkg.ID},
+		})
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "创建订单失败: " + err.Error()})
+		return
+	}
+	orderflow.Invalidate(&order)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "创建订单成功",
+		"data": gin.H{
+			"order_id": order.ID,
+			"order_no": order.OrderNo,
+			"amount":   order.Amount,
+			"status":   order.Status,
+		},
+	})
+}
+
+// GetMyPackages godoc
+// @Summary 获取我的套餐
+// @Description 已购套餐及剩余次数，usable 表示当前可用于预约
+// @Tags 咨询套餐
+// @Produce json
+// @Security BearerAuth
+// @Param counselor_id query int false "咨询师ID"
+// @Success 200 {object} map[string]interface{} "code:200,data:[]user_package"
+// @Router /api/user/packages [get]
+func GetMyPackages(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	query := database.DB.Where("user_id = ?", userID)
+	if counselorID, err := strconv.Atoi(c.Query("counselor_id")); err == nil && counselorID > 0 {
+		query = query.Where("counselor_id = ?", counselorID)
+	}
+	var packages []models.UserPackage
+	query.Order("id DESC").Find(&packages)
+
+	now := time.Now()
+	list := make([]gin.H, 0, len(packages))
+	for i := range packages {
+		list = append(list, gin.H{
+			"package": packages[i],
+			"usable":  packages[i].Usable(now),
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": list,
+	})
+}
+
+// RefundMyPackage godoc
+// @Summary 套餐退款
+// @Description 按剩余次数 × 折合单价退款，剩余次数作废；已预约的咨询不受影响
+// @Tags 咨询套餐
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "用户套餐ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:退款成功"
+// @Failure 400 {object} map[string]interface{} "套餐不可退款"
+// @Failure 404 {object} map[string]interface{} "套餐不存在"
+// @Router /api/user/packages/{id}/refund [post]
+func RefundMyPackage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var up models.UserPackage
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&up).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "套餐不存在"})
+		return
+	}
+	if up.Status != models.UserPackageStatusActive || up.RemainingSessions <= 0 {
+		c.JSON(400, gin.H{"code": 400, "msg": "套餐没有可退款的剩余次数"})
+		return
+	}
+
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID: up.OrderID,
+		Event:   models.OrderEventRefund,
+		Actor:   orderflow.Actor{Type: models.OrderActorUser, ID: up.UserID},
+		Reason:  "套餐剩余次数退款",
+	}); err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "退款成功",
+		"data": gin.H{
+			"refunded_sessions": up.RemainingSessions,
+			"amount":            math.Round(float64(up.RemainingSessions)*up.UnitPrice*100) / 100,
+		},
+	})
+}
+
+func applyPackageRequest(pkg *models.CounselorPackage, req *PackageRequest) {
+	pkg.Name = req.Name
+	pkg.Description = req.Description
+	pkg.Sessions = req.Sessions
+	pkg.Duration = req.Duration
+	pkg.Price = req.Price
+	pkg.ValidDays = req.ValidDays
+	if req.Status != nil {
+		pkg.Status = *req.Status
+	}
+}
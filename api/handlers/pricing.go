@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/pricing"
+	"github.com/gin-gonic/gin"
+)
+
+// 咨询师等级和定价：等级决定单价区间，咨询师可按预约时长设置档位单价、按时段设置加价或优惠比例；
+// 基础单价和定价规则的修改与其他资料修改一样须经审核后生效
+
+// UpdatePricingRequest 修改基础单价和定价规则，整体替换定价规则
+type UpdatePricingRequest struct {
+	Price     *float64               `json:"price" binding:"omitempty,gt=0,max=1000"`
+	Durations []pricing.DurationTier `json:"durations"`
+	TimeSlots []pricing.TimeSlot     `json:"time_slots"`
+	Reason    string                 `json:"reason" binding:"max=500"`
+}
+
+// GetCounselorLevels godoc
+// @Summary 咨询师等级列表
+// @Description 返回各等级的单价区间和晋升条件，按等级从低到高排列
+// @Tags 咨询师定价
+// @Produce json
+// @Success 200 {object} map[string]interface{} "code:200,data:levels"
+// @Router /api/counselor/levels [get]
+func GetCounselorLevels(c *gin.Context) {
+	var levels []models.CounselorLevel
+	if err := database.DB.Order("`rank`").Find(&levels).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询失败: " + err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "msg": "获取成功", "data": levels})
+}
+
+// GetMyPricing godoc
+// @Summary 咨询师查看自己的等级和定价
+// @Description 返回当前等级、基础单价、定价规则和统计数据，以及下一等级的晋升条件（已是最高等级时为空）
+// @Tags 咨询师定价
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,data:{level,next_level,price,rules,statistics}"
+// @Failure 403 {object} map[string]interface{} "不是咨询师"
+// @Router /api/counselor/pricing [get]
+func GetMyPricing(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, principal.CounselorID).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+	rules, _ := pricing.Parse(counselor.PriceRules)
+	level, err := pricing.Level(database.DB, counselor.Level)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询失败: " + err.Error()})
+		return
+	}
+	var next *models.CounselorLevel
+	if level != nil {
+		var candidate models.CounselorLevel
+		if err := database.DB.Where("`rank` > ?", level.Rank).Order("`rank`").First(&candidate).Error; err == nil {
+			next = &candidate
+		}
+	}
+	var stats models.CounselorStatistics
+	database.DB.Where("counselor_id = ?", counselor.ID).First(&stats)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"level":      level,
+			"next_level": next,
+			"price":      counselor.Price,
+			"rules":      rules,
+			"statistics": stats,
+		},
+	})
+}
+
+// UpdateMyPricing godoc
+// @Summary 咨询师修改基础单价和定价规则
+// @Description 提交基础单价、时长档位和时段比例的修改，须在等级单价区间内；记为资料修改申请，审核通过后对之后的预约生效
+// @Tags 咨询师定价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdatePricingRequest true "单价和定价规则"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已提交审核,data:change"
+// @Failure 400 {object} map[string]interface{} "规则格式错误、超出等级价格区间或已有待审核的修改"
+// @Failure 403 {object} map[string]interface{} "不是咨询师"
+// @Router /api/counselor/pricing [put]
+func UpdateMyPricing(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var req UpdatePricingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+	rules, err := pricing.Rules{Durations: req.Durations, TimeSlots: req.TimeSlots}.Encode()
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, principal.CounselorID).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+
+	change, err := newProfileChange(&counselor, models.ProfileEdit{Price: req.Price, PriceRules: &rules})
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	change.SubmitterType = models.ProfileChangeSubmitterCounselor
+	change.SubmitterID = principal.UserID
+	change.Reason = req.Reason
+	if err := database.DB.Create(change).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "提交失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "已提交审核，审核通过后生效",
+		"data": change,
+	})
+}
+
+// GetPriceQuote godoc
+// @Summary 咨询价格试算
+// @Description 按咨询师等级、时长档位和时段比例计算指定预约的单价和金额，不含优惠券和套餐
+// @Tags 咨询师定价
+// @Produce json
+// @Param id path int true "咨询师ID"
+// @Param duration query int true "咨询时长(分钟)"
+// @Param schedule_time query string false "预约时间(YYYY-MM-DD HH:MM)，不传时不计时段比例"
+// @Success 200 {object} map[string]interface{} "code:200,data:breakdown"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 404 {object} map[string]interface{} "咨询师不存在"
+// @Router /api/counselor/{id}/price-quote [get]
+func GetPriceQuote(c *gin.Context) {
+	duration, err := strconv.Atoi(c.Query("duration"))
+	if err != nil || duration < 15 || duration > 180 {
+		c.JSON(400, gin.H{"code": 400, "msg": "咨询时长应在15-180分钟之间"})
+		return
+	}
+	var start time.Time
+	if value := c.Query("schedule_time"); value != "" {
+		var ct CustomTime
+		if err := ct.UnmarshalJSON([]byte(value)); err != nil {
+			c.JSON(400, gin.H{"code": 400, "msg": "预约时间格式错误"})
+			return
+		}
+		start = ct.Time
+	}
+
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+	quote, err := pricing.Quote(database.DB, &counselor, start, duration)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "计算价格失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "获取成功", "data": quote})
+}
+
+// checkPriceBand 修改基础单价或定价规则时，校验修改后的单价都在咨询师当前等级的单价区间内
+func checkPriceBand(counselor *models.Counselor, change *models.CounselorProfileChange) error {
+	price, encoded := counselor.Price, counselor.PriceRules
+	if change.Price != nil {
+		price = *change.Price
+	}
+	if change.PriceRules != nil {
+		encoded = *change.PriceRules
+	}
+	rules, err := pricing.Parse(encoded)
+	if err != nil {
+		return err
+	}
+	level, err := pricing.Level(database.DB, counselor.Level)
+	if err != nil {
+		return err
+	}
+	return pricing.CheckBand(level, price, rules)
+}
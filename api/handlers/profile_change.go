@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 咨询师修改职称、简介、擅长领域、头像、单价和定价规则须经管理后台审核，审核通过后才更新到咨询师资料；
+// 单价只影响之后创建的订单，已下单的咨询按订单记录的单价计费
+
+// ProfileChangeRequest 资料修改，不传的字段不修改
+type ProfileChangeRequest struct {
+	Title     *string  `json:"title" binding:"omitempty,max=50"`
+	Bio       *string  `json:"bio" binding:"omitempty,max=5000"`
+	Specialty *string  `json:"specialty" binding:"omitempty,max=255"`
+	Avatar    *string  `json:"avatar" binding:"omitempty,max=255"`
+	Price     *float64 `json:"price" binding:"omitempty,gt=0,max=1000"`
+	Reason    string   `json:"reason" binding:"max=500"`
+}
+
+// SubmitProfileChange godoc
+// @Summary 咨询师提交资料修改
+// @Description 提交职称、简介、擅长领域、头像或单价的修改，审核通过后生效；同一时间只能有一条待审核的修改
+// @Tags 咨询师资料
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ProfileChangeRequest true "修改内容"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已提交审核,data:change"
+// @Failure 400 {object} map[string]interface{} "参数错误、资料没有变化或已有待审核的修改"
+// @Failure 403 {object} map[string]interface{} "不是咨询师"
+// @Router /api/counselor/profile/changes [post]
+func SubmitProfileChange(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var req ProfileChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	var counselor models.Counselor
+	if err := database.DB.First(&counselor, principal.CounselorID).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+
+	change, err := newProfileChange(&counselor, models.ProfileEdit{
+		Title:     req.Title,
+		Bio:       req.Bio,
+		Specialty: req.Specialty,
+		Avatar:    req.Avatar,
+		Price:     req.Price,
+	})
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	change.SubmitterType = models.ProfileChangeSubmitterCounselor
+	change.SubmitterID = principal.UserID
+	change.Reason = req.Reason
+	if err := database.DB.Create(change).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "提交失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "已提交审核，审核通过后生效",
+		"data": change,
+	})
+}
+
+var (
+	errProfileChangePending = errors.New("已有待审核的资料修改，请等待审核或撤回后重新提交")
+	errProfileUnchanged     = errors.New("资料没有变化")
+)
+
+// newProfileChange 生成修改申请，同一咨询师同一时间只能有一条待审核的修改；单价须在咨询师等级的单价区间内
+func newProfileChange(counselor *models.Counselor, edit models.ProfileEdit) (*models.CounselorProfileChange, error) {
+	change := models.NewProfileChange(counselor, edit)
+	if change == nil {
+		return nil, errProfileUnchanged
+	}
+	if change.Price != nil || change.PriceRules != nil {
+		if err := checkPriceBand(counselor, change); err != nil {
+			return nil, err
+		}
+	}
+	var pending int64
+	database.DB.Model(&models.CounselorProfileChange{}).
+		Where("counselor_id = ? AND status = ?", counselor.ID, models.ProfileChangeStatusPending).Count(&pending)
+	if pending > 0 {
+		return nil, errProfileChangePending
+	}
+	return change, nil
+}
+
+// GetMyProfileChanges godoc
+// @Summary 咨询师查看资料修改记录
+// @Tags 咨询师资料
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{} "code:200,data:{changes,total}"
+// @Router /api/counselor/profile/changes [get]
+func GetMyProfileChanges(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.CounselorProfileChange{}).Where("counselor_id = ?", principal.CounselorID)
+	var total int64
+	query.Count(&total)
+
+	var changes []models.CounselorProfileChange
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&changes).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"changes": changes,
+			"total":   total,
+		},
+	})
+}
+
+// CancelProfileChange godoc
+// @Summary 咨询师撤回待审核的资料修改
+// @Tags 咨询师资料
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "修改申请ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:已撤回"
+// @Failure 400 {object} map[string]interface{} "修改不存在或已审核"
+// @Router /api/counselor/profile/changes/{id}/cancel [post]
+func CancelProfileChange(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	result := database.DB.Model(&models.CounselorProfileChange{}).
+		Where("id = ? AND counselor_id = ? AND status = ?", c.Param("id"), principal.CounselorID, models.ProfileChangeStatusPending).
+		Update("status", models.ProfileChangeStatusCancelled)
+	if result.Error != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "撤回失败: " + result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(400, gin.H{"code": 400, "msg": "修改不存在或已审核"})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "已撤回"})
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/review"
+	"akrick.com/mychat/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewRequest 提交或修改评价
+type ReviewRequest struct {
+	Rating          int    `json:"rating" binding:"required,min=1,max=5"`
+	ServiceRating   int    `json:"service_rating" binding:"required,min=1,max=5"`
+	Professionalism int    `json:"professionalism" binding:"required,min=1,max=5"`
+	Effectiveness   int    `json:"effectiveness" binding:"required,min=1,max=5"`
+	Content         string `json:"content" binding:"max=500"`
+	IsAnonymous     bool   `json:"is_anonymous"`
+}
+
+// ReplyReviewRequest 咨询师回复评价
+type ReplyReviewRequest struct {
+	ReplyContent string `json:"reply_content" binding:"required,max=500"`
+}
+
+// ReportReviewRequest 举报评价
+type ReportReviewRequest struct {
+	Reason string `json:"reason" binding:"required,oneof=abuse privacy false spam other"`
+	Detail string `json:"detail" binding:"max=500"`
+}
+
+// AppealReviewRequest 咨询师申诉评价
+type AppealReviewRequest struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
+
+func (r *ReviewRequest) input() review.Input {
+	return review.Input{
+		Rating:          r.Rating,
+		ServiceRating:   r.ServiceRating,
+		Professionalism: r.Professionalism,
+		Effectiveness:   r.Effectiveness,
+		Content:         r.Content,
+		IsAnonymous:     r.IsAnonymous,
+	}
+}
+
+// CreateReview godoc
+// @Summary 评价订单
+// @Description 用户对已完成的咨询订单进行评价，须在订单完成后的评价期限内（review_window_days）提交，每个订单只能评价一次；内容包含联系方式、敏感词或身份信息时评价转为待审核（status=2），审核通过后公开显示
+// @Tags 评价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "订单ID"
+// @Param request body ReviewRequest true "评价信息"
+// @Success 200 {object} map[string]interface{} "code:200,msg:评价成功,data:review"
+// @Failure 400 {object} map[string]interface{} "订单未完成、已评价或已超过评价期限"
+// @Router /api/order/{id}/review [post]
+func CreateReview(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	rv, err := review.Create(userID.(uint), uint(orderID), req.input())
+	if err != nil {
+		respondReviewError(c, err, "评价失败")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "评价成功",
+		"data": rv,
+	})
+}
+
+// UpdateReview godoc
+// @Summary 修改评价
+// @Description 评价提交后的修改期限内（review_edit_hours）可修改，被管理员隐藏的评价不能修改；修改后的内容同样经过自动检查
+// @Tags 评价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "评价ID"
+// @Param request body ReviewRequest true "评价信息"
+// @Success 200 {object} map[string]interface{} "code:200,msg:修改成功,data:review"
+// @Router /api/review/{id} [put]
+func UpdateReview(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	reviewID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	rv, err := review.Update(userID.(uint), uint(reviewID), req.input())
+	if err != nil {
+		respondReviewError(c, err, "修改失败")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "修改成功",
+		"data": rv,
+	})
+}
+
+// GetMyReviews godoc
+// @Summary 获取我的评价
+// @Description 返回当前用户提交的评价（含被隐藏的），附是否仍可修改
+// @Tags 评价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{reviews,total}"
+// @Router /api/user/reviews [get]
+func GetMyReviews(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "10"))
+
+	query := database.DB.Model(&models.Review{}).Where("user_id = ?", userID)
+	var total int64
+	query.Count(&total)
+
+	var reviews []models.Review
+	if err := query.Preload("Counselor").Offset((page - 1) * pageSize).Limit(pageSize).
+		Order("created_at DESC").Find(&reviews).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+
+	_, editHours := review.Windows()
+	list := make([]gin.H, 0, len(reviews))
+	for _, rv := range reviews {
+		editable := rv.Status != models.ReviewStatusHidden &&
+			(editHours == 0 || time.Since(rv.CreatedAt) <= time.Duration(editHours)*time.Hour)
+		list = append(list, gin.H{
+			"review":   rv,
+			"editable": editable,
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"reviews": list,
+			"total":   total,
+		},
+	})
+}
+
+// GetReceivedReviews godoc
+// @Summary 获取咨询师收到的评价
+// @Description 咨询师查看自己收到的评价（含被隐藏、待审核的及隐藏原因和申诉结果），可按是否已回复筛选
+// @Tags 评价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Param replied query bool false "是否已回复"
+// @Success 200 {object} map[string]interface{} "code:200,msg:获取成功,data:{reviews,total}"
+// @Router /api/counselor/reviews [get]
+func GetReceivedReviews(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+	page := utils.ParseInt(c.DefaultQuery("page", "1"))
+	pageSize := utils.ParseInt(c.DefaultQuery("page_size", "10"))
+
+	query := database.DB.Model(&models.Review{}).Where("counselor_id = ?", principal.CounselorID)
+	switch c.Query("replied") {
+	case "true":
+		query = query.Where("reply_time IS NOT NULL")
+	case "false":
+		query = query.Where("reply_time IS NULL")
+	}
+	var total int64
+	query.Count(&total)
+
+	var reviews []models.Review
+	if err := query.Preload("User").Preload("Appeal").Offset((page - 1) * pageSize).Limit(pageSize).
+		Order("created_at DESC").Find(&reviews).Error; err != nil {
+		c.JSON(500, gin.H{
+			"code": 500,
+			"msg":  "查询失败: " + err.Error(),
+		})
+		return
+	}
+	review.Mask(reviews, 0)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"reviews": reviews,
+			"total":   total,
+		},
+	})
+}
+
+// ReplyReview godoc
+// @Summary 咨询师回复评价
+// @Description 咨询师回复自己收到的评价，再次回复覆盖之前的内容；首次回复时通知用户
+// @Tags 评价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "评价ID"
+// @Param request body ReplyReviewRequest true "回复内容"
+// @Success 200 {object} map[string]interface{} "code:200,msg:回复成功,data:review"
+// @Router /api/counselor/reviews/{id}/reply [post]
+func ReplyReview(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+	reviewID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	var req ReplyReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	rv, err := review.Reply(principal.CounselorID, uint(reviewID), req.ReplyContent)
+	if err != nil {
+		respondReviewError(c, err, "回复失败")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "回复成功",
+		"data": rv,
+	})
+}
+
+// ReportReview godoc
+// @Summary 举报评价
+// @Description 用户或咨询师举报公开显示的评价，同一评价只能举报一次；待处理举报达到阈值（review_report_hold_threshold）时评价转为待审核
+// @Tags 评价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "评价ID"
+// @Param request body ReportReviewRequest true "举报原因:abuse-辱骂,privacy-泄露隐私,false-不实内容,spam-广告,other-其它"
+// @Success 200 {object} map[string]interface{} "code:200,msg:举报成功,data:report"
+// @Router /api/review/{id}/report [post]
+func ReportReview(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	reviewID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	var req ReportReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	report, err := review.Report(principal.UserID, principal.CounselorID, uint(reviewID), req.Reason, req.Detail)
+	if err != nil {
+		respondReviewError(c, err, "举报失败")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "举报成功",
+		"data": report,
+	})
+}
+
+// AppealReview godoc
+// @Summary 咨询师申诉评价
+// @Description 咨询师对自己收到的评价提出申诉，每条评价只能申诉一次，由管理员裁定是否隐藏
+// @Tags 评价
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "评价ID"
+// @Param request body AppealReviewRequest true "申诉理由"
+// @Success 200 {object} map[string]interface{} "code:200,msg:申诉已提交,data:appeal"
+// @Router /api/counselor/reviews/{id}/appeal [post]
+func AppealReview(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+	reviewID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	var req AppealReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"code": 400,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	appeal, err := review.Appeal(principal.CounselorID, uint(reviewID), req.Reason)
+	if err != nil {
+		respondReviewError(c, err, "申诉失败")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "申诉已提交",
+		"data": appeal,
+	})
+}
+
+func respondReviewError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, review.ErrOrderNotFound) || errors.Is(err, review.ErrNotFound):
+		c.JSON(404, gin.H{"code": 404, "msg": err.Error()})
+	case errors.Is(err, review.ErrForbidden):
+		c.JSON(403, gin.H{"code": 403, "msg": err.Error()})
+	case review.IsReviewError(err):
+		c.JSON(400, gin.H{"code": 400, "msg": err.Error()})
+	default:
+		c.JSON(500, gin.H{"code": 500, "msg": msg + ": " + err.Error()})
+	}
+}
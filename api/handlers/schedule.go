@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/schedule"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// WeeklyScheduleItem 每周模板中的一个时段
+type WeeklyScheduleItem struct {
+	Weekday   int    `json:"weekday" binding:"min=0,max=6"`
+	StartTime string `json:"start_time" binding:"required"`
+	EndTime   string `json:"end_time" binding:"required"`
+}
+
+// UpdateWeeklyScheduleRequest 整体替换每周模板，空列表表示恢复默认时段
+type UpdateWeeklyScheduleRequest struct {
+	Items []WeeklyScheduleItem `json:"items" binding:"dive"`
+}
+
+// UpdateScheduleSettingRequest 排班设置
+type UpdateScheduleSettingRequest struct {
+	BufferMinutes    int `json:"buffer_minutes" binding:"min=0,max=120"`
+	SlotStepMinutes  int `json:"slot_step_minutes" binding:"required,min=5,max=240"`
+	MinNoticeMinutes int `json:"min_notice_minutes" binding:"min=0,max=10080"`
+	MaxAdvanceDays   int `json:"max_advance_days" binding:"required,min=1,max=180"`
+}
+
+// CreateScheduleExceptionRequest 添加排班例外
+type CreateScheduleExceptionRequest struct {
+	Date      string `json:"date" binding:"required"`
+	Type      string `json:"type" binding:"required,oneof=off extra"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	Reason    string `json:"reason" binding:"max=100"`
+}
+
+// GetCounselorSlots godoc
+// @Summary 获取咨询师可预约时段
+// @Description 按每周模板、节假日/请假、已有预约和缓冲时间计算可预约时段，最多查询31天
+// @Tags 排班预约
+// @Produce json
+// @Param id path int true "咨询师ID"
+// @Param start_date query string true "开始日期(YYYY-MM-DD)"
+// @Param end_date query string false "结束日期(YYYY-MM-DD，含当天)，默认与开始日期相同"
+// @Param duration query int false "咨询时长(分钟)，默认60"
+// @Success 200 {object} map[string]interface{} "code:200,data:{slots}"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Router /api/counselor/{id}/slots [get]
+func GetCounselorSlots(c *gin.Context) {
+	counselorID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "咨询师ID格式错误"})
+		return
+	}
+
+	start, err := time.ParseInLocation(schedule.DateLayout, c.Query("start_date"), time.Local)
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "开始日期格式错误，应为 YYYY-MM-DD"})
+		return
+	}
+	end := start
+	if endDate := c.Query("end_date"); endDate != "" {
+		if end, err = time.ParseInLocation(schedule.DateLayout, endDate, time.Local); err != nil || end.Before(start) {
+			c.JSON(400, gin.H{"code": 400, "msg": "结束日期格式错误或早于开始日期"})
+			return
+		}
+	}
+	duration, err := strconv.Atoi(c.DefaultQuery("duration", "60"))
+	if err != nil || duration < 1 || duration > 480 {
+		c.JSON(400, gin.H{"code": 400, "msg": "咨询时长应在1-480分钟之间"})
+		return
+	}
+
+	var counselor models.Counselor
+	if err := database.DB.Select("id", "status").First(&counselor, counselorID).Error; err != nil {
+		c.JSON(404, gin.H{"code": 404, "msg": "咨询师不存在"})
+		return
+	}
+	if counselor.Status != 1 {
+		c.JSON(200, gin.H{"code": 200, "msg": "获取成功", "data": gin.H{"slots": []schedule.Slot{}}})
+		return
+	}
+
+	slots, err := schedule.Slots(counselor.ID, start, end.AddDate(0, 0, 1), duration)
+	if errors.Is(err, schedule.ErrInvalidRange) {
+		c.JSON(400, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "查询可预约时段失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"counselor_id": counselor.ID,
+			"duration":     duration,
+			"slots":        slots,
+		},
+	})
+}
+
+// GetMySchedule godoc
+// @Summary 获取我的排班
+// @Description 咨询师查看每周模板、排班设置、近期例外和已占用时段
+// @Tags 排班预约
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "code:200,data:{weekly,settings,exceptions,bookings}"
+// @Failure 403 {object} map[string]interface{} "不是咨询师"
+// @Router /api/counselor/schedule [get]
+func GetMySchedule(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var weekly []models.CounselorAvailability
+	database.DB.Where("counselor_id = ?", principal.CounselorID).Order("weekday ASC, start_time ASC").Find(&weekly)
+
+	today := time.Now().Format(schedule.DateLayout)
+	var exceptions []models.CounselorScheduleException
+	database.DB.Where("counselor_id = ? AND date >= ?", principal.CounselorID, today).Order("date ASC, start_time ASC").Find(&exceptions)
+
+	var bookings []models.CounselorBooking
+	database.DB.Where("counselor_id = ? AND status = ? AND end_time > ?", principal.CounselorID,
+		models.BookingStatusActive, time.Now()).Order("start_time ASC").Find(&bookings)
+
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"weekly":          weekly,
+			"default_windows": schedule.DefaultWindows,
+			"settings":        schedule.Settings(database.DB, principal.CounselorID),
+			"exceptions":      exceptions,
+			"bookings":        bookings,
+		},
+	})
+}
+
+// UpdateWeeklySchedule godoc
+// @Summary 设置每周排班模板
+// @Description 整体替换每周模板；同一天可设置多个时段，空列表表示恢复默认时段（每天09:00-21:00）。已有预约不受影响
+// @Tags 排班预约
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateWeeklyScheduleRequest true "每周模板"
+// @Success 200 {object} map[string]interface{} "code:200,msg:保存成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Router /api/counselor/schedule/weekly [put]
+func UpdateWeeklySchedule(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateWeeklyScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	items := make([]models.CounselorAvailability, 0, len(req.Items))
+	for _, item := range req.Items {
+		if err := schedule.ValidateWindow(schedule.Window{StartTime: item.StartTime, EndTime: item.EndTime}); err != nil {
+			c.JSON(400, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		items = append(items, models.CounselorAvailability{
+			CounselorID: principal.CounselorID,
+			Weekday:     item.Weekday,
+			StartTime:   item.StartTime,
+			EndTime:     item.EndTime,
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("counselor_id = ?", principal.CounselorID).Delete(&models.CounselorAvailability{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "保存失败: " + err.Error()})
+		return
+	}
+
+	if len(items) > 0 {
+		notifyFavoriteSlots(principal.CounselorID)
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "保存成功", "data": items})
+}
+
+// UpdateScheduleSetting godoc
+// @Summary 更新排班设置
+// @Description 设置缓冲时间、可预约起始间隔、最少提前时间和最多提前天数
+// @Tags 排班预约
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateScheduleSettingRequest true "排班设置"
+// @Success 200 {object} map[string]interface{} "code:200,msg:保存成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Router /api/counselor/schedule/settings [put]
+func UpdateScheduleSetting(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateScheduleSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	setting := schedule.Settings(database.DB, principal.CounselorID)
+	setting.BufferMinutes = req.BufferMinutes
+	setting.SlotStepMinutes = req.SlotStepMinutes
+	setting.MinNoticeMinutes = req.MinNoticeMinutes
+	setting.MaxAdvanceDays = req.MaxAdvanceDays
+	if err := database.DB.Save(&setting).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "保存失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "保存成功", "data": setting})
+}
+
+// CreateScheduleException godoc
+// @Summary 添加排班例外
+// @Description type=off 为休息（不填时间表示全天，如节假日、请假），type=extra 为额外开放时段
+// @Tags 排班预约
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateScheduleExceptionRequest true "排班例外"
+// @Success 200 {object} map[string]interface{} "code:200,msg:添加成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Router /api/counselor/schedule/exceptions [post]
+func CreateScheduleException(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	var req CreateScheduleExceptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+	if _, err := time.ParseInLocation(schedule.DateLayout, req.Date, time.Local); err != nil {
+		c.JSON(400, gin.H{"code": 400, "msg": "日期格式错误，应为 YYYY-MM-DD"})
+		return
+	}
+	wholeDay := req.Type == models.ScheduleExceptionOff && req.StartTime == "" && req.EndTime == ""
+	if !wholeDay {
+		if err := schedule.ValidateWindow(schedule.Window{StartTime: req.StartTime, EndTime: req.EndTime}); err != nil {
+			c.JSON(400, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+	}
+
+	exception := models.CounselorScheduleException{
+		CounselorID: principal.CounselorID,
+		Date:        req.Date,
+		Type:        req.Type,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+		Reason:      req.Reason,
+	}
+	if err := database.DB.Create(&exception).Error; err != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "添加失败: " + err.Error()})
+		return
+	}
+
+	if exception.Type == models.ScheduleExceptionExtra {
+		notifyFavoriteSlots(principal.CounselorID)
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "添加成功", "data": exception})
+}
+
+// DeleteScheduleException godoc
+// @Summary 删除排班例外
+// @Tags 排班预约
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "例外ID"
+// @Success 200 {object} map[string]interface{} "code:200,msg:删除成功"
+// @Failure 404 {object} map[string]interface{} "记录不存在"
+// @Router /api/counselor/schedule/exceptions/{id} [delete]
+func DeleteScheduleException(c *gin.Context) {
+	principal, ok := scheduleCounselor(c)
+	if !ok {
+		return
+	}
+
+	result := database.DB.Where("id = ? AND counselor_id = ?", c.Param("id"), principal.CounselorID).
+		Delete(&models.CounselorScheduleException{})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"code": 500, "msg": "删除失败: " + result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"code": 404, "msg": "记录不存在"})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "msg": "删除成功"})
+}
+
+// scheduleCounselor 排班接口仅限咨询师本人
+func scheduleCounselor(c *gin.Context) (*identity.Principal, bool) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return nil, false
+	}
+	if !principal.IsCounselor() {
+		c.JSON(403, gin.H{"code": 403, "msg": "不是咨询师"})
+		return nil, false
+	}
+	return principal, true
+}
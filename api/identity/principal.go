@@ -0,0 +1,142 @@
+package identity
+
+import (
+	"context"
+	"errors"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// 主体类型
+const (
+	PrincipalUser      = "user"      // 普通用户
+	PrincipalCounselor = "counselor" // 咨询师
+	PrincipalAdmin     = "admin"     // 管理员
+)
+
+// 会话中的身份（与 ChatMessage.SenderType 取值一致）
+const (
+	SessionRoleUser      = "user"
+	SessionRoleCounselor = "counselor"
+)
+
+// principalContextKey gin上下文中缓存主体的键
+const principalContextKey = "principal"
+
+var ErrUserDisabled = errors.New("用户不存在或已禁用")
+
+// Principal 当前请求的身份主体
+// UserID 始终是 users 表ID；CounselorID 是 counselors 表ID，非咨询师为0
+type Principal struct {
+	UserID      uint   `json:"user_id"`
+	Username    string `json:"username"`
+	CounselorID uint   `json:"counselor_id"`
+	IsAdmin     bool   `json:"is_admin"`
+}
+
+// Type 返回主体类型
+func (p *Principal) Type() string {
+	switch {
+	case p.IsAdmin:
+		return PrincipalAdmin
+	case p.CounselorID != 0:
+		return PrincipalCounselor
+	default:
+		return PrincipalUser
+	}
+}
+
+// IsCounselor 是否为咨询师
+func (p *Principal) IsCounselor() bool {
+	return p.CounselorID != 0
+}
+
+// SessionRole 返回主体在会话中的身份，非参与者返回空字符串
+// userID 为会话的用户ID，counselorID 为会话的咨询师ID（counselors 表）
+func (p *Principal) SessionRole(userID, counselorID uint) string {
+	if p.CounselorID != 0 && p.CounselorID == counselorID {
+		return SessionRoleCounselor
+	}
+	if p.UserID == userID {
+		return SessionRoleUser
+	}
+	return ""
+}
+
+// IsParticipant 是否为会话参与者
+func (p *Principal) IsParticipant(userID, counselorID uint) bool {
+	return p.SessionRole(userID, counselorID) != ""
+}
+
+// CanView 是否可以查看会话（参与者或管理员）
+func (p *Principal) CanView(userID, counselorID uint) bool {
+	return p.IsAdmin || p.IsParticipant(userID, counselorID)
+}
+
+// Resolve 根据用户ID解析主体
+func Resolve(ctx context.Context, userID uint, username string) (*Principal, error) {
+	var user models.User
+	if err := database.DB.Select("id", "username", "is_admin", "status").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+
+	counselorID, err := cache.GetCounselorIDByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if username == "" {
+		username = user.Username
+	}
+
+	return &Principal{
+		UserID:      user.ID,
+		Username:    username,
+		CounselorID: counselorID,
+		IsAdmin:     user.IsAdmin,
+	}, nil
+}
+
+// FromToken 根据JWT解析主体
+func FromToken(ctx context.Context, token string) (*Principal, error) {
+	claims, err := utils.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return Resolve(ctx, claims.UserID, claims.Username)
+}
+
+// Current 获取当前请求的主体（需在 AuthMiddleware 之后调用，同一请求内只解析一次）
+func Current(c *gin.Context) (*Principal, error) {
+	if p, ok := c.Get(principalContextKey); ok {
+		return p.(*Principal), nil
+	}
+
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return nil, errors.New("未认证")
+	}
+
+	p, err := Resolve(c.Request.Context(), userID.(uint), c.GetString("username"))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(principalContextKey, p)
+	return p, nil
+}
+
+// UserIDForSessionRole 返回会话中某一方对应的用户ID（用于推送和通知）
+func UserIDForSessionRole(ctx context.Context, role string, userID, counselorID uint) (uint, error) {
+	if role == SessionRoleCounselor {
+		return cache.GetUserIDByCounselor(ctx, counselorID)
+	}
+	return userID, nil
+}
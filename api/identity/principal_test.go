@@ -0,0 +1,98 @@
+package identity
+
+import (
+	"context"
+	"testing"
+
+	"akrick.com/mychat/testutil"
+)
+
+func TestResolveMapsCounselorUserToCounselorID(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	ctx := context.Background()
+
+	counselor, err := Resolve(ctx, ids.CounselorUser.ID, "")
+	if err != nil {
+		t.Fatalf("Resolve(counselor user) error: %v", err)
+	}
+	if counselor.UserID != ids.CounselorUser.ID || counselor.CounselorID != ids.Counselor.ID {
+		t.Fatalf("counselor principal = {UserID:%d CounselorID:%d}, want {UserID:%d CounselorID:%d}",
+			counselor.UserID, counselor.CounselorID, ids.CounselorUser.ID, ids.Counselor.ID)
+	}
+	if counselor.Type() != PrincipalCounselor {
+		t.Fatalf("counselor principal type = %q, want %q", counselor.Type(), PrincipalCounselor)
+	}
+
+	// Other 的用户ID与咨询师ID相同，但不是咨询师
+	other, err := Resolve(ctx, ids.Other.ID, "")
+	if err != nil {
+		t.Fatalf("Resolve(other) error: %v", err)
+	}
+	if other.CounselorID != 0 || other.Type() != PrincipalUser {
+		t.Fatalf("user whose ID equals a counselor ID resolved as counselor %d", other.CounselorID)
+	}
+}
+
+func TestSessionRoleNeverMixesUserAndCounselorIDs(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	ctx := context.Background()
+
+	resolve := func(userID uint) *Principal {
+		p, err := Resolve(ctx, userID, "")
+		if err != nil {
+			t.Fatalf("Resolve(%d) error: %v", userID, err)
+		}
+		return p
+	}
+	client, counselor, other := resolve(ids.Client.ID), resolve(ids.CounselorUser.ID), resolve(ids.Other.ID)
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		session   [2]uint // user_id, counselor_id
+		want      string
+	}{
+		{"client in own session", client, [2]uint{ids.Session.UserID, ids.Session.CounselorID}, SessionRoleUser},
+		{"counselor in own session", counselor, [2]uint{ids.Session.UserID, ids.Session.CounselorID}, SessionRoleCounselor},
+		// Other 的用户ID等于会话的 counselor_id，不能被当作咨询师
+		{"user id equal to counselor_id", other, [2]uint{ids.Session.UserID, ids.Session.CounselorID}, ""},
+		// 咨询师的咨询师ID等于会话的 user_id，不能被当作来访者
+		{"counselor id equal to user_id", counselor, [2]uint{ids.OtherSession.UserID, ids.OtherSession.CounselorID}, ""},
+		{"other in own session", other, [2]uint{ids.OtherSession.UserID, ids.OtherSession.CounselorID}, SessionRoleUser},
+		{"client in foreign session", client, [2]uint{ids.OtherSession.UserID, ids.OtherSession.CounselorID}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.SessionRole(tt.session[0], tt.session[1]); got != tt.want {
+				t.Fatalf("SessionRole = %q, want %q", got, tt.want)
+			}
+			if got := tt.principal.IsParticipant(tt.session[0], tt.session[1]); got != (tt.want != "") {
+				t.Fatalf("IsParticipant = %v, want %v", got, tt.want != "")
+			}
+		})
+	}
+}
+
+func TestUserIDForSessionRoleMapsCounselorToUser(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	ctx := context.Background()
+
+	got, err := UserIDForSessionRole(ctx, SessionRoleCounselor, ids.Session.UserID, ids.Session.CounselorID)
+	if err != nil {
+		t.Fatalf("UserIDForSessionRole error: %v", err)
+	}
+	if got != ids.CounselorUser.ID {
+		t.Fatalf("counselor side user ID = %d, want counselor's user %d (not counselor ID %d)", got, ids.CounselorUser.ID, ids.Counselor.ID)
+	}
+
+	got, err = UserIDForSessionRole(ctx, SessionRoleUser, ids.Session.UserID, ids.Session.CounselorID)
+	if err != nil {
+		t.Fatalf("UserIDForSessionRole error: %v", err)
+	}
+	if got != ids.Client.ID {
+		t.Fatalf("user side user ID = %d, want %d", got, ids.Client.ID)
+	}
+}
@@ -0,0 +1,307 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// 定时任务框架
+// 任务在代码中注册，启动时同步到 scheduled_jobs 表；每个实例定期轮询到期任务，
+// 通过条件更新抢占数据库租约，保证同一任务在集群内同一时间只执行一次。
+// 管理后台通过修改表中的暂停标记和手动触发时间控制任务，并发布 WakeChannel 让调度器立即检查
+
+// WakeChannel 手动触发、暂停或恢复任务后发布的唤醒通道
+const WakeChannel = "jobs:wake"
+
+const (
+	pollInterval = 15 * time.Second
+	leaseTTL     = 2 * time.Minute
+	// 重试退避：第 n 次重试前等待 retryBackoff * 2^(n-1)，最长 maxBackoff
+	retryBackoff = 30 * time.Second
+	maxBackoff   = 10 * time.Minute
+	// 执行记录保留天数
+	runRetentionDays = 30
+)
+
+// Job 任务定义
+type Job struct {
+	Name        string
+	Description string
+	Cron        string
+	MaxRetries  int
+	Timeout     time.Duration
+	// Run 执行任务，应在 ctx 超时后尽快返回；返回错误时按 MaxRetries 重试
+	Run func(ctx context.Context) error
+}
+
+var (
+	mu       sync.Mutex
+	registry = map[string]*registered{}
+	instance = instanceID()
+)
+
+type registered struct {
+	Job
+	schedule *Schedule
+}
+
+// Register 注册任务，cron 表达式无效时 panic（属于代码错误）
+func Register(job Job) {
+	schedule, err := ParseCron(job.Cron)
+	if err != nil {
+		panic(fmt.Sprintf("任务 %s: %v", job.Name, err))
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = 10 * time.Minute
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	registry[job.Name] = &registered{Job: job, schedule: schedule}
+}
+
+// Start 同步任务定义并启动调度循环
+func Start() {
+	mu.Lock()
+	jobs := make([]*registered, 0, len(registry))
+	for _, j := range registry {
+		jobs = append(jobs, j)
+	}
+	mu.Unlock()
+
+	for _, j := range jobs {
+		if err := syncJob(j); err != nil {
+			log.Printf("同步任务 %s 失败: %v", j.Name, err)
+		}
+	}
+
+	wake := make(chan struct{}, 1)
+	if cache.Rdb != nil {
+		go func() {
+			sub := cache.Rdb.Subscribe(context.Background(), WakeChannel)
+			for range sub.Channel() {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			for _, j := range jobs {
+				if claim, ok := tryClaim(j); ok {
+					go execute(j, claim)
+				}
+			}
+			select {
+			case <-wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("定时任务调度器已启动，实例 %s，共 %d 个任务", instance, len(jobs))
+}
+
+// syncJob 创建任务记录，或在代码中的 cron、重试和超时配置变化时更新（保留暂停状态）
+func syncJob(j *registered) error {
+	row := models.ScheduledJob{
+		Name:           j.Name,
+		Description:    j.Description,
+		Cron:           j.Cron,
+		MaxRetries:     j.MaxRetries,
+		TimeoutSeconds: int(j.Timeout / time.Second),
+		NextRunAt:      j.schedule.Next(time.Now()),
+	}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return err
+	}
+	if err := database.DB.Where("name = ?", j.Name).First(&row).Error; err != nil {
+		return err
+	}
+	if row.Cron == j.Cron && row.MaxRetries == j.MaxRetries && row.TimeoutSeconds == int(j.Timeout/time.Second) &&
+		row.Description == j.Description {
+		return nil
+	}
+	return database.DB.Model(&row).Updates(map[string]interface{}{
+		"description":     j.Description,
+		"cron":            j.Cron,
+		"max_retries":     j.MaxRetries,
+		"timeout_seconds": int(j.Timeout / time.Second),
+		"next_run_at":     j.schedule.Next(time.Now()),
+	}).Error
+}
+
+type claim struct {
+	trigger     string
+	triggeredBy string
+}
+
+// tryClaim 任务到期（未暂停）或有手动触发请求时抢占租约，抢占成功的实例负责执行
+func tryClaim(j *registered) (claim, bool) {
+	now := time.Now()
+	var row models.ScheduledJob
+	if err := database.DB.Where("name = ?", j.Name).First(&row).Error; err != nil {
+		return claim{}, false
+	}
+	manual := row.TriggerRequestedAt != nil
+	if !manual && (row.Paused || now.Before(row.NextRunAt)) {
+		return claim{}, false
+	}
+	if row.LeaseUntil != nil && now.Before(*row.LeaseUntil) {
+		return claim{}, false
+	}
+
+	until := now.Add(leaseTTL)
+	updates := map[string]interface{}{
+		"lease_owner":          instance,
+		"lease_until":          until,
+		"last_run_at":          now,
+		"trigger_requested_at": nil,
+		"triggered_by":         "",
+	}
+	query := database.DB.Model(&models.ScheduledJob{}).Where("id = ?", row.ID).
+		Where("lease_until IS NULL OR lease_until < ?", now)
+	if manual {
+		// 手动触发不改变定时计划
+		query = query.Where("trigger_requested_at IS NOT NULL")
+	} else {
+		// 条件中带上到期时间，避免其他实例在本次执行结束、租约释放后按旧的读取结果重复执行
+		query = query.Where("paused = ? AND next_run_at <= ?", false, now)
+		updates["next_run_at"] = j.schedule.Next(now)
+	}
+	result := query.Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return claim{}, false
+	}
+
+	// 持有租约时仍为 running 的记录来自已失联的实例
+	database.DB.Model(&models.JobRun{}).
+		Where("job_name = ? AND status = ?", j.Name, models.JobRunRunning).
+		Updates(map[string]interface{}{"status": models.JobRunFailed, "error": "执行实例失联，租约已过期"})
+
+	c := claim{trigger: models.JobTriggerSchedule}
+	if manual {
+		c = claim{trigger: models.JobTriggerManual, triggeredBy: row.TriggeredBy}
+	}
+	return c, true
+}
+
+// execute 执行任务（含重试），执行期间定期续租，结束后释放租约
+func execute(j *registered, c claim) {
+	stop := make(chan struct{})
+	go renewLease(j.Name, stop)
+	defer close(stop)
+
+	var err error
+	for attempt := 1; attempt <= j.MaxRetries+1; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff(attempt - 1))
+		}
+		err = runOnce(j, c, attempt)
+		if err == nil {
+			break
+		}
+	}
+
+	status := models.JobRunSuccess
+	if err != nil {
+		status = models.JobRunFailed
+		log.Printf("任务 %s 执行失败（已重试%d次）: %v", j.Name, j.MaxRetries, err)
+	}
+	database.DB.Model(&models.ScheduledJob{}).Where("name = ? AND lease_owner = ?", j.Name, instance).
+		Updates(map[string]interface{}{"last_status": status, "lease_owner": "", "lease_until": nil})
+}
+
+// runOnce 执行一次并写入执行记录，任务 panic 视为失败
+func runOnce(j *registered, c claim, attempt int) (err error) {
+	run := models.JobRun{
+		JobName:     j.Name,
+		TriggerType: c.trigger,
+		TriggeredBy: c.triggeredBy,
+		Attempt:     attempt,
+		Status:      models.JobRunRunning,
+		Instance:    instance,
+		StartedAt:   time.Now(),
+	}
+	database.DB.Create(&run)
+
+	ctx, cancel := context.WithTimeout(context.Background(), j.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("执行超时（%s）", j.Timeout)
+		}
+		finish(&run, err)
+	}()
+	return j.Run(ctx)
+}
+
+func finish(run *models.JobRun, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      models.JobRunSuccess,
+		"finished_at": now,
+		"duration_ms": now.Sub(run.StartedAt).Milliseconds(),
+	}
+	if err != nil {
+		updates["status"] = models.JobRunFailed
+		updates["error"] = err.Error()
+	}
+	if run.ID != 0 {
+		database.DB.Model(run).Updates(updates)
+	}
+}
+
+func renewLease(name string, stop <-chan struct{}) {
+	ticker := time.NewTicker(leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			database.DB.Model(&models.ScheduledJob{}).Where("name = ? AND lease_owner = ?", name, instance).
+				Update("lease_until", time.Now().Add(leaseTTL))
+		}
+	}
+}
+
+func backoff(retry int) time.Duration {
+	d := retryBackoff << uint(retry-1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// CleanupRuns 删除过期的执行记录，作为任务注册
+func CleanupRuns(ctx context.Context) error {
+	cutoff := time.Now().AddDate(0, 0, -runRetentionDays)
+	return database.DB.WithContext(ctx).Where("started_at < ?", cutoff).Delete(&models.JobRun{}).Error
+}
+
+func instanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"log"
+	"akrick.com/mychat/attachment"
 	"akrick.com/mychat/cache"
+	"akrick.com/mychat/counselorsearch"
 	"akrick.com/mychat/database"
 	"akrick.com/mychat/handlers"
 	"akrick.com/mychat/middleware"
+	"akrick.com/mychat/search"
 	"akrick.com/mychat/tasks"
 	"os"
 	"os/signal"
@@ -46,6 +49,21 @@ func main() {
 		log.Println("Redis连接成功")
 	}
 
+	// 初始化聊天记录检索（CHAT_SEARCH_ENGINE=bleve 使用内嵌索引，默认 MySQL 全文索引）
+	if err := search.Init(os.Getenv("CHAT_SEARCH_ENGINE"), search.DefaultBleveDir); err != nil {
+		log.Printf("检索服务初始化失败（聊天记录搜索不可用）: %v", err)
+	}
+
+	// 加载附件下载链接签名密钥
+	if err := attachment.Init(); err != nil {
+		log.Fatalf("附件服务初始化失败: %v", err)
+	}
+
+	// 初始化咨询师检索（COUNSELOR_SEARCH_ENGINE=memory 使用进程内快照，默认直接查询 MySQL）
+	if err := counselorsearch.Init(os.Getenv("COUNSELOR_SEARCH_ENGINE")); err != nil {
+		log.Printf("咨询师检索初始化失败（咨询师列表不可用）: %v", err)
+	}
+
 	// 启动定时任务
 	tasks.StartScheduler()
 
@@ -92,12 +110,65 @@ func main() {
 	r.GET("/api/counselor/list", handlers.GetCounselorList)
 	r.GET("/api/counselor/:id", handlers.GetCounselorDetail)
 	r.GET("/api/counselor/:id/reviews", handlers.GetCounselorReviews)
+	r.GET("/api/counselor/:id/slots", handlers.GetCounselorSlots)
+
+	// 咨询师匹配
+	r.GET("/api/match/options", handlers.GetMatchOptions)
+	r.POST("/api/match", middleware.AuthMiddleware(), handlers.MatchCounselors)
+
+	// 评价
+	r.POST("/api/order/:id/review", middleware.AuthMiddleware(), handlers.CreateReview)
+	r.PUT("/api/review/:id", middleware.AuthMiddleware(), handlers.UpdateReview)
+	r.POST("/api/review/:id/report", middleware.AuthMiddleware(), handlers.ReportReview)
+	r.GET("/api/user/reviews", middleware.AuthMiddleware(), handlers.GetMyReviews)
+	r.GET("/api/counselor/reviews", middleware.AuthMiddleware(), handlers.GetReceivedReviews)
+	r.POST("/api/counselor/reviews/:id/reply", middleware.AuthMiddleware(), handlers.ReplyReview)
+	r.POST("/api/counselor/reviews/:id/appeal", middleware.AuthMiddleware(), handlers.AppealReview)
+
+	// 咨询师排班
+	r.GET("/api/counselor/schedule", middleware.AuthMiddleware(), handlers.GetMySchedule)
+	r.PUT("/api/counselor/schedule/weekly", middleware.AuthMiddleware(), handlers.UpdateWeeklySchedule)
+	r.PUT("/api/counselor/schedule/settings", middleware.AuthMiddleware(), handlers.UpdateScheduleSetting)
+	r.POST("/api/counselor/schedule/exceptions", middleware.AuthMiddleware(), handlers.CreateScheduleException)
+	r.DELETE("/api/counselor/schedule/exceptions/:id", middleware.AuthMiddleware(), handlers.DeleteScheduleException)
+
+	// 咨询师资料修改（须经审核）
+	r.POST("/api/counselor/profile/changes", middleware.AuthMiddleware(), handlers.SubmitProfileChange)
+	r.GET("/api/counselor/profile/changes", middleware.AuthMiddleware(), handlers.GetMyProfileChanges)
+	r.POST("/api/counselor/profile/changes/:id/cancel", middleware.AuthMiddleware(), handlers.CancelProfileChange)
+
+	// 咨询师等级和定价
+	r.GET("/api/counselor/levels", handlers.GetCounselorLevels)
+	r.GET("/api/counselor/:id/price-quote", handlers.GetPriceQuote)
+	r.GET("/api/counselor/pricing", middleware.AuthMiddleware(), handlers.GetMyPricing)
+	r.PUT("/api/counselor/pricing", middleware.AuthMiddleware(), handlers.UpdateMyPricing)
+
+	// 收藏、我的咨询师和一键再约
+	r.POST("/api/counselor/:id/favorite", middleware.AuthMiddleware(), handlers.AddFavorite)
+	r.PUT("/api/counselor/:id/favorite", middleware.AuthMiddleware(), handlers.UpdateFavorite)
+	r.DELETE("/api/counselor/:id/favorite", middleware.AuthMiddleware(), handlers.RemoveFavorite)
+	r.POST("/api/counselor/:id/rebook", middleware.AuthMiddleware(), handlers.Rebook)
+	r.GET("/api/user/favorites", middleware.AuthMiddleware(), handlers.GetMyFavorites)
+	r.GET("/api/user/counselors", middleware.AuthMiddleware(), handlers.GetMyCounselors)
+	r.GET("/api/counselor/clients", middleware.AuthMiddleware(), handlers.GetMyClients)
+
+	// 咨询套餐
+	r.GET("/api/counselor/:id/packages", handlers.GetCounselorPackages)
+	r.GET("/api/counselor/packages", middleware.AuthMiddleware(), handlers.GetMyPackageProducts)
+	r.POST("/api/counselor/packages", middleware.AuthMiddleware(), handlers.CreatePackageProduct)
+	r.PUT("/api/counselor/packages/:id", middleware.AuthMiddleware(), handlers.UpdatePackageProduct)
+	r.POST("/api/packages/:id/purchase", middleware.AuthMiddleware(), handlers.PurchasePackage)
+	r.GET("/api/user/packages", middleware.AuthMiddleware(), handlers.GetMyPackages)
+	r.POST("/api/user/packages/:id/refund", middleware.AuthMiddleware(), handlers.RefundMyPackage)
+
+	// 优惠券
+	r.POST("/api/coupon/preview", middleware.AuthMiddleware(), handlers.PreviewCoupon)
+	r.GET("/api/user/coupons", middleware.AuthMiddleware(), handlers.GetMyCoupons)
 
 	// 咨询师入驻接口
 	r.POST("/api/counselor/application", middleware.AuthMiddleware(), handlers.CreateCounselorApplication)
 	r.GET("/api/counselor/my-application", middleware.AuthMiddleware(), handlers.GetMyApplication)
-	r.GET("/api/counselor/applications", middleware.AuthMiddleware(), handlers.GetAllApplications)
-	r.PUT("/api/counselor/application/:id/review", middleware.AuthMiddleware(), handlers.ReviewApplication)
+	r.POST("/api/counselor/application/supplement", middleware.AuthMiddleware(), handlers.SupplementApplication)
 	r.POST("/api/counselor/upload-certificate", middleware.AuthMiddleware(), handlers.UploadCertificate)
 
 	// 订单接口
@@ -106,7 +177,18 @@ func main() {
 	r.GET("/api/order/list", middleware.AuthMiddleware(), handlers.GetUserOrders)
 	r.PUT("/api/order/:id/status", middleware.AuthMiddleware(), handlers.UpdateOrderStatus)
 	r.POST("/api/order/:id/cancel", middleware.AuthMiddleware(), handlers.CancelOrder)
+	r.GET("/api/order/:id/timeline", middleware.AuthMiddleware(), handlers.GetOrderTimeline)
+	r.POST("/api/order/:id/reschedule", middleware.AuthMiddleware(), handlers.RescheduleOrder)
+	r.POST("/api/order/:id/checkin", middleware.AuthMiddleware(), handlers.CheckInOrder)
+	r.GET("/api/order/policy", handlers.GetOrderPolicy)
+	r.GET("/api/order/:id/ics", middleware.AuthMiddleware(), handlers.GetOrderICS)
 	r.GET("/api/counselor/orders", middleware.AuthMiddleware(), handlers.GetCounselorOrders)
+	r.GET("/api/counselor/dashboard", middleware.AuthMiddleware(), handlers.GetCounselorDashboard)
+
+	// 日历订阅
+	r.GET("/api/calendar/token", middleware.AuthMiddleware(), handlers.GetCalendarToken)
+	r.POST("/api/calendar/token/reset", middleware.AuthMiddleware(), handlers.ResetCalendarToken)
+	r.GET("/api/calendar/feed/:token", handlers.GetCalendarFeed)
 	// 支付接口
 	r.POST("/api/payment/create", middleware.AuthMiddleware(), handlers.CreatePayment)
 	r.GET("/api/payment/:id", middleware.AuthMiddleware(), handlers.GetPaymentStatus)
@@ -126,8 +208,14 @@ func main() {
 	r.GET("/api/chat/order/:order_id/session", middleware.AuthMiddleware(), handlers.GetOrderSessionId)
 	r.POST("/api/chat/session/:session_id/message", middleware.AuthMiddleware(), handlers.SendMessage)
 	r.GET("/api/chat/messages/:session_id", middleware.AuthMiddleware(), handlers.GetMessages)
+	r.PUT("/api/chat/message/:message_id", middleware.AuthMiddleware(), handlers.EditMessage)
+	r.POST("/api/chat/message/:message_id/recall", middleware.AuthMiddleware(), handlers.RecallMessage)
+	r.DELETE("/api/chat/message/:message_id", middleware.AuthMiddleware(), handlers.DeleteMessageForMe)
+	r.GET("/api/chat/search", middleware.AuthMiddleware(), handlers.SearchChatMessages)
 	r.POST("/api/chat/end/:session_id", middleware.AuthMiddleware(), handlers.EndChatSession)
 	r.GET("/api/chat/sessions", middleware.AuthMiddleware(), handlers.GetChatSessions)
+	r.POST("/api/chat/session/:session_id/attachment", middleware.AuthMiddleware(), handlers.UploadChatAttachment)
+	r.GET("/api/chat/file/:id", handlers.DownloadChatFile)
 
 	// 文件接口
 	r.POST("/api/upload", middleware.AuthMiddleware(), handlers.UploadFile)
@@ -153,6 +241,14 @@ func main() {
 		<-quit
 		log.Println("接收到退出信号，正在优雅关闭...")
 
+		// 关闭检索索引
+		if err := search.Close(); err != nil {
+			log.Printf("关闭检索索引失败: %v", err)
+		}
+		if err := counselorsearch.Close(); err != nil {
+			log.Printf("关闭咨询师检索失败: %v", err)
+		}
+
 		// 关闭Redis连接
 		if cache.Rdb != nil {
 			if err := cache.CloseRedis(); err != nil {
@@ -0,0 +1,36 @@
+package matching
+
+import (
+	"errors"
+	"time"
+
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+)
+
+// AttributionWindow 展示后多久内预约该咨询师计为匹配带来的预约
+const AttributionWindow = 7 * 24 * time.Hour
+
+// RecordBooking 用户创建咨询订单时，将订单记到最近一次展示该咨询师的匹配结果上，须在创建订单的事务内调用
+// requestID 为前端回传的匹配请求ID，未回传时按归因窗口内最近的展示归因；没有对应展示时不记录
+func RecordBooking(tx *gorm.DB, order *models.Order, requestID uint) error {
+	query := tx.Where("user_id = ? AND counselor_id = ? AND order_id IS NULL AND created_at >= ?",
+		order.UserID, order.CounselorID, time.Now().Add(-AttributionWindow))
+	if requestID != 0 {
+		query = query.Where("request_id = ?", requestID)
+	}
+	var impression models.MatchImpression
+	err := query.Order("id DESC").First(&impression).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return tx.Model(&impression).Updates(map[string]interface{}{
+		"order_id":  order.ID,
+		"booked_at": &now,
+	}).Error
+}
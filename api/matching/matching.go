@@ -0,0 +1,348 @@
+package matching
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"akrick.com/mychat/counselorsearch"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/schedule"
+
+	"gorm.io/gorm"
+)
+
+// 咨询师匹配
+// 用户填写问卷（困扰领域、偏好性别、预算、时间偏好），性别和预算为硬性条件，其余按策略权重综合打分：
+// 擅长领域匹配度、未来一周符合时间偏好的可约时段、平滑评分、回头客比例、未来一周的预约负荷。
+// 每次匹配按用户分桶选择策略，记录请求和展示的咨询师；用户随后预约展示过的咨询师时记录订单，用于 A/B 对比各策略的转化
+
+const (
+	// DefaultLimit 默认返回的咨询师数
+	DefaultLimit = 10
+	// MaxLimit 单次最多返回的咨询师数
+	MaxLimit = 20
+
+	// maxCandidates 按擅长领域和评分初筛后参与完整打分的咨询师数，可约时段的计算开销较大
+	maxCandidates = 50
+	// lookaheadDays 可约时段和预约负荷的统计范围
+	lookaheadDays = 7
+	// slotDuration 按 60 分钟的咨询计算可约时段
+	slotDuration = 60
+	// availabilitySaturation 符合时间偏好的可约时段达到该数量时可约得分为满分
+	availabilitySaturation = 10
+	// loadCapacity 未来一周的预约达到该数量时负荷得分为 0
+	loadCapacity = 20
+	// neutralScore 用户未填写对应偏好时的得分
+	neutralScore = 0.5
+)
+
+// Intake 匹配问卷
+type Intake struct {
+	IssueAreas      []string
+	PreferredGender string  // 空表示不限
+	BudgetMax       float64 // 元/分钟，0 表示不限
+	TimePreferences []string
+}
+
+// Breakdown 各项得分
+type Breakdown struct {
+	Specialty    float64 `json:"specialty"`
+	Availability float64 `json:"availability"`
+	Rating       float64 `json:"rating"`
+	Repeat       float64 `json:"repeat"`
+	Load         float64 `json:"load"`
+}
+
+// Match 一个匹配结果
+type Match struct {
+	Position       int              `json:"position"`
+	Score          float64          `json:"score"`
+	Breakdown      Breakdown        `json:"breakdown"`
+	MatchedAreas   []string         `json:"matched_areas"`
+	AvailableSlots int              `json:"available_slots"`
+	Counselor      models.Counselor `json:"counselor"`
+}
+
+// Result 匹配结果，RequestID 在预约时回传用于归因
+type Result struct {
+	RequestID uint    `json:"request_id"`
+	Strategy  string  `json:"strategy"`
+	Matches   []Match `json:"matches"`
+}
+
+// Recommend 为用户匹配咨询师并记录本次展示
+func Recommend(userID uint, intake *Intake, limit int) (*Result, error) {
+	if limit < 1 || limit > MaxLimit {
+		limit = DefaultLimit
+	}
+	strategy := Assign(userID, Strategies())
+	w := strategy.Weights
+
+	query := database.DB.Where("status = ?", 1)
+	if intake.PreferredGender != "" {
+		query = query.Where("gender = ?", intake.PreferredGender)
+	}
+	if intake.BudgetMax > 0 {
+		query = query.Where("price <= ?", intake.BudgetMax)
+	}
+	var counselors []models.Counselor
+	if err := query.Find(&counselors).Error; err != nil {
+		return nil, err
+	}
+	if err := counselorsearch.Fill(counselors); err != nil {
+		return nil, err
+	}
+
+	// 初筛：只用无需额外查询的两项得分
+	matches := make([]Match, 0, len(counselors))
+	for _, c := range counselors {
+		specialty, areas := specialtyScore(&c, intake.IssueAreas)
+		matches = append(matches, Match{
+			Counselor:    c,
+			MatchedAreas: areas,
+			Breakdown:    Breakdown{Specialty: specialty, Rating: ratingScore(c.Rating)},
+		})
+	}
+	rank(matches, func(m *Match) float64 {
+		return w.Specialty*m.Breakdown.Specialty + w.Rating*m.Breakdown.Rating
+	})
+	if len(matches) > maxCandidates {
+		matches = matches[:maxCandidates]
+	}
+
+	ids := make([]uint, len(matches))
+	for i, m := range matches {
+		ids[i] = m.Counselor.ID
+	}
+	repeat, err := repeatScores(ids)
+	if err != nil {
+		return nil, err
+	}
+	load, err := loadScores(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range matches {
+		m := &matches[i]
+		slots, err := availableSlots(m.Counselor.ID, intake.TimePreferences)
+		if err != nil {
+			return nil, err
+		}
+		m.AvailableSlots = slots
+		m.Breakdown.Availability = math.Min(float64(slots)/availabilitySaturation, 1)
+		m.Breakdown.Repeat = repeat[m.Counselor.ID]
+		m.Breakdown.Load = load[m.Counselor.ID]
+	}
+
+	total := w.Specialty + w.Availability + w.Rating + w.Repeat + w.Load
+	rank(matches, func(m *Match) float64 {
+		b := m.Breakdown
+		return (w.Specialty*b.Specialty + w.Availability*b.Availability + w.Rating*b.Rating +
+			w.Repeat*b.Repeat + w.Load*b.Load) / total
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	for i := range matches {
+		matches[i].Position = i + 1
+	}
+
+	result := &Result{Strategy: strategy.Name, Matches: matches}
+	if err := record(userID, intake, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// rank 按得分倒序排列，得分相同按评分、ID 排列
+func rank(matches []Match, score func(m *Match) float64) {
+	for i := range matches {
+		matches[i].Score = round(score(&matches[i]))
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Counselor.Rating != b.Counselor.Rating {
+			return a.Counselor.Rating > b.Counselor.Rating
+		}
+		return a.Counselor.ID < b.Counselor.ID
+	})
+}
+
+// specialtyScore 困扰领域中被咨询师擅长领域覆盖的比例，返回命中的领域
+func specialtyScore(c *models.Counselor, areas []string) (float64, []string) {
+	if len(areas) == 0 {
+		return neutralScore, nil
+	}
+	matched := []string{}
+	for _, area := range areas {
+		hit := strings.Contains(c.Specialty, area)
+		for _, s := range c.Specialties {
+			if s == area {
+				hit = true
+				break
+			}
+		}
+		if hit {
+			matched = append(matched, area)
+		}
+	}
+	return round(float64(len(matched)) / float64(len(areas))), matched
+}
+
+// ratingScore 将 1-5 分的评分折算到 0-1
+func ratingScore(rating float64) float64 {
+	return round(math.Max(0, math.Min((rating-1)/4, 1)))
+}
+
+// repeatScores 回头客比例：完成过两次及以上咨询的用户占比，按 (回头客+1)/(用户数+4) 平滑，新咨询师约为 0.25
+func repeatScores(counselorIDs []uint) (map[uint]float64, error) {
+	scores := make(map[uint]float64, len(counselorIDs))
+	for _, id := range counselorIDs {
+		scores[id] = 0.25
+	}
+	if len(counselorIDs) == 0 {
+		return scores, nil
+	}
+	var rows []struct {
+		CounselorID   uint
+		Clients       int
+		RepeatClients int
+	}
+	if err := database.DB.Raw(`SELECT counselor_id, COUNT(*) AS clients, COALESCE(SUM(n >= 2), 0) AS repeat_clients
+		FROM (SELECT counselor_id, user_id, COUNT(*) AS n FROM orders
+			WHERE counselor_id IN ? AND type = ? AND status = ? GROUP BY counselor_id, user_id) t
+		GROUP BY counselor_id`, counselorIDs, models.OrderTypeSession, models.OrderStatusCompleted).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		scores[r.CounselorID] = round(float64(r.RepeatClients+1) / float64(r.Clients+4))
+	}
+	return scores, nil
+}
+
+// loadScores 负荷得分：未来一周已占用的预约越多得分越低
+func loadScores(counselorIDs []uint) (map[uint]float64, error) {
+	scores := make(map[uint]float64, len(counselorIDs))
+	for _, id := range counselorIDs {
+		scores[id] = 1
+	}
+	if len(counselorIDs) == 0 {
+		return scores, nil
+	}
+	now := time.Now()
+	var rows []struct {
+		CounselorID uint
+		Bookings    int
+	}
+	if err := database.DB.Model(&models.CounselorBooking{}).Select("counselor_id, COUNT(*) AS bookings").
+		Where("counselor_id IN ? AND status = ? AND start_time >= ? AND start_time < ?",
+			counselorIDs, models.BookingStatusActive, now, now.AddDate(0, 0, lookaheadDays)).
+		Group("counselor_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		scores[r.CounselorID] = round(1 - math.Min(float64(r.Bookings)/loadCapacity, 1))
+	}
+	return scores, nil
+}
+
+// availableSlots 未来一周符合时间偏好的可约时段数
+func availableSlots(counselorID uint, preferences []string) (int, error) {
+	now := time.Now()
+	slots, err := schedule.Slots(counselorID, now, now.AddDate(0, 0, lookaheadDays), slotDuration)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, s := range slots {
+		if preferred(s.StartTime, preferences) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// preferred 时段是否符合时间偏好：时段（上午/下午/晚上）和日期类型（工作日/周末）分别满足其一，未填写的不限
+func preferred(t time.Time, preferences []string) bool {
+	var periods, days []string
+	for _, p := range preferences {
+		switch p {
+		case models.MatchTimeMorning, models.MatchTimeAfternoon, models.MatchTimeEvening:
+			periods = append(periods, p)
+		case models.MatchTimeWeekday, models.MatchTimeWeekend:
+			days = append(days, p)
+		}
+	}
+
+	period := models.MatchTimeEvening
+	switch h := t.Hour(); {
+	case h >= 6 && h < 12:
+		period = models.MatchTimeMorning
+	case h >= 12 && h < 18:
+		period = models.MatchTimeAfternoon
+	case h < 6:
+		period = ""
+	}
+	day := models.MatchTimeWeekday
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		day = models.MatchTimeWeekend
+	}
+	return (len(periods) == 0 || contains(periods, period)) && (len(days) == 0 || contains(days, day))
+}
+
+// record 保存匹配请求和展示的咨询师
+func record(userID uint, intake *Intake, result *Result) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		req := models.MatchRequest{
+			UserID:          userID,
+			IssueAreas:      strings.Join(intake.IssueAreas, ","),
+			PreferredGender: intake.PreferredGender,
+			BudgetMax:       intake.BudgetMax,
+			TimePreferences: strings.Join(intake.TimePreferences, ","),
+			Strategy:        result.Strategy,
+			ResultCount:     len(result.Matches),
+		}
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		result.RequestID = req.ID
+		if len(result.Matches) == 0 {
+			return nil
+		}
+
+		impressions := make([]models.MatchImpression, 0, len(result.Matches))
+		for _, m := range result.Matches {
+			breakdown, _ := json.Marshal(m.Breakdown)
+			impressions = append(impressions, models.MatchImpression{
+				RequestID:   req.ID,
+				UserID:      userID,
+				CounselorID: m.Counselor.ID,
+				Strategy:    result.Strategy,
+				Position:    m.Position,
+				Score:       m.Score,
+				Breakdown:   string(breakdown),
+			})
+		}
+		return tx.Create(&impressions).Error
+	})
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -0,0 +1,86 @@
+package matching
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"akrick.com/mychat/sysconfig"
+)
+
+// ConfigStrategies 排序策略配置键，值为 Strategy 数组（JSON）
+const ConfigStrategies = "match_strategies"
+
+// DefaultStrategy 未配置或配置无效时使用的策略
+var DefaultStrategy = Strategy{
+	Name:    "balanced",
+	Traffic: 100,
+	Weights: Weights{Specialty: 0.35, Availability: 0.2, Rating: 0.2, Repeat: 0.15, Load: 0.1},
+}
+
+// Weights 各项得分的权重，各项得分均在 0-1 之间
+type Weights struct {
+	Specialty    float64 `json:"specialty"`    // 擅长领域与困扰领域的匹配度
+	Availability float64 `json:"availability"` // 未来一周符合时间偏好的可约时段
+	Rating       float64 `json:"rating"`       // 平滑评分
+	Repeat       float64 `json:"repeat"`       // 回头客比例
+	Load         float64 `json:"load"`         // 未来一周预约越少越高，用于分散流量
+}
+
+// Strategy 排序策略：一组权重和分配到的流量比例
+type Strategy struct {
+	Name    string  `json:"name"`
+	Traffic int     `json:"traffic"` // 流量权重，按各策略权重之和折算比例，0 表示停用
+	Weights Weights `json:"weights"`
+}
+
+// Strategies 读取启用的排序策略，配置缺失、格式错误或没有可用策略时返回默认策略
+func Strategies() []Strategy {
+	var configured []Strategy
+	if !sysconfig.Decode(sysconfig.Values(ConfigStrategies), ConfigStrategies, &configured) {
+		return []Strategy{DefaultStrategy}
+	}
+	var strategies []Strategy
+	seen := make(map[string]bool)
+	for _, s := range configured {
+		if s.Name == "" || s.Traffic <= 0 || seen[s.Name] || !s.Weights.valid() {
+			continue
+		}
+		seen[s.Name] = true
+		strategies = append(strategies, s)
+	}
+	if len(strategies) == 0 {
+		return []Strategy{DefaultStrategy}
+	}
+	return strategies
+}
+
+// Assign 按用户ID哈希分桶选择策略：同一用户在策略配置不变时始终落在同一策略，便于对比转化
+func Assign(userID uint, strategies []Strategy) Strategy {
+	total := 0
+	for _, s := range strategies {
+		total += s.Traffic
+	}
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatUint(uint64(userID), 10)))
+	bucket := int(h.Sum32() % uint32(total))
+	for _, s := range strategies {
+		if bucket < s.Traffic {
+			return s
+		}
+		bucket -= s.Traffic
+	}
+	return strategies[len(strategies)-1]
+}
+
+// valid 权重不能为负且不能全为 0
+func (w Weights) valid() bool {
+	values := []float64{w.Specialty, w.Availability, w.Rating, w.Repeat, w.Load}
+	sum := 0.0
+	for _, v := range values {
+		if v < 0 {
+			return false
+		}
+		sum += v
+	}
+	return sum > 0
+}
@@ -4,29 +4,116 @@ import (
 	"time"
 )
 
-// CounselorApplication 咨询师入驻申请表
+// 入驻申请状态
+const (
+	ApplicationStatusPending      = 0 // 审核中（所处阶段见 Stage）
+	ApplicationStatusApproved     = 1 // 审核通过
+	ApplicationStatusRejected     = 2 // 审核拒绝
+	ApplicationStatusNeedMaterial = 3 // 待补充材料
+	ApplicationStatusExpired      = 4 // 未在期限内补充材料，已失效
+)
+
+// 入驻审核阶段，依次为资质审核、面试、终审，每个阶段由不同角色的管理员处理
+const (
+	ApplicationStageQualification = "qualification" // 资质审核：核验证明材料
+	ApplicationStageInterview     = "interview"     // 面试
+	ApplicationStageFinal         = "final"         // 终审：通过后创建咨询师
+)
+
+// ApplicationStages 审核阶段的先后顺序
+var ApplicationStages = []string{ApplicationStageQualification, ApplicationStageInterview, ApplicationStageFinal}
+
+// 证明材料类型
+const (
+	ApplicationDocumentIDCard      = "id_card"     // 身份证明
+	ApplicationDocumentCertificate = "certificate" // 资质证书
+	ApplicationDocumentDegree      = "degree"      // 学历证明
+	ApplicationDocumentOther       = "other"       // 其他
+)
+
+// 证明材料核验状态
+const (
+	ApplicationDocumentPending  = 0 // 待核验
+	ApplicationDocumentVerified = 1 // 核验通过
+	ApplicationDocumentRejected = 2 // 核验不通过
+)
+
+// 入驻申请处理动作
+const (
+	ApplicationActionSubmit          = "submit"           // 提交申请
+	ApplicationActionSupplement      = "supplement"       // 补充材料
+	ApplicationActionVerifyDocument  = "verify_document"  // 核验材料
+	ApplicationActionPass            = "pass"             // 通过当前阶段
+	ApplicationActionReject          = "reject"           // 拒绝
+	ApplicationActionRequestMaterial = "request_material" // 要求补充材料
+	ApplicationActionExpire          = "expire"           // 超时失效
+)
+
+// 处理人类型
+const (
+	ApplicationActorUser   = "user"
+	ApplicationActorAdmin  = "admin"
+	ApplicationActorSystem = "system"
+)
+
+// CounselorApplication 咨询师入驻申请表，每个用户一条，被拒绝或失效后重新提交时复用
 type CounselorApplication struct {
-	ID              uint      `gorm:"primaryKey" json:"id"`
-	UserID          uint      `gorm:"not null;uniqueIndex;comment:用户ID" json:"user_id"`
-	Name            string    `gorm:"type:varchar(50);not null;comment:真实姓名" json:"name"`
-	Gender          string    `gorm:"type:varchar(10);comment:性别" json:"gender"`
-	Phone           string    `gorm:"type:varchar(20);not null;comment:联系电话" json:"phone"`
-	Email           string    `gorm:"type:varchar(100);comment:邮箱" json:"email"`
-	Title           string    `gorm:"type:varchar(50);comment:职称" json:"title"`
-	Specialty       string    `gorm:"type:varchar(500);comment:擅长领域" json:"specialty"`
-	YearsExp        int       `gorm:"comment:从业年限" json:"years_exp"`
-	Bio             string    `gorm:"type:text;comment:个人简介" json:"bio"`
-	CertificateImg1 string    `gorm:"type:varchar(255);comment:资质证书1" json:"certificate_img1"`
-	CertificateImg2 string    `gorm:"type:varchar(255);comment:资质证书2" json:"certificate_img2"`
-	CertificateImg3 string    `gorm:"type:varchar(255);comment:资质证书3" json:"certificate_img3"`
-	Status          int       `gorm:"not null;default:0;comment:状态:0-待审核,1-审核通过,2-审核拒绝" json:"status"`
-	RejectReason    string    `gorm:"type:text;comment:拒绝原因" json:"reject_reason"`
-	ReviewedBy      uint      `gorm:"comment:审核人ID" json:"reviewed_by"`
-	ReviewedAt      *time.Time `json:"reviewed_at"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	UserID           uint       `gorm:"not null;uniqueIndex;comment:用户ID" json:"user_id"`
+	Name             string     `gorm:"type:varchar(50);not null;comment:真实姓名" json:"name"`
+	Gender           string     `gorm:"type:varchar(10);comment:性别" json:"gender"`
+	Phone            string     `gorm:"type:varchar(20);not null;comment:联系电话" json:"phone"`
+	Email            string     `gorm:"type:varchar(100);comment:邮箱" json:"email"`
+	Title            string     `gorm:"type:varchar(50);comment:职称" json:"title"`
+	Specialty        string     `gorm:"type:varchar(500);comment:擅长领域" json:"specialty"`
+	YearsExp         int        `gorm:"comment:从业年限" json:"years_exp"`
+	Bio              string     `gorm:"type:text;comment:个人简介" json:"bio"`
+	CertificateImg1  string     `gorm:"type:varchar(255);comment:资质证书1(旧版申请)" json:"certificate_img1,omitempty"`
+	CertificateImg2  string     `gorm:"type:varchar(255);comment:资质证书2(旧版申请)" json:"certificate_img2,omitempty"`
+	CertificateImg3  string     `gorm:"type:varchar(255);comment:资质证书3(旧版申请)" json:"certificate_img3,omitempty"`
+	Status           int        `gorm:"not null;default:0;index;comment:状态:0-审核中,1-审核通过,2-审核拒绝,3-待补充材料,4-已失效" json:"status"`
+	Stage            string     `gorm:"type:varchar(20);not null;default:'qualification';index;comment:审核阶段:qualification/interview/final" json:"stage"`
+	RejectReason     string     `gorm:"type:text;comment:拒绝原因" json:"reject_reason"`
+	MaterialRequest  string     `gorm:"type:text;comment:要求补充的材料说明" json:"material_request"`
+	MaterialDeadline *time.Time `gorm:"index;comment:补充材料截止时间" json:"material_deadline"`
+	SubmittedAt      *time.Time `gorm:"comment:最近一次提交时间" json:"submitted_at"`
+	ReviewedBy       uint       `gorm:"comment:终审管理员ID" json:"reviewed_by"`
+	ReviewedAt       *time.Time `gorm:"comment:终审时间" json:"reviewed_at"`
+	CounselorID      uint       `gorm:"comment:终审通过后创建的咨询师ID" json:"counselor_id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 
 	// 关联
-	User     User `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Reviewer *User `gorm:"foreignKey:ReviewedBy" json:"reviewer,omitempty"`
+	User      User                           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Documents []CounselorApplicationDocument `gorm:"foreignKey:ApplicationID" json:"documents,omitempty"`
+	Events    []CounselorApplicationEvent    `gorm:"foreignKey:ApplicationID" json:"events,omitempty"`
+}
+
+// CounselorApplicationDocument 入驻申请的证明材料，文件本身保存在 files 表
+type CounselorApplicationDocument struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ApplicationID uint       `gorm:"not null;index;comment:申请ID" json:"application_id"`
+	FileID        uint       `gorm:"not null;index;comment:文件ID" json:"file_id"`
+	Kind          string     `gorm:"type:varchar(20);not null;comment:材料类型:id_card/certificate/degree/other" json:"kind"`
+	Status        int        `gorm:"not null;default:0;comment:核验状态:0-待核验,1-通过,2-不通过" json:"status"`
+	Note          string     `gorm:"type:varchar(500);comment:核验说明" json:"note"`
+	VerifiedBy    uint       `gorm:"comment:核验管理员ID" json:"verified_by"`
+	VerifiedAt    *time.Time `gorm:"comment:核验时间" json:"verified_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// 关联
+	File File `gorm:"foreignKey:FileID" json:"file,omitempty"`
+}
+
+// CounselorApplicationEvent 入驻申请处理记录
+type CounselorApplicationEvent struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ApplicationID uint      `gorm:"not null;index;comment:申请ID" json:"application_id"`
+	Stage         string    `gorm:"type:varchar(20);not null;comment:处理时所处阶段" json:"stage"`
+	Action        string    `gorm:"type:varchar(30);not null;comment:动作" json:"action"`
+	ActorType     string    `gorm:"type:varchar(10);not null;comment:处理人类型:user/admin/system" json:"actor_type"`
+	ActorID       uint      `gorm:"comment:处理人ID" json:"actor_id"`
+	Comment       string    `gorm:"type:text;comment:说明" json:"comment"`
+	CreatedAt     time.Time `json:"created_at"`
 }
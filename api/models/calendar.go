@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarToken 日历订阅令牌，订阅地址不需要登录，凭令牌识别用户；重置后旧地址失效
+type CalendarToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex;comment:用户ID" json:"user_id"`
+	Token     string    `gorm:"type:varchar(64);not null;uniqueIndex;comment:订阅令牌" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
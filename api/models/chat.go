@@ -25,21 +25,69 @@ type ChatSession struct {
 	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
 }
 
+// 消息内容类型
+const (
+	MessageTypeText   = "text"   // 文本
+	MessageTypeImage  = "image"  // 图片
+	MessageTypeAudio  = "audio"  // 语音
+	MessageTypeFile   = "file"   // 文件
+	MessageTypeSystem = "system" // 系统消息
+)
+
 // ChatMessage 聊天消息表
 type ChatMessage struct {
 	ID          uint       `gorm:"primaryKey" json:"id"`
 	SessionID   uint       `gorm:"not null;index;comment:会话ID" json:"session_id"`
 	SenderID    uint       `gorm:"not null;index;comment:发送者ID" json:"sender_id"`
 	SenderType  string     `gorm:"type:varchar(20);not null;comment:发送者类型:user/counselor" json:"sender_type"`
-	ContentType string     `gorm:"type:varchar(20);default:text;comment:内容类型:text/image/file" json:"content_type"`
+	ContentType string     `gorm:"type:varchar(20);default:text;comment:内容类型:text/image/audio/file/system" json:"content_type"`
 	Content     string     `gorm:"type:text;comment:消息内容" json:"content"`
+	FileID      *uint      `gorm:"index;comment:附件文件ID" json:"file_id,omitempty"`
 	FileURL     string     `gorm:"type:varchar(255);comment:文件URL" json:"file_url"`
 	IsRead      bool       `gorm:"default:false;comment:是否已读" json:"is_read"`
 	ReadTime    *time.Time `json:"read_time"`
+	Revision    int        `gorm:"not null;default:0;comment:修订次数" json:"revision"`
+	EditedAt    *time.Time `gorm:"comment:最后编辑时间" json:"edited_at"`
+	RecalledAt  *time.Time `gorm:"comment:撤回时间" json:"recalled_at"`
 	CreatedAt   time.Time  `json:"created_at"`
 
+	// 附件下载地址（按查看者签名，不持久化）
+	DownloadURL string `gorm:"-" json:"download_url,omitempty"`
+	ThumbURL    string `gorm:"-" json:"thumb_url,omitempty"`
+
 	// 关联
 	Session ChatSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
+	File    *File       `gorm:"foreignKey:FileID" json:"file,omitempty"`
+}
+
+// 消息修订动作
+const (
+	MessageActionEdit   = "edit"   // 编辑
+	MessageActionRecall = "recall" // 撤回
+)
+
+// ChatMessageRevision 消息修订审计表（保存编辑、撤回前的原始内容，仅特权管理员可查）
+type ChatMessageRevision struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	MessageID    uint      `gorm:"not null;index;comment:消息ID" json:"message_id"`
+	SessionID    uint      `gorm:"not null;index;comment:会话ID" json:"session_id"`
+	Revision     int       `gorm:"not null;comment:修订序号" json:"revision"`
+	Action       string    `gorm:"type:varchar(20);not null;comment:动作:edit/recall" json:"action"`
+	ContentType  string    `gorm:"type:varchar(20);comment:原内容类型" json:"content_type"`
+	Content      string    `gorm:"type:text;comment:原消息内容" json:"content"`
+	FileID       *uint     `gorm:"comment:原附件文件ID" json:"file_id"`
+	FileURL      string    `gorm:"type:varchar(255);comment:原文件URL" json:"file_url"`
+	OperatorID   uint      `gorm:"not null;comment:操作人ID" json:"operator_id"`
+	OperatorType string    `gorm:"type:varchar(20);not null;comment:操作人类型:user/counselor/admin" json:"operator_type"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ChatMessageDeletion 消息"仅自己删除"记录，只影响删除者本人的可见性
+type ChatMessageDeletion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;uniqueIndex:idx_message_deletion;comment:消息ID" json:"message_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_message_deletion;index;comment:用户ID" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // ChatBilling 聊天计费记录表
@@ -81,25 +129,6 @@ type CounselorAccount struct {
 	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
 }
 
-// CounselorReview 咨询师评价表
-type CounselorReview struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	OrderID    uint      `gorm:"not null;uniqueIndex;comment:订单ID" json:"order_id"`
-	UserID     uint      `gorm:"not null;index;comment:用户ID" json:"user_id"`
-	CounselorID uint     `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
-	Rating     int       `gorm:"not null;comment:评分(1-5)" json:"rating"`
-	Comment    string    `gorm:"type:text;comment:评价内容" json:"comment"`
-	IsAnonymous bool     `gorm:"default:false;comment:是否匿名" json:"is_anonymous"`
-	IsVisible  bool      `gorm:"default:true;comment:是否显示" json:"is_visible"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
-
-	// 关联
-	Order     Order     `gorm:"foreignKey:OrderID" json:"order,omitempty"`
-	User      User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
-}
-
 // WithdrawRecord 提现记录表
 type WithdrawRecord struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
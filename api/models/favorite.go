@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// CounselorFavorite 用户收藏的咨询师
+// 收藏的咨询师开放新的可预约时段或上线时通知用户，同一咨询师的同类通知有冷却时间，避免频繁打扰
+type CounselorFavorite struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	UserID           uint       `gorm:"not null;uniqueIndex:idx_favorite_user_counselor;comment:用户ID" json:"user_id"`
+	CounselorID      uint       `gorm:"not null;uniqueIndex:idx_favorite_user_counselor;index;comment:咨询师ID" json:"counselor_id"`
+	NotifySlots      bool       `gorm:"not null;default:true;comment:开放新时段时通知" json:"notify_slots"`
+	NotifyOnline     bool       `gorm:"not null;default:true;comment:上线时通知" json:"notify_online"`
+	SlotsNotifiedAt  *time.Time `gorm:"comment:最近一次新时段通知时间" json:"slots_notified_at"`
+	OnlineNotifiedAt *time.Time `gorm:"comment:最近一次上线通知时间" json:"online_notified_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+
+	// 关联
+	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
+}
@@ -14,6 +14,12 @@ const (
 	FileTypeOther    = "other"    // 其他
 )
 
+// 文件关联类型
+const (
+	FileRelationSession     = "session"     // 聊天会话附件
+	FileRelationApplication = "application" // 咨询师入驻申请材料
+)
+
 // File 文件表
 type File struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
@@ -27,6 +33,10 @@ type File struct {
 	UploaderID   uint      `gorm:"not null;index;comment:上传者ID" json:"uploader_id"`
 	RelationID   uint      `gorm:"index;comment:关联ID" json:"relation_id"`
 	RelationType string    `gorm:"type:varchar(50);index;comment:关联类型:order/session/message" json:"relation_type"`
+	Width        int       `gorm:"not null;default:0;comment:图片宽度(像素)" json:"width,omitempty"`
+	Height       int       `gorm:"not null;default:0;comment:图片高度(像素)" json:"height,omitempty"`
+	Duration     int       `gorm:"not null;default:0;comment:音视频时长(毫秒)" json:"duration,omitempty"`
+	ThumbPath    string    `gorm:"type:varchar(500);comment:缩略图路径" json:"-"`
 	Status       int       `gorm:"not null;default:1;comment:状态:1-正常,0-删除" json:"status"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
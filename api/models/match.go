@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// 时间偏好
+const (
+	MatchTimeMorning   = "morning"   // 上午 06:00-12:00
+	MatchTimeAfternoon = "afternoon" // 下午 12:00-18:00
+	MatchTimeEvening   = "evening"   // 晚上 18:00-24:00
+	MatchTimeWeekday   = "weekday"   // 工作日
+	MatchTimeWeekend   = "weekend"   // 周末
+)
+
+// MatchRequest 一次咨询师匹配：用户填写的问卷和分配到的排序策略
+type MatchRequest struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"not null;index;comment:用户ID" json:"user_id"`
+	IssueAreas      string    `gorm:"type:varchar(500);not null;default:'';comment:困扰领域(逗号分隔)" json:"issue_areas"`
+	PreferredGender string    `gorm:"type:varchar(10);not null;default:'';comment:偏好咨询师性别(空为不限)" json:"preferred_gender"`
+	BudgetMax       float64   `gorm:"type:decimal(10,2);not null;default:0;comment:预算上限(元/分钟,0为不限)" json:"budget_max"`
+	TimePreferences string    `gorm:"type:varchar(100);not null;default:'';comment:时间偏好(逗号分隔)" json:"time_preferences"`
+	Strategy        string    `gorm:"type:varchar(50);not null;index;comment:排序策略" json:"strategy"`
+	ResultCount     int       `gorm:"not null;default:0;comment:返回的咨询师数" json:"result_count"`
+	CreatedAt       time.Time `gorm:"index" json:"created_at"`
+}
+
+// MatchImpression 匹配结果中展示给用户的咨询师，用户随后预约该咨询师时记录订单，用于比较排序策略
+type MatchImpression struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	RequestID   uint       `gorm:"not null;uniqueIndex:idx_match_impression;comment:匹配请求ID" json:"request_id"`
+	UserID      uint       `gorm:"not null;index:idx_match_impression_user;comment:用户ID" json:"user_id"`
+	CounselorID uint       `gorm:"not null;uniqueIndex:idx_match_impression;index:idx_match_impression_user;comment:咨询师ID" json:"counselor_id"`
+	Strategy    string     `gorm:"type:varchar(50);not null;index;comment:排序策略" json:"strategy"`
+	Position    int        `gorm:"not null;comment:展示位置(从1开始)" json:"position"`
+	Score       float64    `gorm:"type:decimal(6,4);not null;comment:综合得分" json:"score"`
+	Breakdown   string     `gorm:"type:varchar(255);comment:各项得分(JSON)" json:"breakdown"`
+	OrderID     *uint      `gorm:"index;comment:由该次展示产生的预约订单ID" json:"order_id,omitempty"`
+	BookedAt    *time.Time `gorm:"comment:预约时间" json:"booked_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+}
@@ -13,6 +13,41 @@ const (
 	OrderStatusRefunded  = 4 // 已退款
 )
 
+// 订单类型
+const (
+	OrderTypeSession = "session" // 单次咨询（含使用套餐预约的咨询）
+	OrderTypePackage = "package" // 购买咨询套餐
+)
+
+// 订单事件（触发状态转换的动作）
+const (
+	OrderEventPay      = "pay"      // 支付成功
+	OrderEventCancel   = "cancel"   // 取消（已支付订单取消时自动退款）
+	OrderEventExpire   = "expire"   // 超时未支付自动取消
+	OrderEventComplete = "complete" // 咨询完成
+	OrderEventRefund   = "refund"   // 退款
+	OrderEventNoShow   = "no_show"  // 爽约（预约开始后会话未开始），按爽约政策退款
+)
+
+// 订单事件（不改变订单状态，仅记录过程）
+const (
+	OrderEventCreate        = "create"           // 创建订单
+	OrderEventPaymentCreate = "payment_created"  // 发起支付
+	OrderEventRefundRequest = "refund_requested" // 申请退款
+	OrderEventSessionStart  = "session_started"  // 咨询会话开始
+	OrderEventSessionEnd    = "session_ended"    // 咨询会话结束
+	OrderEventCheckIn       = "check_in"         // 用户或咨询师到场签到，用于判定爽约方
+	OrderEventReschedule    = "reschedule"       // 改约
+)
+
+// 订单事件操作人类型
+const (
+	OrderActorUser      = "user"
+	OrderActorCounselor = "counselor"
+	OrderActorAdmin     = "admin"
+	OrderActorSystem    = "system"
+)
+
 // Order 订单表
 type Order struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
@@ -21,10 +56,19 @@ type Order struct {
 	CounselorID  uint      `gorm:"not null;index" json:"counselor_id"`
 	Duration     int       `gorm:"not null;comment:咨询时长(分钟)" json:"duration"`
 	Amount       float64   `gorm:"type:decimal(10,2);not null" json:"amount"`
+	UnitPrice    float64   `gorm:"type:decimal(10,2);not null;default:0;comment:下单时的咨询单价(元/分钟)，会话按此计费" json:"unit_price"`
 	Status       int       `gorm:"not null;default:0;index" json:"status"`
 	ScheduleTime time.Time `gorm:"not null;comment:预约时间" json:"schedule_time"`
 	Notes        string    `gorm:"type:text;comment:备注" json:"notes"`
 	PayTime      *time.Time `json:"pay_time"`
+	RescheduleCount int    `gorm:"not null;default:0;comment:改约次数" json:"reschedule_count"`
+	Type          string   `gorm:"type:varchar(20);not null;default:session;index;comment:订单类型:session-咨询,package-购买套餐" json:"type"`
+	PackageID     *uint    `gorm:"index;comment:购买的套餐商品ID(购买套餐订单)" json:"package_id,omitempty"`
+	UserPackageID *uint    `gorm:"index;comment:使用的用户套餐ID(套餐预约订单)" json:"user_package_id,omitempty"`
+	OriginalAmount float64 `gorm:"type:decimal(10,2);not null;default:0;comment:优惠前金额" json:"original_amount"`
+	Discount       float64 `gorm:"type:decimal(10,2);not null;default:0;comment:优惠券抵扣金额" json:"discount"`
+	CouponID       *uint   `gorm:"index;comment:使用的优惠券ID" json:"coupon_id,omitempty"`
+	PriceBreakdown string  `gorm:"type:text;comment:下单时的计价明细(JSON)" json:"price_breakdown"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 
@@ -33,6 +77,21 @@ type Order struct {
 	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
 }
 
+// OrderEvent 订单事件流（只追加，不修改不删除），订单时间线和纠纷调查均以此为准
+type OrderEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	OrderID    uint      `gorm:"not null;index;comment:订单ID" json:"order_id"`
+	Event      string    `gorm:"type:varchar(30);not null;index;comment:事件类型" json:"event"`
+	FromStatus int       `gorm:"not null;comment:变更前状态" json:"from_status"`
+	ToStatus   int       `gorm:"not null;comment:变更后状态" json:"to_status"`
+	ActorType  string    `gorm:"type:varchar(20);not null;index:idx_order_event_actor;comment:操作人类型:user/counselor/admin/system" json:"actor_type"`
+	ActorID    uint      `gorm:"index:idx_order_event_actor;comment:操作人ID(用户ID/咨询师ID/管理员ID)" json:"actor_id"`
+	Reason     string    `gorm:"type:varchar(255);comment:原因" json:"reason"`
+	Amount     float64   `gorm:"type:decimal(10,2);not null;default:0.00;comment:涉及金额(支付/退款)" json:"amount"`
+	Metadata   string    `gorm:"type:text;comment:附加信息(JSON)" json:"metadata"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
 // Counselor 咨询师表
 type Counselor struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -43,12 +102,21 @@ type Counselor struct {
 	Bio       string    `gorm:"type:text;comment:个人简介" json:"bio"`
 	Specialty string    `gorm:"type:varchar(255);comment:擅长领域" json:"specialty"`
 	Price     float64   `gorm:"type:decimal(10,2);not null;comment:单价(元/分钟)" json:"price"`
+	Level     string    `gorm:"type:varchar(20);not null;default:'junior';index;comment:等级代码" json:"level"`
+	// PriceRules 时长档位单价和时段加价规则(JSON)，为空时按基础单价计费，由 api 服务 pricing 包解析
+	PriceRules string   `gorm:"type:text;comment:定价规则(JSON)" json:"price_rules"`
 	YearsExp  int       `gorm:"comment:从业年限" json:"years_exp"`
+	Gender    string    `gorm:"type:varchar(10);not null;default:'';index;comment:性别:male/female" json:"gender"`
 	Rating    float64   `gorm:"type:decimal(3,2);default:5.00;comment:评分" json:"rating"`
 	Status    int       `gorm:"not null;default:1;comment:状态:1-启用,0-禁用" json:"status"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	// 结构化标签（counselor_tags，不持久化到本表）
+	Specialties []string `gorm:"-" json:"specialties,omitempty"`
+	Tags        []string `gorm:"-" json:"tags,omitempty"`
+	Languages   []string `gorm:"-" json:"languages,omitempty"`
+
 	// 统计字段（不持久化到数据库）
 	ServiceCount int `gorm:"-" json:"service_count"`      // 服务人数
 	ReviewCount  int `gorm:"-" json:"review_count"`       // 评价数量
@@ -70,9 +138,20 @@ type CounselorStatistics struct {
 	ReviewCount     int       `gorm:"not null;default:0;comment:评价数量" json:"review_count"`
 	AvgRating       float64   `gorm:"type:decimal(3,2);not null;default:0.00;comment:平均评分" json:"avg_rating"`
 	SumRating       int       `gorm:"not null;default:0;comment:总评分" json:"sum_rating"`
+	SessionCount    int       `gorm:"not null;default:0;comment:已结束会话数" json:"session_count"`
+	SessionDuration int       `gorm:"not null;default:0;comment:实际会话总时长(秒)" json:"session_duration"`
 	LastOrderTime   *time.Time `gorm:"comment:最后订单时间" json:"last_order_time"`
 	UpdatedAt       time.Time `json:"updated_at"`
 
 	// 关联
 	Counselor Counselor `gorm:"foreignKey:CounselorID" json:"counselor,omitempty"`
 }
+
+// OrderReminder 预约提醒发送记录，(订单, 预约时间, 提前分钟数) 唯一：多个调度实例只有插入成功的一方发送，改约后按新时间重新提醒
+type OrderReminder struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	OrderID       uint      `gorm:"not null;uniqueIndex:idx_order_reminder;comment:订单ID" json:"order_id"`
+	ScheduleTime  time.Time `gorm:"not null;uniqueIndex:idx_order_reminder;comment:提醒对应的预约时间" json:"schedule_time"`
+	OffsetMinutes int       `gorm:"not null;uniqueIndex:idx_order_reminder;comment:提前分钟数" json:"offset_minutes"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// 套餐商品状态
+const (
+	PackageStatusOff = 0 // 已下架
+	PackageStatusOn  = 1 // 在售
+)
+
+// 用户套餐状态
+const (
+	UserPackageStatusActive   = 1 // 有效（是否过期以 ExpiresAt 判断）
+	UserPackageStatusRefunded = 2 // 剩余次数已退款
+)
+
+// CounselorPackage 咨询套餐商品：与某位咨询师的 N 次咨询，打包优惠价，购买后在有效期内使用
+type CounselorPackage struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CounselorID uint      `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
+	Name        string    `gorm:"type:varchar(100);not null;comment:套餐名称" json:"name"`
+	Description string    `gorm:"type:varchar(500);comment:套餐说明" json:"description"`
+	Sessions    int       `gorm:"not null;comment:咨询次数" json:"sessions"`
+	Duration    int       `gorm:"not null;comment:每次咨询时长(分钟)" json:"duration"`
+	Price       float64   `gorm:"type:decimal(10,2);not null;comment:套餐总价" json:"price"`
+	ValidDays   int       `gorm:"not null;comment:购买后有效天数" json:"valid_days"`
+	Status      int       `gorm:"not null;default:1;index;comment:状态:1-在售,0-已下架" json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UserPackage 用户已购套餐及剩余次数，购买订单支付成功时创建
+type UserPackage struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	UserID            uint      `gorm:"not null;index;comment:用户ID" json:"user_id"`
+	CounselorID       uint      `gorm:"not null;index;comment:咨询师ID" json:"counselor_id"`
+	PackageID         uint      `gorm:"not null;index;comment:套餐商品ID" json:"package_id"`
+	OrderID           uint      `gorm:"not null;uniqueIndex;comment:购买订单ID" json:"order_id"`
+	Name              string    `gorm:"type:varchar(100);not null;comment:套餐名称(购买时快照)" json:"name"`
+	TotalSessions     int       `gorm:"not null;comment:总次数" json:"total_sessions"`
+	RemainingSessions int       `gorm:"not null;comment:剩余次数" json:"remaining_sessions"`
+	Duration          int       `gorm:"not null;comment:每次咨询时长(分钟)" json:"duration"`
+	UnitPrice         float64   `gorm:"type:decimal(10,2);not null;comment:折合每次价格(退款按此计算)" json:"unit_price"`
+	ExpiresAt         time.Time `gorm:"not null;index;comment:过期时间" json:"expires_at"`
+	Status            int       `gorm:"not null;default:1;comment:状态:1-有效,2-已退款" json:"status"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Usable 套餐是否可用于预约
+func (p *UserPackage) Usable(now time.Time) bool {
+	return p.Status == UserPackageStatusActive && p.RemainingSessions > 0 && now.Before(p.ExpiresAt)
+}
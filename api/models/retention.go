@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// 归档数据类别
+const (
+	DataClassMessages    = "messages"    // 聊天消息（含修订和仅自己删除记录）
+	DataClassAttachments = "attachments" // 聊天附件文件
+	DataClassBilling     = "billing"     // 已结算的计费记录
+)
+
+// 归档状态
+const (
+	ArchiveStatusArchived         = "archived"          // 已写入归档，源数据待删除
+	ArchiveStatusPurged           = "purged"            // 源数据已删除
+	ArchiveStatusRestoreRequested = "restore_requested" // 管理员已申请恢复，等待恢复任务执行
+	ArchiveStatusRestored         = "restored"          // 已恢复到数据库
+	ArchiveStatusFailed           = "failed"            // 写入或恢复失败
+)
+
+// 法律保留对象类型
+const (
+	LegalHoldSession = "session"
+	LegalHoldUser    = "user"
+)
+
+// DataArchive 数据归档记录，每条对应一个压缩加密的 JSONL 文件
+type DataArchive struct {
+	ID                 uint       `gorm:"primaryKey" json:"id"`
+	DataClass          string     `gorm:"type:varchar(20);not null;index;comment:数据类别:messages/attachments/billing" json:"data_class"`
+	Storage            string     `gorm:"type:varchar(20);not null;comment:存储方式:local/object" json:"storage"`
+	Location           string     `gorm:"type:varchar(500);not null;comment:归档文件位置" json:"location"`
+	RecordCount        int        `gorm:"not null;default:0;comment:记录数" json:"record_count"`
+	SizeBytes          int64      `gorm:"not null;default:0;comment:文件大小(字节)" json:"size_bytes"`
+	SHA256             string     `gorm:"column:sha256;type:varchar(64);comment:文件SHA256" json:"sha256"`
+	KeyID              string     `gorm:"type:varchar(32);comment:加密密钥指纹" json:"key_id"`
+	RangeStart         *time.Time `gorm:"comment:数据最早时间" json:"range_start"`
+	RangeEnd           *time.Time `gorm:"comment:数据最晚时间" json:"range_end"`
+	Status             string     `gorm:"type:varchar(20);not null;index;comment:状态" json:"status"`
+	PurgedAt           *time.Time `gorm:"comment:源数据删除时间" json:"purged_at"`
+	RestoreRequestedAt *time.Time `gorm:"comment:申请恢复时间" json:"restore_requested_at"`
+	RestoreRequestedBy string     `gorm:"type:varchar(64);comment:申请恢复的管理员" json:"restore_requested_by"`
+	RestoredAt         *time.Time `gorm:"comment:恢复完成时间" json:"restored_at"`
+	Error              string     `gorm:"type:text;comment:错误信息" json:"error"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// LegalHold 法律保留，生效期间（未解除）对应会话或用户的数据不会被归档删除
+type LegalHold struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	SubjectType string     `gorm:"type:varchar(20);not null;index:idx_legal_hold_subject;comment:对象类型:session/user" json:"subject_type"`
+	SubjectID   uint       `gorm:"not null;index:idx_legal_hold_subject;comment:会话ID或用户ID" json:"subject_id"`
+	Reason      string     `gorm:"type:varchar(500);not null;comment:保留原因" json:"reason"`
+	CreatedBy   string     `gorm:"type:varchar(64);comment:设置人" json:"created_by"`
+	ReleasedAt  *time.Time `gorm:"index;comment:解除时间" json:"released_at"`
+	ReleasedBy  string     `gorm:"type:varchar(64);comment:解除人" json:"released_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// SystemConfig 系统配置表，由管理后台维护和迁移，api 服务只读
+type SystemConfig struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Key       string    `gorm:"type:varchar(100);uniqueIndex;not null;comment:配置键" json:"key"`
+	Value     string    `gorm:"type:text;comment:配置值" json:"value"`
+	Category  string    `gorm:"type:varchar(50);comment:配置分类" json:"category"`
+	Label     string    `gorm:"type:varchar(100);comment:配置标签" json:"label"`
+	Type      string    `gorm:"type:varchar(20);comment:配置类型" json:"type"`
+	IsSystem  bool      `gorm:"default:false;comment:是否系统配置" json:"is_system"`
+	Sort      int       `gorm:"default:0;comment:排序" json:"sort"`
+	Remark    string    `gorm:"type:varchar(255);comment:备注" json:"remark"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
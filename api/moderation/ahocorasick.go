@@ -0,0 +1,135 @@
+package moderation
+
+import (
+	"unicode"
+)
+
+// Matcher Aho-Corasick 多模式匹配器
+// 匹配前对文本做归一化（大小写、全角半角折叠，忽略空白和标点），
+// 用于识别"自 杀""自.杀"一类插入分隔符的规避写法；返回的位置对应原文
+type Matcher struct {
+	nodes []acNode
+	rules []Rule
+}
+
+type acNode struct {
+	next map[rune]int32
+	fail int32
+	out  []int32 // 在该节点结束的规则下标（含失败链上的）
+}
+
+// Match 一次命中，Start/End 为原文中的 rune 下标（左闭右开）
+type Match struct {
+	Rule  *Rule
+	Start int
+	End   int
+}
+
+// NewMatcher 根据规则构建匹配器，归一化后为空的词会被忽略
+func NewMatcher(rules []Rule) *Matcher {
+	m := &Matcher{
+		nodes: []acNode{{next: map[rune]int32{}}},
+		rules: rules,
+	}
+
+	for i := range rules {
+		cur := int32(0)
+		n := 0
+		for _, r := range rules[i].Word {
+			nr, ok := normalize(r)
+			if !ok {
+				continue
+			}
+			n++
+			nxt, exists := m.nodes[cur].next[nr]
+			if !exists {
+				m.nodes = append(m.nodes, acNode{next: map[rune]int32{}})
+				nxt = int32(len(m.nodes) - 1)
+				m.nodes[cur].next[nr] = nxt
+			}
+			cur = nxt
+		}
+		rules[i].length = n
+		if n > 0 {
+			m.nodes[cur].out = append(m.nodes[cur].out, int32(i))
+		}
+	}
+
+	// BFS 构建失败指针，并把失败链上的输出合并到当前节点
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		m.nodes[child].fail = 0
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			f := m.nodes[cur].fail
+			for f != 0 {
+				if _, ok := m.nodes[f].next[r]; ok {
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			if nxt, ok := m.nodes[f].next[r]; ok && nxt != child {
+				m.nodes[child].fail = nxt
+			} else {
+				m.nodes[child].fail = 0
+			}
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[m.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// Match 返回文本中的全部命中（可能重叠）
+func (m *Matcher) Match(text string) []Match {
+	if m == nil || len(m.rules) == 0 {
+		return nil
+	}
+
+	runes := []rune(text)
+	// pos[i] 为归一化后第 i 个字符在原文中的下标
+	pos := make([]int, 0, len(runes))
+
+	var matches []Match
+	cur := int32(0)
+	for i, r := range runes {
+		nr, ok := normalize(r)
+		if !ok {
+			continue
+		}
+		pos = append(pos, i)
+
+		for cur != 0 {
+			if _, ok := m.nodes[cur].next[nr]; ok {
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+		if nxt, ok := m.nodes[cur].next[nr]; ok {
+			cur = nxt
+		}
+
+		for _, idx := range m.nodes[cur].out {
+			rule := &m.rules[idx]
+			start := pos[len(pos)-rule.length]
+			matches = append(matches, Match{Rule: rule, Start: start, End: i + 1})
+		}
+	}
+	return matches
+}
+
+// normalize 归一化单个字符，返回 false 表示匹配时忽略该字符
+func normalize(r rune) (rune, bool) {
+	if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.Is(unicode.Cf, r) {
+		return 0, false
+	}
+	// 全角 ASCII 折叠为半角
+	if r >= 0xFF01 && r <= 0xFF5E {
+		r -= 0xFEE0
+	}
+	return unicode.ToLower(r), true
+}
@@ -0,0 +1,148 @@
+package moderation
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"unicode/utf8"
+
+	"akrick.com/mychat/models"
+)
+
+func TestMatcherMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		text  string
+		want  []string // "词@起-止"，起止为原文 rune 下标
+	}{
+		{"plain", []string{"自杀"}, "我想自杀", []string{"自杀@2-4"}},
+		{"no match", []string{"自杀"}, "我想自我了断", nil},
+		{"other char between", []string{"自杀"}, "自我杀", nil},
+
+		// 分隔符规避：空白、标点、符号、零宽字符都被忽略，命中范围包含中间的分隔符
+		{"space separator", []string{"自杀"}, "想自 杀了", []string{"自杀@1-4"}},
+		{"punct separator", []string{"自杀"}, "自.杀", []string{"自杀@0-3"}},
+		{"mixed separators", []string{"自杀"}, "自-_~ 杀", []string{"自杀@0-6"}},
+		{"full-width separator", []string{"自杀"}, "自，杀", []string{"自杀@0-3"}},
+		{"zero-width separator", []string{"自杀"}, "自\u200b杀", []string{"自杀@0-3"}},
+		{"leading separator not counted", []string{"自杀"}, "  自杀", []string{"自杀@2-4"}},
+		{"separator in word", []string{"自 杀"}, "自杀", []string{"自 杀@0-2"}},
+
+		// 全角、大小写规避
+		{"full-width text", []string{"kill"}, "ｋｉｌｌ", []string{"kill@0-4"}},
+		{"full-width upper", []string{"kill"}, "ＫＩＬＬ me", []string{"kill@0-4"}},
+		{"full-width word", []string{"ＱＱ"}, "加qq", []string{"ＱＱ@1-3"}},
+		{"case", []string{"WeChat"}, "加我wEcHaT", []string{"WeChat@2-8"}},
+		{"full-width and separator", []string{"vx"}, "Ｖ．Ｘ", []string{"vx@0-3"}},
+
+		// 重叠与嵌套
+		{"overlapping", []string{"abc", "bcd"}, "abcd", []string{"abc@0-3", "bcd@1-4"}},
+		{"nested suffix", []string{"想自杀", "自杀", "杀"}, "我想自杀", []string{"想自杀@1-4", "自杀@2-4", "杀@3-4"}},
+		{"nested infix", []string{"自杀倾向", "杀倾"}, "有自杀倾向", []string{"杀倾@2-4", "自杀倾向@1-5"}},
+		{"failure links", []string{"he", "she", "his", "hers"}, "ushers", []string{"she@1-4", "he@2-4", "hers@2-6"}},
+		{"partial then restart", []string{"自杀倾向"}, "自杀自杀倾向", []string{"自杀倾向@2-6"}},
+		{"repeated", []string{"aa"}, "aaa", []string{"aa@0-2", "aa@1-3"}},
+		{"duplicate rules", []string{"自杀", "自杀"}, "自杀", []string{"自杀@0-2", "自杀@0-2"}},
+
+		// 归一化后为空的词被忽略
+		{"empty word", []string{"...", "自杀"}, "...自杀", []string{"自杀@3-5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := make([]Rule, 0, len(tt.words))
+			for _, w := range tt.words {
+				rules = append(rules, Rule{Word: w})
+			}
+			var got []string
+			for _, m := range NewMatcher(rules).Match(tt.text) {
+				got = append(got, fmt.Sprintf("%s@%d-%d", m.Rule.Word, m.Start, m.End))
+			}
+			slices.Sort(got)
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Fatalf("Match(%q) = %v, want %v", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestMatcherNoRules(t *testing.T) {
+	var nilMatcher *Matcher
+	if got := nilMatcher.Match("自杀"); got != nil {
+		t.Fatalf("nil matcher = %v", got)
+	}
+	if got := NewMatcher(nil).Match("自杀"); got != nil {
+		t.Fatalf("empty matcher = %v", got)
+	}
+}
+
+// useRules 以给定规则替换当前词库，测试结束后恢复
+func useRules(t *testing.T, rules ...Rule) {
+	t.Helper()
+	startOnce.Do(func() {}) // 不从数据库加载词库
+	prev := current.Load()
+	current.Store(NewMatcher(rules))
+	t.Cleanup(func() { current.Store(prev) })
+}
+
+func TestCheckMasksMultibyteText(t *testing.T) {
+	mask := func(word string) Rule {
+		return Rule{Word: word, Category: models.SensitiveCategoryAbuse, Action: models.ModerationActionMask}
+	}
+	tests := []struct {
+		name  string
+		rules []Rule
+		text  string
+		want  string
+	}{
+		{"chinese", []Rule{mask("傻瓜")}, "你这个傻瓜！", "你这个**！"},
+		{"separator kept", []Rule{mask("傻瓜")}, "你这个傻 瓜！", "你这个* *！"},
+		{"mixed widths", []Rule{mask("sb")}, "a傻Ｓ.ｂ瓜", "a傻*.*瓜"},
+		{"four-byte runes around", []Rule{mask("傻瓜")}, "😀傻瓜😀", "😀**😀"},
+		{"overlapping", []Rule{mask("傻瓜"), mask("瓜蛋")}, "大傻瓜蛋了", "大***了"},
+		{"nested", []Rule{mask("笨蛋"), mask("大笨蛋")}, "你个大笨蛋", "你个***"},
+		{"several hits", []Rule{mask("傻瓜")}, "傻瓜，傻-瓜", "**，*-*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRules(t, tt.rules...)
+			v := Check(tt.text)
+			if v.Action != models.ModerationActionMask {
+				t.Fatalf("Check(%q).Action = %q, want mask", tt.text, v.Action)
+			}
+			if !utf8.ValidString(v.Content) {
+				t.Fatalf("Check(%q).Content is not valid UTF-8: %q", tt.text, v.Content)
+			}
+			if v.Content != tt.want {
+				t.Fatalf("Check(%q).Content = %q, want %q", tt.text, v.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckActionsAndCrisis(t *testing.T) {
+	useRules(t,
+		Rule{Word: "傻瓜", Category: models.SensitiveCategoryAbuse, Action: models.ModerationActionMask},
+		Rule{Word: "加微信", Category: models.SensitiveCategoryFraud, Action: models.ModerationActionBlock},
+		Rule{Word: "不想活", Category: models.SensitiveCategoryCrisis, Action: models.ModerationActionFlag},
+	)
+
+	// block 优先于 mask
+	v := Check("傻瓜，加 微 信")
+	if v.Action != models.ModerationActionBlock || v.Crisis {
+		t.Fatalf("block verdict = %+v", v)
+	}
+	// 危机词以 flag 动作命中时内容不变，但标记 Crisis
+	v = Check("我不 想 活了")
+	if v.Action != models.ModerationActionFlag || !v.Crisis || v.Content != "我不 想 活了" {
+		t.Fatalf("crisis verdict = %+v", v)
+	}
+	if v.category() != models.SensitiveCategoryCrisis || v.severity() != models.IncidentSeverityCrisis {
+		t.Fatalf("crisis category = %q, severity = %d", v.category(), v.severity())
+	}
+	if v = Check("你好"); v.Action != "" || v.Content != "你好" {
+		t.Fatalf("clean verdict = %+v", v)
+	}
+}
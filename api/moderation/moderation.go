@@ -0,0 +1,257 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+)
+
+// 热加载与告警通道（管理端修改词库后发布 ReloadChannel，危机事件发布到 AlertChannel）
+const (
+	ReloadChannel  = "moderation:words:reload"
+	AlertChannel   = "moderation:alert"
+	reloadInterval = 30 * time.Second
+	maskRune       = '*'
+)
+
+var ErrBlocked = errors.New("消息包含违规内容，无法发送")
+
+// Rule 一条敏感词规则
+type Rule struct {
+	Word     string
+	Category string
+	Action   string
+	length   int // 归一化后的长度
+}
+
+// Source 消息来源
+type Source struct {
+	SessionID  uint
+	SenderID   uint
+	SenderType string
+}
+
+// Verdict 审核结果
+type Verdict struct {
+	Action  string  // 最终动作：空表示放行，其余为 block/mask/flag
+	Content string  // 处理后的内容（mask 时已打码）
+	Crisis  bool    // 是否命中危机词
+	Matches []Match // 全部命中
+
+	original string
+}
+
+var (
+	current     atomic.Pointer[Matcher]
+	fingerprint string
+	reloadMu    sync.Mutex
+	startOnce   sync.Once
+)
+
+// Start 加载词库并启动热加载（每个进程只启动一次，Check 会自动调用）
+func Start() {
+	startOnce.Do(func() {
+		if err := reload(); err != nil {
+			log.Printf("加载敏感词库失败: %v", err)
+		}
+		go watch()
+	})
+}
+
+// Check 审核一段文本
+// block 优先于 mask；flag 不改变内容；命中危机词时即使规则动作为 flag 也会标记 Crisis
+func Check(text string) *Verdict {
+	Start()
+
+	v := &Verdict{Content: text, original: text}
+	v.Matches = current.Load().Match(text)
+	if len(v.Matches) == 0 {
+		return v
+	}
+
+	var masked []rune
+	for _, m := range v.Matches {
+		if m.Rule.Category == models.SensitiveCategoryCrisis {
+			v.Crisis = true
+		}
+		switch m.Rule.Action {
+		case models.ModerationActionBlock:
+			v.Action = models.ModerationActionBlock
+		case models.ModerationActionMask:
+			if v.Action != models.ModerationActionBlock {
+				v.Action = models.ModerationActionMask
+			}
+			if masked == nil {
+				masked = []rune(text)
+			}
+			for i := m.Start; i < m.End; i++ {
+				if !isSeparator(masked[i]) {
+					masked[i] = maskRune
+				}
+			}
+		default:
+			if v.Action == "" {
+				v.Action = models.ModerationActionFlag
+			}
+		}
+	}
+	if masked != nil {
+		v.Content = string(masked)
+	}
+	return v
+}
+
+// Screen 审核并在拦截时直接记录事件，返回可发送的内容
+// 未拦截时调用方应在消息保存后调用 Report 记录标记和危机事件
+func Screen(text string, src Source) (*Verdict, error) {
+	v := Check(text)
+	if v.Action == models.ModerationActionBlock {
+		Report(v, src, nil)
+		return v, ErrBlocked
+	}
+	return v, nil
+}
+
+// Report 记录审核事件：拦截、标记和危机命中都会生成事件，危机事件立即告警
+// 仅打码的命中不生成事件
+func Report(v *Verdict, src Source, messageID *uint) {
+	if v == nil || (!v.Crisis && v.Action != models.ModerationActionBlock && v.Action != models.ModerationActionFlag) {
+		return
+	}
+
+	incident := models.ModerationIncident{
+		SessionID:    src.SessionID,
+		MessageID:    messageID,
+		SenderID:     src.SenderID,
+		SenderType:   src.SenderType,
+		Category:     v.category(),
+		Action:       v.Action,
+		Severity:     v.severity(),
+		MatchedWords: v.words(),
+		Content:      v.original,
+		Status:       models.IncidentStatusPending,
+	}
+	if err := database.DB.Create(&incident).Error; err != nil {
+		log.Printf("记录审核事件失败: %v", err)
+		return
+	}
+
+	if v.Crisis {
+		log.Printf("危机信号: incidentID=%d, sessionID=%d, senderID=%d", incident.ID, src.SessionID, src.SenderID)
+		if cache.Rdb != nil {
+			cache.Rdb.Publish(context.Background(), AlertChannel, incident.ID)
+		}
+	}
+}
+
+// category 返回最需要关注的命中分类（危机优先）
+func (v *Verdict) category() string {
+	if v.Crisis {
+		return models.SensitiveCategoryCrisis
+	}
+	for _, m := range v.Matches {
+		if m.Rule.Action == v.Action {
+			return m.Rule.Category
+		}
+	}
+	return v.Matches[0].Rule.Category
+}
+
+func (v *Verdict) severity() int {
+	switch {
+	case v.Crisis:
+		return models.IncidentSeverityCrisis
+	case v.Action == models.ModerationActionBlock:
+		return models.IncidentSeverityHigh
+	default:
+		return models.IncidentSeverityNormal
+	}
+}
+
+func (v *Verdict) words() string {
+	seen := make(map[string]bool, len(v.Matches))
+	words := make([]string, 0, len(v.Matches))
+	for _, m := range v.Matches {
+		if !seen[m.Rule.Word] {
+			seen[m.Rule.Word] = true
+			words = append(words, m.Rule.Word)
+		}
+	}
+	s := strings.Join(words, ",")
+	if r := []rune(s); len(r) > 500 {
+		s = string(r[:500])
+	}
+	return s
+}
+
+// watch 订阅热加载通知，并定期比对词库指纹兜底（Redis 不可用或通知丢失时）
+func watch() {
+	if cache.Rdb != nil {
+		go func() {
+			sub := cache.Rdb.Subscribe(context.Background(), ReloadChannel)
+			for range sub.Channel() {
+				if err := reload(); err != nil {
+					log.Printf("重新加载敏感词库失败: %v", err)
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := reload(); err != nil {
+			log.Printf("重新加载敏感词库失败: %v", err)
+		}
+	}
+}
+
+// reload 词库有变化时重建匹配器
+func reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	var stat struct {
+		Total     int64
+		UpdatedAt *time.Time
+	}
+	if err := database.DB.Model(&models.SensitiveWord{}).Select("COUNT(*) AS total, MAX(updated_at) AS updated_at").Scan(&stat).Error; err != nil {
+		return err
+	}
+	fp := strconv.FormatInt(stat.Total, 10)
+	if stat.UpdatedAt != nil {
+		fp += "@" + stat.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	if fp == fingerprint && current.Load() != nil {
+		return nil
+	}
+
+	var words []models.SensitiveWord
+	if err := database.DB.Where("status = 1").Find(&words).Error; err != nil {
+		return err
+	}
+	rules := make([]Rule, 0, len(words))
+	for _, w := range words {
+		rules = append(rules, Rule{Word: w.Word, Category: w.Category, Action: w.Action})
+	}
+
+	current.Store(NewMatcher(rules))
+	fingerprint = fp
+	log.Printf("敏感词库已加载: %d 条", len(rules))
+	return nil
+}
+
+// isSeparator 打码时保留分隔字符，只替换词本身
+func isSeparator(r rune) bool {
+	_, ok := normalize(r)
+	return !ok
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strconv"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/sysconfig"
+)
+
+// 通知投递
+// 站内通知写入 notifications 表后发布到 Channel，WebSocket 服务据此推送给在线用户（Redis 不可用时由其定时拉取兜底）；
+// 邮件和短信为可选渠道，由系统配置 email_enabled / sms_enabled 开启，投递失败只记录日志
+
+// Channel 新通知推送通道，消息内容为通知ID
+const Channel = "notification:push"
+
+// 外部渠道配置键
+const (
+	ConfigEmailEnabled = "email_enabled"
+	ConfigSMTPHost     = "smtp_host"
+	ConfigSMTPPort     = "smtp_port"
+	ConfigSMTPUsername = "smtp_username"
+	ConfigSMTPPassword = "smtp_password"
+	ConfigSMSEnabled   = "sms_enabled"
+	ConfigSMSProvider  = "sms_provider"
+)
+
+// SMSGateway 短信服务商发送函数，由部署方按 sms_provider 注册；未注册时跳过短信渠道
+var SMSGateway func(provider, phone, content string) error
+
+// Sender 外部通知渠道
+type Sender interface {
+	Name() string
+	Send(config map[string]string, user *models.User, title, content string) error
+}
+
+var senders = []Sender{emailSender{}, smsSender{}}
+
+// Deliver 推送已写入的站内通知，并异步投递到已开启的外部渠道
+// 须在写入通知的事务提交后调用
+func Deliver(notifications ...models.Notification) {
+	if len(notifications) == 0 {
+		return
+	}
+	if cache.Rdb != nil {
+		for _, n := range notifications {
+			cache.Rdb.Publish(context.Background(), Channel, n.ID)
+		}
+	}
+	go deliverExternal(notifications)
+}
+
+func deliverExternal(notifications []models.Notification) {
+	config := sysconfig.Values(ConfigEmailEnabled, ConfigSMTPHost, ConfigSMTPPort, ConfigSMTPUsername,
+		ConfigSMTPPassword, ConfigSMSEnabled, ConfigSMSProvider)
+	if !sysconfig.Bool(config, ConfigEmailEnabled, false) && !sysconfig.Bool(config, ConfigSMSEnabled, false) {
+		return
+	}
+
+	for _, n := range notifications {
+		var user models.User
+		if err := database.DB.Select("id", "email", "phone").First(&user, n.UserID).Error; err != nil {
+			continue
+		}
+		for _, s := range senders {
+			if err := s.Send(config, &user, n.Title, n.Content); err != nil {
+				log.Printf("%s通知发送失败: notificationID=%d, userID=%d, err=%v", s.Name(), n.ID, n.UserID, err)
+			}
+		}
+	}
+}
+
+type emailSender struct{}
+
+func (emailSender) Name() string { return "邮件" }
+
+func (emailSender) Send(config map[string]string, user *models.User, title, content string) error {
+	if !sysconfig.Bool(config, ConfigEmailEnabled, false) || user.Email == "" {
+		return nil
+	}
+	host := sysconfig.String(config, ConfigSMTPHost, "")
+	username := sysconfig.String(config, ConfigSMTPUsername, "")
+	if host == "" || username == "" {
+		return fmt.Errorf("SMTP 未配置")
+	}
+	addr := host + ":" + strconv.Itoa(sysconfig.Int(config, ConfigSMTPPort, 25))
+	auth := smtp.PlainAuth("", username, sysconfig.String(config, ConfigSMTPPassword, ""), host)
+	msg := "From: " + username + "\r\n" +
+		"To: " + user.Email + "\r\n" +
+		"Subject: " + mime.BEncoding.Encode("UTF-8", title) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		content
+	return smtp.SendMail(addr, auth, username, []string{user.Email}, []byte(msg))
+}
+
+type smsSender struct{}
+
+func (smsSender) Name() string { return "短信" }
+
+func (smsSender) Send(config map[string]string, user *models.User, title, content string) error {
+	if !sysconfig.Bool(config, ConfigSMSEnabled, false) || user.Phone == "" {
+		return nil
+	}
+	if SMSGateway == nil {
+		return fmt.Errorf("未注册短信服务商")
+	}
+	return SMSGateway(sysconfig.String(config, ConfigSMSProvider, ""), user.Phone, "【"+title+"】"+content)
+}
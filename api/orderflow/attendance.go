@@ -0,0 +1,40 @@
+package orderflow
+
+import (
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+)
+
+// CheckIn 记录用户或咨询师到场，每方只记录一次
+func CheckIn(db *gorm.DB, order *models.Order, actor Actor) error {
+	var count int64
+	if err := db.Model(&models.OrderEvent{}).
+		Where("order_id = ? AND event = ? AND actor_type = ?", order.ID, models.OrderEventCheckIn, actor.Type).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return Record(db, order, Request{Event: models.OrderEventCheckIn, Actor: actor})
+}
+
+// NoShowParty 判定爽约方：咨询师已到场而用户未到场为用户爽约，
+// 其余情况（咨询师未到场，或双方都到场但咨询师未开始会话）为咨询师爽约
+func NoShowParty(db *gorm.DB, order *models.Order) (string, error) {
+	var actors []string
+	if err := db.Model(&models.OrderEvent{}).
+		Where("order_id = ? AND event = ?", order.ID, models.OrderEventCheckIn).
+		Distinct().Pluck("actor_type", &actors).Error; err != nil {
+		return "", err
+	}
+	present := make(map[string]bool, len(actors))
+	for _, a := range actors {
+		present[a] = true
+	}
+	if present[models.OrderActorCounselor] && !present[models.OrderActorUser] {
+		return models.OrderActorUser, nil
+	}
+	return models.OrderActorCounselor, nil
+}
@@ -0,0 +1,31 @@
+package orderflow
+
+import (
+	"time"
+
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+)
+
+// releaseCoupon 订单取消时退回优惠券（恢复可用数量和用户使用次数）
+// 已支付订单只有全额退款时才退回，按政策部分退款或不退款时视为已使用
+func releaseCoupon(tx *gorm.DB, order *models.Order, req *Request) error {
+	if order.CouponID == nil {
+		return nil
+	}
+	if order.PayTime != nil && (req.NoRefund || req.Amount > 0 && req.Amount < order.Amount) {
+		return nil
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.CouponRedemption{}).
+		Where("order_id = ? AND status = ?", order.ID, models.CouponRedemptionUsed).
+		Updates(map[string]interface{}{"status": models.CouponRedemptionReleased, "released_at": &now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	setMetadata(req, "coupon_released", true)
+	return tx.Model(&models.Coupon{}).Where("id = ? AND used_quantity > 0", *order.CouponID).
+		Update("used_quantity", gorm.Expr("used_quantity - 1")).Error
+}
@@ -0,0 +1,585 @@
+package orderflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/counselorstats"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 订单状态机
+// 所有订单状态变更（接口、管理后台、WebSocket 服务、定时任务）都经过 Fire：
+// 按转换表校验当前状态、操作人和守卫条件，在同一事务内写入新状态、执行副作用并追加 OrderEvent
+
+var (
+	ErrNotFound           = errors.New("订单不存在")
+	ErrInvalidTransition  = errors.New("当前订单状态不允许该操作")
+	ErrForbidden          = errors.New("无权操作此订单")
+	ErrScheduleStarted    = errors.New("预约已开始，无法取消")
+	ErrScheduleNotReached = errors.New("预约时间未到，无法完成")
+	ErrRefundAmount       = errors.New("退款金额不能超过支付金额")
+	ErrSessionStarted     = errors.New("咨询会话已开始，不能按爽约处理")
+	ErrRefundFailed       = errors.New("退款失败")
+	ErrPackageOrder       = errors.New("套餐购买订单不能执行该操作")
+)
+
+// RefundGateway 调用支付渠道退款，由支付模块注册；未注册的进程无法执行带退款的转换
+var RefundGateway func(payment *models.Payment, amount float64, reason string) bool
+
+// Actor 操作人，ID 对用户为用户ID、对咨询师为咨询师ID、对管理员为管理员ID
+type Actor struct {
+	Type string
+	ID   uint
+}
+
+// System 定时任务、支付回调、会话结束等系统触发的操作
+var System = Actor{Type: models.OrderActorSystem}
+
+// Request 一次状态转换请求
+type Request struct {
+	OrderID  uint
+	Event    string
+	Actor    Actor
+	Reason   string
+	Amount   float64                // 退款金额，0 表示全额
+	NoRefund bool                   // 按政策不退款（如用户爽约）
+	Metadata map[string]interface{} // 写入事件的附加信息，副作用也会补充（如退款的支付单号）
+}
+
+type guard func(tx *gorm.DB, order *models.Order, req *Request) error
+
+type effect func(tx *gorm.DB, order *models.Order, req *Request) error
+
+type transition struct {
+	to      int
+	actors  []string
+	guards  []guard
+	effects []effect
+	// explicit 只能按事件显式触发，不参与 EventFor 按目标状态匹配
+	explicit bool
+}
+
+type key struct {
+	from  int
+	event string
+}
+
+var table = map[key]transition{
+	{models.OrderStatusPending, models.OrderEventPay}: {
+		to:      models.OrderStatusPaid,
+		actors:  []string{models.OrderActorSystem, models.OrderActorAdmin},
+		effects: []effect{markPaid, countOrder, grantPackage, notifyPaid},
+	},
+	{models.OrderStatusPending, models.OrderEventCancel}: {
+		to:      models.OrderStatusCancelled,
+		actors:  []string{models.OrderActorUser, models.OrderActorAdmin},
+		effects: []effect{releaseCoupon, releaseSlot, notifyCancelled},
+	},
+	{models.OrderStatusPending, models.OrderEventExpire}: {
+		to:      models.OrderStatusCancelled,
+		actors:  []string{models.OrderActorSystem},
+		effects: []effect{releaseCoupon, releaseSlot, notifyExpired},
+	},
+	{models.OrderStatusPaid, models.OrderEventCancel}: {
+		to:      models.OrderStatusCancelled,
+		actors:  []string{models.OrderActorUser, models.OrderActorCounselor, models.OrderActorAdmin},
+		guards:  []guard{scheduleNotStarted},
+		effects: []effect{applyCancelPolicy, refundPackage, restoreCredit, releaseCoupon, refund, releaseSlot, countCancelled, notifyCancelled},
+	},
+	{models.OrderStatusPaid, models.OrderEventComplete}: {
+		to:      models.OrderStatusCompleted,
+		actors:  []string{models.OrderActorCounselor, models.OrderActorSystem, models.OrderActorAdmin},
+		guards:  []guard{sessionOrder, scheduleReached},
+		effects: []effect{countCompleted, notifyCompleted},
+	},
+	{models.OrderStatusPaid, models.OrderEventRefund}: {
+		to:      models.OrderStatusRefunded,
+		actors:  []string{models.OrderActorUser, models.OrderActorAdmin},
+		effects: []effect{applyCancelPolicy, refundPackage, restoreCredit, releaseCoupon, refund, releaseSlot, countCancelled, notifyRefunded},
+	},
+	{models.OrderStatusPaid, models.OrderEventNoShow}: {
+		to:       models.OrderStatusCancelled,
+		actors:   []string{models.OrderActorSystem, models.OrderActorAdmin},
+		guards:   []guard{schedulePassed, sessionNotStarted},
+		effects:  []effect{restoreCredit, releaseCoupon, refund, releaseSlot, countCancelled, notifyNoShow},
+		explicit: true,
+	},
+	{models.OrderStatusCompleted, models.OrderEventRefund}: {
+		to:      models.OrderStatusRefunded,
+		actors:  []string{models.OrderActorAdmin},
+		effects: []effect{restoreCredit, refund, notifyRefunded},
+	},
+}
+
+// Fire 在独立事务中执行状态转换，提交后清理订单缓存
+func Fire(req Request) (*models.Order, error) {
+	var order *models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = FireTx(tx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	Invalidate(order)
+	if err := SettleRefund(order.ID); err != nil {
+		log.Printf("发起订单退款失败，等待重试: orderID=%d, err=%v", order.ID, err)
+	}
+	return order, nil
+}
+
+// FireTx 在调用方事务中执行状态转换（如支付回调需与支付记录一同提交）
+// 调用方提交事务后应调用 Invalidate 清理缓存；转换带退款时还应调用 SettleRefund 发起渠道退款
+func FireTx(tx *gorm.DB, req Request) (*models.Order, error) {
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, req.OrderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	from := order.Status
+	t, err := check(tx, &order, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&order).Update("status", t.to).Error; err != nil {
+		return nil, err
+	}
+	order.Status = t.to
+
+	for _, fn := range t.effects {
+		if err := fn(tx, &order, &req); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := appendEvent(tx, &order, from, &req); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Record 追加不改变订单状态的事件（创建订单、发起支付、申请退款、会话开始与结束）
+func Record(tx *gorm.DB, order *models.Order, req Request) error {
+	return appendEvent(tx, order, order.Status, &req)
+}
+
+func appendEvent(tx *gorm.DB, order *models.Order, from int, req *Request) error {
+	event := models.OrderEvent{
+		OrderID:    order.ID,
+		Event:      req.Event,
+		FromStatus: from,
+		ToStatus:   order.Status,
+		ActorType:  req.Actor.Type,
+		ActorID:    req.Actor.ID,
+		Reason:     req.Reason,
+		Amount:     eventAmount(order, req),
+	}
+	if len(req.Metadata) > 0 {
+		data, err := json.Marshal(req.Metadata)
+		if err != nil {
+			return err
+		}
+		event.Metadata = string(data)
+	}
+	return tx.Create(&event).Error
+}
+
+// Check 校验操作是否可执行（不修改数据），用于界面按钮状态和预校验
+func Check(order *models.Order, event string, actor Actor) error {
+	req := Request{OrderID: order.ID, Event: event, Actor: actor}
+	_, err := check(database.DB, order, &req)
+	return err
+}
+
+// EventFor 根据目标状态找到操作人可用的事件，用于兼容按状态值更新的接口
+func EventFor(order *models.Order, to int, actor Actor) (string, bool) {
+	for k, t := range table {
+		if k.from == order.Status && t.to == to && !t.explicit && allowed(t.actors, actor.Type) {
+			return k.event, true
+		}
+	}
+	return "", false
+}
+
+// Invalidate 清理订单相关缓存
+func Invalidate(order *models.Order) {
+	if cache.Rdb == nil || order == nil {
+		return
+	}
+	ctx := context.Background()
+	cache.DeleteOrderCache(ctx, order.ID)
+	cache.InvalidateUserOrdersCache(ctx, order.UserID)
+	cache.InvalidateCounselorOrdersCache(ctx, order.CounselorID)
+}
+
+func check(tx *gorm.DB, order *models.Order, req *Request) (transition, error) {
+	t, ok := table[key{order.Status, req.Event}]
+	if !ok {
+		return t, ErrInvalidTransition
+	}
+	if !allowed(t.actors, req.Actor.Type) || !owns(order, req.Actor) {
+		return t, ErrForbidden
+	}
+	for _, fn := range t.guards {
+		if err := fn(tx, order, req); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+func allowed(actors []string, actorType string) bool {
+	for _, a := range actors {
+		if a == actorType {
+			return true
+		}
+	}
+	return false
+}
+
+// owns 用户和咨询师只能操作自己的订单
+func owns(order *models.Order, actor Actor) bool {
+	switch actor.Type {
+	case models.OrderActorUser:
+		return order.UserID == actor.ID
+	case models.OrderActorCounselor:
+		return order.CounselorID == actor.ID
+	default:
+		return true
+	}
+}
+
+func eventAmount(order *models.Order, req *Request) float64 {
+	switch req.Event {
+	case models.OrderEventCreate, models.OrderEventPay:
+		return order.Amount
+	case models.OrderEventPaymentCreate, models.OrderEventRefundRequest:
+		return req.Amount
+	case models.OrderEventRefund, models.OrderEventCancel, models.OrderEventNoShow:
+		if order.PayTime == nil || req.NoRefund {
+			return 0
+		}
+		if req.Amount > 0 {
+			return req.Amount
+		}
+		return order.Amount
+	}
+	return 0
+}
+
+// 守卫条件
+
+// scheduleNotStarted 已支付订单只能在预约开始前由用户或咨询师取消，管理员不受限
+func scheduleNotStarted(_ *gorm.DB, order *models.Order, req *Request) error {
+	if req.Actor.Type != models.OrderActorAdmin && !time.Now().Before(order.ScheduleTime) {
+		return ErrScheduleStarted
+	}
+	return nil
+}
+
+// sessionOrder 套餐购买订单没有咨询，不能标记完成
+func sessionOrder(_ *gorm.DB, order *models.Order, _ *Request) error {
+	if order.Type == models.OrderTypePackage {
+		return ErrPackageOrder
+	}
+	return nil
+}
+
+// scheduleReached 咨询师不能在预约时间之前标记完成
+func scheduleReached(_ *gorm.DB, order *models.Order, req *Request) error {
+	if req.Actor.Type == models.OrderActorCounselor && time.Now().Before(order.ScheduleTime) {
+		return ErrScheduleNotReached
+	}
+	return nil
+}
+
+// schedulePassed 爽约只能在预约开始之后判定
+func schedulePassed(_ *gorm.DB, order *models.Order, _ *Request) error {
+	if time.Now().Before(order.ScheduleTime) {
+		return ErrScheduleNotReached
+	}
+	return nil
+}
+
+// sessionNotStarted 会话已开始的订单不是爽约
+func sessionNotStarted(tx *gorm.DB, order *models.Order, _ *Request) error {
+	var count int64
+	if err := tx.Model(&models.ChatSession{}).Where("order_id = ? AND start_time IS NOT NULL", order.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSessionStarted
+	}
+	return nil
+}
+
+// 副作用
+
+func markPaid(tx *gorm.DB, order *models.Order, _ *Request) error {
+	if order.PayTime != nil {
+		return nil
+	}
+	now := time.Now()
+	order.PayTime = &now
+	return tx.Model(order).Update("pay_time", &now).Error
+}
+
+// refund 将最近一笔成功支付标记为退款中，事务提交后由 SettleRefund 调用支付渠道退款；
+// 渠道退款不能随事务回滚，不在事务内调用。没有支付记录（如管理员手动标记支付）时只变更状态
+func refund(tx *gorm.DB, order *models.Order, req *Request) error {
+	if req.NoRefund {
+		return nil
+	}
+	var payment models.Payment
+	err := tx.Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusPaid).Order("id DESC").First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	amount := req.Amount
+	if amount <= 0 {
+		amount = payment.Amount
+	}
+	if amount > payment.Amount {
+		return ErrRefundAmount
+	}
+	if RefundGateway == nil {
+		return ErrRefundFailed
+	}
+	if err := tx.Model(&payment).Updates(map[string]interface{}{
+		"status":        models.PaymentStatusRefunding,
+		"refund_no":     refundNo(order.ID),
+		"refund_amount": amount,
+		"refund_reason": req.Reason,
+	}).Error; err != nil {
+		return err
+	}
+	if req.Metadata == nil {
+		req.Metadata = map[string]interface{}{}
+	}
+	req.Metadata["payment_no"] = payment.PaymentNo
+	req.Metadata["payment_method"] = payment.PaymentMethod
+	req.Metadata["refund_no"] = refundNo(order.ID)
+	return nil
+}
+
+// refundNo 退款单号按订单生成：订单的退款转换只会成功一次，同一订单重复发起的渠道退款使用同一单号
+func refundNo(orderID uint) string {
+	return fmt.Sprintf("RF%d", orderID)
+}
+
+// SettleRefund 对订单退款中的支付记录调用支付渠道退款，成功后标记已退款
+// 退款单号按订单生成，渠道按单号幂等处理，重复调用（如多个实例同时重试）不会重复退款；
+// 失败时支付记录保持退款中，由 RetryRefunds 定时重试
+func SettleRefund(orderID uint) error {
+	var payment models.Payment
+	err := database.DB.Where("order_id = ? AND status = ?", orderID, models.PaymentStatusRefunding).Order("id DESC").First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if RefundGateway == nil || !RefundGateway(&payment, payment.RefundAmount, payment.RefundReason) {
+		return ErrRefundFailed
+	}
+	if err := database.DB.Model(&payment).Where("status = ?", models.PaymentStatusRefunding).
+		Update("status", models.PaymentStatusRefunded).Error; err != nil {
+		return err
+	}
+	if cache.Rdb != nil {
+		cache.DeletePaymentCache(context.Background(), payment.ID)
+	}
+	return nil
+}
+
+// RefundRetryJobName 重试渠道退款的定时任务
+const RefundRetryJobName = "order_refund_retry"
+
+// refundRetryAfter 标记退款中超过该时间仍未完成的支付记录才重试，避免与转换后立即发起的退款并发
+const refundRetryAfter = 5 * time.Minute
+
+// RetryRefunds 重试退款中的支付记录（渠道退款失败，或事务提交后进程退出未发起退款）
+func RetryRefunds(ctx context.Context) error {
+	var orderIDs []uint
+	if err := database.DB.Model(&models.Payment{}).
+		Where("status = ? AND updated_at < ?", models.PaymentStatusRefunding, time.Now().Add(-refundRetryAfter)).
+		Distinct("order_id").Pluck("order_id", &orderIDs).Error; err != nil {
+		return fmt.Errorf("查询退款中的支付记录失败: %w", err)
+	}
+
+	failed := 0
+	for _, id := range orderIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := SettleRefund(id); err != nil {
+			log.Printf("重试订单退款失败: orderID=%d, err=%v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 笔订单退款失败", failed)
+	}
+	return nil
+}
+
+// countOrder、countCompleted、countCancelled 在状态转换的事务内更新咨询师统计（见 counselorstats）
+func countOrder(tx *gorm.DB, order *models.Order, _ *Request) error {
+	return counselorstats.OrderPaid(tx, order)
+}
+
+func countCompleted(tx *gorm.DB, order *models.Order, _ *Request) error {
+	return counselorstats.OrderCompleted(tx, order)
+}
+
+// releaseSlot 释放订单占用的预约时段
+func releaseSlot(tx *gorm.DB, order *models.Order, _ *Request) error {
+	return tx.Model(&models.CounselorBooking{}).
+		Where("order_id = ? AND status = ?", order.ID, models.BookingStatusActive).
+		Update("status", models.BookingStatusReleased).Error
+}
+
+func countCancelled(tx *gorm.DB, order *models.Order, _ *Request) error {
+	return counselorstats.OrderCancelled(tx, order)
+}
+
+func notifyPaid(tx *gorm.DB, order *models.Order, _ *Request) error {
+	switch {
+	case order.Type == models.OrderTypePackage:
+		if err := notify(tx, order.UserID, models.NotificationTypePayment, models.NotificationLevelSuccess,
+			"套餐购买成功", fmt.Sprintf("您的套餐订单 %s 已支付成功，金额：%.2f元，可在有效期内使用套餐预约咨询", order.OrderNo, order.Amount)); err != nil {
+			return err
+		}
+		return notifyCounselor(tx, order, models.NotificationLevelInfo,
+			"新的套餐购买", fmt.Sprintf("有用户购买了您的咨询套餐，订单 %s", order.OrderNo))
+	case order.UserPackageID != nil:
+		if err := notify(tx, order.UserID, models.NotificationTypeOrder, models.NotificationLevelSuccess,
+			"预约成功", fmt.Sprintf("您已使用套餐预约咨询，订单 %s，预约时间：%s", order.OrderNo, order.ScheduleTime.Format("2006-01-02 15:04"))); err != nil {
+			return err
+		}
+		return notifyCounselor(tx, order, models.NotificationLevelInfo,
+			"新的预约订单", fmt.Sprintf("您有新的预约订单 %s（套餐），预约时间：%s", order.OrderNo, order.ScheduleTime.Format("2006-01-02 15:04")))
+	}
+	if err := notify(tx, order.UserID, models.NotificationTypePayment, models.NotificationLevelSuccess,
+		"支付成功", fmt.Sprintf("您的订单 %s 已支付成功，金额：%.2f元", order.OrderNo, order.Amount)); err != nil {
+		return err
+	}
+	return notifyCounselor(tx, order, models.NotificationLevelInfo,
+		"新的预约订单", fmt.Sprintf("您有新的预约订单 %s，预约时间：%s", order.OrderNo, order.ScheduleTime.Format("2006-01-02 15:04")))
+}
+
+func notifyCancelled(tx *gorm.DB, order *models.Order, req *Request) error {
+	content := fmt.Sprintf("订单 %s 已取消", order.OrderNo)
+	if req.Reason != "" {
+		content += "，原因：" + req.Reason
+	}
+	if order.PayTime != nil {
+		content += refundNote(order, req)
+	}
+	if req.Actor.Type != models.OrderActorUser {
+		if err := notify(tx, order.UserID, models.NotificationTypeOrder, models.NotificationLevelWarning, "订单已取消", content); err != nil {
+			return err
+		}
+	}
+	// 未支付的订单咨询师无感知，不打扰
+	if req.Actor.Type != models.OrderActorCounselor && order.PayTime != nil {
+		return notifyCounselor(tx, order, models.NotificationLevelWarning, "预约已取消", content)
+	}
+	return nil
+}
+
+// notifyNoShow 通知双方爽约处理结果
+func notifyNoShow(tx *gorm.DB, order *models.Order, req *Request) error {
+	party, _ := req.Metadata["party"].(string)
+	who := "咨询师"
+	if party == models.OrderActorUser {
+		who = "用户"
+	}
+	content := fmt.Sprintf("订单 %s 预约开始后%s未到场，订单已取消%s", order.OrderNo, who, refundNote(order, req))
+	if err := notify(tx, order.UserID, models.NotificationTypeOrder, models.NotificationLevelWarning, "预约爽约", content); err != nil {
+		return err
+	}
+	return notifyCounselor(tx, order, models.NotificationLevelWarning, "预约爽约", content)
+}
+
+func refundNote(order *models.Order, req *Request) string {
+	if restored, ok := req.Metadata["credit_restored"].(bool); ok {
+		if restored {
+			return "，已退回1次套餐次数"
+		}
+		return "，按政策套餐次数不予退回"
+	}
+	if req.NoRefund {
+		return "，按政策不予退款"
+	}
+	note := fmt.Sprintf("，退款%.2f元将原路退回", eventAmount(order, req))
+	if released, _ := req.Metadata["coupon_released"].(bool); released {
+		note += "，优惠券已退回"
+	}
+	return note
+}
+
+func notifyExpired(tx *gorm.DB, order *models.Order, _ *Request) error {
+	return notify(tx, order.UserID, models.NotificationTypeOrder, models.NotificationLevelWarning,
+		"订单已取消", fmt.Sprintf("您的订单 %s 因超时未支付已自动取消", order.OrderNo))
+}
+
+func notifyCompleted(tx *gorm.DB, order *models.Order, _ *Request) error {
+	return notify(tx, order.UserID, models.NotificationTypeOrder, models.NotificationLevelSuccess,
+		"咨询已完成", fmt.Sprintf("订单 %s 的咨询已完成，欢迎对本次咨询进行评价", order.OrderNo))
+}
+
+func notifyRefunded(tx *gorm.DB, order *models.Order, req *Request) error {
+	return notify(tx, order.UserID, models.NotificationTypePayment, models.NotificationLevelInfo,
+		"订单已退款", fmt.Sprintf("订单 %s 已退款，%.2f元将原路退回", order.OrderNo, eventAmount(order, req)))
+}
+
+// NotifyOther 通知订单另一方（操作人为用户时通知咨询师，反之通知用户），用于改约等非状态变更
+func NotifyOther(tx *gorm.DB, order *models.Order, actor Actor, title, content string) error {
+	if actor.Type == models.OrderActorUser {
+		return notifyCounselor(tx, order, models.NotificationLevelInfo, title, content)
+	}
+	return notify(tx, order.UserID, models.NotificationTypeOrder, models.NotificationLevelInfo, title, content)
+}
+
+// notifyCounselor 通知发送给咨询师对应的用户账号
+func notifyCounselor(tx *gorm.DB, order *models.Order, level, title, content string) error {
+	var userID uint
+	if err := tx.Model(&models.Counselor{}).Select("user_id").Where("id = ?", order.CounselorID).Scan(&userID).Error; err != nil {
+		return err
+	}
+	if userID == 0 {
+		log.Printf("咨询师未关联用户账号，跳过通知: counselorID=%d", order.CounselorID)
+		return nil
+	}
+	return notify(tx, userID, models.NotificationTypeOrder, level, title, content)
+}
+
+func notify(tx *gorm.DB, userID uint, notificationType, level, title, content string) error {
+	return tx.Create(&models.Notification{
+		UserID:  userID,
+		Type:    notificationType,
+		Level:   level,
+		Title:   title,
+		Content: content,
+	}).Error
+}
@@ -0,0 +1,124 @@
+package orderflow
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 咨询套餐
+// 购买套餐是一笔 Type=package 的订单，走正常支付；支付成功后发放次数（UserPackage）。
+// 使用套餐预约的咨询订单不再支付，取消或咨询师爽约时退回次数；套餐退款按剩余次数折算金额，通过购买订单的支付原路退回
+
+// grantPackage 套餐购买订单支付成功后发放次数
+func grantPackage(tx *gorm.DB, order *models.Order, req *Request) error {
+	if order.Type != models.OrderTypePackage || order.PackageID == nil {
+		return nil
+	}
+	var pkg models.CounselorPackage
+	if err := tx.First(&pkg, *order.PackageID).Error; err != nil {
+		return err
+	}
+
+	up := models.UserPackage{
+		UserID:            order.UserID,
+		CounselorID:       order.CounselorID,
+		PackageID:         pkg.ID,
+		OrderID:           order.ID,
+		Name:              pkg.Name,
+		TotalSessions:     pkg.Sessions,
+		RemainingSessions: pkg.Sessions,
+		Duration:          pkg.Duration,
+		UnitPrice:         math.Round(order.Amount/float64(pkg.Sessions)*100) / 100,
+		ExpiresAt:         time.Now().AddDate(0, 0, pkg.ValidDays),
+		Status:            models.UserPackageStatusActive,
+	}
+	if err := tx.Create(&up).Error; err != nil {
+		return err
+	}
+	setMetadata(req, "user_package_id", up.ID)
+	return recordTransaction(tx, order, models.TransactionTypeConsume, order.Amount, "购买套餐："+pkg.Name)
+}
+
+// refundPackage 套餐购买订单退款：按剩余次数 × 折合单价计算退款金额（管理员可指定金额），并作废剩余次数
+func refundPackage(tx *gorm.DB, order *models.Order, req *Request) error {
+	if order.Type != models.OrderTypePackage {
+		return nil
+	}
+	var up models.UserPackage
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", order.ID).First(&up).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	amount := math.Round(float64(up.RemainingSessions)*up.UnitPrice*100) / 100
+	if req.Actor.Type != models.OrderActorAdmin || req.Amount <= 0 {
+		req.Amount = amount
+		req.NoRefund = amount <= 0
+	}
+	setMetadata(req, "user_package_id", up.ID)
+	setMetadata(req, "refunded_sessions", up.RemainingSessions)
+
+	if err := tx.Model(&up).Updates(map[string]interface{}{
+		"remaining_sessions": 0,
+		"status":             models.UserPackageStatusRefunded,
+	}).Error; err != nil {
+		return err
+	}
+	if req.NoRefund {
+		return nil
+	}
+	return recordTransaction(tx, order, models.TransactionTypeRefund, req.Amount,
+		fmt.Sprintf("套餐退款：%s（剩余%d次）", up.Name, up.RemainingSessions))
+}
+
+// restoreCredit 使用套餐预约的咨询取消、退款或咨询师爽约时退回次数（该订单没有支付记录，不退现金）
+// 按政策只能部分退款或不退款时，次数视为已使用
+func restoreCredit(tx *gorm.DB, order *models.Order, req *Request) error {
+	if order.UserPackageID == nil {
+		return nil
+	}
+	full := !req.NoRefund && (req.Amount <= 0 || req.Amount >= order.Amount)
+	req.NoRefund = true
+	req.Amount = 0
+	setMetadata(req, "credit_restored", full)
+	if !full {
+		return nil
+	}
+	return tx.Model(&models.UserPackage{}).
+		Where("id = ? AND status = ?", *order.UserPackageID, models.UserPackageStatusActive).
+		Update("remaining_sessions", gorm.Expr("remaining_sessions + 1")).Error
+}
+
+// recordTransaction 记录用户交易流水（套餐通过支付渠道付款，不影响余额）
+func recordTransaction(tx *gorm.DB, order *models.Order, txType string, amount float64, description string) error {
+	var balance float64
+	if err := tx.Model(&models.User{}).Select("balance").Where("id = ?", order.UserID).Scan(&balance).Error; err != nil {
+		return err
+	}
+	orderID := order.ID
+	return tx.Create(&models.UserTransaction{
+		UserID:      order.UserID,
+		Type:        txType,
+		Amount:      amount,
+		Description: description,
+		OrderID:     &orderID,
+		Balance:     balance,
+	}).Error
+}
+
+func setMetadata(req *Request, key string, value interface{}) {
+	if req.Metadata == nil {
+		req.Metadata = map[string]interface{}{}
+	}
+	req.Metadata[key] = value
+}
@@ -0,0 +1,121 @@
+package orderflow
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+)
+
+// 取消、改约和爽约政策的配置键（system_configs 表，category=order，由管理后台维护）
+const (
+	ConfigCancelFullRefundHours      = "cancel_full_refund_hours"
+	ConfigCancelPartialRefundPercent = "cancel_partial_refund_percent"
+	ConfigRescheduleMaxTimes         = "reschedule_max_times"
+	ConfigRescheduleMinHours         = "reschedule_min_hours"
+	ConfigNoShowGraceMinutes         = "no_show_grace_minutes"
+	ConfigNoShowUserRefundPercent    = "no_show_user_refund_percent"
+	ConfigNoShowCounselorRefund      = "no_show_counselor_refund_percent"
+)
+
+// Policy 订单取消、改约和爽约政策
+type Policy struct {
+	CancelFullRefundHours      int `json:"cancel_full_refund_hours"`         // 距预约开始不少于该小时数取消，全额退款
+	CancelPartialRefundPercent int `json:"cancel_partial_refund_percent"`    // 之后取消按该比例退款
+	RescheduleMaxTimes         int `json:"reschedule_max_times"`             // 每个订单最多改约次数
+	RescheduleMinHours         int `json:"reschedule_min_hours"`             // 距预约开始不足该小时数不能改约
+	NoShowGraceMinutes         int `json:"no_show_grace_minutes"`            // 预约开始后超过该分钟数会话仍未开始视为爽约
+	NoShowUserRefundPercent    int `json:"no_show_user_refund_percent"`      // 用户爽约的退款比例
+	NoShowCounselorRefund      int `json:"no_show_counselor_refund_percent"` // 咨询师爽约的退款比例
+}
+
+// DefaultPolicy 未配置时使用的默认政策
+var DefaultPolicy = Policy{
+	CancelFullRefundHours:      24,
+	CancelPartialRefundPercent: 50,
+	RescheduleMaxTimes:         2,
+	RescheduleMinHours:         12,
+	NoShowGraceMinutes:         15,
+	NoShowUserRefundPercent:    0,
+	NoShowCounselorRefund:      100,
+}
+
+// LoadPolicy 读取系统配置中的政策，缺失或格式错误的项使用默认值
+func LoadPolicy(db *gorm.DB) Policy {
+	p := DefaultPolicy
+	fields := map[string]*int{
+		ConfigCancelFullRefundHours:      &p.CancelFullRefundHours,
+		ConfigCancelPartialRefundPercent: &p.CancelPartialRefundPercent,
+		ConfigRescheduleMaxTimes:         &p.RescheduleMaxTimes,
+		ConfigRescheduleMinHours:         &p.RescheduleMinHours,
+		ConfigNoShowGraceMinutes:         &p.NoShowGraceMinutes,
+		ConfigNoShowUserRefundPercent:    &p.NoShowUserRefundPercent,
+		ConfigNoShowCounselorRefund:      &p.NoShowCounselorRefund,
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+
+	var configs []models.SystemConfig
+	if err := db.Where("`key` IN ?", keys).Find(&configs).Error; err != nil {
+		return p
+	}
+	for _, c := range configs {
+		var v int
+		if err := json.Unmarshal([]byte(c.Value), &v); err == nil && v >= 0 {
+			*fields[c.Key] = v
+		}
+	}
+	return p
+}
+
+// CancelRefundPercent 用户在 now 取消时的退款比例
+func (p Policy) CancelRefundPercent(scheduleTime, now time.Time) int {
+	if scheduleTime.Sub(now) >= time.Duration(p.CancelFullRefundHours)*time.Hour {
+		return 100
+	}
+	return p.CancelPartialRefundPercent
+}
+
+// NoShowRefundPercent 爽约方为 party（user 或 counselor）时的退款比例
+func (p Policy) NoShowRefundPercent(party string) int {
+	if party == models.OrderActorCounselor {
+		return p.NoShowCounselorRefund
+	}
+	return p.NoShowUserRefundPercent
+}
+
+// ApplyRefundPercent 按比例设置请求的退款金额，比例为 0 时不退款
+func ApplyRefundPercent(req *Request, order *models.Order, percent int) {
+	if req.Metadata == nil {
+		req.Metadata = map[string]interface{}{}
+	}
+	req.Metadata["refund_percent"] = percent
+	if percent <= 0 {
+		req.NoRefund = true
+		req.Amount = 0
+		return
+	}
+	if percent >= 100 {
+		return
+	}
+	amount := math.Round(order.Amount*float64(percent)) / 100
+	if req.Amount <= 0 || req.Amount > amount {
+		req.Amount = amount
+	}
+}
+
+// applyCancelPolicy 用户取消或申请退款已支付订单时按取消政策计算退款金额
+// 咨询师取消全额退款，管理员不受政策限制；套餐购买订单按剩余次数退款（见 refundPackage）
+func applyCancelPolicy(tx *gorm.DB, order *models.Order, req *Request) error {
+	if req.Actor.Type != models.OrderActorUser || order.Type == models.OrderTypePackage {
+		return nil
+	}
+	percent := LoadPolicy(tx).CancelRefundPercent(order.ScheduleTime, time.Now())
+	ApplyRefundPercent(req, order, percent)
+	return nil
+}
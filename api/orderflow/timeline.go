@@ -0,0 +1,135 @@
+package orderflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+)
+
+var eventTitles = map[string]string{
+	models.OrderEventCreate:        "创建订单",
+	models.OrderEventPaymentCreate: "发起支付",
+	models.OrderEventPay:           "支付订单",
+	models.OrderEventCancel:        "取消订单",
+	models.OrderEventExpire:        "超时取消",
+	models.OrderEventRefundRequest: "申请退款",
+	models.OrderEventRefund:        "退款成功",
+	models.OrderEventSessionStart:  "咨询开始",
+	models.OrderEventSessionEnd:    "咨询结束",
+	models.OrderEventComplete:      "完成咨询",
+	models.OrderEventCheckIn:       "到场签到",
+	models.OrderEventReschedule:    "改约",
+	models.OrderEventNoShow:        "爽约",
+}
+
+var actorNames = map[string]string{
+	models.OrderActorUser:      "用户",
+	models.OrderActorCounselor: "咨询师",
+	models.OrderActorAdmin:     "管理员",
+	models.OrderActorSystem:    "系统",
+}
+
+// TimelineEntry 时间线条目
+type TimelineEntry struct {
+	Event     string    `json:"event"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	ActorType string    `json:"actor_type"`
+	Time      time.Time `json:"time"`
+}
+
+// Events 按发生顺序返回订单的全部事件
+func Events(orderID uint) ([]models.OrderEvent, error) {
+	var events []models.OrderEvent
+	err := database.DB.Where("order_id = ?", orderID).Order("id ASC").Find(&events).Error
+	return events, err
+}
+
+// Timeline 将事件流转换为面向用户的时间线
+func Timeline(events []models.OrderEvent) []TimelineEntry {
+	entries := make([]TimelineEntry, 0, len(events))
+	for i := range events {
+		e := &events[i]
+		entries = append(entries, TimelineEntry{
+			Event:     e.Event,
+			Title:     Title(e.Event),
+			Message:   Describe(e),
+			ActorType: e.ActorType,
+			Time:      e.CreatedAt,
+		})
+	}
+	return entries
+}
+
+// Title 事件名称
+func Title(event string) string {
+	if title, ok := eventTitles[event]; ok {
+		return title
+	}
+	return event
+}
+
+// Describe 生成事件描述，如"用户取消了订单，原因：时间冲突"
+func Describe(e *models.OrderEvent) string {
+	actor := actorNames[e.ActorType]
+	var msg string
+	switch e.Event {
+	case models.OrderEventCreate:
+		msg = fmt.Sprintf("%s创建了订单，金额：%.2f元", actor, e.Amount)
+		if code, ok := metadata(e)["coupon_code"].(string); ok {
+			discount, _ := metadata(e)["discount"].(float64)
+			msg += fmt.Sprintf("（使用优惠券 %s 抵扣%.2f元）", code, discount)
+		}
+	case models.OrderEventPaymentCreate:
+		msg = fmt.Sprintf("%s发起支付，金额：%.2f元", actor, e.Amount)
+	case models.OrderEventPay:
+		msg = fmt.Sprintf("订单已支付，金额：%.2f元", e.Amount)
+	case models.OrderEventCancel:
+		msg = fmt.Sprintf("%s取消了订单", actor)
+		if e.Amount > 0 {
+			msg += fmt.Sprintf("，退款：%.2f元", e.Amount)
+		}
+	case models.OrderEventExpire:
+		msg = "订单超时未支付，已自动取消"
+	case models.OrderEventRefundRequest:
+		msg = fmt.Sprintf("%s申请退款，金额：%.2f元", actor, e.Amount)
+	case models.OrderEventRefund:
+		msg = fmt.Sprintf("已退款：%.2f元", e.Amount)
+	case models.OrderEventSessionStart:
+		msg = "咨询会话已开始"
+	case models.OrderEventSessionEnd:
+		msg = fmt.Sprintf("咨询会话由%s结束", actor)
+	case models.OrderEventComplete:
+		msg = "咨询已完成"
+	case models.OrderEventCheckIn:
+		msg = fmt.Sprintf("%s已到场", actor)
+	case models.OrderEventReschedule:
+		msg = fmt.Sprintf("%s修改了预约时间", actor)
+		if to, ok := metadata(e)["to"].(string); ok {
+			msg += "，新时间：" + to
+		}
+	case models.OrderEventNoShow:
+		party, _ := metadata(e)["party"].(string)
+		msg = fmt.Sprintf("%s未按时到场，订单已取消", actorNames[party])
+		if e.Amount > 0 {
+			msg += fmt.Sprintf("，退款：%.2f元", e.Amount)
+		}
+	default:
+		msg = Title(e.Event)
+	}
+	if e.Reason != "" && e.Event != models.OrderEventExpire {
+		msg += "，原因：" + e.Reason
+	}
+	return msg
+}
+
+func metadata(e *models.OrderEvent) map[string]interface{} {
+	data := map[string]interface{}{}
+	if e.Metadata != "" {
+		json.Unmarshal([]byte(e.Metadata), &data)
+	}
+	return data
+}
@@ -0,0 +1,257 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/schedule"
+
+	"gorm.io/gorm"
+)
+
+// 咨询计价
+// 成交单价 = 时长档位单价（没有匹配的档位时为基础单价 Counselor.Price）× 预约开始时间所在时段的比例，
+// 再限制在咨询师等级的单价区间内；下单时计价明细写入 Order.PriceBreakdown，之后调价不影响已下单的订单
+
+var (
+	ErrInvalidRules = errors.New("定价规则格式错误")
+	ErrOutOfBand    = errors.New("单价超出咨询师等级的价格区间")
+)
+
+const (
+	maxDurationTiers = 10
+	maxTimeSlots     = 10
+	minSlotRate      = 50  // 时段比例下限(%)
+	maxSlotRate      = 300 // 时段比例上限(%)
+)
+
+// DurationTier 时长档位：预约时长不少于 MinDuration 分钟时按 Price 计费
+type DurationTier struct {
+	MinDuration int     `json:"min_duration"`
+	Price       float64 `json:"price"`
+}
+
+// TimeSlot 时段加价：预约开始时间落在 Weekdays 的 [Start, End) 内时单价乘以 Rate%，
+// Rate 大于 100 为高峰加价，小于 100 为低峰优惠；Weekdays 为空表示每天
+type TimeSlot struct {
+	Name     string `json:"name"`
+	Weekdays []int  `json:"weekdays"` // 0-周日,1-周一...6-周六
+	Start    string `json:"start"`    // HH:MM
+	End      string `json:"end"`      // HH:MM
+	Rate     int    `json:"rate"`
+}
+
+// Rules 咨询师定价规则，存于 Counselor.PriceRules
+type Rules struct {
+	Durations []DurationTier `json:"durations"`
+	TimeSlots []TimeSlot     `json:"time_slots"`
+}
+
+// Parse 解析定价规则，空串返回空规则
+func Parse(s string) (Rules, error) {
+	var r Rules
+	if s == "" {
+		return r, nil
+	}
+	if err := json.Unmarshal([]byte(s), &r); err != nil {
+		return r, ErrInvalidRules
+	}
+	return r, nil
+}
+
+// Encode 校验后按档位时长排序序列化，没有任何规则时返回空串
+func (r Rules) Encode() (string, error) {
+	if err := r.Validate(); err != nil {
+		return "", err
+	}
+	if len(r.Durations) == 0 && len(r.TimeSlots) == 0 {
+		return "", nil
+	}
+	sort.Slice(r.Durations, func(i, j int) bool { return r.Durations[i].MinDuration < r.Durations[j].MinDuration })
+	data, err := json.Marshal(r)
+	return string(data), err
+}
+
+// Validate 校验档位和时段：档位时长不重复，时段格式正确、比例在允许范围内且同一天内不重叠
+func (r Rules) Validate() error {
+	if len(r.Durations) > maxDurationTiers || len(r.TimeSlots) > maxTimeSlots {
+		return fmt.Errorf("%w：最多 %d 个时长档位和 %d 个时段", ErrInvalidRules, maxDurationTiers, maxTimeSlots)
+	}
+	seen := make(map[int]bool)
+	for _, d := range r.Durations {
+		if d.MinDuration <= 0 || d.Price <= 0 {
+			return fmt.Errorf("%w：时长档位的时长和单价须大于0", ErrInvalidRules)
+		}
+		if seen[d.MinDuration] {
+			return fmt.Errorf("%w：时长档位 %d 分钟重复", ErrInvalidRules, d.MinDuration)
+		}
+		seen[d.MinDuration] = true
+	}
+
+	type span struct{ start, end int }
+	days := make(map[int][]span)
+	for _, s := range r.TimeSlots {
+		start, err := schedule.ParseClock(s.Start)
+		if err != nil {
+			return fmt.Errorf("%w：时段 %s 的开始时间", ErrInvalidRules, s.Name)
+		}
+		end, err := schedule.ParseClock(s.End)
+		if err != nil || end <= start {
+			return fmt.Errorf("%w：时段 %s 的结束时间", ErrInvalidRules, s.Name)
+		}
+		if s.Rate < minSlotRate || s.Rate > maxSlotRate {
+			return fmt.Errorf("%w：时段比例须在 %d%%-%d%% 之间", ErrInvalidRules, minSlotRate, maxSlotRate)
+		}
+		for _, day := range s.days() {
+			if day < 0 || day > 6 {
+				return fmt.Errorf("%w：星期须为 0-6", ErrInvalidRules)
+			}
+			for _, o := range days[day] {
+				if start < o.end && o.start < end {
+					return fmt.Errorf("%w：时段 %s 与其他时段重叠", ErrInvalidRules, s.Name)
+				}
+			}
+			days[day] = append(days[day], span{start, end})
+		}
+	}
+	return nil
+}
+
+// Prices 规则中出现的所有单价（基础单价和各档位单价），用于校验是否在等级价格区间内
+func (r Rules) Prices(base float64) []float64 {
+	prices := []float64{base}
+	for _, d := range r.Durations {
+		prices = append(prices, d.Price)
+	}
+	return prices
+}
+
+func (s TimeSlot) days() []int {
+	if len(s.Weekdays) == 0 {
+		return []int{0, 1, 2, 3, 4, 5, 6}
+	}
+	return s.Weekdays
+}
+
+func (s TimeSlot) contains(t time.Time) bool {
+	start, _ := schedule.ParseClock(s.Start)
+	end, _ := schedule.ParseClock(s.End)
+	minute := t.Hour()*60 + t.Minute()
+	if minute < start || minute >= end {
+		return false
+	}
+	for _, day := range s.days() {
+		if day == int(t.Weekday()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Breakdown 计价明细
+type Breakdown struct {
+	BasePrice    float64       `json:"base_price"`              // 基础单价
+	DurationTier *DurationTier `json:"duration_tier,omitempty"` // 命中的时长档位
+	TimeSlot     *TimeSlot     `json:"time_slot,omitempty"`     // 命中的时段
+	Level        string        `json:"level"`                   // 咨询师等级
+	LevelName    string        `json:"level_name"`
+	Clamped      bool          `json:"clamped"`    // 是否按等级价格区间调整过单价
+	UnitPrice    float64       `json:"unit_price"` // 成交单价(元/分钟)
+	Duration     int           `json:"duration"`
+	Amount       float64       `json:"amount"`
+}
+
+// JSON 序列化，写入 Order.PriceBreakdown
+func (b *Breakdown) JSON() string {
+	data, _ := json.Marshal(b)
+	return string(data)
+}
+
+// ParseBreakdown 解析订单保存的计价明细，未记录（如定价规则上线前的订单）或无法解析时返回 nil
+func ParseBreakdown(s string) *Breakdown {
+	if s == "" {
+		return nil
+	}
+	var b Breakdown
+	if err := json.Unmarshal([]byte(s), &b); err != nil {
+		return nil
+	}
+	return &b
+}
+
+// Quote 按咨询师的定价规则和等级计算 start 开始、时长 duration 分钟的咨询价格
+func Quote(db *gorm.DB, counselor *models.Counselor, start time.Time, duration int) (*Breakdown, error) {
+	rules, err := Parse(counselor.PriceRules)
+	if err != nil {
+		return nil, err
+	}
+	level, err := Level(db, counselor.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Breakdown{BasePrice: counselor.Price, Duration: duration}
+	price := counselor.Price
+	for i := range rules.Durations {
+		tier := rules.Durations[i]
+		if duration >= tier.MinDuration && (b.DurationTier == nil || tier.MinDuration > b.DurationTier.MinDuration) {
+			b.DurationTier = &tier
+			price = tier.Price
+		}
+	}
+	start = start.Local() // 时段按服务器本地时区判断，与排班一致
+	for i := range rules.TimeSlots {
+		if slot := rules.TimeSlots[i]; slot.contains(start) {
+			b.TimeSlot = &slot
+			price = price * float64(slot.Rate) / 100
+			break
+		}
+	}
+	if level != nil {
+		b.Level, b.LevelName = level.Code, level.Name
+		if clamped := level.Clamp(price); clamped != price {
+			b.Clamped, price = true, clamped
+		}
+	}
+	b.UnitPrice = round(price)
+	b.Amount = round(b.UnitPrice * float64(duration))
+	return b, nil
+}
+
+// Level 按代码查询等级，等级不存在时返回 nil（不限制单价）
+func Level(db *gorm.DB, code string) (*models.CounselorLevel, error) {
+	var level models.CounselorLevel
+	err := db.Where("code = ?", code).First(&level).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &level, nil
+}
+
+// CheckBand 校验基础单价和各档位单价是否都在等级价格区间内
+func CheckBand(level *models.CounselorLevel, base float64, rules Rules) error {
+	if level == nil {
+		return nil
+	}
+	for _, p := range rules.Prices(base) {
+		if !level.InBand(p) {
+			if level.PriceMax > 0 {
+				return fmt.Errorf("%w（%s：%.2f-%.2f 元/分钟）", ErrOutOfBand, level.Name, level.PriceMin, level.PriceMax)
+			}
+			return fmt.Errorf("%w（%s：不低于 %.2f 元/分钟）", ErrOutOfBand, level.Name, level.PriceMin)
+		}
+	}
+	return nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
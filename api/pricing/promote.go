@@ -0,0 +1,105 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/notify"
+)
+
+// PromoteJobName 等级晋升任务名，管理后台可手动触发
+const PromoteJobName = "counselor_level_promote"
+
+// Promote 按咨询师统计评估晋升：达到更高等级的晋升条件时升到满足条件的最高等级并通知咨询师；
+// 只升级不降级，降级由管理员在管理后台调整。晋升后单价低于新等级下限的，下单时按下限计费
+func Promote(ctx context.Context) error {
+	var levels []models.CounselorLevel
+	if err := database.DB.Order("`rank` DESC").Find(&levels).Error; err != nil {
+		return fmt.Errorf("查询咨询师等级失败: %w", err)
+	}
+	if len(levels) == 0 {
+		return nil
+	}
+	ranks := make(map[string]int, len(levels))
+	for _, l := range levels {
+		ranks[l.Code] = l.Rank
+	}
+
+	var counselors []models.Counselor
+	if err := database.DB.Select("id", "user_id", "level").Where("status = ?", 1).Find(&counselors).Error; err != nil {
+		return fmt.Errorf("查询咨询师失败: %w", err)
+	}
+	var stats []models.CounselorStatistics
+	if err := database.DB.Find(&stats).Error; err != nil {
+		return fmt.Errorf("查询咨询师统计失败: %w", err)
+	}
+	statsByCounselor := make(map[uint]*models.CounselorStatistics, len(stats))
+	for i := range stats {
+		statsByCounselor[stats[i].CounselorID] = &stats[i]
+	}
+
+	promoted, failed := 0, 0
+	for _, counselor := range counselors {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s, ok := statsByCounselor[counselor.ID]
+		if !ok {
+			continue
+		}
+		var target *models.CounselorLevel
+		for i := range levels {
+			if levels[i].Rank > ranks[counselor.Level] && levels[i].Qualifies(s) {
+				target = &levels[i]
+				break
+			}
+		}
+		if target == nil {
+			continue
+		}
+
+		// 按原等级条件更新，管理员同时调整了等级时不覆盖
+		result := database.DB.Model(&models.Counselor{}).
+			Where("id = ? AND level = ?", counselor.ID, counselor.Level).
+			Update("level", target.Code)
+		if result.Error != nil {
+			log.Printf("咨询师 %d 晋升失败: %v", counselor.ID, result.Error)
+			failed++
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		promoted++
+		if cache.Rdb != nil {
+			cache.DeleteCounselorCache(ctx, counselor.ID)
+		}
+		if counselor.UserID == 0 {
+			continue
+		}
+		notification := models.Notification{
+			UserID:  counselor.UserID,
+			Type:    models.NotificationTypeSystem,
+			Level:   models.NotificationLevelSuccess,
+			Title:   "等级晋升",
+			Content: fmt.Sprintf("恭喜您晋升为%s，单价可在 %.2f-%.2f 元/分钟之间设置", target.Name, target.PriceMin, target.PriceMax),
+		}
+		if target.PriceMax <= 0 {
+			notification.Content = fmt.Sprintf("恭喜您晋升为%s，单价不低于 %.2f 元/分钟", target.Name, target.PriceMin)
+		}
+		if err := database.DB.Create(&notification).Error; err != nil {
+			log.Printf("咨询师 %d 晋升通知创建失败: %v", counselor.ID, err)
+			continue
+		}
+		notify.Deliver(notification)
+	}
+	log.Printf("咨询师等级评估完成: 晋升 %d 人", promoted)
+	if failed > 0 {
+		return fmt.Errorf("%d 个咨询师晋升失败", failed)
+	}
+	return nil
+}
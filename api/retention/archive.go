@@ -0,0 +1,213 @@
+package retention
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"akrick.com/mychat/models"
+)
+
+// 归档文件格式：gzip 压缩的 JSONL，整体用 AES-256-GCM 加密
+// 文件内容为 magic(4) + nonce(12) + 密文；每行一条 record
+
+// KeyEnv 归档加密密钥环境变量（64位十六进制，即32字节）；密钥不写入数据库，丢失后归档无法恢复
+const KeyEnv = "MYCHAT_ARCHIVE_KEY"
+
+var archiveMagic = []byte("MCA1")
+
+var (
+	ErrNoKey       = errors.New("未配置归档加密密钥 " + KeyEnv)
+	ErrKeyMismatch = errors.New("归档加密密钥与当前密钥不一致")
+	ErrNoStore     = errors.New("归档存储不可用")
+)
+
+// record 归档文件中的一行
+type record struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+	// 附件文件内容（JSON 中为 base64）；缩略图路径不随 File 序列化，单独保存
+	Data      []byte `json:"data,omitempty"`
+	Thumb     []byte `json:"thumb,omitempty"`
+	ThumbPath string `json:"thumb_path,omitempty"`
+}
+
+// Store 归档存储
+type Store interface {
+	// Put 保存归档文件，返回之后用于读取的位置
+	Put(name string, data []byte) (string, error)
+	Get(location string) ([]byte, error)
+}
+
+// ObjectStore 对象存储实现，由部署方注册；archive_storage 为 object 时使用，未注册时归档任务报错
+var ObjectStore Store
+
+// localStore 本地目录存储
+type localStore struct {
+	dir string
+}
+
+func (s localStore) Put(name string, data []byte) (string, error) {
+	path := filepath.Join(s.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	// 先写临时文件再改名，避免进程中断留下不完整的归档
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+func (s localStore) Get(location string) ([]byte, error) {
+	return os.ReadFile(location)
+}
+
+func storeFor(storage, path string) (Store, error) {
+	switch storage {
+	case StorageLocal:
+		return localStore{dir: path}, nil
+	case StorageObject:
+		if ObjectStore == nil {
+			return nil, fmt.Errorf("%w: 未注册对象存储", ErrNoStore)
+		}
+		return ObjectStore, nil
+	}
+	return nil, fmt.Errorf("%w: 未知的存储方式 %q", ErrNoStore, storage)
+}
+
+// loadKey 读取加密密钥，返回密钥和指纹（SHA256 前8字节）
+func loadKey() ([]byte, string, error) {
+	raw := strings.TrimSpace(os.Getenv(KeyEnv))
+	if raw == "" {
+		return nil, "", ErrNoKey
+	}
+	key, err := hex.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		return nil, "", fmt.Errorf("%s 必须是64位十六进制字符串", KeyEnv)
+	}
+	sum := sha256.Sum256(key)
+	return key, hex.EncodeToString(sum[:8]), nil
+}
+
+// encoder 逐条写入记录，finish 后得到加密的归档内容
+type encoder struct {
+	buf   bytes.Buffer
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	count int
+}
+
+func newEncoder() *encoder {
+	e := &encoder{}
+	e.gz = gzip.NewWriter(&e.buf)
+	e.enc = json.NewEncoder(e.gz)
+	return e
+}
+
+func (e *encoder) add(table string, row interface{}) error {
+	raw, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	e.count++
+	return e.enc.Encode(record{Table: table, Row: raw})
+}
+
+func (e *encoder) addFile(f *models.File, data, thumb []byte) error {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	e.count++
+	return e.enc.Encode(record{Table: "files", Row: raw, Data: data, Thumb: thumb, ThumbPath: f.ThumbPath})
+}
+
+func (e *encoder) finish(key []byte) ([]byte, error) {
+	if err := e.gz.Close(); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(archiveMagic)+len(nonce)+e.buf.Len()+gcm.Overhead())
+	out = append(out, archiveMagic...)
+	out = append(out, nonce...)
+	// magic 作为附加认证数据，防止格式标记被篡改
+	return gcm.Seal(out, nonce, e.buf.Bytes(), archiveMagic), nil
+}
+
+// decode 解密并逐行解析归档内容
+func decode(data, key []byte) ([]record, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	head := len(archiveMagic) + gcm.NonceSize()
+	if len(data) < head || !bytes.Equal(data[:len(archiveMagic)], archiveMagic) {
+		return nil, errors.New("归档文件格式无效")
+	}
+	plain, err := gcm.Open(nil, data[len(archiveMagic):head], data[head:], archiveMagic)
+	if err != nil {
+		return nil, fmt.Errorf("归档文件解密失败: %w", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var records []record
+	reader := bufio.NewReader(gz)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var r record
+			if err := json.Unmarshal(line, &r); err != nil {
+				return nil, fmt.Errorf("归档记录解析失败: %w", err)
+			}
+			records = append(records, r)
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
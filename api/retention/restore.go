@@ -0,0 +1,191 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/search"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RestoreJobName 恢复任务名，管理后台申请恢复后手动触发该任务
+const RestoreJobName = "data_restore"
+
+// Restore 恢复管理员已申请恢复的归档，作为定时任务注册
+// 恢复后为涉及的会话加法律保留，避免下一次归档任务再次删除；管理员确认不再需要后解除保留即可
+func Restore(ctx context.Context) error {
+	var archives []models.DataArchive
+	if err := database.DB.Where("status = ?", models.ArchiveStatusRestoreRequested).Order("id").Find(&archives).Error; err != nil {
+		return fmt.Errorf("查询待恢复归档失败: %w", err)
+	}
+	if len(archives) == 0 {
+		return nil
+	}
+	key, keyID, err := loadKey()
+	if err != nil {
+		return err
+	}
+	path := LoadPolicy().Path
+
+	failed := 0
+	for i := range archives {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		archive := &archives[i]
+		if err := restore(archive, key, keyID, path); err != nil {
+			failed++
+			log.Printf("恢复归档 %d 失败: %v", archive.ID, err)
+			database.DB.Model(archive).Updates(map[string]interface{}{
+				"status": models.ArchiveStatusFailed,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		log.Printf("归档 %d 已恢复: %d 条记录", archive.ID, archive.RecordCount)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个归档恢复失败", failed)
+	}
+	return nil
+}
+
+func restore(archive *models.DataArchive, key []byte, keyID, path string) error {
+	if archive.KeyID != keyID {
+		return ErrKeyMismatch
+	}
+	records, err := load(archive, key, path)
+	if err != nil {
+		return err
+	}
+
+	// 先写回附件文件，数据库恢复失败时重试会覆盖
+	for _, r := range records {
+		if r.Table != "files" {
+			continue
+		}
+		var f models.File
+		if err := json.Unmarshal(r.Row, &f); err != nil {
+			return err
+		}
+		if err := writeBack(f.FilePath, r.Data); err != nil {
+			return fmt.Errorf("写回附件 %d 失败: %w", f.ID, err)
+		}
+		if err := writeBack(r.ThumbPath, r.Thumb); err != nil {
+			return fmt.Errorf("写回附件 %d 缩略图失败: %w", f.ID, err)
+		}
+	}
+
+	sessions := map[uint]bool{}
+	var messageIDs []uint
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, r := range records {
+			var err error
+			switch r.Table {
+			case "chat_messages":
+				var m models.ChatMessage
+				if err = insert(tx, r.Row, &m); err == nil {
+					sessions[m.SessionID] = true
+					messageIDs = append(messageIDs, m.ID)
+				}
+			case "chat_message_revisions":
+				err = insert(tx, r.Row, &models.ChatMessageRevision{})
+			case "chat_message_deletions":
+				err = insert(tx, r.Row, &models.ChatMessageDeletion{})
+			case "chat_billings":
+				var b models.ChatBilling
+				if err = insert(tx, r.Row, &b); err == nil {
+					sessions[b.SessionID] = true
+				}
+			case "files":
+				var f models.File
+				if err = json.Unmarshal(r.Row, &f); err != nil {
+					break
+				}
+				f.ThumbPath = r.ThumbPath
+				f.Status = 1
+				// 附件删除时只标记状态，记录通常仍在
+				err = tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+					DoUpdates: clause.AssignmentColumns([]string{"status"}),
+				}).Create(&f).Error
+				if err == nil && f.RelationType == models.FileRelationSession {
+					sessions[f.RelationID] = true
+				}
+			default:
+				err = fmt.Errorf("未知的归档表 %q", r.Table)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		for sessionID := range sessions {
+			if err := holdSession(tx, sessionID, archive); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.Model(archive).Updates(map[string]interface{}{
+			"status":      models.ArchiveStatusRestored,
+			"restored_at": now,
+			"error":       "",
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range messageIDs {
+		if err := search.Sync(id); err != nil {
+			log.Printf("同步消息索引失败: messageID=%d, err=%v", id, err)
+		}
+	}
+	return nil
+}
+
+// insert 按原主键写回记录，已存在（未被删除或已恢复过）时跳过
+func insert(tx *gorm.DB, raw json.RawMessage, row interface{}) error {
+	if err := json.Unmarshal(raw, row); err != nil {
+		return err
+	}
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error
+}
+
+// holdSession 为恢复的会话加法律保留，已有生效中的保留时跳过
+func holdSession(tx *gorm.DB, sessionID uint, archive *models.DataArchive) error {
+	var count int64
+	if err := tx.Model(&models.LegalHold{}).
+		Where("subject_type = ? AND subject_id = ? AND released_at IS NULL", models.LegalHoldSession, sessionID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Create(&models.LegalHold{
+		SubjectType: models.LegalHoldSession,
+		SubjectID:   sessionID,
+		Reason:      fmt.Sprintf("从归档 #%d 恢复", archive.ID),
+		CreatedBy:   archive.RestoreRequestedBy,
+	}).Error
+}
+
+func writeBack(path string, data []byte) error {
+	if path == "" || data == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
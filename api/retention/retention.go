@@ -0,0 +1,508 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/search"
+	"akrick.com/mychat/sysconfig"
+
+	"gorm.io/gorm"
+)
+
+// 聊天数据保留与归档
+// 按 system_configs 中各数据类别的保留天数，将过期数据写入加密归档并校验可读后再删除源数据；
+// 法律保留中的会话（或保留用户参与的会话）不归档也不删除。删除由归档内容驱动，
+// 进程在写入归档后中断时，下次执行会按归档记录补完删除
+
+// 配置键（0 天表示永久保留）
+const (
+	ConfigEnabled        = "retention_enabled"
+	ConfigMessageDays    = "message_retention_days"
+	ConfigAttachmentDays = "attachment_retention_days"
+	ConfigBillingDays    = "billing_retention_days"
+	ConfigStorage        = "archive_storage"
+	ConfigPath           = "archive_path"
+)
+
+// 归档存储方式
+const (
+	StorageLocal  = "local"
+	StorageObject = "object"
+)
+
+const (
+	// 单个附件归档的文件内容上限，超出后剩余文件留到下一个归档
+	maxAttachmentBytes = 64 << 20
+	// 删除时 IN 列表的分块大小
+	chunkSize = 1000
+)
+
+// Policy 保留策略
+type Policy struct {
+	Enabled bool
+	Days    map[string]int
+	Storage string
+	Path    string
+}
+
+// LoadPolicy 读取保留策略，未配置时使用默认值（默认不启用）
+func LoadPolicy() Policy {
+	values := sysconfig.Values(ConfigEnabled, ConfigMessageDays, ConfigAttachmentDays, ConfigBillingDays, ConfigStorage, ConfigPath)
+	return Policy{
+		Enabled: sysconfig.Bool(values, ConfigEnabled, false),
+		Days: map[string]int{
+			models.DataClassMessages:    sysconfig.Int(values, ConfigMessageDays, 90),
+			models.DataClassAttachments: sysconfig.Int(values, ConfigAttachmentDays, 365),
+			models.DataClassBilling:     sysconfig.Int(values, ConfigBillingDays, 1825),
+		},
+		Storage: sysconfig.String(values, ConfigStorage, StorageLocal),
+		Path:    sysconfig.String(values, ConfigPath, "./storage/archive"),
+	}
+}
+
+// class 一个数据类别的归档方式
+type class struct {
+	name  string
+	batch int
+	// candidates 返回一批已过期且不受法律保留限制的主记录ID
+	candidates func(cutoff time.Time, limit int) ([]uint, error)
+	// write 将主记录及附属记录写入归档，返回数据的时间范围
+	write func(ids []uint, enc *encoder) (start, end *time.Time, err error)
+	// purge 按归档内容删除源数据，写入归档后新加法律保留的数据跳过
+	purge func(records []record) error
+}
+
+var classes = []*class{
+	{name: models.DataClassMessages, batch: 100, candidates: messageCandidates, write: writeMessages, purge: purgeMessages},
+	{name: models.DataClassAttachments, batch: 200, candidates: attachmentCandidates, write: writeAttachments, purge: purgeAttachments},
+	{name: models.DataClassBilling, batch: 1000, candidates: billingCandidates, write: writeBilling, purge: purgeBilling},
+}
+
+func classOf(name string) *class {
+	for _, c := range classes {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Run 按保留策略归档并删除过期数据，作为定时任务注册
+func Run(ctx context.Context) error {
+	policy := LoadPolicy()
+	if !policy.Enabled {
+		log.Println("数据保留策略未启用，跳过归档")
+		return nil
+	}
+	key, keyID, err := loadKey()
+	if err != nil {
+		return err
+	}
+	store, err := storeFor(policy.Storage, policy.Path)
+	if err != nil {
+		return err
+	}
+
+	// 先补完上次中断的删除
+	var pending []models.DataArchive
+	if err := database.DB.Where("status = ?", models.ArchiveStatusArchived).Order("id").Find(&pending).Error; err != nil {
+		return fmt.Errorf("查询待删除归档失败: %w", err)
+	}
+	for i := range pending {
+		if err := purge(&pending[i], key, policy.Path); err != nil {
+			return fmt.Errorf("归档 %d 删除源数据失败: %w", pending[i].ID, err)
+		}
+	}
+
+	var errs []error
+	for _, c := range classes {
+		days := policy.Days[c.name]
+		if days <= 0 {
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+		archived, err := runClass(ctx, c, cutoff, store, policy, key, keyID)
+		if archived > 0 {
+			log.Printf("%s 归档完成: %d 条记录", c.name, archived)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runClass 分批归档一个类别，直到没有过期数据或任务超时
+func runClass(ctx context.Context, c *class, cutoff time.Time, store Store, policy Policy, key []byte, keyID string) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		ids, err := c.candidates(cutoff, c.batch)
+		if err != nil {
+			return total, fmt.Errorf("查询过期数据失败: %w", err)
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		enc := newEncoder()
+		start, end, err := c.write(ids, enc)
+		if err != nil {
+			return total, fmt.Errorf("读取过期数据失败: %w", err)
+		}
+		if enc.count == 0 {
+			return total, nil
+		}
+		data, err := enc.finish(key)
+		if err != nil {
+			return total, fmt.Errorf("生成归档失败: %w", err)
+		}
+
+		now := time.Now()
+		name := fmt.Sprintf("%s/%s/%s-%d.jsonl.gz.enc", c.name, now.Format("200601"), c.name, now.UnixNano())
+		location, err := store.Put(name, data)
+		if err != nil {
+			return total, fmt.Errorf("保存归档失败: %w", err)
+		}
+		archive := models.DataArchive{
+			DataClass:   c.name,
+			Storage:     policy.Storage,
+			Location:    location,
+			RecordCount: enc.count,
+			SizeBytes:   int64(len(data)),
+			SHA256:      checksum(data),
+			KeyID:       keyID,
+			RangeStart:  start,
+			RangeEnd:    end,
+			Status:      models.ArchiveStatusArchived,
+		}
+		if err := database.DB.Create(&archive).Error; err != nil {
+			return total, fmt.Errorf("保存归档记录失败: %w", err)
+		}
+		if err := purge(&archive, key, policy.Path); err != nil {
+			return total, fmt.Errorf("归档 %d 删除源数据失败: %w", archive.ID, err)
+		}
+		total += enc.count
+	}
+	return total, ctx.Err()
+}
+
+// purge 从存储读回归档并校验，确认可以解密后按其内容删除源数据
+func purge(archive *models.DataArchive, key []byte, path string) error {
+	records, err := load(archive, key, path)
+	if err != nil {
+		return err
+	}
+	c := classOf(archive.DataClass)
+	if c == nil {
+		return fmt.Errorf("未知的数据类别 %q", archive.DataClass)
+	}
+	if err := c.purge(records); err != nil {
+		return err
+	}
+	now := time.Now()
+	return database.DB.Model(archive).Updates(map[string]interface{}{
+		"status":    models.ArchiveStatusPurged,
+		"purged_at": now,
+	}).Error
+}
+
+// load 读取并解密归档，校验文件摘要和记录数
+func load(archive *models.DataArchive, key []byte, path string) ([]record, error) {
+	store, err := storeFor(archive.Storage, path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.Get(archive.Location)
+	if err != nil {
+		return nil, fmt.Errorf("读取归档文件失败: %w", err)
+	}
+	if checksum(data) != archive.SHA256 {
+		return nil, errors.New("归档文件摘要不一致")
+	}
+	records, err := decode(data, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != archive.RecordCount {
+		return nil, fmt.Errorf("归档记录数不一致: 期望 %d, 实际 %d", archive.RecordCount, len(records))
+	}
+	return records, nil
+}
+
+// notHeld 返回会话ID列不受法律保留限制的条件：会话本身、会话用户或咨询师对应的用户均未被保留
+func notHeld(column string) string {
+	heldUsers := fmt.Sprintf("SELECT subject_id FROM legal_holds WHERE subject_type = '%s' AND released_at IS NULL", models.LegalHoldUser)
+	return fmt.Sprintf("%s NOT IN (SELECT subject_id FROM legal_holds WHERE subject_type = '%s' AND released_at IS NULL) AND "+
+		"%s NOT IN (SELECT id FROM chat_sessions WHERE user_id IN (%s) OR counselor_id IN (SELECT id FROM counselors WHERE user_id IN (%s)))",
+		column, models.LegalHoldSession, column, heldUsers, heldUsers)
+}
+
+// 已结束（2）或已超时（3）的会话
+var endedSessionStatus = []int{2, 3}
+
+// ---- 消息 ----
+
+// messageCandidates 按会话归档：会话结束超过保留期且仍有消息
+func messageCandidates(cutoff time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Model(&models.ChatSession{}).
+		Where("status IN ? AND COALESCE(end_time, updated_at) < ?", endedSessionStatus, cutoff).
+		Where("EXISTS (SELECT 1 FROM chat_messages WHERE chat_messages.session_id = chat_sessions.id)").
+		Where(notHeld("id")).
+		Order("id").Limit(limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func writeMessages(sessionIDs []uint, enc *encoder) (*time.Time, *time.Time, error) {
+	var messages []models.ChatMessage
+	if err := database.DB.Where("session_id IN ?", sessionIDs).Order("id").Find(&messages).Error; err != nil {
+		return nil, nil, err
+	}
+	var start, end *time.Time
+	messageIDs := make([]uint, 0, len(messages))
+	for i := range messages {
+		m := &messages[i]
+		if err := enc.add("chat_messages", m); err != nil {
+			return nil, nil, err
+		}
+		messageIDs = append(messageIDs, m.ID)
+		start, end = widen(start, end, m.CreatedAt)
+	}
+
+	var revisions []models.ChatMessageRevision
+	if err := database.DB.Where("session_id IN ?", sessionIDs).Order("id").Find(&revisions).Error; err != nil {
+		return nil, nil, err
+	}
+	for i := range revisions {
+		if err := enc.add("chat_message_revisions", &revisions[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, chunk := range chunks(messageIDs) {
+		var deletions []models.ChatMessageDeletion
+		if err := database.DB.Where("message_id IN ?", chunk).Order("id").Find(&deletions).Error; err != nil {
+			return nil, nil, err
+		}
+		for i := range deletions {
+			if err := enc.add("chat_message_deletions", &deletions[i]); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return start, end, nil
+}
+
+func purgeMessages(records []record) error {
+	ids := recordIDs(records, "chat_messages")
+	var purged []uint
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, chunk := range chunks(ids) {
+			var deletable []uint
+			if err := tx.Model(&models.ChatMessage{}).Where("id IN ?", chunk).Where(notHeld("session_id")).
+				Pluck("id", &deletable).Error; err != nil {
+				return err
+			}
+			if len(deletable) == 0 {
+				continue
+			}
+			if err := tx.Where("message_id IN ?", deletable).Delete(&models.ChatMessageRevision{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("message_id IN ?", deletable).Delete(&models.ChatMessageDeletion{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", deletable).Delete(&models.ChatMessage{}).Error; err != nil {
+				return err
+			}
+			purged = append(purged, deletable...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range purged {
+		if err := search.Sync(id); err != nil {
+			log.Printf("同步消息索引失败: messageID=%d, err=%v", id, err)
+		}
+	}
+	return nil
+}
+
+// ---- 附件 ----
+
+// attachmentCandidates 已结束会话中上传超过保留期的附件
+func attachmentCandidates(cutoff time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Model(&models.File{}).
+		Where("relation_type = ? AND status = 1 AND created_at < ?", models.FileRelationSession, cutoff).
+		Where("relation_id IN (SELECT id FROM chat_sessions WHERE status IN ?)", endedSessionStatus).
+		Where(notHeld("relation_id")).
+		Order("id").Limit(limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func writeAttachments(ids []uint, enc *encoder) (*time.Time, *time.Time, error) {
+	var files []models.File
+	if err := database.DB.Where("id IN ?", ids).Order("id").Find(&files).Error; err != nil {
+		return nil, nil, err
+	}
+	var start, end *time.Time
+	size := 0
+	for i := range files {
+		f := &files[i]
+		data, err := os.ReadFile(f.FilePath)
+		if err != nil {
+			// 文件已丢失时仍归档元数据，删除后与文件丢失的状态一致
+			log.Printf("读取附件失败，仅归档元数据: fileID=%d, err=%v", f.ID, err)
+		}
+		var thumb []byte
+		if f.ThumbPath != "" {
+			thumb, _ = os.ReadFile(f.ThumbPath)
+		}
+		if size > 0 && size+len(data)+len(thumb) > maxAttachmentBytes {
+			break
+		}
+		size += len(data) + len(thumb)
+		if err := enc.addFile(f, data, thumb); err != nil {
+			return nil, nil, err
+		}
+		start, end = widen(start, end, f.CreatedAt)
+	}
+	return start, end, nil
+}
+
+func purgeAttachments(records []record) error {
+	type filePaths struct{ file, thumb string }
+	paths := make(map[uint]filePaths)
+	ids := make([]uint, 0, len(records))
+	for _, r := range records {
+		if r.Table != "files" {
+			continue
+		}
+		var f models.File
+		if err := json.Unmarshal(r.Row, &f); err != nil {
+			return err
+		}
+		paths[f.ID] = filePaths{file: f.FilePath, thumb: r.ThumbPath}
+		ids = append(ids, f.ID)
+	}
+
+	var purged []uint
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, chunk := range chunks(ids) {
+			var deletable []uint
+			if err := tx.Model(&models.File{}).Where("id IN ? AND status = 1", chunk).Where(notHeld("relation_id")).
+				Pluck("id", &deletable).Error; err != nil {
+				return err
+			}
+			if len(deletable) == 0 {
+				continue
+			}
+			if err := tx.Model(&models.File{}).Where("id IN ?", deletable).Update("status", 0).Error; err != nil {
+				return err
+			}
+			purged = append(purged, deletable...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// 数据库标记删除后再删文件，删除失败只留下孤立文件，不影响数据一致性
+	for _, id := range purged {
+		p := paths[id]
+		os.Remove(p.file)
+		if p.thumb != "" {
+			os.Remove(p.thumb)
+		}
+	}
+	return nil
+}
+
+// ---- 计费记录 ----
+
+// billingCandidates 结算超过保留期的计费记录
+func billingCandidates(cutoff time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Model(&models.ChatBilling{}).
+		Where("status = 1 AND settled_at < ?", cutoff).
+		Where(notHeld("session_id")).
+		Order("id").Limit(limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func writeBilling(ids []uint, enc *encoder) (*time.Time, *time.Time, error) {
+	var billings []models.ChatBilling
+	if err := database.DB.Where("id IN ?", ids).Order("id").Find(&billings).Error; err != nil {
+		return nil, nil, err
+	}
+	var start, end *time.Time
+	for i := range billings {
+		if err := enc.add("chat_billings", &billings[i]); err != nil {
+			return nil, nil, err
+		}
+		start, end = widen(start, end, billings[i].CreatedAt)
+	}
+	return start, end, nil
+}
+
+func purgeBilling(records []record) error {
+	ids := recordIDs(records, "chat_billings")
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, chunk := range chunks(ids) {
+			if err := tx.Where("id IN ?", chunk).Where(notHeld("session_id")).Delete(&models.ChatBilling{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordIDs 取出归档中某张表记录的主键
+func recordIDs(records []record, table string) []uint {
+	ids := make([]uint, 0, len(records))
+	for _, r := range records {
+		if r.Table != table {
+			continue
+		}
+		var row struct {
+			ID uint `json:"id"`
+		}
+		if json.Unmarshal(r.Row, &row) == nil && row.ID != 0 {
+			ids = append(ids, row.ID)
+		}
+	}
+	return ids
+}
+
+func chunks(ids []uint) [][]uint {
+	var out [][]uint
+	for len(ids) > chunkSize {
+		out = append(out, ids[:chunkSize])
+		ids = ids[chunkSize:]
+	}
+	if len(ids) > 0 {
+		out = append(out, ids)
+	}
+	return out
+}
+
+func widen(start, end *time.Time, t time.Time) (*time.Time, *time.Time) {
+	if start == nil || t.Before(*start) {
+		start = &t
+	}
+	if end == nil || t.After(*end) {
+		end = &t
+	}
+	return start, end
+}
@@ -0,0 +1,162 @@
+package review
+
+import (
+	"fmt"
+	"strings"
+
+	"akrick.com/mychat/counselorstats"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/sysconfig"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Report 用户或咨询师（counselorID 非 0）举报公开显示的评价；待处理举报达到阈值时评价转为待审核，等待管理员处理
+func Report(reporterID, counselorID, reviewID uint, reason, detail string) (*models.ReviewReport, error) {
+	threshold := sysconfig.Int(sysconfig.Values(ConfigReportHoldThreshold), ConfigReportHoldThreshold, 3)
+	var report models.ReviewReport
+	var reviewCounselorID uint
+	var notice *models.Notification
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var rv models.Review
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&rv, reviewID).Error; err != nil {
+			return ErrNotFound
+		}
+		if rv.Status != models.ReviewStatusVisible {
+			return ErrNotVisible
+		}
+		reporterType := models.OrderActorUser
+		if counselorID != 0 && counselorID == rv.CounselorID {
+			reporterType = models.OrderActorCounselor
+		}
+		reviewCounselorID = rv.CounselorID
+
+		var count int64
+		tx.Model(&models.ReviewReport{}).Where("review_id = ? AND reporter_id = ?", rv.ID, reporterID).Count(&count)
+		if count > 0 {
+			return ErrReported
+		}
+		report = models.ReviewReport{
+			ReviewID:     rv.ID,
+			ReporterID:   reporterID,
+			ReporterType: reporterType,
+			Reason:       reason,
+			Detail:       detail,
+			Status:       models.ReviewCaseStatusPending,
+		}
+		if err := tx.Create(&report).Error; err != nil {
+			return err
+		}
+
+		if threshold <= 0 {
+			return nil
+		}
+		tx.Model(&models.ReviewReport{}).Where("review_id = ? AND status = ?", rv.ID, models.ReviewCaseStatusPending).Count(&count)
+		if count < int64(threshold) {
+			return nil
+		}
+		before := counselorstats.StateOf(&rv)
+		rv.Status = models.ReviewStatusPending
+		if err := tx.Model(&rv).Update("status", rv.Status).Error; err != nil {
+			return err
+		}
+		if err := counselorstats.ReviewChanged(tx, rv.CounselorID, before, counselorstats.StateOf(&rv)); err != nil {
+			return err
+		}
+		return hold(tx, &rv, models.ReviewStatusVisible, models.ReviewActionReportHold,
+			fmt.Sprintf("待处理举报达到 %d 条", count), &notice)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if notice != nil {
+		afterChange(reviewCounselorID, notice)
+	}
+	return &report, nil
+}
+
+// Appeal 咨询师申诉自己收到的评价（每条评价只能申诉一次），由管理员裁定是否隐藏
+func Appeal(counselorID, reviewID uint, reason string) (*models.ReviewAppeal, error) {
+	var appeal models.ReviewAppeal
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var rv models.Review
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&rv, reviewID).Error; err != nil {
+			return ErrNotFound
+		}
+		if rv.CounselorID != counselorID {
+			return ErrForbidden
+		}
+		if rv.Status == models.ReviewStatusHidden {
+			return ErrHidden
+		}
+		var count int64
+		tx.Model(&models.ReviewAppeal{}).Where("review_id = ?", rv.ID).Count(&count)
+		if count > 0 {
+			return ErrAppealed
+		}
+		appeal = models.ReviewAppeal{
+			ReviewID:    rv.ID,
+			CounselorID: counselorID,
+			Reason:      reason,
+			Status:      models.ReviewCaseStatusPending,
+		}
+		return tx.Create(&appeal).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &appeal, nil
+}
+
+// screen 按配置自动检查评价内容
+func screen(content string) []string {
+	if !sysconfig.Bool(sysconfig.Values(ConfigAutoScreen), ConfigAutoScreen, true) {
+		return nil
+	}
+	return Screen(content)
+}
+
+// hold 记录转为待审核的决定并通知评价者
+func hold(tx *gorm.DB, rv *models.Review, fromStatus int, action, reason string, notice **models.Notification) error {
+	if err := tx.Create(&models.ReviewDecision{
+		ReviewID:   rv.ID,
+		Action:     action,
+		ActorType:  models.OrderActorSystem,
+		Reason:     reason,
+		FromStatus: fromStatus,
+		ToStatus:   rv.Status,
+	}).Error; err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf("您对订单 %s 的评价正在审核中，审核通过后公开显示", rv.OrderNo)
+	if action == models.ReviewActionAutoHold {
+		content = fmt.Sprintf("您对订单 %s 的评价可能包含%s，审核通过后公开显示；您也可以在修改期限内修改评价",
+			rv.OrderNo, flagNames(rv.ModerationFlags))
+	}
+	*notice = &models.Notification{
+		UserID:  rv.UserID,
+		Type:    models.NotificationTypeReview,
+		Level:   models.NotificationLevelWarning,
+		Title:   "评价待审核",
+		Content: content,
+	}
+	return tx.Create(*notice).Error
+}
+
+func flagNames(flags string) string {
+	names := map[string]string{
+		models.ReviewFlagContact:   "联系方式",
+		models.ReviewFlagProfanity: "敏感词",
+		models.ReviewFlagIdentity:  "身份信息",
+	}
+	var out []string
+	for _, f := range strings.Split(flags, ",") {
+		if name, ok := names[f]; ok {
+			out = append(out, name)
+		}
+	}
+	return strings.Join(out, "、")
+}
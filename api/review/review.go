@@ -0,0 +1,276 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/counselorstats"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/notify"
+	"akrick.com/mychat/sysconfig"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 咨询评价
+// 用户在订单完成后的评价期限内提交评价，提交后的修改期限内可修改；咨询师可回复；
+// 提交和修改时自动检查内容（见 screen.go），用户和咨询师可举报、咨询师可申诉（见 report.go），
+// 待审核的评价由管理后台通过、隐藏或打码（见 admin/backend/handlers/review.go），每次决定记入 ReviewDecision。
+// 咨询师评分只统计公开显示的评价，评价变更时按增量更新（见 counselorstats）
+
+// 配置键（0 表示不限）
+const (
+	ConfigWindowDays          = "review_window_days"           // 订单完成后多少天内可评价
+	ConfigEditHours           = "review_edit_hours"            // 评价提交后多少小时内可修改
+	ConfigAutoScreen          = "review_auto_screen"           // 是否自动检查评价内容
+	ConfigReportHoldThreshold = "review_report_hold_threshold" // 待处理举报达到多少条时转为待审核
+)
+
+var (
+	ErrOrderNotFound = errors.New("订单不存在")
+	ErrNotFound      = errors.New("评价不存在")
+	ErrForbidden     = errors.New("无权操作此评价")
+	ErrNotCompleted  = errors.New("咨询完成后才能评价")
+	ErrReviewed      = errors.New("该订单已评价")
+	ErrWindowClosed  = errors.New("已超过评价期限")
+	ErrEditClosed    = errors.New("已超过修改期限")
+	ErrHidden        = errors.New("评价已被管理员隐藏，不能修改")
+	ErrNotVisible    = errors.New("评价未公开显示")
+	ErrReported      = errors.New("您已举报过该评价")
+	ErrAppealed      = errors.New("每条评价只能申诉一次")
+)
+
+// IsReviewError 是否为评价业务错误（用于映射为 4xx）
+func IsReviewError(err error) bool {
+	for _, e := range []error{ErrOrderNotFound, ErrNotFound, ErrForbidden, ErrNotCompleted, ErrReviewed,
+		ErrWindowClosed, ErrEditClosed, ErrHidden, ErrNotVisible, ErrReported, ErrAppealed} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Input 用户提交或修改的评价内容
+type Input struct {
+	Rating          int
+	ServiceRating   int
+	Professionalism int
+	Effectiveness   int
+	Content         string
+	IsAnonymous     bool
+}
+
+// Windows 返回评价期限（天）和修改期限（小时）
+func Windows() (windowDays, editHours int) {
+	values := sysconfig.Values(ConfigWindowDays, ConfigEditHours)
+	return sysconfig.Int(values, ConfigWindowDays, 30), sysconfig.Int(values, ConfigEditHours, 72)
+}
+
+// Create 用户评价已完成的咨询订单
+func Create(userID, orderID uint, in Input) (*models.Review, error) {
+	windowDays, _ := Windows()
+	var rv models.Review
+	var notice *models.Notification
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return ErrOrderNotFound
+		}
+		if order.UserID != userID {
+			return ErrForbidden
+		}
+		if order.Type != models.OrderTypeSession || order.Status != models.OrderStatusCompleted {
+			return ErrNotCompleted
+		}
+		if windowDays > 0 && time.Since(completedAt(tx, &order)) > time.Duration(windowDays)*24*time.Hour {
+			return ErrWindowClosed
+		}
+		var count int64
+		tx.Model(&models.Review{}).Where("order_id = ?", order.ID).Count(&count)
+		if count > 0 {
+			return ErrReviewed
+		}
+
+		rv = models.Review{
+			OrderID:     order.ID,
+			OrderNo:     order.OrderNo,
+			UserID:      userID,
+			CounselorID: order.CounselorID,
+			Status:      models.ReviewStatusVisible,
+		}
+		apply(&rv, in)
+		flags := screen(rv.Content)
+		if len(flags) > 0 {
+			rv.Status = models.ReviewStatusPending
+			rv.ModerationFlags = strings.Join(flags, ",")
+		}
+		if err := tx.Create(&rv).Error; err != nil {
+			return err
+		}
+		if err := counselorstats.ReviewChanged(tx, order.CounselorID, counselorstats.ReviewState{}, counselorstats.StateOf(&rv)); err != nil {
+			return err
+		}
+		if len(flags) > 0 {
+			// 待审核期间不通知咨询师
+			return hold(tx, &rv, models.ReviewStatusVisible, models.ReviewActionAutoHold, "自动检查命中: "+rv.ModerationFlags, &notice)
+		}
+
+		var counselorUserID uint
+		tx.Model(&models.Counselor{}).Select("user_id").Where("id = ?", order.CounselorID).Scan(&counselorUserID)
+		if counselorUserID != 0 {
+			notice = &models.Notification{
+				UserID:  counselorUserID,
+				Type:    models.NotificationTypeReview,
+				Level:   models.NotificationLevelInfo,
+				Title:   "收到新的评价",
+				Content: fmt.Sprintf("订单 %s 的用户给出了 %d 星评价", order.OrderNo, rv.Rating),
+			}
+			return tx.Create(notice).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	afterChange(rv.CounselorID, notice)
+	return &rv, nil
+}
+
+// Update 用户在修改期限内修改自己的评价
+func Update(userID, reviewID uint, in Input) (*models.Review, error) {
+	_, editHours := Windows()
+	var rv models.Review
+	var notice *models.Notification
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&rv, reviewID).Error; err != nil {
+			return ErrNotFound
+		}
+		if rv.UserID != userID {
+			return ErrForbidden
+		}
+		if rv.Status == models.ReviewStatusHidden {
+			return ErrHidden
+		}
+		if editHours > 0 && time.Since(rv.CreatedAt) > time.Duration(editHours)*time.Hour {
+			return ErrEditClosed
+		}
+
+		before := counselorstats.StateOf(&rv)
+		fromStatus := rv.Status
+		now := time.Now()
+		apply(&rv, in)
+		rv.EditCount++
+		rv.EditedAt = &now
+		// 修改后仍命中时（重新）转为待审核；待审核的评价修改后仍由管理员处理
+		flags := screen(rv.Content)
+		if len(flags) > 0 {
+			rv.Status = models.ReviewStatusPending
+			rv.ModerationFlags = strings.Join(flags, ",")
+		}
+		if err := tx.Model(&rv).Select("rating", "service_rating", "professionalism", "effectiveness", "content",
+			"is_anonymous", "edit_count", "edited_at", "status", "moderation_flags").Updates(&rv).Error; err != nil {
+			return err
+		}
+		if err := counselorstats.ReviewChanged(tx, rv.CounselorID, before, counselorstats.StateOf(&rv)); err != nil {
+			return err
+		}
+		if len(flags) > 0 {
+			return hold(tx, &rv, fromStatus, models.ReviewActionAutoHold, "修改后自动检查命中: "+rv.ModerationFlags, &notice)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	afterChange(rv.CounselorID, notice)
+	return &rv, nil
+}
+
+// Reply 咨询师回复评价，重复回复覆盖之前的内容
+func Reply(counselorID, reviewID uint, content string) (*models.Review, error) {
+	var rv models.Review
+	var notice *models.Notification
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&rv, reviewID).Error; err != nil {
+			return ErrNotFound
+		}
+		if rv.CounselorID != counselorID {
+			return ErrForbidden
+		}
+		first := rv.ReplyTime == nil
+		now := time.Now()
+		rv.ReplyContent = content
+		rv.ReplyTime = &now
+		if err := tx.Model(&rv).Updates(map[string]interface{}{
+			"reply_content": content,
+			"reply_time":    now,
+		}).Error; err != nil {
+			return err
+		}
+		if !first {
+			return nil
+		}
+		notice = &models.Notification{
+			UserID:  rv.UserID,
+			Type:    models.NotificationTypeReview,
+			Level:   models.NotificationLevelInfo,
+			Title:   "咨询师回复了您的评价",
+			Content: fmt.Sprintf("您对订单 %s 的评价收到了咨询师的回复", rv.OrderNo),
+		}
+		return tx.Create(notice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	afterChange(rv.CounselorID, notice)
+	return &rv, nil
+}
+
+// Mask 隐藏匿名评价的用户信息，评价者本人查看时保留
+func Mask(reviews []models.Review, viewerID uint) {
+	for i := range reviews {
+		if reviews[i].IsAnonymous && reviews[i].UserID != viewerID {
+			reviews[i].UserID = 0
+			reviews[i].User = models.User{Username: "匿名用户"}
+		}
+	}
+}
+
+// completedAt 订单完成时间：取完成事件的时间，缺失时（早期订单）按最后更新时间
+func completedAt(tx *gorm.DB, order *models.Order) time.Time {
+	var event models.OrderEvent
+	err := tx.Where("order_id = ? AND event = ?", order.ID, models.OrderEventComplete).
+		Order("id DESC").First(&event).Error
+	if err != nil {
+		return order.UpdatedAt
+	}
+	return event.CreatedAt
+}
+
+func apply(rv *models.Review, in Input) {
+	rv.Rating = in.Rating
+	rv.ServiceRating = in.ServiceRating
+	rv.Professionalism = in.Professionalism
+	rv.Effectiveness = in.Effectiveness
+	rv.Content = in.Content
+	rv.IsAnonymous = in.IsAnonymous
+}
+
+func afterChange(counselorID uint, notice *models.Notification) {
+	if notice != nil {
+		notify.Deliver(*notice)
+	}
+	if cache.Rdb != nil {
+		if err := cache.DeleteCounselorCache(context.Background(), counselorID); err != nil {
+			log.Printf("清除咨询师缓存失败: counselorID=%d, err=%v", counselorID, err)
+		}
+	}
+}
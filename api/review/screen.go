@@ -0,0 +1,51 @@
+package review
+
+import (
+	"regexp"
+	"strings"
+
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/moderation"
+)
+
+// 评价内容自动检查：命中联系方式、敏感词或身份信息的评价转为待审核，由管理员通过、隐藏或打码后公开
+
+var (
+	// 数字之间的空格、横线、点等分隔符先去掉，识别"138 1234 5678"一类写法
+	digitSeparators = regexp.MustCompile(`(\d)[\s\-－—.·]+(\d)`)
+
+	phonePattern    = regexp.MustCompile(`(^|\D)1[3-9]\d{9}(\D|$)`)
+	emailPattern    = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	urlPattern      = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+	imPattern       = regexp.MustCompile(`(?i)(微信|威信|v信|vx|wx|weixin|wechat|qq|扣扣)\s*(号)?\s*[:：]?\s*[A-Za-z0-9_\-]{5,}`)
+	idCardPattern   = regexp.MustCompile(`(^|\D)\d{17}[\dXx](\D|$)`)
+	bankCardPattern = regexp.MustCompile(`(^|\D)\d{16,19}(\D|$)`)
+)
+
+// Screen 检查评价内容，返回命中的类型（models.ReviewFlag*），未命中返回空
+func Screen(content string) []string {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	compact := content
+	for {
+		next := digitSeparators.ReplaceAllString(compact, "$1$2")
+		if next == compact {
+			break
+		}
+		compact = next
+	}
+
+	var flags []string
+	if phonePattern.MatchString(compact) || emailPattern.MatchString(content) ||
+		urlPattern.MatchString(content) || imPattern.MatchString(content) {
+		flags = append(flags, models.ReviewFlagContact)
+	}
+	if len(moderation.Check(content).Matches) > 0 {
+		flags = append(flags, models.ReviewFlagProfanity)
+	}
+	if idCardPattern.MatchString(compact) || bankCardPattern.MatchString(compact) {
+		flags = append(flags, models.ReviewFlagIdentity)
+	}
+	return flags
+}
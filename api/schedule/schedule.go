@@ -0,0 +1,395 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 咨询师排班与预约
+// 可预约时段 = 每周模板（或默认时段）+ 额外时段 - 休息 - 已占用时段（前后各加缓冲时间）
+// 预约时锁定咨询师的排班设置行再校验并写入占用记录，多实例并发预约同一时段只有一个成功
+
+const (
+	DateLayout  = "2006-01-02"
+	ClockLayout = "15:04"
+
+	// MaxRangeDays 单次查询可预约时段的最大天数
+	MaxRangeDays = 31
+)
+
+// 排班设置默认值（与 CounselorScheduleSetting 的数据库默认值一致）
+const (
+	DefaultBufferMinutes    = 10
+	DefaultSlotStepMinutes  = 30
+	DefaultMinNoticeMinutes = 120
+	DefaultMaxAdvanceDays   = 30
+)
+
+var (
+	ErrSlotUnavailable = errors.New("该时段不可预约，请选择其他时间")
+	ErrTooSoon         = errors.New("预约时间距现在过近")
+	ErrTooFar          = errors.New("预约时间超出可预约范围")
+	ErrInvalidClock    = errors.New("时间格式错误，应为 HH:MM")
+	ErrInvalidWindow   = errors.New("结束时间必须晚于开始时间")
+	ErrInvalidRange    = fmt.Errorf("查询范围不能超过%d天", MaxRangeDays)
+)
+
+// Window 一天内的时段（HH:MM，结束时间可为 24:00）
+type Window struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+// DefaultWindows 尚未配置每周模板的咨询师按每天 09:00-21:00 开放预约
+var DefaultWindows = []Window{{StartTime: "09:00", EndTime: "21:00"}}
+
+// Slot 一个可预约时段
+type Slot struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+func (a interval) overlaps(b interval) bool {
+	return a.start.Before(b.end) && b.start.Before(a.end)
+}
+
+func (a interval) contains(b interval) bool {
+	return !b.start.Before(a.start) && !b.end.After(a.end)
+}
+
+// plan 某咨询师在一段时间内的可用时段和已占用时段
+type plan struct {
+	setting models.CounselorScheduleSetting
+	open    []interval
+	busy    []interval // 已含缓冲时间
+}
+
+// ParseClock 解析 HH:MM 为当天分钟数，允许 24:00
+func ParseClock(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse(ClockLayout, s)
+	if err != nil {
+		return 0, ErrInvalidClock
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidateWindow 校验时段格式和先后顺序
+func ValidateWindow(w Window) error {
+	start, err := ParseClock(w.StartTime)
+	if err != nil {
+		return err
+	}
+	end, err := ParseClock(w.EndTime)
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		return ErrInvalidWindow
+	}
+	return nil
+}
+
+// Settings 返回咨询师的排班设置，未设置时返回默认值
+func Settings(db *gorm.DB, counselorID uint) models.CounselorScheduleSetting {
+	setting := models.CounselorScheduleSetting{
+		CounselorID:      counselorID,
+		BufferMinutes:    DefaultBufferMinutes,
+		SlotStepMinutes:  DefaultSlotStepMinutes,
+		MinNoticeMinutes: DefaultMinNoticeMinutes,
+		MaxAdvanceDays:   DefaultMaxAdvanceDays,
+	}
+	db.Where("counselor_id = ?", counselorID).First(&setting)
+	return setting
+}
+
+// Slots 返回 [from, to) 日期范围内可预约的时段，duration 为咨询时长（分钟）
+func Slots(counselorID uint, from, to time.Time, duration int) ([]Slot, error) {
+	if to.Sub(from) > MaxRangeDays*24*time.Hour {
+		return nil, ErrInvalidRange
+	}
+	p, err := load(database.DB, counselorID, from, to, Settings(database.DB, counselorID))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	length := time.Duration(duration) * time.Minute
+	step := time.Duration(p.setting.SlotStepMinutes) * time.Minute
+	if step <= 0 {
+		step = DefaultSlotStepMinutes * time.Minute
+	}
+
+	slots := make([]Slot, 0)
+	for _, w := range p.open {
+		for t := w.start; !t.Add(length).After(w.end); t = t.Add(step) {
+			candidate := interval{t, t.Add(length)}
+			if p.check(candidate, now) == nil {
+				slots = append(slots, Slot{StartTime: candidate.start, EndTime: candidate.end})
+			}
+		}
+	}
+	return slots, nil
+}
+
+// AvailableWithin 咨询师在 within 时间内是否有可开始的时段（duration 为咨询时长，分钟），用于列表按近期可约筛选
+func AvailableWithin(counselorID uint, within time.Duration, duration int) (bool, error) {
+	now := time.Now()
+	deadline := now.Add(within)
+	p, err := load(database.DB, counselorID, now, deadline.AddDate(0, 0, 1), Settings(database.DB, counselorID))
+	if err != nil {
+		return false, err
+	}
+
+	length := time.Duration(duration) * time.Minute
+	step := time.Duration(p.setting.SlotStepMinutes) * time.Minute
+	if step <= 0 {
+		step = DefaultSlotStepMinutes * time.Minute
+	}
+	for _, w := range p.open {
+		for t := w.start; !t.Add(length).After(w.end) && !t.After(deadline); t = t.Add(step) {
+			if p.check(interval{t, t.Add(length)}, now) == nil {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Utilization 咨询师在 [from, to) 内的开放时长和已预约时长（分钟），from、to 须为整天的零点；
+// 开放时长按每周模板和排班例外计算，已预约时长不含缓冲时间，用于工作台统计时段利用率
+func Utilization(counselorID uint, from, to time.Time) (open, booked int, err error) {
+	p, err := load(database.DB, counselorID, from, to, Settings(database.DB, counselorID))
+	if err != nil {
+		return 0, 0, err
+	}
+	span := interval{from, to}
+	for _, w := range p.open {
+		open += clipMinutes(w, span)
+	}
+
+	var bookings []models.CounselorBooking
+	if err := database.DB.Where("counselor_id = ? AND status = ? AND start_time < ? AND end_time > ?", counselorID,
+		models.BookingStatusActive, to, from).Find(&bookings).Error; err != nil {
+		return 0, 0, err
+	}
+	for _, b := range bookings {
+		booked += clipMinutes(interval{b.StartTime, b.EndTime}, span)
+	}
+	return open, booked, nil
+}
+
+// clipMinutes 区间 a 落在 span 内的分钟数
+func clipMinutes(a, span interval) int {
+	if !a.overlaps(span) {
+		return 0
+	}
+	start, end := a.start, a.end
+	if start.Before(span.start) {
+		start = span.start
+	}
+	if end.After(span.end) {
+		end = span.end
+	}
+	return int(end.Sub(start) / time.Minute)
+}
+
+// Book 为订单占用时段，须在创建订单的事务内调用
+// 锁定咨询师排班设置行后校验，保证同一咨询师的预约串行执行
+func Book(tx *gorm.DB, order *models.Order) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.CounselorScheduleSetting{CounselorID: order.CounselorID}).Error; err != nil {
+		return err
+	}
+	var setting models.CounselorScheduleSetting
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("counselor_id = ?", order.CounselorID).First(&setting).Error; err != nil {
+		return err
+	}
+
+	start := order.ScheduleTime
+	end := start.Add(time.Duration(order.Duration) * time.Minute)
+	day := dayOf(start)
+	p, err := load(tx, order.CounselorID, day, dayOf(end).AddDate(0, 0, 1), setting)
+	if err != nil {
+		return err
+	}
+	if err := p.check(interval{start, end}, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Create(&models.CounselorBooking{
+		CounselorID: order.CounselorID,
+		OrderID:     order.ID,
+		StartTime:   start,
+		EndTime:     end,
+		Status:      models.BookingStatusActive,
+	}).Error
+}
+
+// Rebook 改约时释放订单原时段并按新的预约时间重新占用，须在同一事务内调用
+func Rebook(tx *gorm.DB, order *models.Order) error {
+	if err := tx.Where("order_id = ?", order.ID).Delete(&models.CounselorBooking{}).Error; err != nil {
+		return err
+	}
+	return Book(tx, order)
+}
+
+// check 校验候选时段：在开放时段内、满足提前量且不与已占用时段冲突
+func (p *plan) check(candidate interval, now time.Time) error {
+	if candidate.start.Before(now.Add(time.Duration(p.setting.MinNoticeMinutes) * time.Minute)) {
+		return ErrTooSoon
+	}
+	if candidate.start.After(now.AddDate(0, 0, p.setting.MaxAdvanceDays)) {
+		return ErrTooFar
+	}
+	inside := false
+	for _, w := range p.open {
+		if w.contains(candidate) {
+			inside = true
+			break
+		}
+	}
+	if !inside {
+		return ErrSlotUnavailable
+	}
+	for _, b := range p.busy {
+		if b.overlaps(candidate) {
+			return ErrSlotUnavailable
+		}
+	}
+	return nil
+}
+
+// load 加载 [from, to) 日期范围内的开放时段和已占用时段
+func load(db *gorm.DB, counselorID uint, from, to time.Time, setting models.CounselorScheduleSetting) (*plan, error) {
+	from, to = dayOf(from), dayOf(to)
+	p := &plan{setting: setting}
+
+	var templates []models.CounselorAvailability
+	if err := db.Where("counselor_id = ?", counselorID).Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	var exceptions []models.CounselorScheduleException
+	if err := db.Where("counselor_id = ? AND date >= ? AND date < ?", counselorID,
+		from.Format(DateLayout), to.Format(DateLayout)).Find(&exceptions).Error; err != nil {
+		return nil, err
+	}
+
+	weekly := make(map[int][]Window)
+	for _, t := range templates {
+		weekly[t.Weekday] = append(weekly[t.Weekday], Window{StartTime: t.StartTime, EndTime: t.EndTime})
+	}
+	byDate := make(map[string][]models.CounselorScheduleException)
+	for _, e := range exceptions {
+		byDate[e.Date] = append(byDate[e.Date], e)
+	}
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		windows := DefaultWindows
+		if len(templates) > 0 {
+			windows = weekly[int(day.Weekday())]
+		}
+		open := toIntervals(day, windows)
+
+		var off []interval
+		for _, e := range byDate[day.Format(DateLayout)] {
+			switch {
+			case e.Type == models.ScheduleExceptionExtra:
+				open = append(open, toIntervals(day, []Window{{StartTime: e.StartTime, EndTime: e.EndTime}})...)
+			case e.StartTime == "":
+				off = append(off, interval{day, day.AddDate(0, 0, 1)})
+			default:
+				off = append(off, toIntervals(day, []Window{{StartTime: e.StartTime, EndTime: e.EndTime}})...)
+			}
+		}
+		p.open = append(p.open, subtract(merge(open), off)...)
+	}
+
+	buffer := time.Duration(setting.BufferMinutes) * time.Minute
+	var bookings []models.CounselorBooking
+	if err := db.Where("counselor_id = ? AND status = ? AND start_time < ? AND end_time > ?", counselorID,
+		models.BookingStatusActive, to.Add(buffer), from.Add(-buffer)).Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range bookings {
+		p.busy = append(p.busy, interval{b.StartTime.Add(-buffer), b.EndTime.Add(buffer)})
+	}
+	return p, nil
+}
+
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+func toIntervals(day time.Time, windows []Window) []interval {
+	result := make([]interval, 0, len(windows))
+	for _, w := range windows {
+		start, err1 := ParseClock(w.StartTime)
+		end, err2 := ParseClock(w.EndTime)
+		if err1 != nil || err2 != nil || end <= start {
+			continue
+		}
+		result = append(result, interval{
+			day.Add(time.Duration(start) * time.Minute),
+			day.Add(time.Duration(end) * time.Minute),
+		})
+	}
+	return result
+}
+
+// merge 合并重叠或相邻的时段
+func merge(list []interval) []interval {
+	if len(list) < 2 {
+		return list
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].start.Before(list[j].start) })
+	merged := []interval{list[0]}
+	for _, cur := range list[1:] {
+		last := &merged[len(merged)-1]
+		if !cur.start.After(last.end) {
+			if cur.end.After(last.end) {
+				last.end = cur.end
+			}
+			continue
+		}
+		merged = append(merged, cur)
+	}
+	return merged
+}
+
+// subtract 从开放时段中扣除休息时段
+func subtract(open, off []interval) []interval {
+	for _, o := range off {
+		next := make([]interval, 0, len(open))
+		for _, w := range open {
+			if !w.overlaps(o) {
+				next = append(next, w)
+				continue
+			}
+			if w.start.Before(o.start) {
+				next = append(next, interval{w.start, o.start})
+			}
+			if o.end.Before(w.end) {
+				next = append(next, interval{o.end, w.end})
+			}
+		}
+		open = next
+	}
+	return open
+}
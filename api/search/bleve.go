@@ -0,0 +1,303 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Bleve 索引参数
+const (
+	DefaultBleveDir  = "./storage/search/chat_messages.bleve"
+	catchUpBatchSize = 500
+	catchUpInterval  = time.Minute
+	lastIndexedIDKey = "last_indexed_message_id"
+)
+
+type bleveEngine struct {
+	index bleve.Index
+	stop  chan struct{}
+}
+
+// bleveDoc 索引文档（字段名即 mapping 中的字段）
+type bleveDoc struct {
+	SessionID   float64   `json:"session_id"`
+	SenderID    float64   `json:"sender_id"`
+	SenderType  string    `json:"sender_type"`
+	ContentType string    `json:"content_type"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"created_at"`
+	HiddenFor   []string  `json:"hidden_for"`
+}
+
+// NewBleve 打开（不存在则创建）进程内 Bleve 索引，并在后台补齐索引落后的消息
+// 同一索引目录只能被一个进程打开，其它进程通过 SyncChannel 通知
+func NewBleve(dir string) (Engine, error) {
+	if dir == "" {
+		dir = DefaultBleveDir
+	}
+
+	index, err := bleve.Open(dir)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return nil, err
+		}
+		index, err = bleve.New(dir, messageMapping())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &bleveEngine{index: index, stop: make(chan struct{})}
+	go e.catchUpLoop()
+	return e, nil
+}
+
+// messageMapping 正文使用 CJK 二元分词，其余字段只做过滤
+func messageMapping() *mapping.IndexMappingImpl {
+	content := bleve.NewTextFieldMapping()
+	content.Analyzer = cjk.AnalyzerName
+	content.Store = true
+	content.IncludeTermVectors = true
+
+	kw := bleve.NewTextFieldMapping()
+	kw.Analyzer = keyword.Name
+	kw.Store = false
+
+	num := bleve.NewNumericFieldMapping()
+	num.Store = false
+
+	created := bleve.NewDateTimeFieldMapping()
+	created.Store = false
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("content", content)
+	doc.AddFieldMappingsAt("session_id", num)
+	doc.AddFieldMappingsAt("sender_id", num)
+	doc.AddFieldMappingsAt("sender_type", kw)
+	doc.AddFieldMappingsAt("content_type", kw)
+	doc.AddFieldMappingsAt("hidden_for", kw)
+	doc.AddFieldMappingsAt("created_at", created)
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = doc
+	m.DefaultAnalyzer = cjk.AnalyzerName
+	return m
+}
+
+func (e *bleveEngine) Name() string { return EngineBleve }
+
+func (e *bleveEngine) Index(doc *Document) error {
+	return e.index.Index(strconv.FormatUint(uint64(doc.MessageID), 10), toBleveDoc(doc))
+}
+
+func (e *bleveEngine) Delete(messageID uint) error {
+	return e.index.Delete(strconv.FormatUint(uint64(messageID), 10))
+}
+
+func (e *bleveEngine) Close() error {
+	close(e.stop)
+	return e.index.Close()
+}
+
+func (e *bleveEngine) Search(ctx context.Context, q *Query) ([]Hit, int64, error) {
+	terms := Terms(q.Keyword)
+	if len(terms) == 0 {
+		return nil, 0, ErrEmptyKeyword
+	}
+
+	// 每个词按短语匹配，与 MySQL 实现的 +"词" 语义一致
+	bq := bleve.NewBooleanQuery()
+	for _, t := range terms {
+		pq := bleve.NewMatchPhraseQuery(t)
+		pq.SetField("content")
+		pq.Analyzer = cjk.AnalyzerName
+		bq.AddMust(pq)
+	}
+
+	if q.SessionIDs != nil {
+		sessions := make([]query.Query, 0, len(q.SessionIDs))
+		for _, id := range q.SessionIDs {
+			sessions = append(sessions, numericEq("session_id", id))
+		}
+		bq.AddMust(bleve.NewDisjunctionQuery(sessions...))
+	}
+	if q.SessionID != 0 {
+		bq.AddMust(numericEq("session_id", q.SessionID))
+	}
+	if q.SenderID != 0 {
+		bq.AddMust(numericEq("sender_id", q.SenderID))
+	}
+	if q.ContentType != "" {
+		tq := bleve.NewTermQuery(q.ContentType)
+		tq.SetField("content_type")
+		bq.AddMust(tq)
+	}
+	if q.StartTime != nil || q.EndTime != nil {
+		var start, end time.Time
+		if q.StartTime != nil {
+			start = *q.StartTime
+		}
+		if q.EndTime != nil {
+			end = *q.EndTime
+		}
+		dq := bleve.NewDateRangeQuery(start, end)
+		dq.SetField("created_at")
+		bq.AddMust(dq)
+	}
+	if q.ViewerID != 0 {
+		tq := bleve.NewTermQuery(strconv.FormatUint(uint64(q.ViewerID), 10))
+		tq.SetField("hidden_for")
+		bq.AddMustNot(tq)
+	}
+
+	req := bleve.NewSearchRequestOptions(bq, q.PageSize, (q.Page-1)*q.PageSize, false)
+	req.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	req.Highlight.AddField("content")
+	if q.Sort == SortRelevance {
+		req.SortBy([]string{"-_score", "-created_at"})
+	} else {
+		req.SortBy([]string{"-created_at"})
+	}
+
+	res, err := e.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]Hit, 0, len(res.Hits))
+	for _, h := range res.Hits {
+		id, err := strconv.ParseUint(h.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		hit := Hit{MessageID: uint(id), Score: h.Score}
+		if fragments := h.Fragments["content"]; len(fragments) > 0 {
+			hit.Snippet = fragments[0]
+		}
+		hits = append(hits, hit)
+	}
+	return hits, int64(res.Total), nil
+}
+
+// catchUpLoop 定期补齐索引：启动时和每分钟检查一次新消息，覆盖 Redis 通知丢失的情况
+func (e *bleveEngine) catchUpLoop() {
+	ticker := time.NewTicker(catchUpInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.catchUp(); err != nil {
+			log.Printf("补齐消息索引失败: %v", err)
+		}
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// catchUp 按ID顺序索引尚未入索引的消息
+func (e *bleveEngine) catchUp() error {
+	lastID, err := e.lastIndexedID()
+	if err != nil {
+		return err
+	}
+
+	for {
+		var messages []models.ChatMessage
+		if err := database.DB.Where("id > ?", lastID).Order("id ASC").Limit(catchUpBatchSize).Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(messages))
+		for _, m := range messages {
+			ids = append(ids, m.ID)
+		}
+		var deletions []models.ChatMessageDeletion
+		if err := database.DB.Where("message_id IN ?", ids).Find(&deletions).Error; err != nil {
+			return err
+		}
+		hidden := make(map[uint][]uint)
+		for _, d := range deletions {
+			hidden[d.MessageID] = append(hidden[d.MessageID], d.UserID)
+		}
+
+		batch := e.index.NewBatch()
+		for i := range messages {
+			m := &messages[i]
+			docID := strconv.FormatUint(uint64(m.ID), 10)
+			if !indexable(m) {
+				batch.Delete(docID)
+				continue
+			}
+			doc := &Document{
+				MessageID:   m.ID,
+				SessionID:   m.SessionID,
+				SenderID:    m.SenderID,
+				SenderType:  m.SenderType,
+				ContentType: m.ContentType,
+				Content:     m.Content,
+				CreatedAt:   m.CreatedAt,
+				HiddenFor:   hidden[m.ID],
+			}
+			if err := batch.Index(docID, toBleveDoc(doc)); err != nil {
+				return err
+			}
+		}
+		lastID = messages[len(messages)-1].ID
+		batch.SetInternal([]byte(lastIndexedIDKey), []byte(strconv.FormatUint(uint64(lastID), 10)))
+		if err := e.index.Batch(batch); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *bleveEngine) lastIndexedID() (uint, error) {
+	v, err := e.index.GetInternal([]byte(lastIndexedIDKey))
+	if err != nil || len(v) == 0 {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(string(v), 10, 64)
+	return uint(id), err
+}
+
+func toBleveDoc(doc *Document) *bleveDoc {
+	hiddenFor := make([]string, 0, len(doc.HiddenFor))
+	for _, id := range doc.HiddenFor {
+		hiddenFor = append(hiddenFor, strconv.FormatUint(uint64(id), 10))
+	}
+	return &bleveDoc{
+		SessionID:   float64(doc.SessionID),
+		SenderID:    float64(doc.SenderID),
+		SenderType:  doc.SenderType,
+		ContentType: doc.ContentType,
+		Content:     doc.Content,
+		CreatedAt:   doc.CreatedAt,
+		HiddenFor:   hiddenFor,
+	}
+}
+
+func numericEq(field string, v uint) query.Query {
+	f := float64(v)
+	inclusive := true
+	q := bleve.NewNumericRangeInclusiveQuery(&f, &f, &inclusive, &inclusive)
+	q.SetField(field)
+	return q
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"gorm.io/gorm/clause"
+)
+
+// ngramTokenSize MySQL ngram_token_size 默认值，短于该长度的词无法走全文索引
+const ngramTokenSize = 2
+
+const fulltextIndexName = "ft_chat_messages_content"
+
+type mysqlEngine struct{}
+
+// NewMySQL 创建 MySQL 全文检索引擎，必要时为消息表建立 ngram 全文索引
+func NewMySQL() (Engine, error) {
+	var count int64
+	err := database.DB.Raw(
+		"SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?",
+		"chat_messages", fulltextIndexName,
+	).Scan(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		sql := fmt.Sprintf("ALTER TABLE chat_messages ADD FULLTEXT INDEX %s (content) WITH PARSER ngram", fulltextIndexName)
+		if err := database.DB.Exec(sql).Error; err != nil {
+			return nil, fmt.Errorf("创建全文索引失败: %w", err)
+		}
+	}
+	return &mysqlEngine{}, nil
+}
+
+func (e *mysqlEngine) Name() string { return EngineMySQL }
+
+// Index 消息表本身即索引，无需额外写入
+func (e *mysqlEngine) Index(doc *Document) error { return nil }
+
+func (e *mysqlEngine) Delete(messageID uint) error { return nil }
+
+func (e *mysqlEngine) Close() error { return nil }
+
+func (e *mysqlEngine) Search(ctx context.Context, q *Query) ([]Hit, int64, error) {
+	terms := Terms(q.Keyword)
+	if len(terms) == 0 {
+		return nil, 0, ErrEmptyKeyword
+	}
+
+	query := database.DB.WithContext(ctx).Model(&models.ChatMessage{}).
+		Where("recalled_at IS NULL AND content_type <> ?", models.MessageTypeSystem)
+
+	// 每个词都必须命中；单字词达不到 ngram 长度，退回 LIKE
+	var boolean []string
+	for _, t := range terms {
+		if utf8.RuneCountInString(t) < ngramTokenSize {
+			query = query.Where("content LIKE ?", "%"+escapeLike(t)+"%")
+		} else {
+			boolean = append(boolean, `+"`+t+`"`)
+		}
+	}
+	against := strings.Join(boolean, " ")
+	if against != "" {
+		query = query.Where("MATCH(content) AGAINST(? IN BOOLEAN MODE)", against)
+	}
+
+	if q.SessionIDs != nil {
+		query = query.Where("session_id IN ?", q.SessionIDs)
+	}
+	if q.SessionID != 0 {
+		query = query.Where("session_id = ?", q.SessionID)
+	}
+	if q.SenderID != 0 {
+		query = query.Where("sender_id = ?", q.SenderID)
+	}
+	if q.ContentType != "" {
+		query = query.Where("content_type = ?", q.ContentType)
+	}
+	if q.StartTime != nil {
+		query = query.Where("created_at >= ?", q.StartTime)
+	}
+	if q.EndTime != nil {
+		query = query.Where("created_at < ?", q.EndTime)
+	}
+	if q.ViewerID != 0 {
+		hidden := database.DB.Model(&models.ChatMessageDeletion{}).Select("message_id").Where("user_id = ?", q.ViewerID)
+		query = query.Where("id NOT IN (?)", hidden)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if q.Sort == SortRelevance && against != "" {
+		query = query.Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "MATCH(content) AGAINST(? IN BOOLEAN MODE) DESC, created_at DESC",
+			Vars: []interface{}{against},
+		}})
+	} else {
+		query = query.Order("created_at DESC")
+	}
+
+	var messages []models.ChatMessage
+	if err := query.Select("id", "content").Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&messages).Error; err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]Hit, 0, len(messages))
+	for _, m := range messages {
+		hits = append(hits, Hit{MessageID: m.ID, Snippet: Snippet(m.Content, terms)})
+	}
+	return hits, total, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,279 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/models"
+	"gorm.io/gorm"
+)
+
+// 检索引擎
+const (
+	EngineMySQL = "mysql" // MySQL FULLTEXT（ngram 分词），消息表即索引
+	EngineBleve = "bleve" // 进程内嵌 Bleve 索引
+)
+
+// 排序方式
+const (
+	SortTime      = "time"      // 按时间倒序
+	SortRelevance = "relevance" // 按相关度
+)
+
+// SyncChannel 未持有索引的进程（如 WebSocket 服务）通过该频道通知索引进程同步消息
+const SyncChannel = "chat:search:sync"
+
+var ErrEmptyKeyword = errors.New("请输入搜索关键词")
+
+// Query 检索条件
+type Query struct {
+	Keyword     string
+	SessionID   uint
+	SenderID    uint
+	ContentType string
+	StartTime   *time.Time
+	EndTime     *time.Time
+	Sort        string
+	Page        int
+	PageSize    int
+
+	// 权限范围：SessionIDs 为 nil 表示不限会话（管理员），
+	// ViewerID 非0时排除该用户"仅自己删除"的消息
+	SessionIDs []uint
+	ViewerID   uint
+}
+
+// Hit 引擎命中结果
+type Hit struct {
+	MessageID uint
+	Score     float64
+	Snippet   string
+}
+
+// Document 待索引的消息
+type Document struct {
+	MessageID   uint
+	SessionID   uint
+	SenderID    uint
+	SenderType  string
+	ContentType string
+	Content     string
+	CreatedAt   time.Time
+	HiddenFor   []uint
+}
+
+// Engine 全文检索引擎
+type Engine interface {
+	Name() string
+	Index(doc *Document) error
+	Delete(messageID uint) error
+	Search(ctx context.Context, q *Query) ([]Hit, int64, error)
+	Close() error
+}
+
+// Result 检索结果
+type Result struct {
+	Messages []MessageHit `json:"messages"`
+	Total    int64        `json:"total"`
+}
+
+// MessageHit 带高亮片段的消息
+type MessageHit struct {
+	models.ChatMessage
+	Snippet string `json:"snippet"`
+}
+
+var engine Engine
+
+// Init 初始化检索引擎，未知引擎回退到 MySQL
+func Init(name, bleveDir string) error {
+	var (
+		e   Engine
+		err error
+	)
+	switch name {
+	case EngineBleve:
+		e, err = NewBleve(bleveDir)
+	default:
+		e, err = NewMySQL()
+	}
+	if err != nil {
+		return err
+	}
+	engine = e
+
+	if e.Name() != EngineMySQL {
+		go subscribe()
+	}
+	return nil
+}
+
+// Close 关闭检索引擎
+func Close() error {
+	if engine == nil {
+		return nil
+	}
+	return engine.Close()
+}
+
+// Search 执行检索并加载命中的消息
+func Search(ctx context.Context, q *Query) (*Result, error) {
+	if strings.TrimSpace(q.Keyword) == "" {
+		return nil, ErrEmptyKeyword
+	}
+	if engine == nil {
+		return nil, errors.New("检索服务未初始化")
+	}
+	if q.SessionIDs != nil && len(q.SessionIDs) == 0 {
+		return &Result{Messages: []MessageHit{}}, nil
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+
+	hits, total, err := engine.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(hits))
+	for _, h := range hits {
+		ids = append(ids, h.MessageID)
+	}
+	var messages []models.ChatMessage
+	if len(ids) > 0 {
+		if err := database.DB.Where("id IN ?", ids).Find(&messages).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]models.ChatMessage, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+
+	// 保持引擎给出的顺序；索引滞后时已撤回的消息直接丢弃
+	result := &Result{Messages: make([]MessageHit, 0, len(hits)), Total: total}
+	for _, h := range hits {
+		m, ok := byID[h.MessageID]
+		if !ok || m.RecalledAt != nil {
+			continue
+		}
+		result.Messages = append(result.Messages, MessageHit{ChatMessage: m, Snippet: h.Snippet})
+	}
+	return result, nil
+}
+
+// ScopeFor 返回主体可检索的会话范围，管理员返回 nil（不限）
+func ScopeFor(p *identity.Principal) ([]uint, error) {
+	if p.IsAdmin {
+		return nil, nil
+	}
+	ids := []uint{}
+	query := database.DB.Model(&models.ChatSession{})
+	if p.IsCounselor() {
+		query = query.Where("user_id = ? OR counselor_id = ?", p.UserID, p.CounselorID)
+	} else {
+		query = query.Where("user_id = ?", p.UserID)
+	}
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Sync 按数据库中的最新状态同步一条消息的索引（新建、编辑、撤回、仅自己删除后调用）
+// 本进程持有的索引直接更新；同时通过 Redis 通知其它持有索引的进程（API 服务和管理后台各自维护一份 Bleve 索引）
+func Sync(messageID uint) error {
+	if engine != nil && engine.Name() == EngineMySQL {
+		return nil
+	}
+	if engine != nil {
+		if err := syncLocal(messageID); err != nil {
+			return err
+		}
+	}
+	if cache.Rdb == nil {
+		return nil
+	}
+	return cache.Rdb.Publish(context.Background(), SyncChannel, messageID).Err()
+}
+
+// syncLocal 更新本进程持有的索引
+func syncLocal(messageID uint) error {
+	var message models.ChatMessage
+	err := database.DB.First(&message, messageID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return engine.Delete(messageID)
+	}
+	if err != nil {
+		return err
+	}
+	if !indexable(&message) {
+		return engine.Delete(messageID)
+	}
+
+	doc, err := documentOf(&message)
+	if err != nil {
+		return err
+	}
+	return engine.Index(doc)
+}
+
+// Notify 异步同步索引，失败只记录日志，不影响消息本身的读写
+func Notify(messageID uint) {
+	go func() {
+		if err := Sync(messageID); err != nil {
+			log.Printf("同步消息索引失败: messageID=%d, err=%v", messageID, err)
+		}
+	}()
+}
+
+// subscribe 接收其他进程的同步通知
+func subscribe() {
+	if cache.Rdb == nil {
+		return
+	}
+	sub := cache.Rdb.Subscribe(context.Background(), SyncChannel)
+	for msg := range sub.Channel() {
+		id, err := strconv.ParseUint(msg.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		// 发出通知的进程也会收到自己的通知，重复同步一次是幂等的
+		if err := syncLocal(uint(id)); err != nil {
+			log.Printf("同步消息索引失败: messageID=%d, err=%v", id, err)
+		}
+	}
+}
+
+// indexable 撤回的消息和系统消息不进入索引
+func indexable(m *models.ChatMessage) bool {
+	return m.RecalledAt == nil && m.ContentType != models.MessageTypeSystem && m.Content != ""
+}
+
+func documentOf(m *models.ChatMessage) (*Document, error) {
+	var hiddenFor []uint
+	if err := database.DB.Model(&models.ChatMessageDeletion{}).Where("message_id = ?", m.ID).Pluck("user_id", &hiddenFor).Error; err != nil {
+		return nil, err
+	}
+	return &Document{
+		MessageID:   m.ID,
+		SessionID:   m.SessionID,
+		SenderID:    m.SenderID,
+		SenderType:  m.SenderType,
+		ContentType: m.ContentType,
+		Content:     m.Content,
+		CreatedAt:   m.CreatedAt,
+		HiddenFor:   hiddenFor,
+	}, nil
+}
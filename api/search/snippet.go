@@ -0,0 +1,93 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// 高亮片段参数
+const (
+	snippetRadius = 30 // 命中词前后保留的字符数
+	highlightPre  = "<mark>"
+	highlightPost = "</mark>"
+)
+
+// Terms 拆分关键词（空白分隔，去掉引号等布尔检索操作符）
+func Terms(keyword string) []string {
+	fields := strings.FieldsFunc(keyword, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"+-<>()~*@`, r)
+	})
+	terms := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		lower := strings.ToLower(f)
+		if !seen[lower] {
+			seen[lower] = true
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// Snippet 截取首个命中词附近的内容并高亮所有命中词，输出已做 HTML 转义
+func Snippet(content string, terms []string) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, t := range terms {
+		tr := []rune(strings.ToLower(t))
+		if len(tr) == 0 {
+			continue
+		}
+		for i := 0; i+len(tr) <= len(lower); {
+			if string(lower[i:i+len(tr)]) == string(tr) {
+				spans = append(spans, span{i, i + len(tr)})
+				i += len(tr)
+			} else {
+				i++
+			}
+		}
+	}
+
+	// 截取窗口：以最早的命中位置为中心
+	from, to := 0, len(runes)
+	if len(spans) > 0 {
+		first := spans[0].start
+		for _, s := range spans {
+			first = min(first, s.start)
+		}
+		from = max(first-snippetRadius, 0)
+		to = min(first+snippetRadius*2, len(runes))
+	} else if to > snippetRadius*3 {
+		to = snippetRadius * 3
+	}
+
+	// 标记需要高亮的字符
+	marked := make([]bool, len(runes))
+	for _, s := range spans {
+		for i := s.start; i < s.end; i++ {
+			marked[i] = true
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	for i := from; i < to; i++ {
+		if marked[i] && (i == from || !marked[i-1]) {
+			b.WriteString(highlightPre)
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i] && (i == to-1 || !marked[i+1]) {
+			b.WriteString(highlightPost)
+		}
+	}
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
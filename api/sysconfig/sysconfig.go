@@ -0,0 +1,53 @@
+package sysconfig
+
+import (
+	"encoding/json"
+
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+)
+
+// 系统配置（system_configs 表，由管理后台维护），配置值均为 JSON
+
+// Values 批量读取配置，返回 key -> 原始 JSON 值，缺失的键不在结果中
+func Values(keys ...string) map[string]string {
+	values := make(map[string]string, len(keys))
+	var configs []models.SystemConfig
+	if err := database.DB.Where("`key` IN ?", keys).Find(&configs).Error; err != nil {
+		return values
+	}
+	for _, c := range configs {
+		values[c.Key] = c.Value
+	}
+	return values
+}
+
+// Decode 将配置值解析到 out，缺失或格式错误时返回 false，out 保持不变
+func Decode(values map[string]string, key string, out interface{}) bool {
+	raw, ok := values[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal([]byte(raw), out) == nil
+}
+
+// String 读取字符串配置
+func String(values map[string]string, key, def string) string {
+	v := def
+	Decode(values, key, &v)
+	return v
+}
+
+// Int 读取整数配置
+func Int(values map[string]string, key string, def int) int {
+	v := def
+	Decode(values, key, &v)
+	return v
+}
+
+// Bool 读取布尔配置
+func Bool(values map[string]string, key string, def bool) bool {
+	v := def
+	Decode(values, key, &v)
+	return v
+}
@@ -0,0 +1,143 @@
+package testutil
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 测试用数据库
+// 每个测试使用独立的 SQLite 内存库替换 database.DB，只迁移聊天和订单相关的表；
+// Redis 置空，身份映射等缓存走直接查库的分支
+
+var dbSeq atomic.Int64
+
+// OpenDB 打开内存数据库并替换 database.DB，测试结束后关闭
+func OpenDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:testdb%d?mode=memory&cache=shared", dbSeq.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Counselor{},
+		&models.CounselorAccount{},
+		&models.CounselorStatistics{},
+		&models.Order{},
+		&models.OrderEvent{},
+		&models.CounselorBooking{},
+		&models.Payment{},
+		&models.ChatSession{},
+		&models.ChatMessage{},
+		&models.ChatMessageRevision{},
+		&models.ChatMessageDeletion{},
+		&models.ChatBilling{},
+		&models.File{},
+		&models.Notification{},
+		&models.SensitiveWord{},
+		&models.ModerationIncident{},
+	); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+
+	// 测试结束后只关闭连接，不把 database.DB 置回 nil：
+	// 处理器异步发送的通知（go CreateNotification）可能晚于测试结束，届时写入失败但不会空指针
+	database.DB, cache.Rdb = db, nil
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// Identities 一组咨询师的用户ID与咨询师ID刻意错开的身份和会话：
+// Other 的用户ID等于 Counselor 的咨询师ID，Counselor 的咨询师ID又等于 OtherSession 的用户ID，
+// 任何把用户ID和咨询师ID混用的判断都会把 Other 当成 Session 的咨询师，或把 Counselor 当成 OtherSession 的用户
+type Identities struct {
+	Client        models.User      // Session 的来访者
+	CounselorUser models.User      // Counselor 的用户账号
+	Counselor     models.Counselor // Session 的咨询师
+	Other         models.User      // 用户ID等于 Counselor.ID，是 OtherSession 的来访者
+	Session       models.ChatSession
+	OtherSession  models.ChatSession // Other 与另一位咨询师的会话
+}
+
+// 固定的ID：用户ID与咨询师ID交错
+const (
+	ClientUserID         = 3
+	CounselorID          = 7
+	OtherUserID          = CounselorID
+	CounselorUserID      = 9
+	OtherCounselorID     = 5
+	OtherCounselorUserID = 11
+)
+
+// SeedIdentities 写入 Identities 描述的用户、咨询师、已支付订单和进行中的会话
+func SeedIdentities(t testing.TB, db *gorm.DB) *Identities {
+	t.Helper()
+
+	ids := &Identities{
+		Client:        models.User{ID: ClientUserID, Username: "client", Email: "client@example.com", Status: 1},
+		CounselorUser: models.User{ID: CounselorUserID, Username: "counselor", Email: "counselor@example.com", Status: 1},
+		Other:         models.User{ID: OtherUserID, Username: "other", Email: "other@example.com", Status: 1},
+		Counselor:     models.Counselor{ID: CounselorID, UserID: CounselorUserID, Name: "咨询师", Price: 2, Status: 1},
+	}
+	otherCounselorUser := models.User{ID: OtherCounselorUserID, Username: "counselor2", Email: "counselor2@example.com", Status: 1}
+	otherCounselor := models.Counselor{ID: OtherCounselorID, UserID: OtherCounselorUserID, Name: "咨询师2", Price: 2, Status: 1}
+
+	for _, v := range []interface{}{&ids.Client, &ids.CounselorUser, &ids.Other, &otherCounselorUser, &ids.Counselor, &otherCounselor} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatalf("写入测试身份失败: %v", err)
+		}
+	}
+
+	ids.Session = seedSession(t, db, ClientUserID, CounselorID)
+	ids.OtherSession = seedSession(t, db, OtherUserID, OtherCounselorID)
+	return ids
+}
+
+// seedSession 写入已支付的订单和进行中的会话
+func seedSession(t testing.TB, db *gorm.DB, userID, counselorID uint) models.ChatSession {
+	t.Helper()
+
+	now := time.Now()
+	start := now.Add(-10 * time.Minute)
+	order := models.Order{
+		OrderNo:      fmt.Sprintf("T%d%d%d", userID, counselorID, now.UnixNano()),
+		UserID:       userID,
+		CounselorID:  counselorID,
+		Duration:     30,
+		Amount:       60,
+		UnitPrice:    2,
+		Status:       models.OrderStatusPaid,
+		ScheduleTime: start,
+		PayTime:      &start,
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("写入测试订单失败: %v", err)
+	}
+	session := models.ChatSession{
+		OrderID:     order.ID,
+		UserID:      userID,
+		CounselorID: counselorID,
+		Status:      1,
+		StartTime:   &start,
+	}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("写入测试会话失败: %v", err)
+	}
+	return session
+}
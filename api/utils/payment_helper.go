@@ -54,6 +54,7 @@ func GetPaymentStatusText(status int) string {
 		2: "支付失败",
 		3: "已退款",
 		4: "已取消",
+		5: "退款中",
 	}
 	if text, ok := textMap[status]; ok {
 		return text
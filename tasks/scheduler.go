@@ -1,165 +1,399 @@
 package tasks
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
+	"akrick.com/mychat/counselorstats"
 	"akrick.com/mychat/database"
+	"akrick.com/mychat/jobs"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/notify"
+	"akrick.com/mychat/orderflow"
+	"akrick.com/mychat/pricing"
+	"akrick.com/mychat/retention"
+	"akrick.com/mychat/sysconfig"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// StartScheduler 启动定时任务
-// 用于订单超时取消、消息清理等后台任务
+// StartScheduler 注册并启动定时任务
+// 用于订单超时取消、爽约处理、预约提醒、数据归档、统计重算、等级晋升等后台任务；任务经 jobs 框架调度，
+// 多个实例同时启动时每个任务在集群内只执行一次，执行记录可在管理后台查看
 func StartScheduler() {
-	log.Println("定时任务调度器已启动")
-
-	// 启动一个后台goroutine来执行定时任务
-	go func() {
-		// 订单超时检查 - 每5分钟执行一次
-		orderTicker := time.NewTicker(5 * time.Minute)
-		defer orderTicker.Stop()
-
-		// 会话清理 - 每1小时执行一次
-		sessionTicker := time.NewTicker(1 * time.Hour)
-		defer sessionTicker.Stop()
-
-		for {
-			select {
-			case <-orderTicker.C:
-				checkExpiredOrders()
-			case <-sessionTicker.C:
-				cleanupExpiredSessions()
-			}
-		}
-	}()
+	jobs.Register(jobs.Job{
+		Name:        "order_expire",
+		Description: "取消超时未支付的订单",
+		Cron:        "*/5 * * * *",
+		MaxRetries:  2,
+		Run:         checkExpiredOrders,
+	})
+	jobs.Register(jobs.Job{
+		Name:        "order_no_show",
+		Description: "处理预约开始后会话未开始的爽约订单",
+		Cron:        "*/5 * * * *",
+		MaxRetries:  2,
+		Run:         checkNoShows,
+	})
+	jobs.Register(jobs.Job{
+		Name:        orderflow.RefundRetryJobName,
+		Description: "重试退款中订单的支付渠道退款",
+		Cron:        "*/10 * * * *",
+		MaxRetries:  1,
+		Run:         orderflow.RetryRefunds,
+	})
+	jobs.Register(jobs.Job{
+		Name:        "appointment_reminder",
+		Description: "发送预约提醒",
+		Cron:        "* * * * *",
+		Timeout:     time.Minute,
+		Run:         sendReminders,
+	})
+	jobs.Register(jobs.Job{
+		Name:        "data_retention",
+		Description: "按保留策略归档并删除过期的聊天消息、附件和计费记录",
+		Cron:        "0 4 * * *",
+		MaxRetries:  1,
+		Timeout:     2 * time.Hour,
+		Run:         retention.Run,
+	})
+	jobs.Register(jobs.Job{
+		Name:        retention.RestoreJobName,
+		Description: "恢复管理员申请恢复的数据归档",
+		Cron:        "*/10 * * * *",
+		Timeout:     time.Hour,
+		Run:         retention.Restore,
+	})
+	jobs.Register(jobs.Job{
+		Name:        counselorstats.RebuildJobName,
+		Description: "按订单、会话和评价全量重算咨询师统计和评分",
+		Cron:        "0 5 * * 1",
+		Timeout:     time.Hour,
+		Run:         counselorstats.Rebuild,
+	})
+	jobs.Register(jobs.Job{
+		Name:        pricing.PromoteJobName,
+		Description: "按咨询师统计评估等级晋升",
+		Cron:        "30 5 * * *",
+		Timeout:     30 * time.Minute,
+		Run:         pricing.Promote,
+	})
+	jobs.Register(jobs.Job{
+		Name:        "counselor_application_expire",
+		Description: "将超过补充材料期限的咨询师入驻申请置为失效",
+		Cron:        "15 * * * *",
+		MaxRetries:  1,
+		Run:         expireApplications,
+	})
+	jobs.Register(jobs.Job{
+		Name:        "job_run_cleanup",
+		Description: "删除30天前的任务执行记录",
+		Cron:        "30 3 * * *",
+		Run:         jobs.CleanupRuns,
+	})
+	jobs.Start()
 }
 
 // checkExpiredOrders 检查并取消超时未支付的订单
-func checkExpiredOrders() {
+// 逐单经订单状态机取消：状态机锁定订单行并校验当前状态，多实例同时执行或用户恰好支付时不会重复处理
+func checkExpiredOrders(ctx context.Context) error {
 	log.Println("执行订单超时检查...")
 
-	// 创建类型别名以避免循环依赖
-	type Order struct {
-		ID        uint      `gorm:"primaryKey"`
-		UserID    uint      `gorm:"index"`
-		Status    int       `gorm:"default:0"` // 0:待支付, 1:已支付, 2:已取消, 3:已完成
-		CreatedAt time.Time
-	}
-
-	type Notification struct {
-		ID        uint   `gorm:"primaryKey"`
-		UserID    uint   `gorm:"index"`
-		Title     string
-		Content   string `gorm:"type:text"`
-		IsRead    bool   `gorm:"default:false"`
-		CreatedAt time.Time
-	}
-
 	// 查询创建超过30分钟且状态为待支付的订单
 	timeout := 30 * time.Minute
-	var expiredOrders []Order
-	err := database.DB.Where("status = ? AND created_at < ?", 0, time.Now().Add(-timeout)).Find(&expiredOrders).Error
+	var orderIDs []uint
+	err := database.DB.Model(&models.Order{}).
+		Where("status = ? AND created_at < ?", models.OrderStatusPending, time.Now().Add(-timeout)).
+		Pluck("id", &orderIDs).Error
 	if err != nil {
-		log.Printf("查询超时订单失败: %v", err)
-		return
+		return fmt.Errorf("查询超时订单失败: %w", err)
 	}
 
-	if len(expiredOrders) == 0 {
+	if len(orderIDs) == 0 {
 		log.Println("没有超时订单需要处理")
-		return
+		return nil
 	}
 
-	log.Printf("发现 %d 个超时订单", len(expiredOrders))
+	log.Printf("发现 %d 个超时订单", len(orderIDs))
 
-	// 批量取消订单
-	tx := database.DB.Begin()
-	for _, order := range expiredOrders {
-		// 更新订单状态
-		if err := tx.Model(&Order{}).Where("id = ?", order.ID).Update("status", 2).Error; err != nil {
-			log.Printf("更新订单 %d 状态失败: %v", order.ID, err)
-			tx.Rollback()
-			return
+	cancelled, failed := 0, 0
+	for _, id := range orderIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-
-		// 创建通知
-		notification := Notification{
-			UserID:  order.UserID,
-			Title:   "订单已取消",
-			Content: fmt.Sprintf("您的订单 #%d 因超时未支付已自动取消", order.ID),
-			IsRead:  false,
+		_, err := orderflow.Fire(orderflow.Request{
+			OrderID: id,
+			Event:   models.OrderEventExpire,
+			Actor:   orderflow.System,
+			Reason:  "超时未支付",
+		})
+		if errors.Is(err, orderflow.ErrInvalidTransition) {
+			continue
 		}
-		if err := tx.Create(&notification).Error; err != nil {
-			log.Printf("创建通知失败: %v", err)
-			tx.Rollback()
-			return
+		if err != nil {
+			log.Printf("取消订单 %d 失败: %v", id, err)
+			failed++
+			continue
 		}
+		cancelled++
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("事务提交失败: %v", err)
-		return
+	log.Printf("成功取消 %d 个超时订单", cancelled)
+	if failed > 0 {
+		return fmt.Errorf("%d 个超时订单取消失败", failed)
 	}
-
-	log.Printf("成功取消 %d 个超时订单", len(expiredOrders))
+	return nil
 }
 
-// cleanupExpiredSessions 清理过期的聊天会话
-func cleanupExpiredSessions() {
-	log.Println("执行会话清理...")
+// checkNoShows 处理爽约订单：已支付订单在预约开始后超过宽限时间仍未开始会话，
+// 按签到记录判定爽约方并按爽约政策退款；逐单经状态机处理，多实例同时执行不会重复退款
+func checkNoShows(ctx context.Context) error {
+	policy := orderflow.LoadPolicy(database.DB)
+	deadline := time.Now().Add(-time.Duration(policy.NoShowGraceMinutes) * time.Minute)
 
-	// 定义结构体
-	type ChatMessage struct {
-		ID        uint   `gorm:"primaryKey"`
-		SessionID uint   `gorm:"index"`
+	var orders []models.Order
+	err := database.DB.Where("status = ? AND type = ? AND schedule_time < ?", models.OrderStatusPaid, models.OrderTypeSession, deadline).
+		Where("NOT EXISTS (SELECT 1 FROM chat_sessions WHERE chat_sessions.order_id = orders.id AND chat_sessions.start_time IS NOT NULL)").
+		Find(&orders).Error
+	if err != nil {
+		return fmt.Errorf("查询爽约订单失败: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil
 	}
 
-	// 查询已结束超过7天的会话
-	expireDays := 7
-	expiredTime := time.Now().AddDate(0, 0, -expireDays)
+	log.Printf("发现 %d 个爽约订单", len(orders))
+
+	handled, failed := 0, 0
+	for i := range orders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		order := &orders[i]
+		party, err := orderflow.NoShowParty(database.DB, order)
+		if err != nil {
+			log.Printf("判定订单 %d 爽约方失败: %v", order.ID, err)
+			failed++
+			continue
+		}
 
-	type ChatSession struct {
-		ID        uint      `gorm:"primaryKey"`
-		Status    int       // 0:待开始, 1:进行中, 2:已结束
-		EndTime   *time.Time
-		CreatedAt time.Time
+		req := orderflow.Request{
+			OrderID:  order.ID,
+			Event:    models.OrderEventNoShow,
+			Actor:    orderflow.System,
+			Reason:   "预约开始后会话未开始",
+			Metadata: map[string]interface{}{"party": party},
+		}
+		orderflow.ApplyRefundPercent(&req, order, policy.NoShowRefundPercent(party))
+
+		_, err = orderflow.Fire(req)
+		if errors.Is(err, orderflow.ErrInvalidTransition) || errors.Is(err, orderflow.ErrSessionStarted) {
+			continue
+		}
+		if err != nil {
+			log.Printf("处理爽约订单 %d 失败: %v", order.ID, err)
+			failed++
+			continue
+		}
+		handled++
+	}
+
+	log.Printf("成功处理 %d 个爽约订单", handled)
+	if failed > 0 {
+		return fmt.Errorf("%d 个爽约订单处理失败", failed)
+	}
+	return nil
+}
+
+// ConfigReminderOffsets 预约提醒时间点配置键（system_configs，JSON 整数数组，单位分钟）
+const ConfigReminderOffsets = "reminder_offsets_minutes"
+
+// defaultReminderOffsets 默认提前24小时、1小时和10分钟提醒
+var defaultReminderOffsets = []int{1440, 60, 10}
+
+// sendReminders 向已支付订单的用户和咨询师发送预约提醒
+// 每单在每个时间点只提醒一次：先插入 OrderReminder（唯一索引），插入成功的实例才发送；
+// 支付或改约时已错过的较早时间点不补发，只发送当前最近的一个
+func sendReminders(ctx context.Context) error {
+	offsets := reminderOffsets()
+	if len(offsets) == 0 {
+		return nil
 	}
 
-	var expiredSessions []ChatSession
-	err := database.DB.Where("status = ? AND end_time < ?", 2, expiredTime).Find(&expiredSessions).Error
+	now := time.Now()
+	var orders []models.Order
+	err := database.DB.Where("status = ? AND type = ? AND schedule_time > ? AND schedule_time <= ?", models.OrderStatusPaid,
+		models.OrderTypeSession, now, now.Add(time.Duration(offsets[0])*time.Minute)).Find(&orders).Error
 	if err != nil {
-		log.Printf("查询过期会话失败: %v", err)
-		return
+		return fmt.Errorf("查询待提醒订单失败: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil
 	}
 
-	if len(expiredSessions) == 0 {
-		log.Println("没有过期会话需要清理")
-		return
+	orderIDs := make([]uint, 0, len(orders))
+	for _, o := range orders {
+		orderIDs = append(orderIDs, o.ID)
+	}
+	var sent []models.OrderReminder
+	database.DB.Where("order_id IN ?", orderIDs).Find(&sent)
+	done := make(map[string]bool, len(sent))
+	for _, r := range sent {
+		done[reminderKey(r.OrderID, r.ScheduleTime, r.OffsetMinutes)] = true
 	}
 
-	log.Printf("发现 %d 个过期会话", len(expiredSessions))
+	failed := 0
+	for i := range orders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		order := &orders[i]
+		remaining := order.ScheduleTime.Sub(now)
+		offset := 0
+		for _, o := range offsets {
+			if remaining <= time.Duration(o)*time.Minute {
+				offset = o
+			}
+		}
+		if offset == 0 || done[reminderKey(order.ID, order.ScheduleTime, offset)] {
+			continue
+		}
+		if err := sendReminder(order, offset); err != nil {
+			log.Printf("发送订单 %d 的预约提醒失败: %v", order.ID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个订单的预约提醒发送失败", failed)
+	}
+	return nil
+}
 
-	// 批量删除过期的会话和消息
-	tx := database.DB.Begin()
-	for _, session := range expiredSessions {
-		// 删除相关消息
-		if err := tx.Where("session_id = ?", session.ID).Delete(&ChatMessage{}).Error; err != nil {
-			log.Printf("删除会话 %d 的消息失败: %v", session.ID, err)
-			tx.Rollback()
-			return
+func sendReminder(order *models.Order, offset int) error {
+	var notifications []models.Notification
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.OrderReminder{
+			OrderID:       order.ID,
+			ScheduleTime:  order.ScheduleTime,
+			OffsetMinutes: offset,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			// 其他实例已发送
+			return result.Error
 		}
 
-		// 删除会话
-		if err := tx.Delete(&session).Error; err != nil {
-			log.Printf("删除会话 %d 失败: %v", session.ID, err)
-			tx.Rollback()
-			return
+		when := order.ScheduleTime.Format("2006-01-02 15:04")
+		notifications = append(notifications, models.Notification{
+			UserID:  order.UserID,
+			Type:    models.NotificationTypeOrder,
+			Level:   models.NotificationLevelInfo,
+			Title:   "咨询即将开始",
+			Content: fmt.Sprintf("您预约的咨询（订单 %s）将于 %s 开始，距现在约%s，请准时进入咨询", order.OrderNo, when, offsetText(offset)),
+		})
+		var counselorUserID uint
+		tx.Model(&models.Counselor{}).Select("user_id").Where("id = ?", order.CounselorID).Scan(&counselorUserID)
+		if counselorUserID != 0 {
+			notifications = append(notifications, models.Notification{
+				UserID:  counselorUserID,
+				Type:    models.NotificationTypeOrder,
+				Level:   models.NotificationLevelInfo,
+				Title:   "咨询即将开始",
+				Content: fmt.Sprintf("订单 %s 的咨询将于 %s 开始，距现在约%s，请提前做好准备", order.OrderNo, when, offsetText(offset)),
+			})
+		}
+		return tx.Create(&notifications).Error
+	})
+	if err != nil {
+		return err
+	}
+	notify.Deliver(notifications...)
+	return nil
+}
+
+// expireApplications 将超过补充材料期限仍未补充的入驻申请置为失效并通知申请人，用户可重新提交申请
+// 逐条按状态条件更新：用户恰好提交补充材料或其他实例已处理时跳过
+func expireApplications(ctx context.Context) error {
+	var applications []models.CounselorApplication
+	if err := database.DB.Select("id", "user_id", "stage").
+		Where("status = ? AND material_deadline < ?", models.ApplicationStatusNeedMaterial, time.Now()).
+		Find(&applications).Error; err != nil {
+		return fmt.Errorf("查询超期入驻申请失败: %w", err)
+	}
+
+	failed := 0
+	for _, app := range applications {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		var notification *models.Notification
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.CounselorApplication{}).
+				Where("id = ? AND status = ?", app.ID, models.ApplicationStatusNeedMaterial).
+				Update("status", models.ApplicationStatusExpired)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			if err := tx.Create(&models.CounselorApplicationEvent{
+				ApplicationID: app.ID,
+				Stage:         app.Stage,
+				Action:        models.ApplicationActionExpire,
+				ActorType:     models.ApplicationActorSystem,
+				Comment:       "未在期限内补充材料",
+			}).Error; err != nil {
+				return err
+			}
+			notification = &models.Notification{
+				UserID:  app.UserID,
+				Type:    models.NotificationTypeSystem,
+				Level:   models.NotificationLevelWarning,
+				Title:   "入驻申请已失效",
+				Content: "您的咨询师入驻申请未在期限内补充材料，申请已失效，如需入驻请重新提交申请",
+			}
+			return tx.Create(notification).Error
+		})
+		if err != nil {
+			log.Printf("入驻申请 %d 置为失效失败: %v", app.ID, err)
+			failed++
+			continue
+		}
+		if notification != nil {
+			notify.Deliver(*notification)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个入驻申请置为失效失败", failed)
 	}
+	return nil
+}
 
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("事务提交失败: %v", err)
-		return
+// reminderOffsets 读取提醒时间点，按从早到晚（提前分钟数从大到小）排序
+func reminderOffsets() []int {
+	offsets := append([]int(nil), defaultReminderOffsets...)
+	var configured []int
+	if sysconfig.Decode(sysconfig.Values(ConfigReminderOffsets), ConfigReminderOffsets, &configured) {
+		offsets = offsets[:0]
+		for _, o := range configured {
+			if o > 0 {
+				offsets = append(offsets, o)
+			}
+		}
 	}
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	return offsets
+}
 
-	log.Printf("成功清理 %d 个过期会话及其消息", len(expiredSessions))
+func reminderKey(orderID uint, scheduleTime time.Time, offset int) string {
+	return fmt.Sprintf("%d:%d:%d", orderID, scheduleTime.Unix(), offset)
+}
+
+func offsetText(minutes int) string {
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%d小时", minutes/60)
+	}
+	return fmt.Sprintf("%d分钟", minutes)
 }
@@ -9,10 +9,16 @@ import (
 	"sync"
 	"time"
 
+	"akrick.com/mychat/attachment"
 	"akrick.com/mychat/cache"
+	"akrick.com/mychat/counselorstats"
 	"akrick.com/mychat/database"
+	"akrick.com/mychat/favorite"
+	"akrick.com/mychat/identity"
 	"akrick.com/mychat/models"
-	"akrick.com/mychat/utils"
+	"akrick.com/mychat/moderation"
+	"akrick.com/mychat/orderflow"
+	"akrick.com/mychat/search"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -27,10 +33,12 @@ var upgrader = websocket.Upgrader{
 }
 
 // Client WebSocket客户端
+// ID 为 users 表ID（Hub 以此索引连接），会话权限一律通过 Principal 判断
 type Client struct {
-	ID       uint
-	Conn     *websocket.Conn
-	Send     chan []byte
+	ID        uint
+	Principal *identity.Principal
+	Conn      *websocket.Conn
+	Send      chan []byte
 	SessionID *uint
 }
 
@@ -66,6 +74,7 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			h.clients[client.ID] = client
 			h.mu.Unlock()
+			markOnline(client.ID)
 			log.Printf("客户端注册: userID=%d", client.ID)
 
 		case client := <-h.unregister:
@@ -73,6 +82,9 @@ func (h *Hub) Run() {
 			if _, ok := h.clients[client.ID]; ok {
 				delete(h.clients, client.ID)
 				close(client.Send)
+				if cache.Rdb != nil {
+					cache.ClearOnlineStatus(context.Background(), client.ID)
+				}
 				log.Printf("客户端断开: userID=%d", client.ID)
 			}
 			
@@ -111,8 +123,8 @@ func HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	// 验证token
-	claims, err := utils.ParseToken(token)
+	// 验证token并解析身份
+	principal, err := identity.FromToken(c.Request.Context(), token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "token无效"})
 		return
@@ -126,13 +138,18 @@ func HandleWebSocket(c *gin.Context) {
 	}
 
 	client := &Client{
-		ID:   claims.UserID,
-		Conn: conn,
-		Send: make(chan []byte, 256),
+		ID:        principal.UserID,
+		Principal: principal,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
 	}
 
-	// 注册客户端
+	// 注册客户端，咨询师从离线变为在线时通知收藏了该咨询师的用户
+	wasOnline := IsUserOnline(principal.UserID)
 	globalHub.register <- client
+	if principal.IsCounselor() && !wasOnline {
+		notifyFavoritesOnline(principal.CounselorID)
+	}
 
 	// 启动读写协程
 	go client.readPump()
@@ -155,8 +172,8 @@ func HandleChatWebSocket(c *gin.Context) {
 		return
 	}
 
-	// 验证token
-	claims, err := utils.ParseToken(token)
+	// 验证token并解析身份
+	principal, err := identity.FromToken(c.Request.Context(), token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "token无效"})
 		return
@@ -180,7 +197,8 @@ func HandleChatWebSocket(c *gin.Context) {
 	sid := uint(sessionID)
 
 	client := &Client{
-		ID:        claims.UserID,
+		ID:        principal.UserID,
+		Principal: principal,
 		Conn:      conn,
 		Send:      make(chan []byte, 256),
 		SessionID: &sid,
@@ -211,8 +229,8 @@ func HandleCounselorWebSocket(c *gin.Context) {
 		return
 	}
 
-	// 验证token
-	claims, err := utils.ParseToken(token)
+	// 验证token并解析身份
+	principal, err := identity.FromToken(c.Request.Context(), token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "token无效"})
 		return
@@ -227,9 +245,8 @@ func HandleCounselorWebSocket(c *gin.Context) {
 	}
 
 	// 验证用户是否为该咨询师
-	var counselor models.Counselor
-	if err := database.DB.Where("id = ? AND user_id = ?", counselorID, claims.UserID).First(&counselor).Error; err != nil {
-		log.Printf("咨询师验证失败: %v", err)
+	if !principal.IsCounselor() || principal.CounselorID != uint(counselorID) {
+		log.Printf("咨询师验证失败: userID=%d, counselorID=%d", principal.UserID, counselorID)
 		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
 		return
 	}
@@ -242,15 +259,20 @@ func HandleCounselorWebSocket(c *gin.Context) {
 	}
 
 	client := &Client{
-		ID:   claims.UserID,
-		Conn: conn,
-		Send: make(chan []byte, 256),
+		ID:        principal.UserID,
+		Principal: principal,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
 	}
 
-	// 注册客户端
+	// 注册客户端，咨询师从离线变为在线时通知收藏了该咨询师的用户
+	wasOnline := IsUserOnline(principal.UserID)
 	globalHub.register <- client
+	if !wasOnline {
+		notifyFavoritesOnline(principal.CounselorID)
+	}
 
-	log.Printf("咨询师 WebSocket 连接建立: counselorID=%d, userID=%d", counselorID, claims.UserID)
+	log.Printf("咨询师 WebSocket 连接建立: counselorID=%d, userID=%d", counselorID, principal.UserID)
 
 	// 发送初始连接成功消息
 	client.sendMessage("connected", gin.H{
@@ -280,6 +302,7 @@ func (c *Client) readPump() {
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		markOnline(c.ID)
 		return nil
 	})
 
@@ -314,6 +337,12 @@ func (c *Client) readPump() {
 			messageHandler.handleTypingStop(c, wsMsg)
 		case "read":
 			messageHandler.handleRead(c, wsMsg)
+		case "edit":
+			messageHandler.handleEdit(c, wsMsg)
+		case "recall":
+			messageHandler.handleRecall(c, wsMsg)
+		case "delete":
+			messageHandler.handleDelete(c, wsMsg)
 		}
 	}
 }
@@ -371,7 +400,7 @@ func (c *Client) handleJoin(wsMsg WSMessage) {
 	}
 
 	// 检查权限
-	if session.UserID != c.ID && session.CounselorID != c.ID {
+	if !c.Principal.IsParticipant(session.UserID, session.CounselorID) {
 		c.sendError("无权加入此会话")
 		return
 	}
@@ -393,8 +422,16 @@ func (c *Client) handleJoin(wsMsg WSMessage) {
 	globalHub.sessions[sessionID][c.ID] = c
 	globalHub.mu.Unlock()
 
-	// 如果会话状态是待开始，且双方都已加入，则开始会话
+	// 如果会话状态是待开始，记录到场（会话最终未开始时据此判定爽约方），双方都已加入则开始会话
 	if session.Status == 0 {
+		var order models.Order
+		if err := database.DB.First(&order, session.OrderID).Error; err == nil {
+			actor := orderflow.Actor{Type: models.OrderActorUser, ID: c.Principal.UserID}
+			if c.Principal.IsCounselor() && c.Principal.CounselorID == session.CounselorID {
+				actor = orderflow.Actor{Type: models.OrderActorCounselor, ID: c.Principal.CounselorID}
+			}
+			orderflow.CheckIn(database.DB, &order, actor)
+		}
 		if len(globalHub.sessions[sessionID]) >= 2 {
 			c.startSession(sessionID)
 		}
@@ -402,9 +439,7 @@ func (c *Client) handleJoin(wsMsg WSMessage) {
 
 	// 更新会话管理器
 	if session.Status == 1 {
-		var counselor models.Counselor
-		database.DB.First(&counselor, session.CounselorID)
-		sessionManager.StartSession(sessionID, session.UserID, session.CounselorID, counselor.Price)
+		sessionManager.StartSession(sessionID, session.UserID, session.CounselorID, sessionPrice(&session))
 	}
 
 	// 发送加入成功消息
@@ -428,6 +463,15 @@ func (c *Client) startSession(sessionID uint) {
 	var session models.ChatSession
 	database.DB.Preload("Order").Preload("Counselor").First(&session, sessionID)
 
+	// 双方都已加入，记录咨询开始
+	if session.Order.ID != 0 {
+		orderflow.Record(database.DB, &session.Order, orderflow.Request{
+			Event:    models.OrderEventSessionStart,
+			Actor:    orderflow.System,
+			Metadata: map[string]any{"session_id": sessionID},
+		})
+	}
+
 	// 清除缓存
 	ctx := context.Background()
 	cache.DeleteChatSessionCache(ctx, sessionID)
@@ -442,7 +486,7 @@ func (c *Client) startSession(sessionID uint) {
 			SessionID: sessionID,
 			Data: gin.H{
 				"start_time": now,
-				"price":      session.Counselor.Price,
+				"price":      sessionPrice(&session),
 			},
 		})
 
@@ -459,11 +503,16 @@ func (c *Client) startSession(sessionID uint) {
 func (c *Client) handleMessage(wsMsg WSMessage) {
 	sessionID := wsMsg.SessionID
 	content, _ := wsMsg.Data["content"].(string)
-	contentType, _ := wsMsg.Data["content_type"].(string)
-	if contentType == "" {
-		contentType = "text"
+
+	// 附件消息携带先通过 HTTP 上传得到的 file_id
+	var fileID uint
+	if v, ok := wsMsg.Data["file_id"].(float64); ok && v > 0 {
+		fileID = uint(v)
+	}
+	if content == "" && fileID == 0 {
+		c.sendError("消息内容不能为空")
+		return
 	}
-	fileURL, _ := wsMsg.Data["file_url"].(string)
 
 	// 查询会话
 	var session models.ChatSession
@@ -472,16 +521,19 @@ func (c *Client) handleMessage(wsMsg WSMessage) {
 		return
 	}
 
-	// 检查权限
-	if session.UserID != c.ID && session.CounselorID != c.ID {
+	// 检查权限并确定发送者类型
+	senderType := c.Principal.SessionRole(session.UserID, session.CounselorID)
+	if senderType == "" {
 		c.sendError("无权发送消息")
 		return
 	}
 
-	// 确定发送者类型
-	senderType := "user"
-	if session.CounselorID == c.ID {
-		senderType = "counselor"
+	// 内容审核：拦截的消息不保存，打码的消息以打码后的内容保存和转发
+	src := moderation.Source{SessionID: sessionID, SenderID: c.ID, SenderType: senderType}
+	verdict, err := moderation.Screen(content, src)
+	if err != nil {
+		c.sendError(err.Error())
+		return
 	}
 
 	// 创建消息记录
@@ -489,43 +541,79 @@ func (c *Client) handleMessage(wsMsg WSMessage) {
 		SessionID:   sessionID,
 		SenderID:    c.ID,
 		SenderType:  senderType,
-		ContentType: contentType,
-		Content:     content,
-		FileURL:     fileURL,
+		ContentType: models.MessageTypeText,
+		Content:     verdict.Content,
 		IsRead:      false,
 	}
 
+	var file *models.File
+	if fileID != 0 {
+		f, err := attachment.ForMessage(fileID, sessionID, c.ID)
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		file = f
+		message.FileID = &f.ID
+		message.FileURL = f.FileURL
+		message.ContentType = attachment.Kind(f)
+	}
+
 	if err := database.DB.Create(&message).Error; err != nil {
 		c.sendError("消息保存失败")
 		return
 	}
+	search.Notify(message.ID)
+	moderation.Report(verdict, src, &message.ID)
 
-	// 广播消息给会话内其他客户端
+	// 内容被打码时告知发送者实际发出的内容
+	if message.Content != content {
+		c.sendMessage("message_masked", gin.H{
+			"message_id": message.ID,
+			"content":    message.Content,
+		})
+	}
+
+	// 广播消息给会话内其他客户端（下载链接按接收者签发）
 	globalHub.mu.RLock()
 	defer globalHub.mu.RUnlock()
 
 	if clients, ok := globalHub.sessions[sessionID]; ok {
-		msg, _ := json.Marshal(WSMessage{
-			Type:      "message",
-			SessionID: sessionID,
-			Data: gin.H{
+		for userID, client := range clients {
+			if userID == c.ID {
+				continue
+			}
+
+			data := gin.H{
 				"message_id":   message.ID,
 				"sender_id":    message.SenderID,
 				"sender_type":  message.SenderType,
 				"content_type": message.ContentType,
 				"content":      message.Content,
-				"file_url":     message.FileURL,
 				"created_at":   message.CreatedAt,
-			},
-		})
-
-		for userID, client := range clients {
-			if userID != c.ID {
-				select {
-				case client.Send <- msg:
-				default:
+			}
+			if file != nil {
+				data["file_id"] = file.ID
+				data["file_name"] = file.OriginalName
+				data["file_size"] = file.FileSize
+				data["width"] = file.Width
+				data["height"] = file.Height
+				data["duration"] = file.Duration
+				data["download_url"] = attachment.SignedURL(file.ID, userID, false)
+				if message.ContentType == models.MessageTypeImage {
+					data["thumb_url"] = attachment.SignedURL(file.ID, userID, true)
 				}
 			}
+
+			msg, _ := json.Marshal(WSMessage{
+				Type:      "message",
+				SessionID: sessionID,
+				Data:      data,
+			})
+			select {
+			case client.Send <- msg:
+			default:
+			}
 		}
 	}
 }
@@ -541,7 +629,7 @@ func (c *Client) handleLeave(wsMsg WSMessage) {
 	}
 
 	// 只有咨询师可以结束会话
-	if session.CounselorID != c.ID {
+	if c.Principal.SessionRole(session.UserID, session.CounselorID) != identity.SessionRoleCounselor {
 		c.sendError("只有咨询师可以结束会话")
 		return
 	}
@@ -553,7 +641,7 @@ func (c *Client) handleLeave(wsMsg WSMessage) {
 	}
 
 	// 结束会话并计费
-	c.endSession(sessionID, session)
+	c.endSession(sessionID, session, orderflow.Actor{Type: models.OrderActorCounselor, ID: c.Principal.CounselorID}, "")
 
 	// 更新会话管理器
 	sessionManager.EndSession(sessionID)
@@ -580,18 +668,26 @@ func (c *Client) handleLeave(wsMsg WSMessage) {
 	}
 }
 
-// 结束会话并计费
-func (c *Client) endSession(sessionID uint, session models.ChatSession) {
+// sessionPrice 会话计费单价：取下单时锁定的单价，咨询师调价不影响已下单的咨询；订单未记录单价时按咨询师当前单价
+func sessionPrice(session *models.ChatSession) float64 {
+	var order models.Order
+	if err := database.DB.Select("unit_price").First(&order, session.OrderID).Error; err == nil && order.UnitPrice > 0 {
+		return order.UnitPrice
+	}
+	var counselor models.Counselor
+	database.DB.Select("price").First(&counselor, session.CounselorID)
+	return counselor.Price
+}
+
+// 结束会话并计费，actor 和 reason 记入订单事件
+func (c *Client) endSession(sessionID uint, session models.ChatSession, actor orderflow.Actor, reason string) {
 	now := time.Now()
 	
 	// 计算时长
 	duration := int(now.Sub(*session.StartTime).Seconds())
 	
-	// 查询咨询师获取单价
-	var counselor models.Counselor
-	database.DB.First(&counselor, session.CounselorID)
-	
-	pricePerMinute := counselor.Price
+	// 按下单时锁定的单价计费
+	pricePerMinute := sessionPrice(&session)
 	
 	// 计算总金额（按分钟向上取整）
 	durationMinutes := max((duration+59)/60, 1)
@@ -601,14 +697,19 @@ func (c *Client) endSession(sessionID uint, session models.ChatSession) {
 	platformFee := totalAmount * 0.30
 	counselorFee := totalAmount * 0.70
 	
-	// 更新会话
-	database.DB.Model(&session).Updates(map[string]any{
-		"status":       2,
+	// 更新会话；双方同时结束时只有一方继续计费
+	ended, err := counselorstats.EndSession(database.DB, &session, map[string]any{
 		"end_time":     now,
 		"duration":     duration,
 		"price":        pricePerMinute,
 		"total_amount": totalAmount,
 	})
+	if err != nil || !ended {
+		if err != nil {
+			log.Printf("结束会话失败: sessionID=%d, err=%v", sessionID, err)
+		}
+		return
+	}
 	
 	// 创建计费记录
 	billing := models.ChatBilling{
@@ -624,10 +725,29 @@ func (c *Client) endSession(sessionID uint, session models.ChatSession) {
 		Status:         0, // 待结算
 	}
 	database.DB.Create(&billing)
+
+	// 记录会话结束；会话结束即咨询完成，由订单状态机推进订单并发送完成通知
+	var order models.Order
+	if err := database.DB.First(&order, session.OrderID).Error; err == nil {
+		orderflow.Record(database.DB, &order, orderflow.Request{
+			Event:    models.OrderEventSessionEnd,
+			Actor:    actor,
+			Reason:   reason,
+			Metadata: map[string]any{"session_id": sessionID, "duration": duration, "total_amount": totalAmount},
+		})
+	}
+	if _, err := orderflow.Fire(orderflow.Request{
+		OrderID:  session.OrderID,
+		Event:    models.OrderEventComplete,
+		Actor:    orderflow.System,
+		Metadata: map[string]any{"session_id": sessionID},
+	}); err != nil {
+		log.Printf("会话结束后完成订单失败: sessionID=%d, orderID=%d, err=%v", sessionID, session.OrderID, err)
+	}
 	
 	// 更新咨询师账户
 	var account models.CounselorAccount
-	err := database.DB.Where("counselor_id = ?", session.CounselorID).First(&account).Error
+	err = database.DB.Where("counselor_id = ?", session.CounselorID).First(&account).Error
 	if err != nil {
 		account = models.CounselorAccount{
 			CounselorID: session.CounselorID,
@@ -678,6 +798,7 @@ func (c *Client) endSession(sessionID uint, session models.ChatSession) {
 // 处理ping
 func (c *Client) handlePing() {
 	c.sendMessage("pong", gin.H{"timestamp": time.Now().Unix()})
+	markOnline(c.ID)
 
 	// 更新会话最后ping时间
 	if c.SessionID != nil {
@@ -722,6 +843,22 @@ func BroadcastToAll(message []byte) {
 	globalHub.broadcast <- message
 }
 
+// markOnline 刷新用户在 Redis 中的在线状态（5分钟过期），供 API 服务按在线状态筛选咨询师
+func markOnline(userID uint) {
+	if cache.Rdb != nil {
+		cache.SetOnlineStatus(context.Background(), userID)
+	}
+}
+
+// notifyFavoritesOnline 异步通知收藏了该咨询师且开启了上线通知的用户（有冷却时间，频繁重连不会重复通知）
+func notifyFavoritesOnline(counselorID uint) {
+	go func() {
+		if err := favorite.NotifyOnline(counselorID); err != nil {
+			log.Printf("收藏咨询师上线通知失败: counselorID=%d, err=%v", counselorID, err)
+		}
+	}()
+}
+
 // GetOnlineUsers 获取在线用户列表
 func GetOnlineUsers() []uint {
 	globalHub.mu.RLock()
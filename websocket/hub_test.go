@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"akrick.com/mychat/identity"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/testutil"
+
+	"gorm.io/gorm"
+)
+
+// setupHub 初始化 Hub 和会话管理器，写入身份数据
+func setupHub(t *testing.T) (*gorm.DB, *testutil.Identities) {
+	t.Helper()
+
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	InitHub()
+	if sessionManager == nil {
+		InitSessionManager()
+	}
+	return db, ids
+}
+
+// newTestClient 以 userID 的身份创建客户端（不建立真实连接）
+func newTestClient(t *testing.T, userID uint) *Client {
+	t.Helper()
+
+	principal, err := identity.Resolve(context.Background(), userID, "")
+	if err != nil {
+		t.Fatalf("Resolve(%d) error: %v", userID, err)
+	}
+	return &Client{ID: userID, Principal: principal, Send: make(chan []byte, 16)}
+}
+
+// joinSession 把客户端按用户ID挂到会话下，与 handleJoin 的索引方式一致
+func joinSession(sessionID uint, clients ...*Client) {
+	globalHub.mu.Lock()
+	defer globalHub.mu.Unlock()
+
+	if globalHub.sessions[sessionID] == nil {
+		globalHub.sessions[sessionID] = make(map[uint]*Client)
+	}
+	for _, c := range clients {
+		globalHub.sessions[sessionID][c.ID] = c
+	}
+}
+
+// received 取出客户端已收到的消息
+func received(t *testing.T, c *Client) []WSMessage {
+	t.Helper()
+
+	var list []WSMessage
+	for {
+		select {
+		case data := <-c.Send:
+			var msg WSMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("invalid message %q", data)
+			}
+			list = append(list, msg)
+		default:
+			return list
+		}
+	}
+}
+
+func receivedTypes(t *testing.T, c *Client) []string {
+	t.Helper()
+
+	var types []string
+	for _, msg := range received(t, c) {
+		types = append(types, msg.Type)
+	}
+	return types
+}
+
+func TestHandleMessageUsesSessionRole(t *testing.T) {
+	db, ids := setupHub(t)
+	client := newTestClient(t, ids.Client.ID)
+	counselor := newTestClient(t, ids.CounselorUser.ID)
+	other := newTestClient(t, ids.Other.ID)
+	joinSession(ids.Session.ID, client, counselor)
+
+	// Other 的用户ID等于会话的 counselor_id，不能在该会话中发送
+	other.handleMessage(WSMessage{Type: "message", SessionID: ids.Session.ID, Data: map[string]any{"content": "hi"}})
+	if got := received(t, other); len(got) != 1 || got[0].Type != "error" || got[0].Data["error"] != "无权发送消息" {
+		t.Fatalf("other user got %+v, want 无权发送消息", got)
+	}
+	// 咨询师的咨询师ID等于 OtherSession 的 user_id，不能在该会话中发送
+	counselor.handleMessage(WSMessage{Type: "message", SessionID: ids.OtherSession.ID, Data: map[string]any{"content": "hi"}})
+	if got := received(t, counselor); len(got) != 1 || got[0].Data["error"] != "无权发送消息" {
+		t.Fatalf("counselor in foreign session got %+v, want 无权发送消息", got)
+	}
+	if got := receivedTypes(t, client); len(got) != 0 {
+		t.Fatalf("client received %v from rejected senders", got)
+	}
+
+	counselor.handleMessage(WSMessage{Type: "message", SessionID: ids.Session.ID, Data: map[string]any{"content": "您好"}})
+	got := received(t, client)
+	if len(got) != 1 || got[0].Type != "message" {
+		t.Fatalf("client got %+v, want one message", got)
+	}
+	if got[0].Data["sender_type"] != identity.SessionRoleCounselor || got[0].Data["sender_id"] != float64(ids.CounselorUser.ID) {
+		t.Fatalf("message sender = (%v, %v), want (counselor, %d)", got[0].Data["sender_type"], got[0].Data["sender_id"], ids.CounselorUser.ID)
+	}
+
+	var saved []models.ChatMessage
+	db.Where("session_id = ?", ids.Session.ID).Find(&saved)
+	if len(saved) != 1 || saved[0].SenderType != identity.SessionRoleCounselor || saved[0].SenderID != ids.CounselorUser.ID {
+		t.Fatalf("saved messages = %+v, want one counselor message", saved)
+	}
+}
+
+func TestHandleTypingNotifiesOpponentByUserID(t *testing.T) {
+	_, ids := setupHub(t)
+	client := newTestClient(t, ids.Client.ID)
+	counselor := newTestClient(t, ids.CounselorUser.ID)
+	// Other 的用户ID等于会话的 counselor_id：若按 counselor_id 索引连接，输入状态会发给 Other
+	other := newTestClient(t, ids.Other.ID)
+	joinSession(ids.Session.ID, client, counselor, other)
+
+	messageHandler.handleTyping(client, WSMessage{Type: "typing", SessionID: ids.Session.ID})
+	if got := receivedTypes(t, counselor); len(got) != 1 || got[0] != "typing" {
+		t.Fatalf("counselor got %v, want [typing]", got)
+	}
+	if got := receivedTypes(t, other); len(got) != 0 {
+		t.Fatalf("user whose ID equals counselor_id got %v", got)
+	}
+
+	messageHandler.handleTyping(counselor, WSMessage{Type: "typing", SessionID: ids.Session.ID})
+	if got := receivedTypes(t, client); len(got) != 1 || got[0] != "typing" {
+		t.Fatalf("client got %v, want [typing]", got)
+	}
+
+	// 非参与者的输入状态直接忽略
+	messageHandler.handleTyping(other, WSMessage{Type: "typing", SessionID: ids.Session.ID})
+	if got := append(receivedTypes(t, client), receivedTypes(t, counselor)...); len(got) != 0 {
+		t.Fatalf("participants got %v from non-participant", got)
+	}
+}
+
+func TestHandleLeaveEndsSessionForCounselorOnly(t *testing.T) {
+	db, ids := setupHub(t)
+	client := newTestClient(t, ids.Client.ID)
+	counselor := newTestClient(t, ids.CounselorUser.ID)
+	other := newTestClient(t, ids.Other.ID)
+	joinSession(ids.Session.ID, client, counselor)
+
+	for _, c := range []*Client{other, client} {
+		c.handleLeave(WSMessage{Type: "leave", SessionID: ids.Session.ID})
+		if got := received(t, c); len(got) != 1 || got[0].Data["error"] != "只有咨询师可以结束会话" {
+			t.Fatalf("user %d got %+v, want 只有咨询师可以结束会话", c.ID, got)
+		}
+	}
+	// 咨询师不能结束 user_id 等于其咨询师ID的会话
+	counselor.handleLeave(WSMessage{Type: "leave", SessionID: ids.OtherSession.ID})
+	if got := received(t, counselor); len(got) != 1 || got[0].Data["error"] != "只有咨询师可以结束会话" {
+		t.Fatalf("counselor in foreign session got %+v, want 只有咨询师可以结束会话", got)
+	}
+
+	counselor.handleLeave(WSMessage{Type: "leave", SessionID: ids.Session.ID})
+
+	// 计费信息只发给来访者（按 user_id 索引），会话结束通知发给双方
+	if got := receivedTypes(t, client); len(got) != 2 || got[0] != "billing" || got[1] != "session_end" {
+		t.Fatalf("client got %v, want [billing session_end]", got)
+	}
+	if got := receivedTypes(t, counselor); len(got) != 1 || got[0] != "session_end" {
+		t.Fatalf("counselor got %v, want [session_end]", got)
+	}
+
+	var billing models.ChatBilling
+	if err := db.Where("session_id = ?", ids.Session.ID).First(&billing).Error; err != nil {
+		t.Fatalf("billing not created: %v", err)
+	}
+	if billing.UserID != ids.Client.ID || billing.CounselorID != ids.Counselor.ID {
+		t.Fatalf("billing = {UserID:%d CounselorID:%d}, want {UserID:%d CounselorID:%d}", billing.UserID, billing.CounselorID, ids.Client.ID, ids.Counselor.ID)
+	}
+	var accounts []models.CounselorAccount
+	db.Find(&accounts)
+	if len(accounts) != 1 || accounts[0].CounselorID != ids.Counselor.ID {
+		t.Fatalf("counselor accounts = %+v, want one account for counselor %d", accounts, ids.Counselor.ID)
+	}
+	var order models.Order
+	db.First(&order, ids.Session.OrderID)
+	if order.Status != models.OrderStatusCompleted {
+		t.Fatalf("order status = %d, want completed", order.Status)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"websocket/database"
 	"websocket/models"
 
+	"akrick.com/mychat/attachment"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,10 +28,18 @@ func main() {
 		log.Println("Redis连接成功")
 	}
 
+	// 加载附件下载链接签名密钥（与 API 服务相同）
+	if err := attachment.Init(); err != nil {
+		log.Fatalf("附件服务初始化失败: %v", err)
+	}
+
 	// 初始化WebSocket Hub
 	InitHub()
 	log.Println("WebSocket Hub初始化成功")
 
+	// 启动站内通知推送
+	StartNotificationRelay()
+
 	// 初始化会话管理器
 	InitSessionManager()
 	log.Println("会话管理器初始化成功")
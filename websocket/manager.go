@@ -10,6 +10,7 @@ import (
 	"akrick.com/mychat/cache"
 	"akrick.com/mychat/database"
 	"akrick.com/mychat/models"
+	"akrick.com/mychat/orderflow"
 )
 
 // SessionManager 会话管理器
@@ -145,9 +146,13 @@ func (sm *SessionManager) handleSessionTimeout(sessionID uint) {
 	var sessionModel models.ChatSession
 	if err := database.DB.First(&sessionModel, sessionID).Error; err == nil {
 		if sessionModel.Status == 1 {
-			// 使用client的endSession方法
-			if client, ok := globalHub.clients[counselorID]; ok {
-				client.endSession(sessionID, sessionModel)
+			// 使用client的endSession方法（Hub 以用户ID索引，需先换算咨询师的用户ID）
+			counselorUserID, _ := cache.GetUserIDByCounselor(context.Background(), counselorID)
+			globalHub.mu.RLock()
+			client, ok := globalHub.clients[counselorUserID]
+			globalHub.mu.RUnlock()
+			if ok {
+				client.endSession(sessionID, sessionModel, orderflow.System, "长时间无操作，会话超时自动结束")
 			}
 		}
 	}
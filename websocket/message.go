@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"time"
 
+	"akrick.com/mychat/chatmsg"
 	"akrick.com/mychat/database"
+	"akrick.com/mychat/identity"
 	"akrick.com/mychat/models"
 
 	"github.com/gin-gonic/gin"
@@ -33,6 +36,12 @@ func HandleMessage(c *Client, wsMsg WSMessage) {
 		messageHandler.handleRead(c, wsMsg)
 	case "typing_stop":
 		messageHandler.handleTypingStop(c, wsMsg)
+	case "edit":
+		messageHandler.handleEdit(c, wsMsg)
+	case "recall":
+		messageHandler.handleRecall(c, wsMsg)
+	case "delete":
+		messageHandler.handleDelete(c, wsMsg)
 	default:
 		log.Printf("未知消息类型: %s", wsMsg.Type)
 		c.sendError("未知消息类型")
@@ -49,16 +58,12 @@ func (mh *MessageHandler) handleTyping(c *Client, wsMsg WSMessage) {
 		return
 	}
 
-	if session.UserID != c.ID && session.CounselorID != c.ID {
+	// 确定对方ID（非会话参与者直接忽略）
+	opponentID, ok := c.opponentUserID(session)
+	if !ok {
 		return
 	}
 
-	// 确定对方ID
-	opponentID := session.UserID
-	if session.UserID == c.ID {
-		opponentID = session.CounselorID
-	}
-
 	// 发送正在输入通知
 	globalHub.mu.RLock()
 	defer globalHub.mu.RUnlock()
@@ -91,16 +96,12 @@ func (mh *MessageHandler) handleTypingStop(c *Client, wsMsg WSMessage) {
 		return
 	}
 
-	if session.UserID != c.ID && session.CounselorID != c.ID {
+	// 确定对方ID（非会话参与者直接忽略）
+	opponentID, ok := c.opponentUserID(session)
+	if !ok {
 		return
 	}
 
-	// 确定对方ID
-	opponentID := session.UserID
-	if session.UserID == c.ID {
-		opponentID = session.CounselorID
-	}
-
 	// 发送停止输入通知
 	globalHub.mu.RLock()
 	defer globalHub.mu.RUnlock()
@@ -140,12 +141,9 @@ func (mh *MessageHandler) handleRead(c *Client, wsMsg WSMessage) {
 		return
 	}
 
-	receiverID := session.UserID
-	if session.UserID == c.ID {
-		receiverID = session.CounselorID
-	}
-
-	if receiverID != c.ID {
+	// 接收者即非发送者的一方
+	role := c.Principal.SessionRole(session.UserID, session.CounselorID)
+	if role == "" || message.SenderID == c.ID {
 		return
 	}
 
@@ -179,6 +177,97 @@ func (mh *MessageHandler) handleRead(c *Client, wsMsg WSMessage) {
 	}
 }
 
+// handleEdit 处理编辑消息，编辑结果推送给会话内所有客户端
+func (mh *MessageHandler) handleEdit(c *Client, wsMsg WSMessage) {
+	messageID, _ := wsMsg.Data["message_id"].(float64)
+	content, _ := wsMsg.Data["content"].(string)
+
+	message, err := chatmsg.Edit(c.Principal, uint(messageID), content)
+	if err != nil {
+		c.sendError(err.Error())
+		return
+	}
+
+	msg, _ := json.Marshal(WSMessage{
+		Type:      "message_edited",
+		SessionID: message.SessionID,
+		Data: gin.H{
+			"message_id": message.ID,
+			"content":    message.Content,
+			"revision":   message.Revision,
+			"edited_at":  message.EditedAt,
+		},
+	})
+	BroadcastToSession(message.SessionID, msg)
+}
+
+// handleRecall 处理撤回消息，通知会话内所有客户端
+func (mh *MessageHandler) handleRecall(c *Client, wsMsg WSMessage) {
+	messageID, _ := wsMsg.Data["message_id"].(float64)
+
+	message, err := chatmsg.Recall(c.Principal, uint(messageID))
+	if err != nil {
+		c.sendError(err.Error())
+		return
+	}
+
+	msg, _ := json.Marshal(WSMessage{
+		Type:      "message_recalled",
+		SessionID: message.SessionID,
+		Data: gin.H{
+			"message_id":   message.ID,
+			"content":      message.Content,
+			"content_type": message.ContentType,
+			"revision":     message.Revision,
+			"recalled_at":  message.RecalledAt,
+			"recalled_by":  c.ID,
+		},
+	})
+	BroadcastToSession(message.SessionID, msg)
+}
+
+// handleDelete 处理仅自己删除消息，只回复操作者本人
+func (mh *MessageHandler) handleDelete(c *Client, wsMsg WSMessage) {
+	messageID, _ := wsMsg.Data["message_id"].(float64)
+
+	message, err := chatmsg.Hide(c.Principal, uint(messageID))
+	if err != nil {
+		c.sendError(err.Error())
+		return
+	}
+
+	msg, _ := json.Marshal(WSMessage{
+		Type:      "message_deleted",
+		SessionID: message.SessionID,
+		Data: gin.H{
+			"message_id": message.ID,
+		},
+	})
+	select {
+	case c.Send <- msg:
+	default:
+	}
+}
+
+// opponentUserID 返回会话中对方的用户ID（Hub 以用户ID索引连接，咨询师需换算）
+func (c *Client) opponentUserID(session models.ChatSession) (uint, bool) {
+	role := c.Principal.SessionRole(session.UserID, session.CounselorID)
+	if role == "" {
+		return 0, false
+	}
+
+	opponentRole := identity.SessionRoleCounselor
+	if role == identity.SessionRoleCounselor {
+		opponentRole = identity.SessionRoleUser
+	}
+
+	opponentID, err := identity.UserIDForSessionRole(context.Background(), opponentRole, session.UserID, session.CounselorID)
+	if err != nil || opponentID == 0 {
+		return 0, false
+	}
+	return opponentID, true
+}
+
 // BroadcastUserMessage 向指定用户广播消息
 func BroadcastUserMessage(userID uint, msgType string, data map[string]any) {
 	globalHub.mu.RLock()
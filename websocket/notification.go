@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"akrick.com/mychat/cache"
+	"akrick.com/mychat/database"
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notificationPollInterval Redis 不可用或通知丢失时的兜底拉取间隔
+const notificationPollInterval = 10 * time.Second
+
+// notificationRelayWindow 每次拉取回看的时间窗口
+// 通知在业务事务中写入，ID 和创建时间都早于提交时间，按ID水位增量拉取会漏掉晚提交的通知；
+// 因此每次都重新扫描窗口内的通知，已推送的按ID去重
+const notificationRelayWindow = 2 * time.Minute
+
+// StartNotificationRelay 启动站内通知推送
+// 新通知写入后经 Redis 唤醒，拉取回看窗口内尚未推送的通知，推送给连接在本实例的在线用户
+func StartNotificationRelay() {
+	relay := newNotificationRelay()
+	// 启动前已写入的通知不再推送
+	if _, err := relay.poll(time.Now()); err != nil {
+		log.Printf("拉取新通知失败: %v", err)
+	}
+
+	wake := make(chan struct{}, 1)
+	if cache.Rdb != nil {
+		go func() {
+			sub := cache.Rdb.Subscribe(context.Background(), notify.Channel)
+			for range sub.Channel() {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(notificationPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-wake:
+			case <-ticker.C:
+			}
+
+			notifications, err := relay.poll(time.Now())
+			if err != nil {
+				log.Printf("拉取新通知失败: %v", err)
+				continue
+			}
+			for _, n := range notifications {
+				pushNotification(n)
+			}
+		}
+	}()
+}
+
+// notificationRelay 记录回看窗口内已推送的通知
+type notificationRelay struct {
+	delivered map[uint]time.Time // 通知ID -> 创建时间，移出窗口后清理
+}
+
+func newNotificationRelay() *notificationRelay {
+	return &notificationRelay{delivered: make(map[uint]time.Time)}
+}
+
+// poll 返回回看窗口内尚未推送过的通知，并记为已推送
+func (r *notificationRelay) poll(now time.Time) ([]models.Notification, error) {
+	since := now.Add(-notificationRelayWindow)
+	var notifications []models.Notification
+	if err := database.DB.Where("created_at >= ?", since).Order("id ASC").Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	for id, createdAt := range r.delivered {
+		if createdAt.Before(since) {
+			delete(r.delivered, id)
+		}
+	}
+	fresh := notifications[:0]
+	for _, n := range notifications {
+		if _, ok := r.delivered[n.ID]; ok {
+			continue
+		}
+		r.delivered[n.ID] = n.CreatedAt
+		fresh = append(fresh, n)
+	}
+	return fresh, nil
+}
+
+func pushNotification(n models.Notification) {
+	globalHub.mu.RLock()
+	client, ok := globalHub.clients[n.UserID]
+	globalHub.mu.RUnlock()
+	if !ok {
+		return
+	}
+	client.sendMessage("notification", gin.H{
+		"id":         n.ID,
+		"type":       n.Type,
+		"level":      n.Level,
+		"title":      n.Title,
+		"content":    n.Content,
+		"created_at": n.CreatedAt,
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"akrick.com/mychat/models"
+	"akrick.com/mychat/testutil"
+)
+
+func TestNotificationRelayPicksUpLateCommits(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ids := testutil.SeedIdentities(t, db)
+	now := time.Now()
+
+	relay := newNotificationRelay()
+	db.Create(&models.Notification{ID: 10, UserID: ids.Client.ID, Type: "system", Title: "a", CreatedAt: now})
+	if got, _ := relay.poll(now); len(got) != 1 || got[0].ID != 10 {
+		t.Fatalf("first poll = %+v, want notification 10", got)
+	}
+	if got, _ := relay.poll(now); len(got) != 0 {
+		t.Fatalf("second poll redelivered %+v", got)
+	}
+
+	// 较早分配ID、较晚提交的通知不能因为ID低于已推送的通知而漏掉
+	db.Create(&models.Notification{ID: 5, UserID: ids.Client.ID, Type: "system", Title: "late", CreatedAt: now.Add(-30 * time.Second)})
+	if got, _ := relay.poll(now); len(got) != 1 || got[0].ID != 5 {
+		t.Fatalf("poll after late commit = %+v, want notification 5", got)
+	}
+
+	// 移出回看窗口的记录被清理
+	later := now.Add(notificationRelayWindow + time.Minute)
+	if got, _ := relay.poll(later); len(got) != 0 {
+		t.Fatalf("poll outside window = %+v", got)
+	}
+	if len(relay.delivered) != 0 {
+		t.Fatalf("delivered not pruned: %v", relay.delivered)
+	}
+}